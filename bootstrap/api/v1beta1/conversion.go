@@ -44,7 +44,29 @@ func (c *KThreesConfig) ConvertTo(dstRaw ctrlconversion.Hub) error {
 	dst.Spec.ServerConfig.DisableCloudController = restored.Spec.ServerConfig.DisableCloudController
 	dst.Spec.ServerConfig.SystemDefaultRegistry = restored.Spec.ServerConfig.SystemDefaultRegistry
 	dst.Spec.ServerConfig.EtcdProxyImage = restored.Spec.ServerConfig.EtcdProxyImage
+	dst.Spec.ServerConfig.EgressSelectorMode = restored.Spec.ServerConfig.EgressSelectorMode
+	dst.Spec.ServerConfig.TLSCipherSuites = restored.Spec.ServerConfig.TLSCipherSuites
+	dst.Spec.ServerConfig.TLSMinVersion = restored.Spec.ServerConfig.TLSMinVersion
+	dst.Spec.ServerConfig.KMSEncryption = restored.Spec.ServerConfig.KMSEncryption
+	dst.Spec.ServerConfig.AuditWebhook = restored.Spec.ServerConfig.AuditWebhook
+	dst.Spec.ServerConfig.ExtraHostPaths = restored.Spec.ServerConfig.ExtraHostPaths
+	dst.Spec.ServerConfig.EtcdSnapshots = restored.Spec.ServerConfig.EtcdSnapshots
+	dst.Spec.ServerConfig.ControllerManager = restored.Spec.ServerConfig.ControllerManager
+	dst.Spec.ServerConfig.Scheduler = restored.Spec.ServerConfig.Scheduler
+	dst.Spec.ServerConfig.StaticPods = restored.Spec.ServerConfig.StaticPods
 	dst.Spec.AgentConfig.AirGappedInstallScriptPath = restored.Spec.AgentConfig.AirGappedInstallScriptPath
+	dst.Spec.AgentConfig.PreferBundledBin = restored.Spec.AgentConfig.PreferBundledBin
+	dst.Spec.AgentConfig.ServerTLSBootstrap = restored.Spec.AgentConfig.ServerTLSBootstrap
+	dst.Spec.AgentConfig.VPNAuth = restored.Spec.AgentConfig.VPNAuth
+	dst.Spec.AgentConfig.NodeNameStrategy = restored.Spec.AgentConfig.NodeNameStrategy
+	dst.Spec.AgentConfig.Docker = restored.Spec.AgentConfig.Docker
+	dst.Spec.AgentConfig.ResolvConf = restored.Spec.AgentConfig.ResolvConf
+	dst.Spec.AgentConfig.ServerURL = restored.Spec.AgentConfig.ServerURL
+	dst.Spec.ProvisioningTimeout = restored.Spec.ProvisioningTimeout
+	dst.Spec.BootstrapDataTTL = restored.Spec.BootstrapDataTTL
+	dst.Spec.Debug = restored.Spec.Debug
+	dst.Spec.LogLevel = restored.Spec.LogLevel
+	dst.Status.Initialization = restored.Status.Initialization
 	return nil
 }
 
@@ -99,7 +121,28 @@ func (r *KThreesConfigTemplate) ConvertTo(dstRaw ctrlconversion.Hub) error {
 	dst.Spec.Template.Spec.ServerConfig.DisableCloudController = restored.Spec.Template.Spec.ServerConfig.DisableCloudController
 	dst.Spec.Template.Spec.ServerConfig.SystemDefaultRegistry = restored.Spec.Template.Spec.ServerConfig.SystemDefaultRegistry
 	dst.Spec.Template.Spec.ServerConfig.EtcdProxyImage = restored.Spec.Template.Spec.ServerConfig.EtcdProxyImage
+	dst.Spec.Template.Spec.ServerConfig.EgressSelectorMode = restored.Spec.Template.Spec.ServerConfig.EgressSelectorMode
+	dst.Spec.Template.Spec.ServerConfig.TLSCipherSuites = restored.Spec.Template.Spec.ServerConfig.TLSCipherSuites
+	dst.Spec.Template.Spec.ServerConfig.TLSMinVersion = restored.Spec.Template.Spec.ServerConfig.TLSMinVersion
+	dst.Spec.Template.Spec.ServerConfig.KMSEncryption = restored.Spec.Template.Spec.ServerConfig.KMSEncryption
+	dst.Spec.Template.Spec.ServerConfig.AuditWebhook = restored.Spec.Template.Spec.ServerConfig.AuditWebhook
+	dst.Spec.Template.Spec.ServerConfig.ExtraHostPaths = restored.Spec.Template.Spec.ServerConfig.ExtraHostPaths
+	dst.Spec.Template.Spec.ServerConfig.EtcdSnapshots = restored.Spec.Template.Spec.ServerConfig.EtcdSnapshots
+	dst.Spec.Template.Spec.ServerConfig.ControllerManager = restored.Spec.Template.Spec.ServerConfig.ControllerManager
+	dst.Spec.Template.Spec.ServerConfig.Scheduler = restored.Spec.Template.Spec.ServerConfig.Scheduler
+	dst.Spec.Template.Spec.ServerConfig.StaticPods = restored.Spec.Template.Spec.ServerConfig.StaticPods
 	dst.Spec.Template.Spec.AgentConfig.AirGappedInstallScriptPath = restored.Spec.Template.Spec.AgentConfig.AirGappedInstallScriptPath
+	dst.Spec.Template.Spec.AgentConfig.PreferBundledBin = restored.Spec.Template.Spec.AgentConfig.PreferBundledBin
+	dst.Spec.Template.Spec.AgentConfig.ServerTLSBootstrap = restored.Spec.Template.Spec.AgentConfig.ServerTLSBootstrap
+	dst.Spec.Template.Spec.AgentConfig.VPNAuth = restored.Spec.Template.Spec.AgentConfig.VPNAuth
+	dst.Spec.Template.Spec.AgentConfig.NodeNameStrategy = restored.Spec.Template.Spec.AgentConfig.NodeNameStrategy
+	dst.Spec.Template.Spec.AgentConfig.Docker = restored.Spec.Template.Spec.AgentConfig.Docker
+	dst.Spec.Template.Spec.AgentConfig.ResolvConf = restored.Spec.Template.Spec.AgentConfig.ResolvConf
+	dst.Spec.Template.Spec.AgentConfig.ServerURL = restored.Spec.Template.Spec.AgentConfig.ServerURL
+	dst.Spec.Template.Spec.ProvisioningTimeout = restored.Spec.Template.Spec.ProvisioningTimeout
+	dst.Spec.Template.Spec.BootstrapDataTTL = restored.Spec.Template.Spec.BootstrapDataTTL
+	dst.Spec.Template.Spec.Debug = restored.Spec.Template.Spec.Debug
+	dst.Spec.Template.Spec.LogLevel = restored.Spec.Template.Spec.LogLevel
 	return nil
 }
 
@@ -164,6 +207,16 @@ func Convert_v1beta2_KThreesServerConfig_To_v1beta1_KThreesServerConfig(in *boot
 	return nil
 }
 
+// Convert_v1beta2_KThreesConfigSpec_To_v1beta1_KThreesConfigSpec is an autogenerated conversion function.
+func Convert_v1beta2_KThreesConfigSpec_To_v1beta1_KThreesConfigSpec(in *bootstrapv1beta2.KThreesConfigSpec, out *KThreesConfigSpec, s conversion.Scope) error { //nolint: stylecheck
+	return autoConvert_v1beta2_KThreesConfigSpec_To_v1beta1_KThreesConfigSpec(in, out, s)
+}
+
+// Convert_v1beta2_KThreesConfigStatus_To_v1beta1_KThreesConfigStatus is an autogenerated conversion function.
+func Convert_v1beta2_KThreesConfigStatus_To_v1beta1_KThreesConfigStatus(in *bootstrapv1beta2.KThreesConfigStatus, out *KThreesConfigStatus, s conversion.Scope) error { //nolint: stylecheck
+	return autoConvert_v1beta2_KThreesConfigStatus_To_v1beta1_KThreesConfigStatus(in, out, s)
+}
+
 // Convert_v1beta2_KThreesAgentConfig_To_v1beta1_KThreesAgentConfig is an autogenerated conversion function.
 func Convert_v1beta2_KThreesAgentConfig_To_v1beta1_KThreesAgentConfig(in *bootstrapv1beta2.KThreesAgentConfig, out *KThreesAgentConfig, s conversion.Scope) error { //nolint: stylecheck
 	return autoConvert_v1beta2_KThreesAgentConfig_To_v1beta1_KThreesAgentConfig(in, out, s)
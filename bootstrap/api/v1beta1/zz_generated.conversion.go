@@ -86,21 +86,11 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
-	if err := s.AddGeneratedConversionFunc((*v1beta2.KThreesConfigSpec)(nil), (*KThreesConfigSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
-		return Convert_v1beta2_KThreesConfigSpec_To_v1beta1_KThreesConfigSpec(a.(*v1beta2.KThreesConfigSpec), b.(*KThreesConfigSpec), scope)
-	}); err != nil {
-		return err
-	}
 	if err := s.AddGeneratedConversionFunc((*KThreesConfigStatus)(nil), (*v1beta2.KThreesConfigStatus)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1beta1_KThreesConfigStatus_To_v1beta2_KThreesConfigStatus(a.(*KThreesConfigStatus), b.(*v1beta2.KThreesConfigStatus), scope)
 	}); err != nil {
 		return err
 	}
-	if err := s.AddGeneratedConversionFunc((*v1beta2.KThreesConfigStatus)(nil), (*KThreesConfigStatus)(nil), func(a, b interface{}, scope conversion.Scope) error {
-		return Convert_v1beta2_KThreesConfigStatus_To_v1beta1_KThreesConfigStatus(a.(*v1beta2.KThreesConfigStatus), b.(*KThreesConfigStatus), scope)
-	}); err != nil {
-		return err
-	}
 	if err := s.AddGeneratedConversionFunc((*KThreesConfigTemplate)(nil), (*v1beta2.KThreesConfigTemplate)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1beta1_KThreesConfigTemplate_To_v1beta2_KThreesConfigTemplate(a.(*KThreesConfigTemplate), b.(*v1beta2.KThreesConfigTemplate), scope)
 	}); err != nil {
@@ -161,6 +151,16 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddConversionFunc((*v1beta2.KThreesConfigSpec)(nil), (*KThreesConfigSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1beta2_KThreesConfigSpec_To_v1beta1_KThreesConfigSpec(a.(*v1beta2.KThreesConfigSpec), b.(*KThreesConfigSpec), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddConversionFunc((*v1beta2.KThreesConfigStatus)(nil), (*KThreesConfigStatus)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1beta2_KThreesConfigStatus_To_v1beta1_KThreesConfigStatus(a.(*v1beta2.KThreesConfigStatus), b.(*KThreesConfigStatus), scope)
+	}); err != nil {
+		return err
+	}
 	if err := s.AddConversionFunc((*v1beta2.KThreesServerConfig)(nil), (*KThreesServerConfig)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1beta2_KThreesServerConfig_To_v1beta1_KThreesServerConfig(a.(*v1beta2.KThreesServerConfig), b.(*KThreesServerConfig), scope)
 	}); err != nil {
@@ -246,8 +246,15 @@ func autoConvert_v1beta2_KThreesAgentConfig_To_v1beta1_KThreesAgentConfig(in *v1
 	out.KubeletArgs = *(*[]string)(unsafe.Pointer(&in.KubeletArgs))
 	out.KubeProxyArgs = *(*[]string)(unsafe.Pointer(&in.KubeProxyArgs))
 	out.NodeName = in.NodeName
+	// WARNING: in.NodeNameStrategy requires manual conversion: does not exist in peer-type
+	// WARNING: in.PreferBundledBin requires manual conversion: does not exist in peer-type
+	// WARNING: in.ServerTLSBootstrap requires manual conversion: does not exist in peer-type
 	out.AirGapped = in.AirGapped
 	// WARNING: in.AirGappedInstallScriptPath requires manual conversion: does not exist in peer-type
+	// WARNING: in.VPNAuth requires manual conversion: does not exist in peer-type
+	// WARNING: in.Docker requires manual conversion: does not exist in peer-type
+	// WARNING: in.ResolvConf requires manual conversion: does not exist in peer-type
+	// WARNING: in.ServerURL requires manual conversion: does not exist in peer-type
 	return nil
 }
 
@@ -354,15 +361,14 @@ func autoConvert_v1beta2_KThreesConfigSpec_To_v1beta1_KThreesConfigSpec(in *v1be
 	if err := Convert_v1beta2_KThreesServerConfig_To_v1beta1_KThreesServerConfig(&in.ServerConfig, &out.ServerConfig, s); err != nil {
 		return err
 	}
+	// WARNING: in.ProvisioningTimeout requires manual conversion: does not exist in peer-type
+	// WARNING: in.BootstrapDataTTL requires manual conversion: does not exist in peer-type
+	// WARNING: in.Debug requires manual conversion: does not exist in peer-type
+	// WARNING: in.LogLevel requires manual conversion: does not exist in peer-type
 	out.Version = in.Version
 	return nil
 }
 
-// Convert_v1beta2_KThreesConfigSpec_To_v1beta1_KThreesConfigSpec is an autogenerated conversion function.
-func Convert_v1beta2_KThreesConfigSpec_To_v1beta1_KThreesConfigSpec(in *v1beta2.KThreesConfigSpec, out *KThreesConfigSpec, s conversion.Scope) error {
-	return autoConvert_v1beta2_KThreesConfigSpec_To_v1beta1_KThreesConfigSpec(in, out, s)
-}
-
 func autoConvert_v1beta1_KThreesConfigStatus_To_v1beta2_KThreesConfigStatus(in *KThreesConfigStatus, out *v1beta2.KThreesConfigStatus, s conversion.Scope) error {
 	out.Ready = in.Ready
 	out.BootstrapData = *(*[]byte)(unsafe.Pointer(&in.BootstrapData))
@@ -383,6 +389,7 @@ func autoConvert_v1beta2_KThreesConfigStatus_To_v1beta1_KThreesConfigStatus(in *
 	out.Ready = in.Ready
 	out.BootstrapData = *(*[]byte)(unsafe.Pointer(&in.BootstrapData))
 	out.DataSecretName = (*string)(unsafe.Pointer(in.DataSecretName))
+	// WARNING: in.Initialization requires manual conversion: does not exist in peer-type
 	out.FailureReason = in.FailureReason
 	out.FailureMessage = in.FailureMessage
 	out.ObservedGeneration = in.ObservedGeneration
@@ -390,11 +397,6 @@ func autoConvert_v1beta2_KThreesConfigStatus_To_v1beta1_KThreesConfigStatus(in *
 	return nil
 }
 
-// Convert_v1beta2_KThreesConfigStatus_To_v1beta1_KThreesConfigStatus is an autogenerated conversion function.
-func Convert_v1beta2_KThreesConfigStatus_To_v1beta1_KThreesConfigStatus(in *v1beta2.KThreesConfigStatus, out *KThreesConfigStatus, s conversion.Scope) error {
-	return autoConvert_v1beta2_KThreesConfigStatus_To_v1beta1_KThreesConfigStatus(in, out, s)
-}
-
 func autoConvert_v1beta1_KThreesConfigTemplate_To_v1beta2_KThreesConfigTemplate(in *KThreesConfigTemplate, out *v1beta2.KThreesConfigTemplate, s conversion.Scope) error {
 	out.ObjectMeta = in.ObjectMeta
 	if err := Convert_v1beta1_KThreesConfigTemplateSpec_To_v1beta2_KThreesConfigTemplateSpec(&in.Spec, &out.Spec, s); err != nil {
@@ -548,6 +550,16 @@ func autoConvert_v1beta2_KThreesServerConfig_To_v1beta1_KThreesServerConfig(in *
 	// WARNING: in.CloudProviderName requires manual conversion: does not exist in peer-type
 	// WARNING: in.SystemDefaultRegistry requires manual conversion: does not exist in peer-type
 	// WARNING: in.EtcdProxyImage requires manual conversion: does not exist in peer-type
+	// WARNING: in.EgressSelectorMode requires manual conversion: does not exist in peer-type
+	// WARNING: in.TLSCipherSuites requires manual conversion: does not exist in peer-type
+	// WARNING: in.TLSMinVersion requires manual conversion: does not exist in peer-type
+	// WARNING: in.KMSEncryption requires manual conversion: does not exist in peer-type
+	// WARNING: in.AuditWebhook requires manual conversion: does not exist in peer-type
+	// WARNING: in.ExtraHostPaths requires manual conversion: does not exist in peer-type
+	// WARNING: in.EtcdSnapshots requires manual conversion: does not exist in peer-type
+	// WARNING: in.ControllerManager requires manual conversion: does not exist in peer-type
+	// WARNING: in.Scheduler requires manual conversion: does not exist in peer-type
+	// WARNING: in.StaticPods requires manual conversion: does not exist in peer-type
 	return nil
 }
 
@@ -51,6 +51,33 @@ const (
 	DataSecretGenerationFailedReason = "DataSecretGenerationFailed"
 )
 
+const (
+	// TokenAvailableCondition documents that the cluster token used by nodes to join the cluster is available.
+	TokenAvailableCondition clusterv1.ConditionType = "TokenAvailable"
+
+	// TokenLookupFailedReason (Severity=Warning) documents a KThreesConfig controller detecting
+	// an error while looking up the cluster token; the token is created by the control plane provider,
+	// so it is usually missing until the control plane is reconciled.
+	TokenLookupFailedReason = "TokenLookupFailed"
+)
+
+const (
+	// JoinConfigurationValidCondition documents that the configuration of a node joining the cluster, including
+	// the files and secrets it references, could be resolved.
+	JoinConfigurationValidCondition clusterv1.ConditionType = "JoinConfigurationValid"
+
+	// JoinConfigurationInvalidReason (Severity=Warning) documents a KThreesConfig controller detecting
+	// an error while resolving the join configuration, e.g. a referenced secret that does not exist;
+	// user intervention is usually required to get them fixed.
+	JoinConfigurationInvalidReason = "JoinConfigurationInvalid"
+)
+
+const (
+	// ProvisioningTimeoutReason is the failure reason set on a KThreesConfig whose machine did not get a node
+	// within the configured provisioning timeout.
+	ProvisioningTimeoutReason = "ProvisioningTimeout"
+)
+
 const (
 	// CertificatesAvailableCondition documents that cluster certificates are available.
 	//
@@ -21,6 +21,18 @@ import (
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 )
 
+// SpareControlPlaneLabel marks a control plane KThreesConfig, and the Machine and node it bootstraps, as a spare:
+// the machine joins the cluster as a tainted agent with its server configuration staged, until it is promoted
+// to a server by the KThreesControlPlane controller.
+const SpareControlPlaneLabel = "controlplane.cluster.x-k8s.io/spare"
+
+// DataSecretGeneratedAnnotation records on a bootstrap data secret when its data was last generated, in RFC3339 format.
+const DataSecretGeneratedAnnotation = "bootstrap.cluster.x-k8s.io/data-generated-at"
+
+// NodeConfigFilesSecretKey is the key of a bootstrap data secret storing the JSON encoded k3s configuration files
+// written on the node, config.yaml and the private registry configuration, to detect their drift on the node.
+const NodeConfigFilesSecretKey = "node-config-files"
+
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
 // KThreesConfigSpec defines the desired state of KThreesConfig.
@@ -45,6 +57,31 @@ type KThreesConfigSpec struct {
 	// +optional
 	ServerConfig KThreesServerConfig `json:"serverConfig,omitempty"`
 
+	// ProvisioningTimeout is the maximum time to wait for the node of the machine to join the cluster once
+	// its bootstrap data is available. When exceeded, the config is marked as failed so that the machine
+	// fails and can be remediated; control plane machines are recreated by the KThreesControlPlane.
+	// Defaults to waiting indefinitely.
+	// +optional
+	ProvisioningTimeout *metav1.Duration `json:"provisioningTimeout,omitempty"`
+
+	// BootstrapDataTTL is how long the bootstrap data stays valid while the infrastructure of the machine is not
+	// provisioned, e.g. because it is queued or was stopped for a long time. Once expired, the bootstrap data is
+	// regenerated with the current cluster token and control plane endpoint. Only applies to machines joining an
+	// initialized cluster. Defaults to never regenerating the bootstrap data.
+	// +optional
+	BootstrapDataTTL *metav1.Duration `json:"bootstrapDataTTL,omitempty"`
+
+	// Debug turns on k3s debug logging, and lifts the journald rate limits of the node so that verbose logs
+	// are not dropped.
+	// +optional
+	Debug bool `json:"debug,omitempty"`
+
+	// LogLevel is the k3s log verbosity, passed with the v option (default: 0)
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=10
+	// +optional
+	LogLevel *int32 `json:"logLevel,omitempty"`
+
 	// Version specifies the k3s version
 	// +optional
 	Version string `json:"version,omitempty"`
@@ -128,6 +165,218 @@ type KThreesServerConfig struct {
 	// Customized etcd proxy image for management cluster to communicate with workload cluster etcd (default: "alpine/socat")
 	// +optional
 	EtcdProxyImage string `json:"etcdProxyImage,omitempty"`
+
+	// EgressSelectorMode sets the apiserver egress selector mode, one of agent, cluster, pod or disabled (default: "agent")
+	// +kubebuilder:validation:Enum=agent;cluster;pod;disabled
+	// +optional
+	EgressSelectorMode string `json:"egressSelectorMode,omitempty"`
+
+	// TLSCipherSuites overrides the cipher suites used by the apiserver and kubelets, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+	// (default: a set of modern suites, plus a few AWS ELB compatible ones for the apiserver)
+	// +optional
+	TLSCipherSuites []string `json:"tlsCipherSuites,omitempty"`
+
+	// TLSMinVersion sets the minimum TLS version accepted by the apiserver and kubelets, one of VersionTLS12 or VersionTLS13
+	// +kubebuilder:validation:Enum=VersionTLS12;VersionTLS13
+	// +optional
+	TLSMinVersion string `json:"tlsMinVersion,omitempty"`
+
+	// KMSEncryption configures a KMS v2 provider for encryption at rest, instead of the k3s built-in AES secrets encryption
+	// +optional
+	KMSEncryption *KMSEncryption `json:"kmsEncryption,omitempty"`
+
+	// AuditWebhook configures the apiserver to send audit events to a webhook backend
+	// +optional
+	AuditWebhook *AuditWebhook `json:"auditWebhook,omitempty"`
+
+	// ExtraHostPaths declares host paths on servers referenced by kube-apiserver, kube-controller-manager
+	// or kube-scheduler args, e.g. audit policy directories, encryption configs or OIDC CA files
+	// +optional
+	ExtraHostPaths []HostPath `json:"extraHostPaths,omitempty"`
+
+	// EtcdSnapshots configures scheduled etcd snapshots and their retention, both locally on each server and in S3
+	// +optional
+	EtcdSnapshots *EtcdSnapshots `json:"etcdSnapshots,omitempty"`
+
+	// ControllerManager tunes common kube-controller-manager settings, rendered to kube-controller-manager args
+	// before kubeControllerManagerArgs, which take precedence
+	// +optional
+	ControllerManager *ControllerManagerConfig `json:"controllerManager,omitempty"`
+
+	// Scheduler tunes common kube-scheduler settings, rendered to kube-scheduler args before kubeSchedulerArgs,
+	// which take precedence
+	// +optional
+	Scheduler *SchedulerConfig `json:"scheduler,omitempty"`
+
+	// StaticPods are pod manifests written to the kubelet static pod path on servers, e.g. for kube-vip or
+	// node-local auditing sidecars. As for the other settings, changing them rolls out the control plane machines.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	StaticPods []StaticPod `json:"staticPods,omitempty"`
+}
+
+// StaticPod defines a pod run by the kubelet of the servers from a manifest in its static pod path.
+type StaticPod struct {
+	// Name of the manifest file in the static pod path, without the .yaml extension.
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+
+	// Manifest is the YAML manifest of the v1 Pod.
+	Manifest string `json:"manifest"`
+}
+
+// ControllerManagerConfig defines common kube-controller-manager settings.
+type ControllerManagerConfig struct {
+	// NodeCIDRMaskSize is the mask size of the pod CIDR allocated to each node from a single-stack clusterCidr
+	// (default: 24 for IPv4, 64 for IPv6)
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=128
+	// +optional
+	NodeCIDRMaskSize *int32 `json:"nodeCIDRMaskSize,omitempty"`
+
+	// NodeMonitorGracePeriod is how long a node can be unresponsive before it is marked unhealthy (default: 40s)
+	// +optional
+	NodeMonitorGracePeriod *metav1.Duration `json:"nodeMonitorGracePeriod,omitempty"`
+
+	// BindAddress is the address kube-controller-manager serves its secure port on, e.g. 0.0.0.0 for metrics
+	// to be scraped from outside the node (default: 127.0.0.1)
+	// +optional
+	BindAddress string `json:"bindAddress,omitempty"`
+}
+
+// SchedulerConfig defines common kube-scheduler settings.
+type SchedulerConfig struct {
+	// BindAddress is the address kube-scheduler serves its secure port on, e.g. 0.0.0.0 for metrics
+	// to be scraped from outside the node (default: 127.0.0.1)
+	// +optional
+	BindAddress string `json:"bindAddress,omitempty"`
+}
+
+// HostPathType is the type of a HostPath.
+// +kubebuilder:validation:Enum=Directory;File
+type HostPathType string
+
+const (
+	// HostPathDirectory is a directory created on servers before k3s starts.
+	HostPathDirectory HostPathType = "Directory"
+	// HostPathFile is a file that must be provided by an entry in files.
+	HostPathFile HostPathType = "File"
+)
+
+// HostPath is a path on servers used by control plane components.
+type HostPath struct {
+	// Path is the absolute path on the host.
+	Path string `json:"path"`
+
+	// Type of the path, directories are created before k3s starts while files must be
+	// provided by an entry in files (default: "Directory")
+	// +optional
+	Type HostPathType `json:"type,omitempty"`
+
+	// Permissions of the directory, only used for directories (default: "0755")
+	// +optional
+	Permissions string `json:"permissions,omitempty"`
+}
+
+// KMSEncryption defines a KMS v2 provider used by the apiserver for envelope encryption.
+type KMSEncryption struct {
+	// Name is the name of the KMS plugin, it must be unique across the cluster.
+	Name string `json:"name"`
+
+	// Endpoint is the gRPC listen address of the KMS plugin, e.g. unix:///var/run/kmsplugin/socket.sock
+	Endpoint string `json:"endpoint"`
+
+	// Timeout for gRPC calls to the KMS plugin (default: 3s)
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// Resources lists the resources encrypted with the KMS provider (default: ["secrets"])
+	// +optional
+	Resources []string `json:"resources,omitempty"`
+
+	// PluginManifests are written to the k3s auto-deploying manifests directory on servers,
+	// typically the DaemonSet running the KMS plugin.
+	// +optional
+	PluginManifests string `json:"pluginManifests,omitempty"`
+}
+
+// AuditWebhook defines the apiserver audit webhook backend. An audit policy still has to be provided,
+// e.g. through files and the audit-policy-file kube-apiserver arg, for events to be sent.
+type AuditWebhook struct {
+	// KubeconfigFrom references the secret key holding the kubeconfig used to reach the audit webhook.
+	KubeconfigFrom SecretFileSource `json:"kubeconfigFrom"`
+
+	// Mode is the strategy for sending audit events, one of batch, blocking or blocking-strict (default: "batch")
+	// +kubebuilder:validation:Enum=batch;blocking;blocking-strict
+	// +optional
+	Mode string `json:"mode,omitempty"`
+
+	// InitialBackoff is the amount of time to wait before retrying the first failed request (default: 10s)
+	// +optional
+	InitialBackoff *metav1.Duration `json:"initialBackoff,omitempty"`
+
+	// BatchMaxSize is the maximum size of a batch, only used in batch mode (default: 400)
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	BatchMaxSize *int32 `json:"batchMaxSize,omitempty"`
+
+	// BatchMaxWait is the amount of time to wait before force writing a batch that hasn't reached the max size,
+	// only used in batch mode (default: 30s)
+	// +optional
+	BatchMaxWait *metav1.Duration `json:"batchMaxWait,omitempty"`
+}
+
+// EtcdSnapshots defines the scheduled etcd snapshots of the servers and how long they are kept.
+type EtcdSnapshots struct {
+	// ScheduleCron is the snapshot interval time in cron spec (default: "0 */12 * * *")
+	// +optional
+	ScheduleCron string `json:"scheduleCron,omitempty"`
+
+	// Retention is the number of scheduled snapshots to keep, per server for local snapshots and in S3 (default: 5)
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Retention *int32 `json:"retention,omitempty"`
+
+	// MaxAge is the age after which snapshots, scheduled or on-demand, are pruned by the control plane controller
+	// regardless of the retention count
+	// +optional
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+
+	// Verify checks the integrity of the latest local snapshot once taken, by matching the checksum etcd appends to
+	// snapshots like etcdutl snapshot status does. The result is reported in the KThreesControlPlane
+	// status.lastSnapshotVerified; compressed snapshots are not verified.
+	// +optional
+	Verify bool `json:"verify,omitempty"`
+
+	// S3 enables uploading the snapshots to S3 compatible object storage
+	// +optional
+	S3 *EtcdSnapshotsS3 `json:"s3,omitempty"`
+}
+
+// EtcdSnapshotsS3 defines the S3 storage of etcd snapshots.
+type EtcdSnapshotsS3 struct {
+	// Endpoint is the S3 endpoint url (default: "s3.amazonaws.com")
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Bucket is the S3 bucket name
+	// +optional
+	Bucket string `json:"bucket,omitempty"`
+
+	// Folder is the S3 folder the snapshots are stored in
+	// +optional
+	Folder string `json:"folder,omitempty"`
+
+	// Region is the S3 region / bucket location (default: "us-east-1")
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// ConfigSecret is the name of a secret in the kube-system namespace of the workload cluster holding the S3
+	// configuration and credentials, only used by k3s when no other S3 option is set
+	// +optional
+	ConfigSecret string `json:"configSecret,omitempty"`
 }
 
 type KThreesAgentConfig struct {
@@ -156,6 +405,23 @@ type KThreesAgentConfig struct {
 	// +optional
 	NodeName string `json:"nodeName,omitempty"`
 
+	// NodeNameStrategy controls the name of the Node: MachineName names it after the Machine, Hostname
+	// after the host name, and Template renders nodeName as a Go template with the .MachineName,
+	// .ClusterName and .Namespace fields. When unset, nodeName is used as is, defaulting to the host name.
+	// +optional
+	NodeNameStrategy NodeNameStrategy `json:"nodeNameStrategy,omitempty"`
+
+	// PreferBundledBin makes k3s use its bundled userspace binaries, such as iptables, rather than the host ones.
+	// This avoids kube-proxy failures on hosts shipping old or incompatible versions of those tools.
+	// +optional
+	PreferBundledBin bool `json:"preferBundledBin,omitempty"`
+
+	// ServerTLSBootstrap makes the kubelet request its serving certificate from the cluster and rotate it,
+	// instead of using a self-signed one. When set on a KThreesControlPlane, the control plane controller
+	// approves the serving certificate requests of the cluster nodes.
+	// +optional
+	ServerTLSBootstrap bool `json:"serverTLSBootstrap,omitempty"`
+
 	// AirGapped is a boolean value to define if the bootstrapping should be air-gapped,
 	// basically supposing that online container registries and k3s install scripts are not reachable.
 	// User should prepare docker image, k3s binary, and put the install script in AirGappedInstallScriptPath (default path: "/opt/install.sh")
@@ -168,6 +434,70 @@ type KThreesAgentConfig struct {
 	// used when AirGapped is set to true (default: "/opt/install.sh").
 	// +optional
 	AirGappedInstallScriptPath string `json:"airGappedInstallScriptPath,omitempty"`
+
+	// VPNAuth makes the node join a VPN used by k3s for the node traffic, e.g. Tailscale for nodes behind NAT.
+	// All the nodes of the cluster should join the same VPN.
+	// +optional
+	VPNAuth *VPNAuth `json:"vpnAuth,omitempty"`
+
+	// Docker makes k3s run containers with the Docker engine, through the cri-dockerd shim bundled with k3s,
+	// instead of containerd. It is meant for legacy environments requiring the Docker engine on nodes, which is
+	// installed when missing unless airGapped is set. Deprecated: Docker support is kept for compatibility only,
+	// use containerd.
+	// +optional
+	Docker bool `json:"docker,omitempty"`
+
+	// ResolvConf points kubelet at a custom resolver file instead of the host /etc/resolv.conf, e.g. on
+	// systemd-resolved hosts whose stub resolver makes CoreDNS detect a forwarding loop, or with split DNS.
+	// +optional
+	ResolvConf *ResolvConf `json:"resolvConf,omitempty"`
+
+	// ServerURL is the URL workers join the cluster through, e.g. an internal load balancer or a VPN address
+	// reachable from workers behind NAT, instead of the controlPlaneEndpoint of the Cluster which is still used
+	// in kubeconfigs. It is ignored by control plane machines.
+	// +optional
+	ServerURL string `json:"serverURL,omitempty"`
+}
+
+// ResolvConf defines the resolver file used by kubelet, passed to k3s with the resolv-conf option.
+type ResolvConf struct {
+	// Path of the resolver file on the node, e.g. /run/systemd/resolve/resolv.conf
+	Path string `json:"path"`
+
+	// Content of the resolver file, written to path when set. The file is expected to exist on the node otherwise.
+	// +optional
+	Content string `json:"content,omitempty"`
+}
+
+// NodeNameStrategy controls how the name of a Node is chosen.
+// +kubebuilder:validation:Enum=MachineName;Hostname;Template
+type NodeNameStrategy string
+
+const (
+	// NodeNameStrategyMachineName names the Node after its Machine.
+	NodeNameStrategyMachineName NodeNameStrategy = "MachineName"
+
+	// NodeNameStrategyHostname names the Node after the host name, which is the k3s default.
+	NodeNameStrategyHostname NodeNameStrategy = "Hostname"
+
+	// NodeNameStrategyTemplate names the Node by rendering the nodeName Go template.
+	NodeNameStrategyTemplate NodeNameStrategy = "Template"
+)
+
+// VPNAuth defines the VPN a node joins, passed to k3s with the vpn-auth-file option.
+type VPNAuth struct {
+	// Name of the VPN provider, only tailscale is supported by k3s (default: "tailscale")
+	// +kubebuilder:validation:Enum=tailscale
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// JoinKeyFrom references the secret key holding the auth key used to join the VPN.
+	JoinKeyFrom SecretFileSource `json:"joinKeyFrom"`
+
+	// ControlServerURL is the URL of the VPN control server, e.g. a headscale server
+	// (default: the provider control server)
+	// +optional
+	ControlServerURL string `json:"controlServerURL,omitempty"`
 }
 
 // KThreesConfigStatus defines the observed state of KThreesConfig.
@@ -181,6 +511,11 @@ type KThreesConfigStatus struct {
 	// +optional
 	DataSecretName *string `json:"dataSecretName,omitempty"`
 
+	// Initialization provides observations of the KThreesConfig initialization process,
+	// as defined by the Cluster API v1beta2 bootstrap provider contract.
+	// +optional
+	Initialization *KThreesConfigInitializationStatus `json:"initialization,omitempty"`
+
 	// FailureReason will be set on non-retryable errors
 	// +optional
 	FailureReason string `json:"failureReason,omitempty"`
@@ -198,6 +533,13 @@ type KThreesConfigStatus struct {
 	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
 }
 
+// KThreesConfigInitializationStatus provides observations of the KThreesConfig initialization process.
+type KThreesConfigInitializationStatus struct {
+	// DataSecretCreated is true when the secret storing the bootstrap data is created.
+	// +optional
+	DataSecretCreated bool `json:"dataSecretCreated,omitempty"`
+}
+
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:storageversion
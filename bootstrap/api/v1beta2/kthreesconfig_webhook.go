@@ -18,13 +18,26 @@ package v1beta2
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/yaml"
 )
 
 // SetupWebhookWithManager will setup the webhooks for the KThreesConfig.
@@ -43,13 +56,41 @@ var _ admission.CustomDefaulter = &KThreesConfig{}
 var _ admission.CustomValidator = &KThreesConfig{}
 
 // ValidateCreate will do any extra validation when creating a KThreesConfig.
-func (c *KThreesConfig) ValidateCreate(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
-	return []string{}, nil
+func (c *KThreesConfig) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	config, ok := obj.(*KThreesConfig)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a KThreesConfig but got a %T", obj))
+	}
+
+	return config.Spec.Warnings(field.NewPath("spec")), config.validate(nil)
 }
 
 // ValidateUpdate will do any extra validation when updating a KThreesConfig.
-func (c *KThreesConfig) ValidateUpdate(_ context.Context, _, _ runtime.Object) (admission.Warnings, error) {
-	return []string{}, nil
+func (c *KThreesConfig) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldConfig, ok := oldObj.(*KThreesConfig)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a KThreesConfig but got a %T", oldObj))
+	}
+	config, ok := newObj.(*KThreesConfig)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a KThreesConfig but got a %T", newObj))
+	}
+
+	return config.Spec.Warnings(field.NewPath("spec")), config.validate(oldConfig)
+}
+
+// validate validates the KThreesConfig; old is nil on create.
+func (c *KThreesConfig) validate(old *KThreesConfig) error {
+	var oldSpec *KThreesConfigSpec
+	if old != nil {
+		oldSpec = &old.Spec
+	}
+	allErrs := c.Spec.Validate(field.NewPath("spec"), oldSpec)
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(GroupVersion.WithKind("KThreesConfig").GroupKind(), c.Name, allErrs)
 }
 
 // ValidateDelete allows you to add any extra validation when deleting.
@@ -64,12 +105,340 @@ func (c *KThreesConfig) Default(_ context.Context, obj runtime.Object) error {
 		return apierrors.NewBadRequest(fmt.Sprintf("expected a KThreesConfig but got a %T", obj))
 	}
 
-	if c.Spec.ServerConfig.DisableCloudController == nil {
-		c.Spec.ServerConfig.DisableCloudController = ptr.To(true)
+	c.Spec.Default()
+	return nil
+}
+
+// Default sets the default values of the KThreesConfigSpec.
+func (c *KThreesConfigSpec) Default() {
+	if c.ServerConfig.DisableCloudController == nil {
+		c.ServerConfig.DisableCloudController = ptr.To(true)
+	}
+
+	if c.ServerConfig.CloudProviderName == nil {
+		c.ServerConfig.CloudProviderName = ptr.To("external")
+	}
+}
+
+// Validate ensures the KThreesConfigSpec is valid; old is nil on create. The extra host paths are only
+// validated when they or the files change, so that existing objects can still be updated.
+func (c *KThreesConfigSpec) Validate(pathPrefix *field.Path, old *KThreesConfigSpec) field.ErrorList {
+	allErrs := c.ServerConfig.validate(pathPrefix.Child("serverConfig"))
+	if old == nil || !reflect.DeepEqual(old.ServerConfig.ExtraHostPaths, c.ServerConfig.ExtraHostPaths) || !reflect.DeepEqual(old.Files, c.Files) {
+		allErrs = append(allErrs, c.validateExtraHostPaths(pathPrefix.Child("serverConfig"))...)
+	}
+	allErrs = append(allErrs, c.AgentConfig.validate(pathPrefix.Child("agentConfig"))...)
+	return allErrs
+}
+
+// packagedComponents are the components deployed by k3s that can be disabled with disableComponents.
+var packagedComponents = []string{"coredns", "servicelb", "traefik", "local-storage", "metrics-server", "runtimes"}
+
+// Warnings returns the warnings about deprecated fields and risky settings of the KThreesConfigSpec, which are
+// surfaced to users at apply time without rejecting the object.
+func (c *KThreesConfigSpec) Warnings(pathPrefix *field.Path) admission.Warnings {
+	var warnings admission.Warnings
+
+	serverConfigPath := pathPrefix.Child("serverConfig")
+	if c.ServerConfig.DeprecatedDisableExternalCloudProvider {
+		warnings = append(warnings, fmt.Sprintf("%s is deprecated, use %s and %s instead",
+			serverConfigPath.Child("disableExternalCloudProvider"), serverConfigPath.Child("cloudProviderName"), serverConfigPath.Child("disableCloudController")))
+	}
+
+	for i, component := range c.ServerConfig.DisableComponents {
+		switch {
+		case component == "coredns":
+			warnings = append(warnings, fmt.Sprintf("%s disables coredns, the cluster has no DNS until a replacement is deployed",
+				serverConfigPath.Child("disableComponents").Index(i)))
+		case !slices.Contains(packagedComponents, component):
+			warnings = append(warnings, fmt.Sprintf("%s: %q is not a packaged k3s component and is ignored, only %s can be disabled",
+				serverConfigPath.Child("disableComponents").Index(i), component, strings.Join(packagedComponents, ", ")))
+		}
+	}
+
+	if c.AgentConfig.Docker {
+		warnings = append(warnings, fmt.Sprintf("%s is deprecated, the Docker engine is only supported for legacy environments, use containerd instead",
+			pathPrefix.Child("agentConfig", "docker")))
+	}
+
+	for i, cipherSuite := range c.ServerConfig.TLSCipherSuites {
+		if isInsecureCipherSuite(cipherSuite) {
+			warnings = append(warnings, fmt.Sprintf("%s: %s is an insecure TLS cipher suite",
+				serverConfigPath.Child("tlsCipherSuites").Index(i), cipherSuite))
+		}
+	}
+
+	warnings = append(warnings, c.argPathWarnings(serverConfigPath)...)
+
+	return warnings
+}
+
+// k3sManagedPaths are the directories whose content is written by k3s itself, which args may refer to without
+// declaring them as extra host paths.
+var k3sManagedPaths = []string{"/var/lib/rancher/k3s", "/etc/rancher/k3s"}
+
+// outputPathArgs are the args of kube-apiserver, kube-controller-manager and kube-scheduler whose paths are
+// written by the components themselves, so they do not have to be provided by files.
+var outputPathArgs = []string{"audit-log-path", "log-file", "cert-dir"}
+
+// validateExtraHostPaths ensures extra host paths are absolute, that the ones declared as files are provided
+// by an entry in files, and that the permissions of directories are octal modes.
+func (c *KThreesConfigSpec) validateExtraHostPaths(pathPrefix *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	files := map[string]bool{}
+	for _, file := range c.Files {
+		files[file.Path] = true
+	}
+
+	hostPathsPath := pathPrefix.Child("extraHostPaths")
+	for i, hostPath := range c.ServerConfig.ExtraHostPaths {
+		if !path.IsAbs(hostPath.Path) {
+			allErrs = append(allErrs, field.Invalid(hostPathsPath.Index(i).Child("path"), hostPath.Path, "must be an absolute path"))
+			continue
+		}
+
+		if hostPath.Type == HostPathFile {
+			if !files[hostPath.Path] {
+				allErrs = append(allErrs, field.Invalid(hostPathsPath.Index(i).Child("path"), hostPath.Path, "file host paths must be provided by an entry in files"))
+			}
+			continue
+		}
+
+		if hostPath.Permissions != "" {
+			if mode, err := strconv.ParseUint(hostPath.Permissions, 8, 32); err != nil || mode > 0o7777 {
+				allErrs = append(allErrs, field.Invalid(hostPathsPath.Index(i).Child("permissions"), hostPath.Permissions, "must be an octal mode, e.g. 0755"))
+			}
+		}
+	}
+
+	return allErrs
+}
+
+// argPathWarnings warns about the input paths referenced by kube-apiserver, kube-controller-manager and
+// kube-scheduler args that are neither provided by files nor under a directory of the extra host paths.
+// They are only warnings, as the paths may also be provided by the machine image.
+func (c *KThreesConfigSpec) argPathWarnings(pathPrefix *field.Path) admission.Warnings {
+	var warnings admission.Warnings
+
+	files := map[string]bool{}
+	for _, file := range c.Files {
+		files[file.Path] = true
+	}
+	directories := append([]string{}, k3sManagedPaths...)
+	for _, hostPath := range c.ServerConfig.ExtraHostPaths {
+		if hostPath.Type != HostPathFile && path.IsAbs(hostPath.Path) {
+			directories = append(directories, path.Clean(hostPath.Path))
+		}
+	}
+
+	isProvided := func(argPath string) bool {
+		argPath = path.Clean(argPath)
+		if files[argPath] {
+			return true
+		}
+		for _, dir := range directories {
+			if argPath == dir || strings.HasPrefix(argPath, dir+"/") {
+				return true
+			}
+		}
+		return false
 	}
 
-	if c.Spec.ServerConfig.CloudProviderName == nil {
-		c.Spec.ServerConfig.CloudProviderName = ptr.To("external")
+	for _, componentArgs := range []struct {
+		name string
+		args []string
+	}{
+		{name: "kubeAPIServerArg", args: c.ServerConfig.KubeAPIServerArgs},
+		{name: "kubeControllerManagerArgs", args: c.ServerConfig.KubeControllerManagerArgs},
+		{name: "kubeSchedulerArgs", args: c.ServerConfig.KubeSchedulerArgs},
+	} {
+		for i, arg := range componentArgs.args {
+			name, value, _ := strings.Cut(arg, "=")
+			if slices.Contains(outputPathArgs, name) {
+				continue
+			}
+			for _, argPath := range strings.Split(value, ",") {
+				if path.IsAbs(argPath) && !isProvided(argPath) {
+					warnings = append(warnings, fmt.Sprintf("%s: %s is neither provided by an entry in files nor under a directory of %s, "+
+						"make sure it exists on the machines", pathPrefix.Child(componentArgs.name).Index(i), argPath, pathPrefix.Child("extraHostPaths")))
+				}
+			}
+		}
+	}
+
+	return warnings
+}
+
+func (c *KThreesAgentConfig) validate(pathPrefix *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	switch c.NodeNameStrategy {
+	case NodeNameStrategyMachineName, NodeNameStrategyHostname:
+		if c.NodeName != "" {
+			allErrs = append(allErrs, field.Invalid(pathPrefix.Child("nodeName"), c.NodeName,
+				fmt.Sprintf("must be empty with the %s node name strategy", c.NodeNameStrategy)))
+		}
+	case NodeNameStrategyTemplate:
+		if c.NodeName == "" {
+			allErrs = append(allErrs, field.Required(pathPrefix.Child("nodeName"), "a Go template is required with the Template node name strategy"))
+		} else if _, err := template.New("nodeName").Option("missingkey=error").Parse(c.NodeName); err != nil {
+			allErrs = append(allErrs, field.Invalid(pathPrefix.Child("nodeName"), c.NodeName, fmt.Sprintf("is not a valid Go template: %v", err)))
+		}
+	}
+
+	if c.ResolvConf != nil && !path.IsAbs(c.ResolvConf.Path) {
+		allErrs = append(allErrs, field.Invalid(pathPrefix.Child("resolvConf", "path"), c.ResolvConf.Path, "must be an absolute path"))
+	}
+
+	if c.ServerURL != "" {
+		if u, err := url.Parse(c.ServerURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			allErrs = append(allErrs, field.Invalid(pathPrefix.Child("serverURL"), c.ServerURL, "must be an https URL, e.g. https://10.0.0.10:6443"))
+		}
+	}
+
+	return allErrs
+}
+
+func (c *KThreesServerConfig) validate(pathPrefix *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	serviceCIDRs, errs := parseCIDRs(c.ServiceCidr, pathPrefix.Child("serviceCidr"))
+	allErrs = append(allErrs, errs...)
+
+	if c.ClusterDNS != "" {
+		for _, dns := range strings.Split(c.ClusterDNS, ",") {
+			ip := net.ParseIP(strings.TrimSpace(dns))
+			if ip == nil {
+				allErrs = append(allErrs, field.Invalid(pathPrefix.Child("clusterDNS"), c.ClusterDNS, fmt.Sprintf("%q is not a valid IP address", dns)))
+				continue
+			}
+
+			if len(serviceCIDRs) > 0 && !cidrsContain(serviceCIDRs, ip) {
+				allErrs = append(allErrs, field.Invalid(pathPrefix.Child("clusterDNS"), c.ClusterDNS, fmt.Sprintf("%s is not within the service CIDR %q", ip, c.ServiceCidr)))
+			}
+		}
+	}
+
+	if c.ClusterDomain != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(c.ClusterDomain) {
+			allErrs = append(allErrs, field.Invalid(pathPrefix.Child("clusterDomain"), c.ClusterDomain, msg))
+		}
+	}
+
+	if c.KMSEncryption != nil && !strings.HasPrefix(c.KMSEncryption.Endpoint, "unix://") {
+		allErrs = append(allErrs, field.Invalid(pathPrefix.Child("kmsEncryption", "endpoint"), c.KMSEncryption.Endpoint, "must be a unix socket, e.g. unix:///var/run/kmsplugin/socket.sock"))
+	}
+
+	for i, cipherSuite := range c.TLSCipherSuites {
+		if !isKnownCipherSuite(cipherSuite) {
+			allErrs = append(allErrs, field.Invalid(pathPrefix.Child("tlsCipherSuites").Index(i), cipherSuite, "unknown TLS cipher suite"))
+		}
+	}
+
+	if c.ControllerManager != nil {
+		allErrs = append(allErrs, c.ControllerManager.validate(pathPrefix.Child("controllerManager"), c.ClusterCidr)...)
+	}
+
+	if c.Scheduler != nil {
+		allErrs = append(allErrs, validateBindAddress(c.Scheduler.BindAddress, pathPrefix.Child("scheduler", "bindAddress"))...)
+	}
+
+	for i, staticPod := range c.StaticPods {
+		allErrs = append(allErrs, validateStaticPodManifest(staticPod.Manifest, pathPrefix.Child("staticPods").Index(i).Child("manifest"))...)
+	}
+
+	return allErrs
+}
+
+// validateStaticPodManifest ensures the manifest is a single v1 Pod, the only kind the kubelet runs as a static pod.
+func validateStaticPodManifest(manifest string, fldPath *field.Path) field.ErrorList {
+	typeMeta := metav1.TypeMeta{}
+	if err := yaml.Unmarshal([]byte(manifest), &typeMeta); err != nil {
+		return field.ErrorList{field.Invalid(fldPath, manifest, fmt.Sprintf("is not a valid YAML manifest: %v", err))}
+	}
+	if typeMeta.APIVersion != "v1" || typeMeta.Kind != "Pod" {
+		return field.ErrorList{field.Invalid(fldPath, manifest, "must be the manifest of a v1 Pod")}
+	}
+	return nil
+}
+
+func (c *ControllerManagerConfig) validate(pathPrefix *field.Path, clusterCidr string) field.ErrorList {
+	allErrs := validateBindAddress(c.BindAddress, pathPrefix.Child("bindAddress"))
+
+	if c.NodeCIDRMaskSize != nil {
+		// invalid cluster CIDRs are left to k3s, which defaults the cluster CIDR to 10.42.0.0/16.
+		clusterCIDRs, _ := parseCIDRs(clusterCidr, pathPrefix)
+		if clusterCidr == "" {
+			_, defaultCIDR, _ := net.ParseCIDR("10.42.0.0/16")
+			clusterCIDRs = []*net.IPNet{defaultCIDR}
+		}
+
+		maskSize := int(*c.NodeCIDRMaskSize)
+		switch {
+		case len(clusterCIDRs) > 1:
+			allErrs = append(allErrs, field.Forbidden(pathPrefix.Child("nodeCIDRMaskSize"), "is not supported with a dual-stack clusterCidr"))
+		case len(clusterCIDRs) == 1:
+			prefix, bits := clusterCIDRs[0].Mask.Size()
+			if maskSize < prefix || maskSize > bits {
+				allErrs = append(allErrs, field.Invalid(pathPrefix.Child("nodeCIDRMaskSize"), maskSize,
+					fmt.Sprintf("must be between %d and %d for the cluster CIDR %s", prefix, bits, clusterCIDRs[0])))
+			}
+		}
+	}
+
+	return allErrs
+}
+
+func validateBindAddress(bindAddress string, fldPath *field.Path) field.ErrorList {
+	if bindAddress != "" && net.ParseIP(bindAddress) == nil {
+		return field.ErrorList{field.Invalid(fldPath, bindAddress, "must be a valid IP address")}
 	}
 	return nil
 }
+
+func isInsecureCipherSuite(name string) bool {
+	for _, cs := range tls.InsecureCipherSuites() {
+		if cs.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isKnownCipherSuite(name string) bool {
+	for _, cs := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		if cs.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCIDRs parses a comma separated list of CIDRs as accepted by k3s.
+func parseCIDRs(cidrs string, fldPath *field.Path) ([]*net.IPNet, field.ErrorList) {
+	if cidrs == "" {
+		return nil, nil
+	}
+
+	var allErrs field.ErrorList
+	nets := []*net.IPNet{}
+	for _, cidr := range strings.Split(cidrs, ",") {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath, cidrs, fmt.Sprintf("%q is not a valid CIDR", cidr)))
+			continue
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, allErrs
+}
+
+func cidrsContain(cidrs []*net.IPNet, ip net.IP) bool {
+	for _, cidr := range cidrs {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
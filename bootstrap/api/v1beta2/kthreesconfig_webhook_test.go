@@ -0,0 +1,441 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/ptr"
+)
+
+func TestKThreesConfigSpecValidate(t *testing.T) {
+	tests := []struct {
+		name         string
+		serverConfig KThreesServerConfig
+		expectErr    bool
+	}{
+		{
+			name:         "empty server config is valid",
+			serverConfig: KThreesServerConfig{},
+		},
+		{
+			name: "cluster dns within service cidr",
+			serverConfig: KThreesServerConfig{
+				ServiceCidr: "10.96.0.0/12",
+				ClusterDNS:  "10.96.0.10",
+			},
+		},
+		{
+			name: "dual-stack cluster dns within service cidrs",
+			serverConfig: KThreesServerConfig{
+				ServiceCidr: "10.96.0.0/12,fd00:43::/112",
+				ClusterDNS:  "10.96.0.10,fd00:43::a",
+			},
+		},
+		{
+			name: "cluster dns outside of service cidr",
+			serverConfig: KThreesServerConfig{
+				ServiceCidr: "10.96.0.0/12",
+				ClusterDNS:  "10.43.0.10",
+			},
+			expectErr: true,
+		},
+		{
+			name: "invalid cluster dns",
+			serverConfig: KThreesServerConfig{
+				ClusterDNS: "coredns",
+			},
+			expectErr: true,
+		},
+		{
+			name: "invalid service cidr",
+			serverConfig: KThreesServerConfig{
+				ServiceCidr: "10.96.0.0",
+			},
+			expectErr: true,
+		},
+		{
+			name: "valid cluster domain",
+			serverConfig: KThreesServerConfig{
+				ClusterDomain: "k3s.internal",
+			},
+		},
+		{
+			name: "known tls cipher suites",
+			serverConfig: KThreesServerConfig{
+				TLSCipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_RSA_WITH_AES_256_GCM_SHA384"},
+			},
+		},
+		{
+			name: "unknown tls cipher suite",
+			serverConfig: KThreesServerConfig{
+				TLSCipherSuites: []string{"TLS_NOT_A_CIPHER"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "kms encryption with unix socket endpoint",
+			serverConfig: KThreesServerConfig{
+				KMSEncryption: &KMSEncryption{Name: "kms", Endpoint: "unix:///var/run/kmsplugin/socket.sock"},
+			},
+		},
+		{
+			name: "kms encryption with tcp endpoint",
+			serverConfig: KThreesServerConfig{
+				KMSEncryption: &KMSEncryption{Name: "kms", Endpoint: "tcp://127.0.0.1:8080"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "invalid cluster domain",
+			serverConfig: KThreesServerConfig{
+				ClusterDomain: "Cluster_Local",
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			spec := &KThreesConfigSpec{ServerConfig: tt.serverConfig}
+			errs := spec.Validate(field.NewPath("spec"), nil)
+			if tt.expectErr {
+				g.Expect(errs).ToNot(BeEmpty())
+			} else {
+				g.Expect(errs).To(BeEmpty())
+			}
+		})
+	}
+}
+
+func TestKThreesConfigSpecValidateExtraHostPaths(t *testing.T) {
+	g := NewWithT(t)
+
+	spec := &KThreesConfigSpec{
+		Files: []File{
+			{Path: "/etc/kubernetes/oidc/ca.crt"},
+		},
+		ServerConfig: KThreesServerConfig{
+			ExtraHostPaths: []HostPath{
+				{Path: "/var/log/kubernetes/audit"},
+				{Path: "/etc/kubernetes/oidc/ca.crt", Type: HostPathFile},
+			},
+		},
+	}
+	g.Expect(spec.Validate(field.NewPath("spec"), nil)).To(BeEmpty())
+
+	spec.ServerConfig.ExtraHostPaths = append(spec.ServerConfig.ExtraHostPaths,
+		HostPath{Path: "/etc/kubernetes/audit-policy.yaml", Type: HostPathFile},
+		HostPath{Path: "relative/path"},
+	)
+	g.Expect(spec.Validate(field.NewPath("spec"), nil)).To(HaveLen(2))
+}
+
+func TestKThreesConfigSpecValidateExtraHostPathsPermissions(t *testing.T) {
+	g := NewWithT(t)
+
+	spec := &KThreesConfigSpec{
+		ServerConfig: KThreesServerConfig{
+			ExtraHostPaths: []HostPath{
+				{Path: "/var/log/kubernetes/audit", Permissions: "0700"},
+				{Path: "/var/log/kubernetes/audit-webhook", Permissions: "750"},
+			},
+		},
+	}
+	g.Expect(spec.Validate(field.NewPath("spec"), nil)).To(BeEmpty())
+
+	for _, permissions := range []string{"0799", "rwx", "0755 /tmp", "17777"} {
+		spec.ServerConfig.ExtraHostPaths[0].Permissions = permissions
+		errs := spec.Validate(field.NewPath("spec"), nil)
+		g.Expect(errs).To(HaveLen(1), permissions)
+		g.Expect(errs[0].Field).To(Equal("spec.serverConfig.extraHostPaths[0].permissions"))
+	}
+}
+
+func TestKThreesConfigSpecValidateExtraHostPathsOnUpdate(t *testing.T) {
+	g := NewWithT(t)
+
+	old := &KThreesConfigSpec{
+		ServerConfig: KThreesServerConfig{
+			ExtraHostPaths: []HostPath{
+				{Path: "/etc/kubernetes/audit-policy.yaml", Type: HostPathFile},
+			},
+		},
+	}
+
+	// existing objects can still be updated while their extra host paths and files do not change.
+	spec := old.DeepCopy()
+	spec.Version = "v1.30.4+k3s1"
+	g.Expect(spec.Validate(field.NewPath("spec"), old)).To(BeEmpty())
+	g.Expect(spec.Validate(field.NewPath("spec"), nil)).To(HaveLen(1))
+
+	spec.ServerConfig.ExtraHostPaths = append(spec.ServerConfig.ExtraHostPaths, HostPath{Path: "/var/log/kubernetes/audit"})
+	g.Expect(spec.Validate(field.NewPath("spec"), old)).To(HaveLen(1))
+
+	spec = old.DeepCopy()
+	spec.Files = []File{{Path: "/etc/kubernetes/scheduler.yaml"}}
+	g.Expect(spec.Validate(field.NewPath("spec"), old)).To(HaveLen(1))
+}
+
+func TestKThreesConfigSpecArgPathWarnings(t *testing.T) {
+	g := NewWithT(t)
+
+	spec := &KThreesConfigSpec{
+		Files: []File{
+			{Path: "/etc/kubernetes/audit-policy.yaml"},
+			{Path: "/etc/kubernetes/scheduler.yaml"},
+		},
+		ServerConfig: KThreesServerConfig{
+			KubeAPIServerArgs: []string{
+				"audit-policy-file=/etc/kubernetes/audit-policy.yaml",
+				"audit-log-path=/var/log/kubernetes/audit/audit.log",
+				"tls-cert-file=/var/lib/rancher/k3s/server/tls/serving-kube-apiserver.crt",
+				"oidc-issuer-url=https://example.com",
+				"audit-log-maxage=30",
+			},
+			KubeSchedulerArgs: []string{"config=/etc/kubernetes/scheduler.yaml"},
+			ExtraHostPaths: []HostPath{
+				{Path: "/var/log/kubernetes/audit"},
+			},
+		},
+	}
+	g.Expect(spec.Warnings(field.NewPath("spec"))).To(BeEmpty())
+
+	// input paths neither written by files nor under an extra host path directory are only warned about,
+	// output paths are written by the components.
+	spec.ServerConfig.KubeAPIServerArgs = append(spec.ServerConfig.KubeAPIServerArgs,
+		"oidc-ca-file=/etc/kubernetes/oidc/ca.crt",
+		"audit-log-path=/var/log/kubernetes/auditlog/audit.log")
+	spec.ServerConfig.KubeControllerManagerArgs = []string{"service-account-private-key-file=/etc/kubernetes/sa.key"}
+	spec.ServerConfig.KubeSchedulerArgs = []string{"config=/etc/kubernetes/scheduler-config.yaml"}
+	g.Expect(spec.Validate(field.NewPath("spec"), nil)).To(BeEmpty())
+	warnings := spec.Warnings(field.NewPath("spec"))
+	g.Expect(warnings).To(HaveLen(3))
+	g.Expect(warnings[0]).To(HavePrefix("spec.serverConfig.kubeAPIServerArg[5]: /etc/kubernetes/oidc/ca.crt"))
+	g.Expect(warnings[1]).To(HavePrefix("spec.serverConfig.kubeControllerManagerArgs[0]"))
+	g.Expect(warnings[2]).To(HavePrefix("spec.serverConfig.kubeSchedulerArgs[0]"))
+
+	// a file host path provides the file it declares, as it must be written by files.
+	spec.Files = append(spec.Files, File{Path: "/etc/kubernetes/oidc/ca.crt"})
+	spec.ServerConfig.ExtraHostPaths = append(spec.ServerConfig.ExtraHostPaths, HostPath{Path: "/etc/kubernetes/oidc/ca.crt", Type: HostPathFile})
+	g.Expect(spec.Warnings(field.NewPath("spec"))).To(HaveLen(2))
+}
+
+func TestKThreesConfigSpecValidateNodeNameStrategy(t *testing.T) {
+	tests := []struct {
+		name        string
+		agentConfig KThreesAgentConfig
+		expectErr   bool
+	}{
+		{
+			name:        "literal node name",
+			agentConfig: KThreesAgentConfig{NodeName: "server-0"},
+		},
+		{
+			name:        "machine name strategy",
+			agentConfig: KThreesAgentConfig{NodeNameStrategy: NodeNameStrategyMachineName},
+		},
+		{
+			name:        "machine name strategy with a node name",
+			agentConfig: KThreesAgentConfig{NodeNameStrategy: NodeNameStrategyMachineName, NodeName: "server-0"},
+			expectErr:   true,
+		},
+		{
+			name:        "template strategy",
+			agentConfig: KThreesAgentConfig{NodeNameStrategy: NodeNameStrategyTemplate, NodeName: "{{ .MachineName }}.{{ .ClusterName }}.internal"},
+		},
+		{
+			name:        "template strategy without a template",
+			agentConfig: KThreesAgentConfig{NodeNameStrategy: NodeNameStrategyTemplate},
+			expectErr:   true,
+		},
+		{
+			name:        "template strategy with an invalid template",
+			agentConfig: KThreesAgentConfig{NodeNameStrategy: NodeNameStrategyTemplate, NodeName: "{{ .MachineName "},
+			expectErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			spec := &KThreesConfigSpec{AgentConfig: tt.agentConfig}
+			errs := spec.Validate(field.NewPath("spec"), nil)
+			if tt.expectErr {
+				g.Expect(errs).NotTo(BeEmpty())
+			} else {
+				g.Expect(errs).To(BeEmpty())
+			}
+		})
+	}
+}
+
+func TestKThreesConfigSpecValidateResolvConf(t *testing.T) {
+	g := NewWithT(t)
+
+	spec := &KThreesConfigSpec{AgentConfig: KThreesAgentConfig{ResolvConf: &ResolvConf{Path: "/run/systemd/resolve/resolv.conf"}}}
+	g.Expect(spec.Validate(field.NewPath("spec"), nil)).To(BeEmpty())
+
+	spec.AgentConfig.ResolvConf.Path = "resolv.conf"
+	g.Expect(spec.Validate(field.NewPath("spec"), nil)).NotTo(BeEmpty())
+}
+
+func TestKThreesConfigSpecValidateServerURL(t *testing.T) {
+	g := NewWithT(t)
+
+	spec := &KThreesConfigSpec{AgentConfig: KThreesAgentConfig{ServerURL: "https://10.0.0.10:6443"}}
+	g.Expect(spec.Validate(field.NewPath("spec"), nil)).To(BeEmpty())
+
+	spec.AgentConfig.ServerURL = "10.0.0.10:6443"
+	g.Expect(spec.Validate(field.NewPath("spec"), nil)).NotTo(BeEmpty())
+
+	spec.AgentConfig.ServerURL = "http://10.0.0.10:6443"
+	g.Expect(spec.Validate(field.NewPath("spec"), nil)).NotTo(BeEmpty())
+}
+
+func TestKThreesConfigSpecValidateControllerManager(t *testing.T) {
+	tests := []struct {
+		name         string
+		serverConfig KThreesServerConfig
+		expectErr    bool
+	}{
+		{
+			name:         "node CIDR mask size within the default cluster CIDR",
+			serverConfig: KThreesServerConfig{ControllerManager: &ControllerManagerConfig{NodeCIDRMaskSize: ptr.To[int32](26)}},
+		},
+		{
+			name:         "node CIDR mask size larger than the cluster CIDR",
+			serverConfig: KThreesServerConfig{ClusterCidr: "10.0.0.0/20", ControllerManager: &ControllerManagerConfig{NodeCIDRMaskSize: ptr.To[int32](16)}},
+			expectErr:    true,
+		},
+		{
+			name:         "node CIDR mask size with a dual-stack cluster CIDR",
+			serverConfig: KThreesServerConfig{ClusterCidr: "10.42.0.0/16,2001:cafe:42::/56", ControllerManager: &ControllerManagerConfig{NodeCIDRMaskSize: ptr.To[int32](24)}},
+			expectErr:    true,
+		},
+		{
+			name:         "bind addresses",
+			serverConfig: KThreesServerConfig{ControllerManager: &ControllerManagerConfig{BindAddress: "0.0.0.0"}, Scheduler: &SchedulerConfig{BindAddress: "0.0.0.0"}},
+		},
+		{
+			name:         "invalid scheduler bind address",
+			serverConfig: KThreesServerConfig{Scheduler: &SchedulerConfig{BindAddress: "localhost"}},
+			expectErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			spec := &KThreesConfigSpec{ServerConfig: tt.serverConfig}
+			errs := spec.Validate(field.NewPath("spec"), nil)
+			if tt.expectErr {
+				g.Expect(errs).NotTo(BeEmpty())
+			} else {
+				g.Expect(errs).To(BeEmpty())
+			}
+		})
+	}
+}
+
+func TestKThreesConfigSpecValidateStaticPods(t *testing.T) {
+	tests := []struct {
+		name      string
+		manifest  string
+		expectErr bool
+	}{
+		{
+			name:     "pod",
+			manifest: "apiVersion: v1\nkind: Pod\nmetadata:\n  name: kube-vip\n  namespace: kube-system\n",
+		},
+		{
+			name:      "deployment",
+			manifest:  "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: kube-vip\n",
+			expectErr: true,
+		},
+		{
+			name:      "invalid YAML",
+			manifest:  "kind: [Pod",
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			spec := &KThreesConfigSpec{ServerConfig: KThreesServerConfig{StaticPods: []StaticPod{{Name: "kube-vip", Manifest: tt.manifest}}}}
+			errs := spec.Validate(field.NewPath("spec"), nil)
+			if tt.expectErr {
+				g.Expect(errs).NotTo(BeEmpty())
+			} else {
+				g.Expect(errs).To(BeEmpty())
+			}
+		})
+	}
+}
+
+func TestKThreesConfigSpecWarnings(t *testing.T) {
+	g := NewWithT(t)
+
+	spec := &KThreesConfigSpec{
+		ServerConfig: KThreesServerConfig{
+			DisableComponents: []string{"traefik", "servicelb"},
+			TLSCipherSuites:   []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+		},
+	}
+	g.Expect(spec.Warnings(field.NewPath("spec"))).To(BeEmpty())
+
+	spec.ServerConfig.DeprecatedDisableExternalCloudProvider = true
+	spec.ServerConfig.DisableComponents = append(spec.ServerConfig.DisableComponents, "coredns", "kube-proxy")
+	spec.ServerConfig.TLSCipherSuites = append(spec.ServerConfig.TLSCipherSuites, "TLS_RSA_WITH_RC4_128_SHA")
+	warnings := spec.Warnings(field.NewPath("spec"))
+	g.Expect(warnings).To(HaveLen(4))
+	g.Expect(warnings[0]).To(ContainSubstring("spec.serverConfig.disableExternalCloudProvider is deprecated"))
+	g.Expect(warnings[1]).To(ContainSubstring("spec.serverConfig.disableComponents[2]"))
+	g.Expect(warnings[2]).To(ContainSubstring(`"kube-proxy" is not a packaged k3s component`))
+	g.Expect(warnings[3]).To(ContainSubstring("spec.serverConfig.tlsCipherSuites[1]"))
+}
+
+func TestKThreesConfigTemplateValidate(t *testing.T) {
+	g := NewWithT(t)
+
+	template := &KThreesConfigTemplate{
+		Spec: KThreesConfigTemplateSpec{
+			Template: KThreesConfigTemplateResource{
+				Spec: KThreesConfigSpec{
+					ServerConfig: KThreesServerConfig{ClusterDNS: "coredns"},
+				},
+			},
+		},
+	}
+	_, err := template.ValidateCreate(context.Background(), template)
+	g.Expect(err).To(HaveOccurred())
+
+	template.Spec.Template.Spec.ServerConfig.ClusterDNS = "10.43.0.10"
+	_, err = template.ValidateCreate(context.Background(), template)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Expect(template.Default(context.Background(), template)).To(Succeed())
+	g.Expect(template.Spec.Template.Spec.ServerConfig.CloudProviderName).To(HaveValue(Equal("external")))
+}
@@ -18,8 +18,11 @@ package v1beta2
 
 import (
 	"context"
+	"fmt"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
@@ -40,13 +43,42 @@ var _ admission.CustomDefaulter = &KThreesConfigTemplate{}
 var _ admission.CustomValidator = &KThreesConfigTemplate{}
 
 // ValidateCreate will do any extra validation when creating a KThreesConfigTemplate.
-func (c *KThreesConfigTemplate) ValidateCreate(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
-	return []string{}, nil
+func (c *KThreesConfigTemplate) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	template, ok := obj.(*KThreesConfigTemplate)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a KThreesConfigTemplate but got a %T", obj))
+	}
+
+	return template.Spec.Template.Spec.Warnings(field.NewPath("spec", "template", "spec")), template.validate(nil)
 }
 
 // ValidateUpdate will do any extra validation when updating a KThreesConfigTemplate.
-func (c *KThreesConfigTemplate) ValidateUpdate(_ context.Context, _, _ runtime.Object) (admission.Warnings, error) {
-	return []string{}, nil
+func (c *KThreesConfigTemplate) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldTemplate, ok := oldObj.(*KThreesConfigTemplate)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a KThreesConfigTemplate but got a %T", oldObj))
+	}
+	template, ok := newObj.(*KThreesConfigTemplate)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a KThreesConfigTemplate but got a %T", newObj))
+	}
+
+	return template.Spec.Template.Spec.Warnings(field.NewPath("spec", "template", "spec")), template.validate(oldTemplate)
+}
+
+// validate runs the KThreesConfig validation on the spec of the template, so errors are caught
+// before machines are created from it; old is nil on create.
+func (c *KThreesConfigTemplate) validate(old *KThreesConfigTemplate) error {
+	var oldSpec *KThreesConfigSpec
+	if old != nil {
+		oldSpec = &old.Spec.Template.Spec
+	}
+	allErrs := c.Spec.Template.Spec.Validate(field.NewPath("spec", "template", "spec"), oldSpec)
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(GroupVersion.WithKind("KThreesConfigTemplate").GroupKind(), c.Name, allErrs)
 }
 
 // ValidateDelete allows you to add any extra validation when deleting.
@@ -55,6 +87,12 @@ func (c *KThreesConfigTemplate) ValidateDelete(_ context.Context, _ runtime.Obje
 }
 
 // Default will set default values for the KThreesConfigTemplate.
-func (c *KThreesConfigTemplate) Default(_ context.Context, _ runtime.Object) error {
+func (c *KThreesConfigTemplate) Default(_ context.Context, obj runtime.Object) error {
+	template, ok := obj.(*KThreesConfigTemplate)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected a KThreesConfigTemplate but got a %T", obj))
+	}
+
+	template.Spec.Template.Spec.Default()
 	return nil
 }
@@ -21,10 +21,112 @@ limitations under the License.
 package v1beta2
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/cluster-api/api/v1beta1"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AuditWebhook) DeepCopyInto(out *AuditWebhook) {
+	*out = *in
+	out.KubeconfigFrom = in.KubeconfigFrom
+	if in.InitialBackoff != nil {
+		in, out := &in.InitialBackoff, &out.InitialBackoff
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.BatchMaxSize != nil {
+		in, out := &in.BatchMaxSize, &out.BatchMaxSize
+		*out = new(int32)
+		**out = **in
+	}
+	if in.BatchMaxWait != nil {
+		in, out := &in.BatchMaxWait, &out.BatchMaxWait
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuditWebhook.
+func (in *AuditWebhook) DeepCopy() *AuditWebhook {
+	if in == nil {
+		return nil
+	}
+	out := new(AuditWebhook)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ControllerManagerConfig) DeepCopyInto(out *ControllerManagerConfig) {
+	*out = *in
+	if in.NodeCIDRMaskSize != nil {
+		in, out := &in.NodeCIDRMaskSize, &out.NodeCIDRMaskSize
+		*out = new(int32)
+		**out = **in
+	}
+	if in.NodeMonitorGracePeriod != nil {
+		in, out := &in.NodeMonitorGracePeriod, &out.NodeMonitorGracePeriod
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ControllerManagerConfig.
+func (in *ControllerManagerConfig) DeepCopy() *ControllerManagerConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ControllerManagerConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EtcdSnapshots) DeepCopyInto(out *EtcdSnapshots) {
+	*out = *in
+	if in.Retention != nil {
+		in, out := &in.Retention, &out.Retention
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxAge != nil {
+		in, out := &in.MaxAge, &out.MaxAge
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.S3 != nil {
+		in, out := &in.S3, &out.S3
+		*out = new(EtcdSnapshotsS3)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EtcdSnapshots.
+func (in *EtcdSnapshots) DeepCopy() *EtcdSnapshots {
+	if in == nil {
+		return nil
+	}
+	out := new(EtcdSnapshots)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EtcdSnapshotsS3) DeepCopyInto(out *EtcdSnapshotsS3) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EtcdSnapshotsS3.
+func (in *EtcdSnapshotsS3) DeepCopy() *EtcdSnapshotsS3 {
+	if in == nil {
+		return nil
+	}
+	out := new(EtcdSnapshotsS3)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *File) DeepCopyInto(out *File) {
 	*out = *in
@@ -61,6 +163,46 @@ func (in *FileSource) DeepCopy() *FileSource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HostPath) DeepCopyInto(out *HostPath) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HostPath.
+func (in *HostPath) DeepCopy() *HostPath {
+	if in == nil {
+		return nil
+	}
+	out := new(HostPath)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KMSEncryption) DeepCopyInto(out *KMSEncryption) {
+	*out = *in
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KMSEncryption.
+func (in *KMSEncryption) DeepCopy() *KMSEncryption {
+	if in == nil {
+		return nil
+	}
+	out := new(KMSEncryption)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KThreesAgentConfig) DeepCopyInto(out *KThreesAgentConfig) {
 	*out = *in
@@ -84,6 +226,16 @@ func (in *KThreesAgentConfig) DeepCopyInto(out *KThreesAgentConfig) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.VPNAuth != nil {
+		in, out := &in.VPNAuth, &out.VPNAuth
+		*out = new(VPNAuth)
+		**out = **in
+	}
+	if in.ResolvConf != nil {
+		in, out := &in.ResolvConf, &out.ResolvConf
+		*out = new(ResolvConf)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KThreesAgentConfig.
@@ -123,6 +275,21 @@ func (in *KThreesConfig) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KThreesConfigInitializationStatus) DeepCopyInto(out *KThreesConfigInitializationStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KThreesConfigInitializationStatus.
+func (in *KThreesConfigInitializationStatus) DeepCopy() *KThreesConfigInitializationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KThreesConfigInitializationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KThreesConfigList) DeepCopyInto(out *KThreesConfigList) {
 	*out = *in
@@ -177,6 +344,21 @@ func (in *KThreesConfigSpec) DeepCopyInto(out *KThreesConfigSpec) {
 	}
 	in.AgentConfig.DeepCopyInto(&out.AgentConfig)
 	in.ServerConfig.DeepCopyInto(&out.ServerConfig)
+	if in.ProvisioningTimeout != nil {
+		in, out := &in.ProvisioningTimeout, &out.ProvisioningTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.BootstrapDataTTL != nil {
+		in, out := &in.BootstrapDataTTL, &out.BootstrapDataTTL
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.LogLevel != nil {
+		in, out := &in.LogLevel, &out.LogLevel
+		*out = new(int32)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KThreesConfigSpec.
@@ -202,6 +384,11 @@ func (in *KThreesConfigStatus) DeepCopyInto(out *KThreesConfigStatus) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.Initialization != nil {
+		in, out := &in.Initialization, &out.Initialization
+		*out = new(KThreesConfigInitializationStatus)
+		**out = **in
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make(v1beta1.Conditions, len(*in))
@@ -349,6 +536,46 @@ func (in *KThreesServerConfig) DeepCopyInto(out *KThreesServerConfig) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.TLSCipherSuites != nil {
+		in, out := &in.TLSCipherSuites, &out.TLSCipherSuites
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.KMSEncryption != nil {
+		in, out := &in.KMSEncryption, &out.KMSEncryption
+		*out = new(KMSEncryption)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AuditWebhook != nil {
+		in, out := &in.AuditWebhook, &out.AuditWebhook
+		*out = new(AuditWebhook)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExtraHostPaths != nil {
+		in, out := &in.ExtraHostPaths, &out.ExtraHostPaths
+		*out = make([]HostPath, len(*in))
+		copy(*out, *in)
+	}
+	if in.EtcdSnapshots != nil {
+		in, out := &in.EtcdSnapshots, &out.EtcdSnapshots
+		*out = new(EtcdSnapshots)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ControllerManager != nil {
+		in, out := &in.ControllerManager, &out.ControllerManager
+		*out = new(ControllerManagerConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Scheduler != nil {
+		in, out := &in.Scheduler, &out.Scheduler
+		*out = new(SchedulerConfig)
+		**out = **in
+	}
+	if in.StaticPods != nil {
+		in, out := &in.StaticPods, &out.StaticPods
+		*out = make([]StaticPod, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KThreesServerConfig.
@@ -361,6 +588,36 @@ func (in *KThreesServerConfig) DeepCopy() *KThreesServerConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResolvConf) DeepCopyInto(out *ResolvConf) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResolvConf.
+func (in *ResolvConf) DeepCopy() *ResolvConf {
+	if in == nil {
+		return nil
+	}
+	out := new(ResolvConf)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SchedulerConfig) DeepCopyInto(out *SchedulerConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SchedulerConfig.
+func (in *SchedulerConfig) DeepCopy() *SchedulerConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(SchedulerConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SecretFileSource) DeepCopyInto(out *SecretFileSource) {
 	*out = *in
@@ -375,3 +632,34 @@ func (in *SecretFileSource) DeepCopy() *SecretFileSource {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StaticPod) DeepCopyInto(out *StaticPod) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StaticPod.
+func (in *StaticPod) DeepCopy() *StaticPod {
+	if in == nil {
+		return nil
+	}
+	out := new(StaticPod)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VPNAuth) DeepCopyInto(out *VPNAuth) {
+	*out = *in
+	out.JoinKeyFrom = in.JoinKeyFrom
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VPNAuth.
+func (in *VPNAuth) DeepCopy() *VPNAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(VPNAuth)
+	in.DeepCopyInto(out)
+	return out
+}
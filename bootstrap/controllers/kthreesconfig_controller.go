@@ -19,6 +19,7 @@ package controllers
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
@@ -51,6 +52,7 @@ import (
 	"github.com/k3s-io/cluster-api-k3s/pkg/locking"
 	"github.com/k3s-io/cluster-api-k3s/pkg/secret"
 	"github.com/k3s-io/cluster-api-k3s/pkg/token"
+	"github.com/k3s-io/cluster-api-k3s/pkg/versions"
 )
 
 // InitLocker is a lock that is used around k3s init.
@@ -156,6 +158,8 @@ func (r *KThreesConfigReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 			conditions.WithConditions(
 				bootstrapv1.DataSecretAvailableCondition,
 				bootstrapv1.CertificatesAvailableCondition,
+				bootstrapv1.TokenAvailableCondition,
+				bootstrapv1.JoinConfigurationValidCondition,
 			),
 		)
 
@@ -183,12 +187,18 @@ func (r *KThreesConfigReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	case configOwner.DataSecretName() != nil && (!config.Status.Ready || config.Status.DataSecretName == nil):
 		config.Status.Ready = true
 		config.Status.DataSecretName = configOwner.DataSecretName()
+		config.Status.Initialization = &bootstrapv1.KThreesConfigInitializationStatus{DataSecretCreated: true}
 		conditions.MarkTrue(config, bootstrapv1.DataSecretAvailableCondition)
 		return ctrl.Result{}, nil
 	// Status is ready means a config has been generated.
 	case config.Status.Ready:
-		// In any other case just return as the config is already generated and need not be generated again.
-		return ctrl.Result{}, nil
+		// In any other case just return as the config is already generated and need not be generated again,
+		// only checking that the node joins the cluster in time and that the bootstrap data does not go stale.
+		result, err := r.reconcileStaleBootstrapData(ctx, scope)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		return util.LowestNonZeroResult(result, r.reconcileProvisioningTimeout(scope)), nil
 	}
 
 	// Note: can't use IsFalse here because we need to handle the absence of the condition as well as false.
@@ -202,13 +212,82 @@ func (r *KThreesConfigReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	// Unlock any locks that might have been set during init process
 	r.KThreesInitLock.Unlock(ctx, cluster)
 
+	return reconcile.Result{}, r.join(ctx, scope)
+}
+
+// join generates the bootstrap data of a machine joining the initialized cluster.
+func (r *KThreesConfigReconciler) join(ctx context.Context, scope *Scope) error {
+	// it's a spare control plane join, which is not a control plane machine until it is promoted
+	if _, ok := scope.Config.Labels[bootstrapv1.SpareControlPlaneLabel]; ok {
+		return r.joinSpareControlplane(ctx, scope)
+	}
+
 	// it's a control plane join
-	if configOwner.IsControlPlaneMachine() {
-		return reconcile.Result{}, r.joinControlplane(ctx, scope)
+	if scope.ConfigOwner.IsControlPlaneMachine() {
+		return r.joinControlplane(ctx, scope)
 	}
 
 	// It's a worker join
-	return reconcile.Result{}, r.joinWorker(ctx, scope)
+	return r.joinWorker(ctx, scope)
+}
+
+// reconcileStaleBootstrapData regenerates the bootstrap data once older than spec.bootstrapDataTTL while the
+// infrastructure of the owner is not provisioned yet, so that machines provisioned late join with the current token
+// and control plane endpoint instead of stale ones.
+func (r *KThreesConfigReconciler) reconcileStaleBootstrapData(ctx context.Context, scope *Scope) (ctrl.Result, error) {
+	config := scope.Config
+	if config.Spec.BootstrapDataTTL == nil || config.Status.DataSecretName == nil || config.Status.FailureReason != "" ||
+		scope.ConfigOwner.IsInfrastructureReady() || scope.ConfigOwner.HasNodeRefs() ||
+		!conditions.IsTrue(scope.Cluster, clusterv1.ControlPlaneInitializedCondition) {
+		return ctrl.Result{}, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: config.Namespace, Name: *config.Status.DataSecretName}, secret); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to get bootstrap data secret for KThreesConfig %s/%s: %w", config.Namespace, config.Name, err)
+	}
+
+	// Secrets created before the annotation was introduced fall back to their creation time.
+	generated := secret.CreationTimestamp.Time
+	if t, err := time.Parse(time.RFC3339, secret.Annotations[bootstrapv1.DataSecretGeneratedAnnotation]); err == nil {
+		generated = t
+	}
+
+	ttl := config.Spec.BootstrapDataTTL.Duration
+	if elapsed := time.Since(generated); elapsed < ttl {
+		return ctrl.Result{RequeueAfter: ttl - elapsed}, nil
+	}
+
+	scope.Info("Regenerating stale bootstrap data", "ttl", ttl, "generated", generated)
+	if err := r.join(ctx, scope); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: ttl}, nil
+}
+
+// reconcileProvisioningTimeout marks the config as failed when the node of its owner did not join the cluster within
+// spec.provisioningTimeout after the bootstrap data became available. The failure is reported on the owner machine by
+// Cluster API, so that it can be remediated instead of waiting indefinitely for a join that will never complete.
+func (r *KThreesConfigReconciler) reconcileProvisioningTimeout(scope *Scope) ctrl.Result {
+	config := scope.Config
+	if config.Spec.ProvisioningTimeout == nil || config.Status.FailureReason != "" || scope.ConfigOwner.HasNodeRefs() {
+		return ctrl.Result{}
+	}
+
+	dataSecretAvailable := conditions.Get(config, bootstrapv1.DataSecretAvailableCondition)
+	if dataSecretAvailable == nil || dataSecretAvailable.Status != corev1.ConditionTrue {
+		return ctrl.Result{}
+	}
+
+	timeout := config.Spec.ProvisioningTimeout.Duration
+	if elapsed := time.Since(dataSecretAvailable.LastTransitionTime.Time); elapsed < timeout {
+		return ctrl.Result{RequeueAfter: timeout - elapsed}
+	}
+
+	scope.Info("Node did not join the cluster within the provisioning timeout", "timeout", timeout)
+	config.Status.FailureReason = bootstrapv1.ProvisioningTimeoutReason
+	config.Status.FailureMessage = fmt.Sprintf("node of %s %s did not join the cluster within %s", scope.ConfigOwner.GetKind(), scope.ConfigOwner.GetName(), timeout)
+	return ctrl.Result{}
 }
 
 func (r *KThreesConfigReconciler) joinControlplane(ctx context.Context, scope *Scope) error {
@@ -220,18 +299,24 @@ func (r *KThreesConfigReconciler) joinControlplane(ctx context.Context, scope *S
 	// injects into config.Version values from top level object
 	r.reconcileTopLevelObjectSettings(scope.Cluster, machine, scope.Config)
 
-	serverURL := fmt.Sprintf("https://%s", scope.Cluster.Spec.ControlPlaneEndpoint.String())
+	serverURL := k3s.ServerURL(scope.Cluster.Spec.ControlPlaneEndpoint)
 
-	tokn, err := token.Lookup(ctx, r.Client, client.ObjectKeyFromObject(scope.Cluster))
+	tokn, err := r.lookupToken(ctx, scope)
 	if err != nil {
-		conditions.MarkFalse(scope.Config, bootstrapv1.DataSecretAvailableCondition, bootstrapv1.DataSecretGenerationFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return err
+	}
+
+	agentConfig, err := resolveAgentConfig(scope, machine)
+	if err != nil {
+		markJoinConfigurationInvalid(scope.Config, err)
 		return err
 	}
 
 	configStruct := k3s.GenerateJoinControlPlaneConfig(serverURL, *tokn,
 		scope.Cluster.Spec.ControlPlaneEndpoint.Host,
 		scope.Config.Spec.ServerConfig,
-		scope.Config.Spec.AgentConfig)
+		agentConfig)
+	configStruct.SetLogging(scope.Config.Spec)
 	b, err := kubeyaml.Marshal(configStruct)
 	if err != nil {
 		return err
@@ -244,43 +329,201 @@ func (r *KThreesConfigReconciler) joinControlplane(ctx context.Context, scope *S
 		Permissions: "0640",
 	}
 
-	files, err := r.resolveFiles(ctx, scope.Config)
+	files, err := r.resolveJoinControlPlaneFiles(ctx, scope)
 	if err != nil {
-		conditions.MarkFalse(scope.Config, bootstrapv1.DataSecretAvailableCondition, bootstrapv1.DataSecretGenerationFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
 		return err
 	}
+	files = append(files, k3s.GenerateStaticPodFiles(scope.Config.Spec.ServerConfig, k3s.StaticPodManifestsLocation)...)
+
+	cpInput := &cloudinit.ControlPlaneInput{
+		BaseUserData: cloudinit.BaseUserData{
+			PreK3sCommands:             scope.Config.Spec.PreK3sCommands,
+			PostK3sCommands:            scope.Config.Spec.PostK3sCommands,
+			AdditionalFiles:            files,
+			ConfigFile:                 workerConfigFile,
+			K3sVersion:                 scope.Config.Spec.Version,
+			AirGapped:                  scope.Config.Spec.AgentConfig.AirGapped,
+			AirGappedInstallScriptPath: scope.Config.Spec.AgentConfig.AirGappedInstallScriptPath,
+			Docker:                     scope.Config.Spec.AgentConfig.Docker,
+			Debug:                      scope.Config.Spec.Debug,
+			ExtraHostPaths:             scope.Config.Spec.ServerConfig.ExtraHostPaths,
+		},
+	}
+
+	cloudInitData, err := cloudinit.NewJoinControlPlane(cpInput)
+	if err != nil {
+		return err
+	}
+
+	if err := r.storeBootstrapData(ctx, scope, cloudInitData, k3s.NodeConfigFiles(workerConfigFile, files, agentConfig)); err != nil {
+		scope.Error(err, "Failed to store bootstrap data")
+		return err
+	}
+	return nil
+}
+
+// lookupToken returns the cluster token, reporting its availability with the TokenAvailable condition.
+func (r *KThreesConfigReconciler) lookupToken(ctx context.Context, scope *Scope) (*string, error) {
+	tokn, err := token.Lookup(ctx, r.Client, client.ObjectKeyFromObject(scope.Cluster))
+	if err != nil {
+		conditions.MarkFalse(scope.Config, bootstrapv1.TokenAvailableCondition, bootstrapv1.TokenLookupFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		conditions.MarkFalse(scope.Config, bootstrapv1.DataSecretAvailableCondition, bootstrapv1.DataSecretGenerationFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return nil, err
+	}
+
+	conditions.MarkTrue(scope.Config, bootstrapv1.TokenAvailableCondition)
+	return tokn, nil
+}
+
+// resolveAgentConfig returns the agent config of the machine, with the node name resolved according to its node name strategy.
+func resolveAgentConfig(scope *Scope, machine *clusterv1.Machine) (bootstrapv1.KThreesAgentConfig, error) {
+	agentConfig := *scope.Config.Spec.AgentConfig.DeepCopy()
+	nodeName, err := k3s.NodeName(agentConfig, machine.Name, scope.Cluster.Name, machine.Namespace)
+	if err != nil {
+		return agentConfig, err
+	}
+	agentConfig.NodeName = nodeName
+	return agentConfig, nil
+}
+
+// markJoinConfigurationInvalid reports a join configuration that cannot be resolved, e.g. because a referenced
+// secret does not exist, which also prevents the bootstrap data from being generated.
+func markJoinConfigurationInvalid(config *bootstrapv1.KThreesConfig, err error) {
+	conditions.MarkFalse(config, bootstrapv1.JoinConfigurationValidCondition, bootstrapv1.JoinConfigurationInvalidReason, clusterv1.ConditionSeverityWarning, err.Error())
+	conditions.MarkFalse(config, bootstrapv1.DataSecretAvailableCondition, bootstrapv1.DataSecretGenerationFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+}
+
+// resolveJoinControlPlaneFiles returns the files written on servers joining the cluster.
+func (r *KThreesConfigReconciler) resolveJoinControlPlaneFiles(ctx context.Context, scope *Scope) ([]bootstrapv1.File, error) {
+	files, err := r.resolveFiles(ctx, scope.Config)
+	if err != nil {
+		markJoinConfigurationInvalid(scope.Config, err)
+		return nil, err
+	}
+
+	kmsFiles, err := k3s.GenerateKMSEncryptionFiles(scope.Config.Spec.ServerConfig)
+	if err != nil {
+		markJoinConfigurationInvalid(scope.Config, err)
+		return nil, err
+	}
+	files = append(files, kmsFiles...)
+
+	if scope.Config.Spec.ServerConfig.AuditWebhook != nil {
+		auditWebhookFile, err := r.resolveAuditWebhookFile(ctx, scope.Config)
+		if err != nil {
+			markJoinConfigurationInvalid(scope.Config, err)
+			return nil, err
+		}
+		files = append(files, *auditWebhookFile)
+	}
 
 	if scope.Config.Spec.IsEtcdEmbedded() {
 		etcdProxyFile, err := r.resolveEtcdProxyFile(scope.Config)
 		if err != nil {
-			conditions.MarkFalse(scope.Config, bootstrapv1.DataSecretAvailableCondition, bootstrapv1.DataSecretGenerationFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
-			return fmt.Errorf("failed to resolve etcd proxy file: %w", err)
+			markJoinConfigurationInvalid(scope.Config, err)
+			return nil, fmt.Errorf("failed to resolve etcd proxy file: %w", err)
 		}
 
 		files = append(files, *etcdProxyFile)
 	}
 
-	cpInput := &cloudinit.ControlPlaneInput{
+	conditions.MarkTrue(scope.Config, bootstrapv1.JoinConfigurationValidCondition)
+	return files, nil
+}
+
+// joinSpareControlplane bootstraps a spare control plane machine: it joins as an agent, with the server
+// configuration and files staged so it can be promoted to a server without provisioning a new machine.
+func (r *KThreesConfigReconciler) joinSpareControlplane(ctx context.Context, scope *Scope) error {
+	machine := &clusterv1.Machine{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(scope.ConfigOwner.Object, machine); err != nil {
+		return fmt.Errorf("cannot convert %s to Machine: %w", scope.ConfigOwner.GetKind(), err)
+	}
+
+	// injects into config.Version values from top level object
+	r.reconcileTopLevelObjectSettings(scope.Cluster, machine, scope.Config)
+
+	serverURL := k3s.ServerURL(scope.Cluster.Spec.ControlPlaneEndpoint)
+
+	tokn, err := r.lookupToken(ctx, scope)
+	if err != nil {
+		return err
+	}
+
+	resolvedAgentConfig, err := resolveAgentConfig(scope, machine)
+	if err != nil {
+		markJoinConfigurationInvalid(scope.Config, err)
+		return err
+	}
+
+	spareAgentConfig := k3s.GenerateSpareAgentConfig(serverURL, *tokn, scope.Config.Spec.ServerConfig, resolvedAgentConfig)
+	spareAgentConfig.SetLogging(scope.Config.Spec)
+	agentConfig, err := kubeyaml.Marshal(spareAgentConfig)
+	if err != nil {
+		return err
+	}
+
+	spareServerConfig := k3s.GenerateJoinControlPlaneConfig(serverURL, *tokn,
+		scope.Cluster.Spec.ControlPlaneEndpoint.Host,
+		scope.Config.Spec.ServerConfig,
+		resolvedAgentConfig)
+	spareServerConfig.SetLogging(scope.Config.Spec)
+	serverConfig, err := kubeyaml.Marshal(spareServerConfig)
+	if err != nil {
+		return err
+	}
+
+	files, err := r.resolveJoinControlPlaneFiles(ctx, scope)
+	if err != nil {
+		return err
+	}
+	// The static pods are staged with the server configuration, to only run once the machine is promoted.
+	files = append(files, k3s.GenerateStaticPodFiles(scope.Config.Spec.ServerConfig, k3s.SpareStaticPodManifestsLocation)...)
+	files = append(files,
+		bootstrapv1.File{
+			Path:        k3s.SpareConfigLocation,
+			Content:     string(serverConfig),
+			Owner:       "root:root",
+			Permissions: "0640",
+		},
+		bootstrapv1.File{
+			Path:        k3s.SparePromotionScriptLocation,
+			Content:     k3s.GenerateSparePromotionScript(resolvedAgentConfig),
+			Owner:       "root:root",
+			Permissions: "0750",
+		},
+	)
+
+	winput := &cloudinit.WorkerInput{
 		BaseUserData: cloudinit.BaseUserData{
-			PreK3sCommands:             scope.Config.Spec.PreK3sCommands,
-			PostK3sCommands:            scope.Config.Spec.PostK3sCommands,
-			AdditionalFiles:            files,
-			ConfigFile:                 workerConfigFile,
+			PreK3sCommands:  scope.Config.Spec.PreK3sCommands,
+			PostK3sCommands: scope.Config.Spec.PostK3sCommands,
+			AdditionalFiles: files,
+			ConfigFile: bootstrapv1.File{
+				Path:        k3s.DefaultK3sConfigLocation,
+				Content:     string(agentConfig),
+				Owner:       "root:root",
+				Permissions: "0640",
+			},
 			K3sVersion:                 scope.Config.Spec.Version,
 			AirGapped:                  scope.Config.Spec.AgentConfig.AirGapped,
 			AirGappedInstallScriptPath: scope.Config.Spec.AgentConfig.AirGappedInstallScriptPath,
+			Docker:                     scope.Config.Spec.AgentConfig.Docker,
+			Debug:                      scope.Config.Spec.Debug,
+			ExtraHostPaths:             scope.Config.Spec.ServerConfig.ExtraHostPaths,
 		},
 	}
 
-	cloudInitData, err := cloudinit.NewJoinControlPlane(cpInput)
+	cloudInitData, err := cloudinit.NewWorker(winput)
 	if err != nil {
 		return err
 	}
 
-	if err := r.storeBootstrapData(ctx, scope, cloudInitData); err != nil {
+	// The k3s configuration of a spare machine is replaced when it is promoted, so its drift is not detected.
+	if err := r.storeBootstrapData(ctx, scope, cloudInitData, nil); err != nil {
 		scope.Error(err, "Failed to store bootstrap data")
 		return err
 	}
+
 	return nil
 }
 
@@ -293,15 +536,24 @@ func (r *KThreesConfigReconciler) joinWorker(ctx context.Context, scope *Scope)
 	// injects into config.Version values from top level object
 	r.reconcileTopLevelObjectSettings(scope.Cluster, machine, scope.Config)
 
-	serverURL := fmt.Sprintf("https://%s", scope.Cluster.Spec.ControlPlaneEndpoint.String())
+	serverURL := k3s.ServerURL(scope.Cluster.Spec.ControlPlaneEndpoint)
+	if scope.Config.Spec.AgentConfig.ServerURL != "" {
+		serverURL = scope.Config.Spec.AgentConfig.ServerURL
+	}
 
-	tokn, err := token.Lookup(ctx, r.Client, client.ObjectKeyFromObject(scope.Cluster))
+	tokn, err := r.lookupToken(ctx, scope)
 	if err != nil {
-		conditions.MarkFalse(scope.Config, bootstrapv1.DataSecretAvailableCondition, bootstrapv1.DataSecretGenerationFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
 		return err
 	}
 
-	configStruct := k3s.GenerateWorkerConfig(serverURL, *tokn, scope.Config.Spec.ServerConfig, scope.Config.Spec.AgentConfig)
+	agentConfig, err := resolveAgentConfig(scope, machine)
+	if err != nil {
+		markJoinConfigurationInvalid(scope.Config, err)
+		return err
+	}
+
+	configStruct := k3s.GenerateWorkerConfig(serverURL, *tokn, scope.Config.Spec.ServerConfig, agentConfig)
+	configStruct.SetLogging(scope.Config.Spec)
 
 	b, err := kubeyaml.Marshal(configStruct)
 	if err != nil {
@@ -317,9 +569,10 @@ func (r *KThreesConfigReconciler) joinWorker(ctx context.Context, scope *Scope)
 
 	files, err := r.resolveFiles(ctx, scope.Config)
 	if err != nil {
-		conditions.MarkFalse(scope.Config, bootstrapv1.DataSecretAvailableCondition, bootstrapv1.DataSecretGenerationFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		markJoinConfigurationInvalid(scope.Config, err)
 		return err
 	}
+	conditions.MarkTrue(scope.Config, bootstrapv1.JoinConfigurationValidCondition)
 
 	winput := &cloudinit.WorkerInput{
 		BaseUserData: cloudinit.BaseUserData{
@@ -330,6 +583,8 @@ func (r *KThreesConfigReconciler) joinWorker(ctx context.Context, scope *Scope)
 			K3sVersion:                 scope.Config.Spec.Version,
 			AirGapped:                  scope.Config.Spec.AgentConfig.AirGapped,
 			AirGappedInstallScriptPath: scope.Config.Spec.AgentConfig.AirGappedInstallScriptPath,
+			Docker:                     scope.Config.Spec.AgentConfig.Docker,
+			Debug:                      scope.Config.Spec.Debug,
 		},
 	}
 
@@ -338,7 +593,7 @@ func (r *KThreesConfigReconciler) joinWorker(ctx context.Context, scope *Scope)
 		return err
 	}
 
-	if err := r.storeBootstrapData(ctx, scope, cloudInitData); err != nil {
+	if err := r.storeBootstrapData(ctx, scope, cloudInitData, k3s.NodeConfigFiles(workerConfigFile, files, agentConfig)); err != nil {
 		scope.Error(err, "Failed to store bootstrap data")
 		return err
 	}
@@ -347,7 +602,7 @@ func (r *KThreesConfigReconciler) joinWorker(ctx context.Context, scope *Scope)
 }
 
 // resolveFiles maps .Spec.Files into cloudinit.Files, resolving any object references
-// along the way.
+// along the way. The VPN authentication file, needed by all the nodes, is added too.
 func (r *KThreesConfigReconciler) resolveFiles(ctx context.Context, cfg *bootstrapv1.KThreesConfig) ([]bootstrapv1.File, error) {
 	collected := make([]bootstrapv1.File, 0, len(cfg.Spec.Files))
 
@@ -364,6 +619,23 @@ func (r *KThreesConfigReconciler) resolveFiles(ctx context.Context, cfg *bootstr
 		collected = append(collected, in)
 	}
 
+	if cfg.Spec.AgentConfig.VPNAuth != nil {
+		vpnAuthFile, err := r.resolveVPNAuthFile(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		collected = append(collected, *vpnAuthFile)
+	}
+
+	if resolvConf := cfg.Spec.AgentConfig.ResolvConf; resolvConf != nil && resolvConf.Content != "" {
+		collected = append(collected, bootstrapv1.File{
+			Path:        resolvConf.Path,
+			Owner:       "root:root",
+			Permissions: "0644",
+			Content:     resolvConf.Content,
+		})
+	}
+
 	return collected, nil
 }
 
@@ -384,6 +656,47 @@ func (r *KThreesConfigReconciler) resolveSecretFileContent(ctx context.Context,
 	return data, nil
 }
 
+// resolveAuditWebhookFile returns the audit webhook kubeconfig file, fetched from the referenced secret.
+func (r *KThreesConfigReconciler) resolveAuditWebhookFile(ctx context.Context, cfg *bootstrapv1.KThreesConfig) (*bootstrapv1.File, error) {
+	file := bootstrapv1.File{
+		Path:        k3s.AuditWebhookConfigLocation,
+		Owner:       "root:root",
+		Permissions: "0600",
+		ContentFrom: &bootstrapv1.FileSource{
+			Secret: cfg.Spec.ServerConfig.AuditWebhook.KubeconfigFrom,
+		},
+	}
+
+	data, err := r.resolveSecretFileContent(ctx, cfg.Namespace, file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve audit webhook kubeconfig: %w", err)
+	}
+	file.ContentFrom = nil
+	file.Content = string(data)
+
+	return &file, nil
+}
+
+// resolveVPNAuthFile returns the VPN authentication file, with the join key fetched from the referenced secret.
+func (r *KThreesConfigReconciler) resolveVPNAuthFile(ctx context.Context, cfg *bootstrapv1.KThreesConfig) (*bootstrapv1.File, error) {
+	vpnAuth := cfg.Spec.AgentConfig.VPNAuth
+	joinKey, err := r.resolveSecretFileContent(ctx, cfg.Namespace, bootstrapv1.File{
+		ContentFrom: &bootstrapv1.FileSource{
+			Secret: vpnAuth.JoinKeyFrom,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve VPN join key: %w", err)
+	}
+
+	return &bootstrapv1.File{
+		Path:        k3s.VPNAuthLocation,
+		Content:     k3s.GenerateVPNAuth(*vpnAuth, string(joinKey)),
+		Owner:       "root:root",
+		Permissions: "0600",
+	}, nil
+}
+
 func (r *KThreesConfigReconciler) resolveEtcdProxyFile(cfg *bootstrapv1.KThreesConfig) (*bootstrapv1.File, error) {
 	// Parse the template
 	tpl, err := template.New("etcd-proxy").Parse(etcd.EtcdProxyDaemonsetYamlTemplate)
@@ -400,9 +713,10 @@ func (r *KThreesConfigReconciler) resolveEtcdProxyFile(cfg *bootstrapv1.KThreesC
 	// Render the template, the image name will be ${EtcdProxyImage} if the user
 	// has set it, otherwise it will be ${SystemDefaultRegistry}alpine/socat
 	var buf bytes.Buffer
-	err = tpl.Execute(&buf, map[string]string{
+	err = tpl.Execute(&buf, map[string]interface{}{
 		"EtcdProxyImage":        cfg.Spec.ServerConfig.EtcdProxyImage,
 		"SystemDefaultRegistry": systemDefaultRegistry,
+		"IPv6":                  k3s.IsIPv6Only(cfg.Spec.ServerConfig.ServiceCidr),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to render etcd-proxy template: %w", err)
@@ -469,8 +783,14 @@ func (r *KThreesConfigReconciler) handleClusterNotInitialized(ctx context.Contex
 	}
 	conditions.MarkTrue(scope.Config, bootstrapv1.CertificatesAvailableCondition)
 
-	token, err := token.Lookup(ctx, r.Client, client.ObjectKeyFromObject(scope.Cluster))
+	token, err := r.lookupToken(ctx, scope)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	agentConfig, err := resolveAgentConfig(scope, machine)
 	if err != nil {
+		conditions.MarkFalse(scope.Config, bootstrapv1.DataSecretAvailableCondition, bootstrapv1.DataSecretGenerationFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
 		return ctrl.Result{}, err
 	}
 
@@ -480,7 +800,8 @@ func (r *KThreesConfigReconciler) handleClusterNotInitialized(ctx context.Contex
 		scope.Cluster.Spec.ControlPlaneEndpoint.Host,
 		*token,
 		scope.Config.Spec.ServerConfig,
-		scope.Config.Spec.AgentConfig)
+		agentConfig)
+	configStruct.SetLogging(scope.Config.Spec)
 
 	b, err := kubeyaml.Marshal(configStruct)
 	if err != nil {
@@ -500,6 +821,22 @@ func (r *KThreesConfigReconciler) handleClusterNotInitialized(ctx context.Contex
 		return ctrl.Result{}, err
 	}
 
+	kmsFiles, err := k3s.GenerateKMSEncryptionFiles(scope.Config.Spec.ServerConfig)
+	if err != nil {
+		conditions.MarkFalse(scope.Config, bootstrapv1.DataSecretAvailableCondition, bootstrapv1.DataSecretGenerationFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return ctrl.Result{}, err
+	}
+	files = append(files, kmsFiles...)
+
+	if scope.Config.Spec.ServerConfig.AuditWebhook != nil {
+		auditWebhookFile, err := r.resolveAuditWebhookFile(ctx, scope.Config)
+		if err != nil {
+			conditions.MarkFalse(scope.Config, bootstrapv1.DataSecretAvailableCondition, bootstrapv1.DataSecretGenerationFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+			return ctrl.Result{}, err
+		}
+		files = append(files, *auditWebhookFile)
+	}
+
 	if scope.Config.Spec.IsEtcdEmbedded() {
 		etcdProxyFile, err := r.resolveEtcdProxyFile(scope.Config)
 		if err != nil {
@@ -509,6 +846,8 @@ func (r *KThreesConfigReconciler) handleClusterNotInitialized(ctx context.Contex
 		files = append(files, *etcdProxyFile)
 	}
 
+	files = append(files, k3s.GenerateStaticPodFiles(scope.Config.Spec.ServerConfig, k3s.StaticPodManifestsLocation)...)
+
 	cpinput := &cloudinit.ControlPlaneInput{
 		BaseUserData: cloudinit.BaseUserData{
 			PreK3sCommands:             scope.Config.Spec.PreK3sCommands,
@@ -518,6 +857,9 @@ func (r *KThreesConfigReconciler) handleClusterNotInitialized(ctx context.Contex
 			K3sVersion:                 scope.Config.Spec.Version,
 			AirGapped:                  scope.Config.Spec.AgentConfig.AirGapped,
 			AirGappedInstallScriptPath: scope.Config.Spec.AgentConfig.AirGappedInstallScriptPath,
+			Docker:                     scope.Config.Spec.AgentConfig.Docker,
+			Debug:                      scope.Config.Spec.Debug,
+			ExtraHostPaths:             scope.Config.Spec.ServerConfig.ExtraHostPaths,
 		},
 		Certificates: certificates,
 	}
@@ -527,7 +869,7 @@ func (r *KThreesConfigReconciler) handleClusterNotInitialized(ctx context.Contex
 		return ctrl.Result{}, err
 	}
 
-	if err := r.storeBootstrapData(ctx, scope, cloudInitData); err != nil {
+	if err := r.storeBootstrapData(ctx, scope, cloudInitData, k3s.NodeConfigFiles(initConfigFile, files, agentConfig)); err != nil {
 		scope.Error(err, "Failed to store bootstrap data")
 		return ctrl.Result{}, err
 	}
@@ -546,9 +888,9 @@ func (r *KThreesConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Complete(r)
 }
 
-// storeBootstrapData creates a new secret with the data passed in as input,
-// sets the reference in the configuration status and ready to true.
-func (r *KThreesConfigReconciler) storeBootstrapData(ctx context.Context, scope *Scope, data []byte) error {
+// storeBootstrapData creates a new secret with the data passed in as input, along with the k3s configuration
+// files of the node if any, sets the reference in the configuration status and ready to true.
+func (r *KThreesConfigReconciler) storeBootstrapData(ctx context.Context, scope *Scope, data []byte, nodeConfigFiles []bootstrapv1.File) error {
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      scope.Config.Name,
@@ -556,6 +898,9 @@ func (r *KThreesConfigReconciler) storeBootstrapData(ctx context.Context, scope
 			Labels: map[string]string{
 				clusterv1.ClusterNameLabel: scope.Cluster.Name,
 			},
+			Annotations: map[string]string{
+				bootstrapv1.DataSecretGeneratedAnnotation: time.Now().UTC().Format(time.RFC3339),
+			},
 			OwnerReferences: []metav1.OwnerReference{
 				{
 					APIVersion: bootstrapv1.GroupVersion.String(),
@@ -572,6 +917,14 @@ func (r *KThreesConfigReconciler) storeBootstrapData(ctx context.Context, scope
 		Type: clusterv1.ClusterSecretType,
 	}
 
+	if len(nodeConfigFiles) > 0 {
+		b, err := json.Marshal(nodeConfigFiles)
+		if err != nil {
+			return fmt.Errorf("failed to marshal the k3s configuration files of KThreesConfig %s/%s: %w", scope.Config.Namespace, scope.Config.Name, err)
+		}
+		secret.Data[bootstrapv1.NodeConfigFilesSecretKey] = b
+	}
+
 	// as secret creation and scope.Config status patch are not atomic operations
 	// it is possible that secret creation happens but the config.Status patches are not applied
 	if err := r.Client.Create(ctx, secret); err != nil {
@@ -586,11 +939,12 @@ func (r *KThreesConfigReconciler) storeBootstrapData(ctx context.Context, scope
 
 	scope.Config.Status.DataSecretName = ptr.To[string](secret.Name)
 	scope.Config.Status.Ready = true
+	scope.Config.Status.Initialization = &bootstrapv1.KThreesConfigInitializationStatus{DataSecretCreated: true}
 	conditions.MarkTrue(scope.Config, bootstrapv1.DataSecretAvailableCondition)
 	return nil
 }
 
-func (r *KThreesConfigReconciler) reconcileTopLevelObjectSettings(_ *clusterv1.Cluster, machine *clusterv1.Machine, config *bootstrapv1.KThreesConfig) {
+func (r *KThreesConfigReconciler) reconcileTopLevelObjectSettings(cluster *clusterv1.Cluster, machine *clusterv1.Machine, config *bootstrapv1.KThreesConfig) {
 	log := r.Log.WithValues("kthreesconfig", fmt.Sprintf("%s/%s", config.Namespace, config.Name))
 
 	// If there are no Version settings defined in Config, use Version from machine, if defined
@@ -598,4 +952,36 @@ func (r *KThreesConfigReconciler) reconcileTopLevelObjectSettings(_ *clusterv1.C
 		config.Spec.Version = *machine.Spec.Version
 		log.Info("Altering Config", "Version", config.Spec.Version)
 	}
+
+	// Plain Kubernetes versions, e.g. set on workers by ClusterClass topologies, are not k3s releases;
+	// resolve them to their first k3s build, like the KThreesControlPlane does by default.
+	if config.Spec.Version != "" {
+		resolved, err := versions.ResolveK3sBuild(config.Spec.Version, false)
+		if err != nil {
+			log.Error(err, "Failed to resolve the k3s version", "Version", config.Spec.Version)
+		} else if resolved != config.Spec.Version {
+			config.Spec.Version = resolved
+			log.Info("Altering Config", "Version", config.Spec.Version)
+		}
+	}
+
+	// k3s defaults to IPv4 pod and service CIDRs, so IPv6-only cluster networks
+	// have to be passed down explicitly.
+	if cluster.Spec.ClusterNetwork == nil {
+		return
+	}
+
+	if config.Spec.ServerConfig.ClusterCidr == "" && cluster.Spec.ClusterNetwork.Pods != nil {
+		if cidrs := cluster.Spec.ClusterNetwork.Pods.String(); k3s.IsIPv6Only(cidrs) {
+			config.Spec.ServerConfig.ClusterCidr = cidrs
+			log.Info("Altering Config", "ClusterCidr", config.Spec.ServerConfig.ClusterCidr)
+		}
+	}
+
+	if config.Spec.ServerConfig.ServiceCidr == "" && cluster.Spec.ClusterNetwork.Services != nil {
+		if cidrs := cluster.Spec.ClusterNetwork.Services.String(); k3s.IsIPv6Only(cidrs) {
+			config.Spec.ServerConfig.ServiceCidr = cidrs
+			log.Info("Altering Config", "ServiceCidr", config.Spec.ServerConfig.ServiceCidr)
+		}
+	}
 }
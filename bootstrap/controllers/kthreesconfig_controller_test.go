@@ -17,9 +17,21 @@ limitations under the License.
 package controllers
 
 import (
+	"context"
 	"testing"
+	"time"
 
+	"github.com/go-logr/logr"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	bsutil "sigs.k8s.io/cluster-api/bootstrap/util"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	bootstrapv1 "github.com/k3s-io/cluster-api-k3s/bootstrap/api/v1beta2"
 )
@@ -52,4 +64,227 @@ func TestKThreesConfigReconciler_ResolveEtcdProxyFile(t *testing.T) {
 	etcdProxyFile, err = r.resolveEtcdProxyFile(config2)
 	g.Expect(err).ToNot(HaveOccurred())
 	g.Expect(etcdProxyFile.Content).To(ContainSubstring("system-default-registry2/"), "generated etcd proxy image should be prefixed with SystemDefaultRegistry")
+	g.Expect(etcdProxyFile.Content).To(ContainSubstring("TCP4:$(HOSTIP):2379"), "etcd proxy should forward over IPv4 by default")
+
+	// If the service CIDR is IPv6-only, the etcd proxy should forward over IPv6
+	config3 := &bootstrapv1.KThreesConfig{
+		Spec: bootstrapv1.KThreesConfigSpec{
+			ServerConfig: bootstrapv1.KThreesServerConfig{
+				ServiceCidr: "fd00:43::/112",
+			},
+		},
+	}
+	etcdProxyFile, err = r.resolveEtcdProxyFile(config3)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(etcdProxyFile.Content).To(ContainSubstring("TCP6-LISTEN:2379"), "etcd proxy should listen on IPv6")
+	g.Expect(etcdProxyFile.Content).To(ContainSubstring("TCP6:[$(HOSTIP)]:2379"), "etcd proxy should bracket the IPv6 host IP")
+}
+
+func TestKThreesConfigReconciler_ResolveVPNAuthFile(t *testing.T) {
+	g := NewWithT(t)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "tailscale", Namespace: "default"},
+		Data:       map[string][]byte{"authkey": []byte("tskey-auth-xyz\n")},
+	}
+	config := &bootstrapv1.KThreesConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "default"},
+		Spec: bootstrapv1.KThreesConfigSpec{
+			AgentConfig: bootstrapv1.KThreesAgentConfig{
+				VPNAuth: &bootstrapv1.VPNAuth{
+					JoinKeyFrom:      bootstrapv1.SecretFileSource{Name: "tailscale", Key: "authkey"},
+					ControlServerURL: "https://headscale.example.com",
+				},
+			},
+		},
+	}
+	r := &KThreesConfigReconciler{Client: fake.NewClientBuilder().WithObjects(secret).Build()}
+
+	files, err := r.resolveFiles(context.TODO(), config)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(files).To(HaveLen(1))
+	g.Expect(files[0].Path).To(Equal("/etc/rancher/k3s/vpn-auth"))
+	g.Expect(files[0].Permissions).To(Equal("0600"))
+	g.Expect(files[0].Content).To(Equal("name=tailscale,joinKey=tskey-auth-xyz,controlServerURL=https://headscale.example.com"))
+
+	// A missing secret key is an error
+	config.Spec.AgentConfig.VPNAuth.JoinKeyFrom.Key = "missing"
+	_, err = r.resolveFiles(context.TODO(), config)
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestKThreesConfigReconciler_ResolveAuditWebhookFile(t *testing.T) {
+	g := NewWithT(t)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "audit-webhook", Namespace: "default"},
+		Data:       map[string][]byte{"kubeconfig": []byte("apiVersion: v1\nkind: Config\n")},
+	}
+	config := &bootstrapv1.KThreesConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "default"},
+		Spec: bootstrapv1.KThreesConfigSpec{
+			ServerConfig: bootstrapv1.KThreesServerConfig{
+				AuditWebhook: &bootstrapv1.AuditWebhook{
+					KubeconfigFrom: bootstrapv1.SecretFileSource{Name: "audit-webhook", Key: "kubeconfig"},
+				},
+			},
+		},
+	}
+	r := &KThreesConfigReconciler{Client: fake.NewClientBuilder().WithObjects(secret).Build()}
+
+	file, err := r.resolveAuditWebhookFile(context.TODO(), config)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(file.Path).To(Equal("/var/lib/rancher/k3s/server/audit-webhook-kubeconfig.yaml"))
+	g.Expect(file.Permissions).To(Equal("0600"))
+	g.Expect(file.Content).To(Equal("apiVersion: v1\nkind: Config\n"))
+	g.Expect(file.ContentFrom).To(BeNil())
+
+	// A missing secret key is an error
+	config.Spec.ServerConfig.AuditWebhook.KubeconfigFrom.Key = "missing"
+	_, err = r.resolveAuditWebhookFile(context.TODO(), config)
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestKThreesConfigReconciler_LookupToken(t *testing.T) {
+	g := NewWithT(t)
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+	scope := &Scope{
+		Config:  &bootstrapv1.KThreesConfig{ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "default"}},
+		Cluster: cluster,
+	}
+	r := &KThreesConfigReconciler{Client: fake.NewClientBuilder().Build()}
+
+	// The token is missing until the control plane creates it
+	_, err := r.lookupToken(context.TODO(), scope)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(conditions.IsFalse(scope.Config, bootstrapv1.TokenAvailableCondition)).To(BeTrue())
+	g.Expect(conditions.GetReason(scope.Config, bootstrapv1.TokenAvailableCondition)).To(Equal(bootstrapv1.TokenLookupFailedReason))
+	g.Expect(conditions.IsFalse(scope.Config, bootstrapv1.DataSecretAvailableCondition)).To(BeTrue())
+
+	r.Client = fake.NewClientBuilder().WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster-token", Namespace: "default"},
+		Data:       map[string][]byte{"value": []byte("secret-token")},
+	}).Build()
+	tokn, err := r.lookupToken(context.TODO(), scope)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(*tokn).To(Equal("secret-token"))
+	g.Expect(conditions.IsTrue(scope.Config, bootstrapv1.TokenAvailableCondition)).To(BeTrue())
+}
+
+func TestKThreesConfigReconciler_ReconcileStaleBootstrapData(t *testing.T) {
+	g := NewWithT(t)
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+	conditions.MarkTrue(cluster, clusterv1.ControlPlaneInitializedCondition)
+	config := &bootstrapv1.KThreesConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "default"},
+		Spec:       bootstrapv1.KThreesConfigSpec{BootstrapDataTTL: &metav1.Duration{Duration: time.Hour}},
+		Status:     bootstrapv1.KThreesConfigStatus{Ready: true, DataSecretName: ptr.To("config")},
+	}
+	owner := &bsutil.ConfigOwner{Unstructured: &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":   "Machine",
+		"status": map[string]interface{}{"infrastructureReady": false},
+	}}}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Name:        "config",
+		Namespace:   "default",
+		Annotations: map[string]string{bootstrapv1.DataSecretGeneratedAnnotation: time.Now().Add(-10 * time.Minute).UTC().Format(time.RFC3339)},
+	}}
+	scope := &Scope{Config: config, ConfigOwner: owner, Cluster: cluster}
+	r := &KThreesConfigReconciler{Client: fake.NewClientBuilder().WithObjects(secret).Build()}
+
+	// Fresh bootstrap data is checked again once it expires
+	result, err := r.reconcileStaleBootstrapData(context.TODO(), scope)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.RequeueAfter).To(BeNumerically("~", 50*time.Minute, time.Minute))
+
+	// Bootstrap data already consumed by the infrastructure is not regenerated
+	g.Expect(unstructured.SetNestedField(owner.Object, true, "status", "infrastructureReady")).To(Succeed())
+	result, err = r.reconcileStaleBootstrapData(context.TODO(), scope)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result.IsZero()).To(BeTrue())
+}
+
+func TestKThreesConfigReconciler_StoreBootstrapData(t *testing.T) {
+	g := NewWithT(t)
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+	config := &bootstrapv1.KThreesConfig{ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "default"}}
+	scope := &Scope{Logger: logr.Discard(), Config: config, Cluster: cluster}
+	c := fake.NewClientBuilder().Build()
+	r := &KThreesConfigReconciler{Log: logr.Discard(), Client: c}
+
+	// The status reports the data secret as created once it is stored
+	g.Expect(r.storeBootstrapData(context.TODO(), scope, []byte("data"), nil)).To(Succeed())
+	secret := &corev1.Secret{}
+	g.Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: "default", Name: "config"}, secret)).To(Succeed())
+	g.Expect(secret.Data).To(HaveKeyWithValue("value", []byte("data")))
+	g.Expect(config.Status.Ready).To(BeTrue())
+	g.Expect(config.Status.DataSecretName).To(Equal(ptr.To("config")))
+	g.Expect(config.Status.Initialization).To(Equal(&bootstrapv1.KThreesConfigInitializationStatus{DataSecretCreated: true}))
+	g.Expect(conditions.IsTrue(config, bootstrapv1.DataSecretAvailableCondition)).To(BeTrue())
+
+	// A data secret left over by a status which was not patched is updated
+	config.Status = bootstrapv1.KThreesConfigStatus{}
+	g.Expect(r.storeBootstrapData(context.TODO(), scope, []byte("new data"), nil)).To(Succeed())
+	g.Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: "default", Name: "config"}, secret)).To(Succeed())
+	g.Expect(secret.Data).To(HaveKeyWithValue("value", []byte("new data")))
+	g.Expect(config.Status.Initialization).To(Equal(&bootstrapv1.KThreesConfigInitializationStatus{DataSecretCreated: true}))
+}
+
+func TestKThreesConfigReconciler_ReconcileProvisioningTimeout(t *testing.T) {
+	g := NewWithT(t)
+	config := &bootstrapv1.KThreesConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "default"},
+		Spec:       bootstrapv1.KThreesConfigSpec{ProvisioningTimeout: &metav1.Duration{Duration: time.Hour}},
+		Status: bootstrapv1.KThreesConfigStatus{Conditions: clusterv1.Conditions{{
+			Type:               bootstrapv1.DataSecretAvailableCondition,
+			Status:             corev1.ConditionTrue,
+			LastTransitionTime: metav1.NewTime(time.Now().Add(-10 * time.Minute)),
+		}}},
+	}
+	owner := &bsutil.ConfigOwner{Unstructured: &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":     "Machine",
+		"metadata": map[string]interface{}{"name": "machine"},
+	}}}
+	scope := &Scope{Logger: logr.Discard(), Config: config, ConfigOwner: owner}
+	r := &KThreesConfigReconciler{}
+
+	// A node still within the timeout is checked again once it expires
+	result := r.reconcileProvisioningTimeout(scope)
+	g.Expect(result.RequeueAfter).To(BeNumerically("~", 50*time.Minute, time.Minute))
+	g.Expect(config.Status.FailureReason).To(BeEmpty())
+
+	// A node which joined the cluster is not checked anymore
+	g.Expect(unstructured.SetNestedField(owner.Object, map[string]interface{}{"name": "node"}, "status", "nodeRef")).To(Succeed())
+	g.Expect(r.reconcileProvisioningTimeout(scope)).To(BeZero())
+	unstructured.RemoveNestedField(owner.Object, "status")
+
+	// Without a provisioning timeout the node is waited for indefinitely
+	config.Spec.ProvisioningTimeout = nil
+	g.Expect(r.reconcileProvisioningTimeout(scope)).To(BeZero())
+	g.Expect(config.Status.FailureReason).To(BeEmpty())
+
+	// The config fails once the node did not join within the timeout
+	config.Spec.ProvisioningTimeout = &metav1.Duration{Duration: 5 * time.Minute}
+	g.Expect(r.reconcileProvisioningTimeout(scope)).To(BeZero())
+	g.Expect(config.Status.FailureReason).To(Equal(bootstrapv1.ProvisioningTimeoutReason))
+	g.Expect(config.Status.FailureMessage).To(Equal("node of Machine machine did not join the cluster within 5m0s"))
+}
+
+func TestKThreesConfigReconciler_ReconcileTopLevelObjectSettings(t *testing.T) {
+	g := NewWithT(t)
+	r := &KThreesConfigReconciler{Log: logr.Discard()}
+	cluster := &clusterv1.Cluster{}
+
+	// A plain Kubernetes version of the machine, e.g. set by a ClusterClass topology, resolves to its first k3s build
+	config := &bootstrapv1.KThreesConfig{}
+	r.reconcileTopLevelObjectSettings(cluster, &clusterv1.Machine{Spec: clusterv1.MachineSpec{Version: ptr.To("v1.30.4")}}, config)
+	g.Expect(config.Spec.Version).To(Equal("v1.30.4+k3s1"))
+
+	// A k3s release is used as is
+	config = &bootstrapv1.KThreesConfig{}
+	r.reconcileTopLevelObjectSettings(cluster, &clusterv1.Machine{Spec: clusterv1.MachineSpec{Version: ptr.To("v1.30.4+k3s2")}}, config)
+	g.Expect(config.Spec.Version).To(Equal("v1.30.4+k3s2"))
+
+	// The version of the config takes precedence over the one of the machine, and is resolved as well
+	config = &bootstrapv1.KThreesConfig{Spec: bootstrapv1.KThreesConfigSpec{Version: "v1.29.8"}}
+	r.reconcileTopLevelObjectSettings(cluster, &clusterv1.Machine{Spec: clusterv1.MachineSpec{Version: ptr.To("v1.30.4+k3s2")}}, config)
+	g.Expect(config.Spec.Version).To(Equal("v1.29.8+k3s1"))
 }
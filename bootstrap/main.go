@@ -29,6 +29,7 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
@@ -53,10 +54,21 @@ func init() {
 
 func main() {
 	var metricsAddr string
+	var secureMetrics bool
+	var metricsCertDir string
+	var profilerAddress string
 	var enableLeaderElection bool
 	var syncPeriod time.Duration
 
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
+	flag.BoolVar(&secureMetrics, "metrics-secure", false,
+		"Serve the metrics endpoint over HTTPS, only to clients authenticated and authorized by the Kubernetes API server "+
+			"(TokenReview and SubjectAccessReview), instead of plain HTTP.")
+	flag.StringVar(&metricsCertDir, "metrics-cert-dir", "",
+		"Directory containing the tls.crt and tls.key serving the secure metrics endpoint. "+
+			"A self-signed certificate is generated when empty.")
+	flag.StringVar(&profilerAddress, "profiler-address", "",
+		"The address the pprof endpoints bind to (e.g. localhost:6060). Profiling is disabled when empty.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
@@ -68,11 +80,19 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
 
+	metricsOptions := server.Options{
+		BindAddress: metricsAddr,
+	}
+	if secureMetrics {
+		metricsOptions.SecureServing = true
+		metricsOptions.CertDir = metricsCertDir
+		metricsOptions.FilterProvider = filters.WithAuthenticationAndAuthorization
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme: scheme,
-		Metrics: server.Options{
-			BindAddress: metricsAddr,
-		},
+		Scheme:           scheme,
+		Metrics:          metricsOptions,
+		PprofBindAddress: profilerAddress,
 		WebhookServer: webhook.NewServer(webhook.Options{
 			Port: 9443,
 		}),
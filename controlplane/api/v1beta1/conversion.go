@@ -95,10 +95,51 @@ func (in *KThreesControlPlane) ConvertTo(dstRaw ctrlconversion.Hub) error {
 	dst.Spec.KThreesConfigSpec.ServerConfig.DisableCloudController = restored.Spec.KThreesConfigSpec.ServerConfig.DisableCloudController
 	dst.Spec.KThreesConfigSpec.ServerConfig.SystemDefaultRegistry = restored.Spec.KThreesConfigSpec.ServerConfig.SystemDefaultRegistry
 	dst.Spec.KThreesConfigSpec.ServerConfig.EtcdProxyImage = restored.Spec.KThreesConfigSpec.ServerConfig.EtcdProxyImage
+	dst.Spec.KThreesConfigSpec.ServerConfig.EgressSelectorMode = restored.Spec.KThreesConfigSpec.ServerConfig.EgressSelectorMode
+	dst.Spec.KThreesConfigSpec.ServerConfig.TLSCipherSuites = restored.Spec.KThreesConfigSpec.ServerConfig.TLSCipherSuites
+	dst.Spec.KThreesConfigSpec.ServerConfig.TLSMinVersion = restored.Spec.KThreesConfigSpec.ServerConfig.TLSMinVersion
+	dst.Spec.KThreesConfigSpec.ServerConfig.KMSEncryption = restored.Spec.KThreesConfigSpec.ServerConfig.KMSEncryption
+	dst.Spec.KThreesConfigSpec.ServerConfig.AuditWebhook = restored.Spec.KThreesConfigSpec.ServerConfig.AuditWebhook
+	dst.Spec.KThreesConfigSpec.ServerConfig.ExtraHostPaths = restored.Spec.KThreesConfigSpec.ServerConfig.ExtraHostPaths
+	dst.Spec.KThreesConfigSpec.ServerConfig.EtcdSnapshots = restored.Spec.KThreesConfigSpec.ServerConfig.EtcdSnapshots
+	dst.Spec.KThreesConfigSpec.ServerConfig.ControllerManager = restored.Spec.KThreesConfigSpec.ServerConfig.ControllerManager
+	dst.Spec.KThreesConfigSpec.ServerConfig.Scheduler = restored.Spec.KThreesConfigSpec.ServerConfig.Scheduler
+	dst.Spec.KThreesConfigSpec.ServerConfig.StaticPods = restored.Spec.KThreesConfigSpec.ServerConfig.StaticPods
 	dst.Spec.MachineTemplate.NodeVolumeDetachTimeout = restored.Spec.MachineTemplate.NodeVolumeDetachTimeout
 	dst.Spec.MachineTemplate.NodeDeletionTimeout = restored.Spec.MachineTemplate.NodeDeletionTimeout
+	dst.Spec.MachineTemplate.PreDrainDeleteHooks = restored.Spec.MachineTemplate.PreDrainDeleteHooks
+	dst.Spec.CertificateValidityPeriod = restored.Spec.CertificateValidityPeriod
+	dst.Spec.CACertificateValidityPeriod = restored.Spec.CACertificateValidityPeriod
+	dst.Spec.SpareReplicas = restored.Spec.SpareReplicas
+	dst.Spec.RolloutStrategy = restored.Spec.RolloutStrategy
+	dst.Spec.ClusterInitFailureDomain = restored.Spec.ClusterInitFailureDomain
+	dst.Spec.VersionBuildPolicy = restored.Spec.VersionBuildPolicy
+	dst.Spec.ConfigDriftPolicy = restored.Spec.ConfigDriftPolicy
+	dst.Spec.JoinInfo = restored.Spec.JoinInfo
 	dst.Status.Version = restored.Status.Version
+	dst.Status.ResolvedVersion = restored.Status.ResolvedVersion
+	dst.Status.CertificateExpiries = restored.Status.CertificateExpiries
+	dst.Status.RolloutPlan = restored.Status.RolloutPlan
+	dst.Status.SpareReplicas = restored.Status.SpareReplicas
+	dst.Status.MachineVersions = restored.Status.MachineVersions
+	dst.Status.LastSnapshotVerified = restored.Status.LastSnapshotVerified
+	dst.Status.Rollout = restored.Status.Rollout
+	dst.Status.FailureDomains = restored.Status.FailureDomains
+	dst.Status.Initialization = restored.Status.Initialization
+	dst.Status.EtcdCertificateExpiries = restored.Status.EtcdCertificateExpiries
+	dst.Status.NodeConfigDrift = restored.Status.NodeConfigDrift
 	dst.Spec.KThreesConfigSpec.AgentConfig.AirGappedInstallScriptPath = restored.Spec.KThreesConfigSpec.AgentConfig.AirGappedInstallScriptPath
+	dst.Spec.KThreesConfigSpec.AgentConfig.PreferBundledBin = restored.Spec.KThreesConfigSpec.AgentConfig.PreferBundledBin
+	dst.Spec.KThreesConfigSpec.AgentConfig.ServerTLSBootstrap = restored.Spec.KThreesConfigSpec.AgentConfig.ServerTLSBootstrap
+	dst.Spec.KThreesConfigSpec.AgentConfig.VPNAuth = restored.Spec.KThreesConfigSpec.AgentConfig.VPNAuth
+	dst.Spec.KThreesConfigSpec.AgentConfig.NodeNameStrategy = restored.Spec.KThreesConfigSpec.AgentConfig.NodeNameStrategy
+	dst.Spec.KThreesConfigSpec.AgentConfig.Docker = restored.Spec.KThreesConfigSpec.AgentConfig.Docker
+	dst.Spec.KThreesConfigSpec.AgentConfig.ResolvConf = restored.Spec.KThreesConfigSpec.AgentConfig.ResolvConf
+	dst.Spec.KThreesConfigSpec.AgentConfig.ServerURL = restored.Spec.KThreesConfigSpec.AgentConfig.ServerURL
+	dst.Spec.KThreesConfigSpec.ProvisioningTimeout = restored.Spec.KThreesConfigSpec.ProvisioningTimeout
+	dst.Spec.KThreesConfigSpec.BootstrapDataTTL = restored.Spec.KThreesConfigSpec.BootstrapDataTTL
+	dst.Spec.KThreesConfigSpec.Debug = restored.Spec.KThreesConfigSpec.Debug
+	dst.Spec.KThreesConfigSpec.LogLevel = restored.Spec.KThreesConfigSpec.LogLevel
 	return nil
 }
 
@@ -213,6 +213,7 @@ func autoConvert_v1beta2_KThreesControlPlaneMachineTemplate_To_v1beta1_KThreesCo
 	// WARNING: in.NodeDrainTimeout requires manual conversion: does not exist in peer-type
 	// WARNING: in.NodeVolumeDetachTimeout requires manual conversion: does not exist in peer-type
 	// WARNING: in.NodeDeletionTimeout requires manual conversion: does not exist in peer-type
+	// WARNING: in.PreDrainDeleteHooks requires manual conversion: does not exist in peer-type
 	return nil
 }
 
@@ -243,6 +244,14 @@ func autoConvert_v1beta2_KThreesControlPlaneSpec_To_v1beta1_KThreesControlPlaneS
 		return err
 	}
 	out.RemediationStrategy = (*RemediationStrategy)(unsafe.Pointer(in.RemediationStrategy))
+	// WARNING: in.CertificateValidityPeriod requires manual conversion: does not exist in peer-type
+	// WARNING: in.CACertificateValidityPeriod requires manual conversion: does not exist in peer-type
+	// WARNING: in.SpareReplicas requires manual conversion: does not exist in peer-type
+	// WARNING: in.RolloutStrategy requires manual conversion: does not exist in peer-type
+	// WARNING: in.ClusterInitFailureDomain requires manual conversion: does not exist in peer-type
+	// WARNING: in.VersionBuildPolicy requires manual conversion: does not exist in peer-type
+	// WARNING: in.ConfigDriftPolicy requires manual conversion: does not exist in peer-type
+	// WARNING: in.JoinInfo requires manual conversion: does not exist in peer-type
 	return nil
 }
 
@@ -271,16 +280,27 @@ func autoConvert_v1beta2_KThreesControlPlaneStatus_To_v1beta1_KThreesControlPlan
 	out.Selector = in.Selector
 	out.Replicas = in.Replicas
 	// WARNING: in.Version requires manual conversion: does not exist in peer-type
+	// WARNING: in.ResolvedVersion requires manual conversion: does not exist in peer-type
 	out.UpdatedReplicas = in.UpdatedReplicas
 	out.ReadyReplicas = in.ReadyReplicas
+	// WARNING: in.SpareReplicas requires manual conversion: does not exist in peer-type
 	out.UnavailableReplicas = in.UnavailableReplicas
 	out.Initialized = in.Initialized
+	// WARNING: in.Initialization requires manual conversion: does not exist in peer-type
 	out.Ready = in.Ready
 	out.FailureReason = errors.KThreesControlPlaneStatusError(in.FailureReason)
 	out.FailureMessage = (*string)(unsafe.Pointer(in.FailureMessage))
 	out.ObservedGeneration = in.ObservedGeneration
 	out.Conditions = *(*clusterapiapiv1beta1.Conditions)(unsafe.Pointer(&in.Conditions))
 	out.LastRemediation = (*LastRemediationStatus)(unsafe.Pointer(in.LastRemediation))
+	// WARNING: in.CertificateExpiries requires manual conversion: does not exist in peer-type
+	// WARNING: in.RolloutPlan requires manual conversion: does not exist in peer-type
+	// WARNING: in.MachineVersions requires manual conversion: does not exist in peer-type
+	// WARNING: in.LastSnapshotVerified requires manual conversion: does not exist in peer-type
+	// WARNING: in.Rollout requires manual conversion: does not exist in peer-type
+	// WARNING: in.FailureDomains requires manual conversion: does not exist in peer-type
+	// WARNING: in.EtcdCertificateExpiries requires manual conversion: does not exist in peer-type
+	// WARNING: in.NodeConfigDrift requires manual conversion: does not exist in peer-type
 	return nil
 }
 
@@ -36,6 +36,18 @@ const (
 	CertificatesGenerationFailedReason = "CertificatesGenerationFailed"
 )
 
+const (
+	// CertificatesExpiringSoonCondition documents that some of the certificates listed in status.certificateExpiries
+	// expire soon. Unlike most conditions, it is true when there is an issue requiring the user attention.
+	CertificatesExpiringSoonCondition clusterv1.ConditionType = "CertificatesExpiringSoon"
+
+	// CertificatesExpiringReason documents some certificates expiring soon.
+	CertificatesExpiringReason = "CertificatesExpiring"
+
+	// CertificatesValidReason (Severity=Info) documents that all the certificates are valid for a while.
+	CertificatesValidReason = "CertificatesValid"
+)
+
 const (
 	// AvailableCondition documents that the first control plane instance has completed the server init operation
 	// and so the control plane is available and an API server instance is ready for processing requests.
@@ -54,6 +66,14 @@ const (
 	// RollingUpdateInProgressReason (Severity=Warning) documents a KThreesControlPlane object executing a
 	// rolling upgrade for aligning the machines spec to the desired state.
 	RollingUpdateInProgressReason = "RollingUpdateInProgress"
+
+	// RolloutWaitingForApprovalReason (Severity=Warning) documents a KThreesControlPlane object waiting for the
+	// ApproveRolloutAnnotation before starting a rolling upgrade.
+	RolloutWaitingForApprovalReason = "RolloutWaitingForApproval"
+
+	// RolloutWaitingForStepApprovalReason (Severity=Warning) documents a KThreesControlPlane object with the Manual
+	// rollout approval mode waiting for the ApproveRolloutStepAnnotation before replacing the next machine.
+	RolloutWaitingForStepApprovalReason = "RolloutWaitingForStepApproval"
 )
 
 const (
@@ -97,6 +117,19 @@ const (
 	PodInspectionFailedReason = "PodInspectionFailed"
 )
 
+const (
+	// MachineK3sServiceHealthyCondition reports whether the k3s service of a machine is running, which tells apart
+	// a machine whose k3s service is down or crash looping from a node that is not ready for other reasons.
+	MachineK3sServiceHealthyCondition clusterv1.ConditionType = "K3sServiceHealthy"
+
+	// K3sServiceDownReason (Severity=Error) documents a machine whose infrastructure is ready but whose node
+	// stopped reporting its status and does not answer health checks.
+	K3sServiceDownReason = "K3sServiceDown"
+
+	// K3sServiceInspectionFailedReason documents a failure in inspecting the k3s service status.
+	K3sServiceInspectionFailedReason = "K3sServiceInspectionFailed"
+)
+
 const (
 	// EtcdClusterHealthyCondition documents the overall etcd cluster's health.
 	EtcdClusterHealthyCondition clusterv1.ConditionType = "EtcdClusterHealthyCondition"
@@ -128,3 +161,101 @@ const (
 	// TokenGenerationFailedReason documents that the token required for nodes to join the cluster could not be generated.
 	TokenGenerationFailedReason = "TokenGenerationFailed"
 )
+
+const (
+	// EtcdSnapshotsPrunedCondition documents whether the etcd snapshots of the cluster are pruned according to
+	// spec.kthreesConfigSpec.serverConfig.etcdSnapshots, i.e. whether snapshot storage is kept within bounds.
+	EtcdSnapshotsPrunedCondition clusterv1.ConditionType = "EtcdSnapshotsPruned"
+
+	// EtcdSnapshotsNotPrunedReason (Severity=Warning) documents that more scheduled snapshots than the retention
+	// count, or snapshots older than the max age, are kept on a node or in S3.
+	EtcdSnapshotsNotPrunedReason = "EtcdSnapshotsNotPruned"
+
+	// EtcdSnapshotsInspectionFailedReason documents a failure in listing the etcd snapshots of the cluster.
+	EtcdSnapshotsInspectionFailedReason = "EtcdSnapshotsInspectionFailed"
+)
+
+const (
+	// EtcdCertificatesValidCondition documents whether the etcd server and peer certificates of the servers,
+	// listed in status.etcdCertificateExpiries, are valid for a while. Certificates expiring soon are rotated
+	// one server at a time.
+	EtcdCertificatesValidCondition clusterv1.ConditionType = "EtcdCertificatesValid"
+
+	// EtcdCertificatesRotatingReason (Severity=Warning) documents that the etcd certificates of some servers
+	// expire soon and are being rotated.
+	EtcdCertificatesRotatingReason = "EtcdCertificatesRotating"
+
+	// EtcdCertificatesInspectionFailedReason documents a failure in reading the etcd certificates of a server.
+	EtcdCertificatesInspectionFailedReason = "EtcdCertificatesInspectionFailed"
+)
+
+const (
+	// NodeConfigInSyncCondition documents whether the k3s configuration files of the servers, config.yaml and the
+	// private registry configuration, match the ones they were bootstrapped with. Drifted servers are listed in
+	// status.nodeConfigDrift.
+	NodeConfigInSyncCondition clusterv1.ConditionType = "NodeConfigInSync"
+
+	// NodeConfigDriftedReason (Severity=Warning) documents that the k3s configuration files of some servers were
+	// changed on the node.
+	NodeConfigDriftedReason = "NodeConfigDrifted"
+
+	// NodeConfigReapplyingReason (Severity=Info) documents that the k3s configuration files of some servers are
+	// being written back, restarting k3s one server at a time.
+	NodeConfigReapplyingReason = "NodeConfigReapplying"
+
+	// NodeConfigInspectionFailedReason documents a failure in reading the k3s configuration files of a server.
+	NodeConfigInspectionFailedReason = "NodeConfigInspectionFailed"
+)
+
+const (
+	// SpecAppliedCondition documents whether the key server settings of spec.kthreesConfigSpec.serverConfig, the
+	// disabled components, the cluster and service CIDRs and the KMS encryption, match the ones the servers run with.
+	SpecAppliedCondition clusterv1.ConditionType = "SpecApplied"
+
+	// SpecRolloutPendingReason (Severity=Info) documents that some servers run with outdated settings and are
+	// going to be replaced by the rollout.
+	SpecRolloutPendingReason = "SpecRolloutPending"
+
+	// SpecIgnoredReason (Severity=Warning) documents that some servers run with settings which differ from the spec
+	// and are not going to be changed, either because no rollout is planned for them, or because the settings,
+	// like the cluster and service CIDRs, cannot be changed on an existing cluster.
+	SpecIgnoredReason = "SpecIgnored"
+
+	// SpecInspectionFailedReason documents a failure in reading the settings the servers run with.
+	SpecInspectionFailedReason = "SpecInspectionFailed"
+)
+
+const (
+	// RemediationBlockedCondition documents that an unhealthy control plane machine can't be remediated yet, and why.
+	// Unlike most conditions, it is true when there is an issue requiring the user attention.
+	RemediationBlockedCondition clusterv1.ConditionType = "RemediationBlocked"
+
+	// RemediationPreviousInProgressReason documents that the machine created by a previous remediation
+	// is not yet created.
+	RemediationPreviousInProgressReason = "PreviousRemediationInProgress"
+
+	// RemediationRetryPeriodNotExpiredReason documents that the remediation of the same machine already failed
+	// within spec.remediationStrategy.retryPeriod.
+	RemediationRetryPeriodNotExpiredReason = "RetryPeriodNotExpired"
+
+	// RemediationMaxRetryReachedReason documents that the remediation of the same machine already failed
+	// spec.remediationStrategy.maxRetry times.
+	RemediationMaxRetryReachedReason = "MaxRetryReached"
+
+	// RemediationNotEnoughReplicasReason documents that the control plane has less than two machines.
+	RemediationNotEnoughReplicasReason = "NotEnoughReplicas"
+
+	// RemediationMachinesProvisioningReason documents that other control plane machines are being provisioned.
+	RemediationMachinesProvisioningReason = "MachinesProvisioning"
+
+	// RemediationMachinesDeletingReason documents that other control plane machines are being deleted.
+	RemediationMachinesDeletingReason = "MachinesDeleting"
+
+	// RemediationEtcdQuorumAtRiskReason documents that removing the etcd member of the machine could result
+	// in etcd losing quorum.
+	RemediationEtcdQuorumAtRiskReason = "EtcdQuorumAtRisk"
+
+	// RemediationNoEtcdLeaderCandidateReason documents that there is no healthy machine to forward
+	// the etcd leadership to.
+	RemediationNoEtcdLeaderCandidateReason = "NoEtcdLeaderCandidate"
+)
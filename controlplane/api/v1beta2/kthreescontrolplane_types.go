@@ -17,6 +17,7 @@ limitations under the License.
 package v1beta2
 
 import (
+	"strings"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
@@ -34,9 +35,43 @@ const (
 	// This annotation is used to detect any changes in ClusterConfiguration and trigger machine rollout in KCP.
 	KThreesServerConfigurationAnnotation = "controlplane.cluster.x-k8s.io/kthrees-server-configuration"
 
+	// ControlPlaneEndpointAnnotation is a machine annotation that stores the control plane endpoint, in the HOST:PORT
+	// form, the machine was bootstrapped with. Machines bootstrapped with another endpoint than the current
+	// Cluster.spec.controlPlaneEndpoint are rolled out, as their serving certificates and k3s configuration are stale.
+	ControlPlaneEndpointAnnotation = "controlplane.cluster.x-k8s.io/control-plane-endpoint"
+
 	// SkipCoreDNSAnnotation annotation explicitly skips reconciling CoreDNS if set.
 	SkipCoreDNSAnnotation = "controlplane.cluster.x-k8s.io/skip-coredns"
 
+	// SkipVersionCheckAnnotation annotation allows a version that is not in the supported versions matrix if set.
+	SkipVersionCheckAnnotation = "controlplane.cluster.x-k8s.io/skip-version-check"
+
+	// RotateServingCertsAnnotation triggers the regeneration of the k3s serving certificates, restarting k3s on one
+	// server at a time. Changing its value, e.g. to the current RFC3339 timestamp, triggers a new rotation. When the
+	// value is a RFC3339 timestamp, the machines created after it are not rotated, as their certificates are newer.
+	RotateServingCertsAnnotation = "controlplane.cluster.x-k8s.io/rotate-serving-certs"
+
+	// ServingCertsRotatedAnnotation is a machine annotation that stores the value of RotateServingCertsAnnotation
+	// the serving certificates of the machine were last rotated for.
+	ServingCertsRotatedAnnotation = "controlplane.cluster.x-k8s.io/serving-certs-rotated"
+
+	// RequireRolloutApprovalAnnotation makes rolling upgrades wait for the ApproveRolloutAnnotation if set,
+	// so the machines listed in status.rolloutPlan can be reviewed before any of them is replaced.
+	RequireRolloutApprovalAnnotation = "controlplane.cluster.x-k8s.io/require-rollout-approval"
+
+	// ApproveRolloutAnnotation approves the pending rollout when RequireRolloutApprovalAnnotation is set.
+	// It is removed once all the machines are up to date, so each rollout has to be approved.
+	ApproveRolloutAnnotation = "controlplane.cluster.x-k8s.io/approve-rollout"
+
+	// ApproveRolloutStepAnnotation approves the replacement of the next machine of a rollout when
+	// spec.rolloutStrategy.approvalMode is Manual. It is removed once the replacement machine is created.
+	ApproveRolloutStepAnnotation = "controlplane.cluster.x-k8s.io/approve-rollout-step"
+
+	// RetainSecretsAnnotation keeps the cluster certificate authorities, the token and the secrets referenced by
+	// spec.kthreesConfigSpec.files, e.g. holding the etcd snapshots S3 credentials, when the KThreesControlPlane is
+	// deleted, instead of garbage collecting them, so the same cluster can be recreated from etcd snapshots.
+	RetainSecretsAnnotation = "controlplane.cluster.x-k8s.io/retain-secrets"
+
 	// RemediationInProgressAnnotation is used to keep track that a KCP remediation is in progress, and more
 	// specifically it tracks that the system is in between having deleted an unhealthy machine and recreating its replacement.
 	// NOTE: if something external to CAPI removes this annotation the system cannot detect the above situation; this can lead to
@@ -84,8 +119,82 @@ type KThreesControlPlaneSpec struct {
 	// The RemediationStrategy that controls how control plane machine remediation happens.
 	// +optional
 	RemediationStrategy *RemediationStrategy `json:"remediationStrategy,omitempty"`
+
+	// CertificateValidityPeriod is how long the client certificates generated by the KThreesControlPlane,
+	// such as the admin kubeconfig one, are valid for. Defaults to 1 year.
+	// +optional
+	CertificateValidityPeriod *metav1.Duration `json:"certificateValidityPeriod,omitempty"`
+
+	// CACertificateValidityPeriod is how long the certificate authorities generated by the KThreesControlPlane
+	// are valid for. It only applies to certificate authorities generated after it is set. Defaults to 10 years.
+	// +optional
+	CACertificateValidityPeriod *metav1.Duration `json:"caCertificateValidityPeriod,omitempty"`
+
+	// SpareReplicas is the number of spare machines to keep provisioned, joined as tainted agents with the
+	// server configuration staged. A spare machine is promoted to a server when the control plane scales up,
+	// e.g. to replace a remediated machine, which is much faster than provisioning a new machine.
+	// Spare machines are not counted in replicas.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	SpareReplicas *int32 `json:"spareReplicas,omitempty"`
+
+	// The RolloutStrategy that controls how control plane machines are replaced during a rollout.
+	// +optional
+	RolloutStrategy *RolloutStrategy `json:"rolloutStrategy,omitempty"`
+
+	// ClusterInitFailureDomain pins the failure domain of the initial control plane machine, the one initializing
+	// the cluster with --cluster-init, e.g. to run the first etcd member on hardware with local NVMe while the other
+	// servers are virtualized. It must be one of the control plane failure domains of the Cluster; defaults to the
+	// failure domain with the fewest control plane machines.
+	// +optional
+	ClusterInitFailureDomain *string `json:"clusterInitFailureDomain,omitempty"`
+
+	// VersionBuildPolicy is how a plain Kubernetes version, e.g. v1.30.4 set by a ClusterClass topology, is
+	// resolved to a k3s release: FirstBuild uses +k3s1 and LatestKnownBuild the latest build listed in the
+	// supported versions matrix. The resolved release is pinned in status.resolvedVersion until the version
+	// changes. Versions with a k3s build, e.g. v1.30.4+k3s2, are used as is. Defaults to FirstBuild.
+	// +optional
+	VersionBuildPolicy VersionBuildPolicy `json:"versionBuildPolicy,omitempty"`
+
+	// ConfigDriftPolicy is what is done when the k3s configuration files of a server, config.yaml and the private
+	// registry configuration, no longer match the ones it was bootstrapped with: Report surfaces the drift with the
+	// NodeConfigInSync condition and Reapply also writes the files back and restarts k3s, one server at a time.
+	// Defaults to Report.
+	// +optional
+	ConfigDriftPolicy ConfigDriftPolicy `json:"configDriftPolicy,omitempty"`
+
+	// JoinInfo publishes in the <cluster>-join-info secret what externally managed nodes, e.g. appliances or edge
+	// devices which are not Cluster API Machines, need to join the cluster as agents: the server URL, the hash of
+	// the cluster CA and an agent token with a limited TTL, rotated before it expires.
+	// +optional
+	JoinInfo *JoinInfo `json:"joinInfo,omitempty"`
 }
 
+// VersionBuildPolicy is how a plain Kubernetes version is resolved to a k3s release.
+// +kubebuilder:validation:Enum=FirstBuild;LatestKnownBuild
+type VersionBuildPolicy string
+
+const (
+	// VersionBuildPolicyFirstBuild resolves plain Kubernetes versions to their first k3s build, e.g. v1.30.4+k3s1.
+	VersionBuildPolicyFirstBuild VersionBuildPolicy = "FirstBuild"
+
+	// VersionBuildPolicyLatestKnownBuild resolves plain Kubernetes versions to the latest k3s build listed in the
+	// supported versions matrix, falling back to the first one.
+	VersionBuildPolicyLatestKnownBuild VersionBuildPolicy = "LatestKnownBuild"
+)
+
+// ConfigDriftPolicy is what is done when the k3s configuration files of a server drifted.
+// +kubebuilder:validation:Enum=Report;Reapply
+type ConfigDriftPolicy string
+
+const (
+	// ConfigDriftPolicyReport only reports the drift of the k3s configuration files of the servers.
+	ConfigDriftPolicyReport ConfigDriftPolicy = "Report"
+
+	// ConfigDriftPolicyReapply writes the drifted k3s configuration files back and restarts k3s in place.
+	ConfigDriftPolicyReapply ConfigDriftPolicy = "Reapply"
+)
+
 // MachineTemplate contains information about how machines should be shaped
 // when creating or updating a control plane.
 type KThreesControlPlaneMachineTemplate struct {
@@ -110,6 +219,14 @@ type KThreesControlPlaneMachineTemplate struct {
 	// If no value is provided, the default value for this property of the Machine resource will be used.
 	// +optional
 	NodeDeletionTimeout *metav1.Duration `json:"nodeDeletionTimeout,omitempty"`
+	// PreDrainDeleteHooks lists the names of the pre-drain delete hooks set on a control plane machine when the
+	// KThreesControlPlane deletes it on scale down, rollout or remediation. The node is only drained once the external
+	// controllers owning the hooks, e.g. for load balancer deregistration or ingress draining, removed their
+	// pre-drain.delete.hook.machine.cluster.x-k8s.io/<name> annotation from the machine.
+	// +kubebuilder:validation:items:MaxLength=63
+	// +kubebuilder:validation:items:Pattern=`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`
+	// +optional
+	PreDrainDeleteHooks []string `json:"preDrainDeleteHooks,omitempty"`
 }
 
 // RemediationStrategy allows to define how control plane machine remediation happens.
@@ -156,6 +273,41 @@ type RemediationStrategy struct {
 	MinHealthyPeriod *metav1.Duration `json:"minHealthyPeriod,omitempty"`
 }
 
+// RolloutApprovalMode defines whether the machine replacements of a rollout have to be approved.
+type RolloutApprovalMode string
+
+const (
+	// RolloutApprovalModeAutomatic replaces the outdated machines one after the other without approval.
+	RolloutApprovalModeAutomatic RolloutApprovalMode = "Automatic"
+
+	// RolloutApprovalModeManual replaces a single machine, then waits for the ApproveRolloutStepAnnotation
+	// before replacing the next one.
+	RolloutApprovalModeManual RolloutApprovalMode = "Manual"
+)
+
+// RolloutStrategy allows to define how control plane machines are replaced during a rollout.
+type RolloutStrategy struct {
+	// ApprovalMode defines whether each machine replacement after the first one has to be approved with
+	// the approve-rollout-step annotation. Defaults to Automatic.
+	// +kubebuilder:validation:Enum=Automatic;Manual
+	// +kubebuilder:default=Automatic
+	// +optional
+	ApprovalMode RolloutApprovalMode `json:"approvalMode,omitempty"`
+}
+
+// IsManualApproval returns true if the machine replacements of a rollout have to be approved.
+func (s *RolloutStrategy) IsManualApproval() bool {
+	return s != nil && s.ApprovalMode == RolloutApprovalModeManual
+}
+
+// JoinInfo configures the join information published for externally managed nodes.
+type JoinInfo struct {
+	// TokenTTL is how long the published agent token is valid for. A new token is published half way through,
+	// the previous one staying valid until it expires. Defaults to 24h.
+	// +optional
+	TokenTTL *metav1.Duration `json:"tokenTTL,omitempty"`
+}
+
 // KThreesControlPlaneStatus defines the observed state of KThreesControlPlane.
 type KThreesControlPlaneStatus struct {
 	// Selector is the label selector in string format to avoid introspection
@@ -171,11 +323,17 @@ type KThreesControlPlaneStatus struct {
 	// +optional
 	Replicas int32 `json:"replicas,omitempty"`
 
-	// Version represents the minimum Kubernetes version for the control plane machines
-	// in the cluster.
+	// Version represents the minimum k3s version running on the nodes of the control plane machines
+	// in the cluster. It is not set until a control plane node is registered, and is lower than
+	// spec.version until all the machines are upgraded.
 	// +optional
 	Version *string `json:"version,omitempty"`
 
+	// ResolvedVersion is the k3s release of the control plane machines, resolved from spec.version
+	// according to spec.versionBuildPolicy.
+	// +optional
+	ResolvedVersion string `json:"resolvedVersion,omitempty"`
+
 	// Total number of non-terminated machines targeted by this control plane
 	// that have the desired template spec.
 	// +optional
@@ -185,6 +343,10 @@ type KThreesControlPlaneStatus struct {
 	// +optional
 	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
 
+	// SpareReplicas is the number of spare machines joined to the cluster and ready to be promoted.
+	// +optional
+	SpareReplicas int32 `json:"spareReplicas,omitempty"`
+
 	// Total number of unavailable machines targeted by this control plane.
 	// This is the total number of machines that are still required for
 	// the deployment to have 100% available capacity. They may either
@@ -197,6 +359,11 @@ type KThreesControlPlaneStatus struct {
 	// +optional
 	Initialized bool `json:"initialized"`
 
+	// Initialization provides observations of the KThreesControlPlane initialization process,
+	// as defined by the Cluster API v1beta2 control plane provider contract.
+	// +optional
+	Initialization *KThreesControlPlaneInitializationStatus `json:"initialization,omitempty"`
+
 	// Ready denotes that the KThreesControlPlane API Server is ready to
 	// receive requests.
 	// +optional
@@ -224,6 +391,202 @@ type KThreesControlPlaneStatus struct {
 	// LastRemediation stores info about last remediation performed.
 	// +optional
 	LastRemediation *LastRemediationStatus `json:"lastRemediation,omitempty"`
+
+	// CertificateExpiries lists when the cluster certificate authorities and the admin client certificate expire.
+	// +optional
+	CertificateExpiries []CertificateExpiry `json:"certificateExpiries,omitempty"`
+
+	// RolloutPlan lists the machines that will be replaced by the next rolling upgrade, and why.
+	// +optional
+	RolloutPlan []MachineRolloutPlan `json:"rolloutPlan,omitempty"`
+
+	// MachineVersions lists the k3s version running on the node of each control plane machine.
+	// +optional
+	MachineVersions []MachineVersion `json:"machineVersions,omitempty"`
+
+	// LastSnapshotVerified reports the integrity check of the latest etcd snapshot, when
+	// spec.kthreesConfigSpec.serverConfig.etcdSnapshots.verify is set.
+	// +optional
+	LastSnapshotVerified *EtcdSnapshotVerification `json:"lastSnapshotVerified,omitempty"`
+
+	// Rollout reports the progress of the rolling upgrade in progress, if any.
+	// +optional
+	Rollout *RolloutStatus `json:"rollout,omitempty"`
+
+	// FailureDomains reports how the control plane machines are spread across the control plane failure domains
+	// of the Cluster. It is not set when the Cluster has no control plane failure domains.
+	// +optional
+	FailureDomains *FailureDomainsStatus `json:"failureDomains,omitempty"`
+
+	// EtcdCertificateExpiries lists the earliest expiry of the etcd server and peer certificates of each control
+	// plane machine, sorted by machine name, when etcd is managed by k3s.
+	// +optional
+	EtcdCertificateExpiries []EtcdCertificateExpiry `json:"etcdCertificateExpiries,omitempty"`
+
+	// NodeConfigDrift lists when the k3s configuration files of each control plane machine were last compared
+	// with the ones it was bootstrapped with, and the files that drifted, sorted by machine name.
+	// +optional
+	NodeConfigDrift []NodeConfigDrift `json:"nodeConfigDrift,omitempty"`
+}
+
+// NodeConfigDrift is the result of the last comparison of the k3s configuration files of a control plane machine
+// with the ones it was bootstrapped with.
+type NodeConfigDrift struct {
+	// Machine is the name of the control plane machine.
+	Machine string `json:"machine"`
+
+	// Files are the paths of the k3s configuration files that drifted on the node.
+	// +optional
+	Files []string `json:"files,omitempty"`
+
+	// LastChecked is when the files were last compared.
+	LastChecked metav1.Time `json:"lastChecked"`
+}
+
+// EtcdCertificateExpiry is the earliest expiry of the etcd server and peer certificates of a control plane machine.
+type EtcdCertificateExpiry struct {
+	// Machine is the name of the control plane machine.
+	Machine string `json:"machine"`
+
+	// NotAfter is when the first of the etcd certificates of the machine expires.
+	NotAfter metav1.Time `json:"notAfter"`
+
+	// LastChecked is when the certificates were last read from the machine.
+	LastChecked metav1.Time `json:"lastChecked"`
+}
+
+// KThreesControlPlaneInitializationStatus provides observations of the KThreesControlPlane initialization process.
+type KThreesControlPlaneInitializationStatus struct {
+	// ControlPlaneInitialized is true when the first k3s server is initialized and the workload cluster
+	// API server can accept requests.
+	// +optional
+	ControlPlaneInitialized bool `json:"controlPlaneInitialized,omitempty"`
+}
+
+// FailureDomainsStatus reports how the control plane machines are spread across failure domains.
+type FailureDomainsStatus struct {
+	// Machines lists the number of control plane machines in each failure domain, sorted by failure domain.
+	// Machines being deleted are not counted.
+	// +optional
+	Machines []FailureDomainMachines `json:"machines,omitempty"`
+
+	// Balanced is true when the numbers of control plane machines in the failure domains differ by at most one,
+	// and all the machines are in one of them.
+	Balanced bool `json:"balanced"`
+}
+
+// FailureDomainMachines is the number of control plane machines in a failure domain.
+type FailureDomainMachines struct {
+	// Name of the failure domain.
+	Name string `json:"name"`
+
+	// Machines is the number of control plane machines in the failure domain.
+	Machines int32 `json:"machines"`
+}
+
+// RolloutPhase is the step a rolling upgrade is at.
+// +kubebuilder:validation:Enum=SelectingMachine;WaitingForApproval;Deleting;WaitingForNewMachine;WaitingForEtcd
+type RolloutPhase string
+
+const (
+	// RolloutPhaseSelectingMachine is when the next outdated machine is being selected and its replacement created.
+	RolloutPhaseSelectingMachine RolloutPhase = "SelectingMachine"
+
+	// RolloutPhaseWaitingForApproval is when the replacement of the next machine waits for the
+	// ApproveRolloutStepAnnotation, with the Manual approval mode.
+	RolloutPhaseWaitingForApproval RolloutPhase = "WaitingForApproval"
+
+	// RolloutPhaseWaitingForNewMachine is when the replacement machine is not provisioned or healthy yet.
+	RolloutPhaseWaitingForNewMachine RolloutPhase = "WaitingForNewMachine"
+
+	// RolloutPhaseWaitingForEtcd is when the etcd members are not healthy yet.
+	RolloutPhaseWaitingForEtcd RolloutPhase = "WaitingForEtcd"
+
+	// RolloutPhaseDeleting is when the outdated machine is being deleted.
+	RolloutPhaseDeleting RolloutPhase = "Deleting"
+)
+
+// RolloutStatus reports the progress of a rolling upgrade.
+type RolloutStatus struct {
+	// Phase is the step the rollout is at.
+	Phase RolloutPhase `json:"phase"`
+
+	// Machine is the name of the outdated machine currently being replaced.
+	// +optional
+	Machine string `json:"machine,omitempty"`
+
+	// StartTime is when the rollout started.
+	StartTime metav1.Time `json:"startTime"`
+
+	// LastTransitionTime is when the rollout last moved to another phase or machine.
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+}
+
+// RolloutReason is why a machine needs to be rolled out.
+// +kubebuilder:validation:Enum=VersionChanged;InfrastructureTemplateChanged;KThreesConfigChanged;RolloutAfterExpired;ControlPlaneEndpointChanged
+type RolloutReason string
+
+const (
+	// RolloutReasonVersionChanged means the machine does not run spec.version.
+	RolloutReasonVersionChanged RolloutReason = "VersionChanged"
+
+	// RolloutReasonInfrastructureTemplateChanged means the machine was not created from spec.machineTemplate.infrastructureRef.
+	RolloutReasonInfrastructureTemplateChanged RolloutReason = "InfrastructureTemplateChanged"
+
+	// RolloutReasonKThreesConfigChanged means the machine KThreesConfig does not match spec.kthreesConfigSpec.
+	RolloutReasonKThreesConfigChanged RolloutReason = "KThreesConfigChanged"
+
+	// RolloutReasonRolloutAfterExpired means the machine was created before spec.rolloutAfter, which has passed.
+	RolloutReasonRolloutAfterExpired RolloutReason = "RolloutAfterExpired"
+
+	// RolloutReasonControlPlaneEndpointChanged means the machine was bootstrapped with another control plane endpoint.
+	RolloutReasonControlPlaneEndpointChanged RolloutReason = "ControlPlaneEndpointChanged"
+)
+
+// MachineRolloutPlan is a machine that will be replaced by a rolling upgrade.
+type MachineRolloutPlan struct {
+	// Machine is the name of the machine.
+	Machine string `json:"machine"`
+
+	// Reasons are why the machine will be replaced.
+	Reasons []RolloutReason `json:"reasons"`
+}
+
+// MachineVersion reports the k3s version running on the node of a machine.
+type MachineVersion struct {
+	// Machine is the name of the machine.
+	Machine string `json:"machine"`
+
+	// Version is the k3s version reported by the kubelet of the machine node.
+	Version string `json:"version"`
+}
+
+// EtcdSnapshotVerification reports the integrity check of an etcd snapshot.
+type EtcdSnapshotVerification struct {
+	// SnapshotName is the name of the snapshot.
+	SnapshotName string `json:"snapshotName"`
+
+	// NodeName is the name of the node storing the snapshot.
+	NodeName string `json:"nodeName"`
+
+	// Verified is true when the snapshot content matched its checksum.
+	Verified bool `json:"verified"`
+
+	// Message describes why the snapshot failed the integrity check.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Timestamp is when the snapshot was verified.
+	Timestamp metav1.Time `json:"timestamp"`
+}
+
+// CertificateExpiry reports when a certificate managed by the KThreesControlPlane expires.
+type CertificateExpiry struct {
+	// Name of the certificate, e.g. ca, cca, etcd or kubeconfig, matching the suffix of the secret storing it.
+	Name string `json:"name"`
+
+	// NotAfter is when the certificate expires.
+	NotAfter metav1.Time `json:"notAfter"`
 }
 
 // LastRemediationStatus  stores info about last remediation performed.
@@ -262,6 +625,16 @@ type KThreesControlPlane struct {
 	Status KThreesControlPlaneStatus `json:"status,omitempty"`
 }
 
+// K3sVersion returns the k3s release of the control plane machines: status.resolvedVersion when it was
+// resolved from spec.version, otherwise spec.version.
+func (in *KThreesControlPlane) K3sVersion() string {
+	kubernetesVersion, _, _ := strings.Cut(in.Status.ResolvedVersion, "+")
+	if in.Status.ResolvedVersion != "" && strings.TrimPrefix(kubernetesVersion, "v") == strings.TrimPrefix(in.Spec.Version, "v") {
+		return in.Status.ResolvedVersion
+	}
+	return in.Spec.Version
+}
+
 func (in *KThreesControlPlane) GetConditions() clusterv1.Conditions {
 	return in.Status.Conditions
 }
@@ -19,12 +19,17 @@ package v1beta2
 import (
 	"context"
 	"fmt"
+	"time"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/utils/ptr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	bootstrapv1beta2 "github.com/k3s-io/cluster-api-k3s/bootstrap/api/v1beta2"
+	"github.com/k3s-io/cluster-api-k3s/pkg/versions"
 )
 
 // SetupWebhookWithManager will setup the webhooks for the KThreesControlPlane.
@@ -42,14 +47,110 @@ func (in *KThreesControlPlane) SetupWebhookWithManager(mgr ctrl.Manager) error {
 var _ admission.CustomDefaulter = &KThreesControlPlane{}
 var _ admission.CustomValidator = &KThreesControlPlane{}
 
+// minJoinInfoTokenTTL is the shortest TTL of the agent token published for externally managed nodes.
+const minJoinInfoTokenTTL = time.Hour
+
 // ValidateCreate will do any extra validation when creating a KThreesControlPlane.
-func (in *KThreesControlPlane) ValidateCreate(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
-	return []string{}, nil
+func (in *KThreesControlPlane) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	c, ok := obj.(*KThreesControlPlane)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a KThreesControlPlane but got a %T", obj))
+	}
+
+	return c.warnings(), c.validate(nil)
 }
 
 // ValidateUpdate will do any extra validation when updating a KThreesControlPlane.
-func (in *KThreesControlPlane) ValidateUpdate(_ context.Context, _, _ runtime.Object) (admission.Warnings, error) {
-	return []string{}, nil
+func (in *KThreesControlPlane) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldC, ok := oldObj.(*KThreesControlPlane)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a KThreesControlPlane but got a %T", oldObj))
+	}
+	c, ok := newObj.(*KThreesControlPlane)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a KThreesControlPlane but got a %T", newObj))
+	}
+
+	return c.warnings(), c.validate(oldC)
+}
+
+// validate validates the KThreesControlPlane; old is nil on create.
+func (in *KThreesControlPlane) validate(old *KThreesControlPlane) error {
+	var oldConfigSpec *bootstrapv1beta2.KThreesConfigSpec
+	if old != nil {
+		oldConfigSpec = &old.Spec.KThreesConfigSpec
+	}
+	allErrs := in.Spec.KThreesConfigSpec.Validate(field.NewPath("spec", "kthreesConfigSpec"), oldConfigSpec)
+	allErrs = append(allErrs, in.validateVersion(old)...)
+	allErrs = append(allErrs, validateValidityPeriod(in.Spec.CertificateValidityPeriod, field.NewPath("spec", "certificateValidityPeriod"))...)
+	allErrs = append(allErrs, validateValidityPeriod(in.Spec.CACertificateValidityPeriod, field.NewPath("spec", "caCertificateValidityPeriod"))...)
+	allErrs = append(allErrs, validateJoinInfo(in.Spec.JoinInfo, field.NewPath("spec", "joinInfo"))...)
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(GroupVersion.WithKind("KThreesControlPlane").GroupKind(), in.Name, allErrs)
+}
+
+// warnings returns the warnings about deprecated fields and risky settings of the KThreesControlPlane.
+func (in *KThreesControlPlane) warnings() admission.Warnings {
+	warnings := in.Spec.KThreesConfigSpec.Warnings(field.NewPath("spec", "kthreesConfigSpec"))
+
+	if in.Spec.KThreesConfigSpec.AgentConfig.ServerURL != "" {
+		warnings = append(warnings, "spec.kthreesConfigSpec.agentConfig.serverURL is only used by workers and is ignored by control plane machines")
+	}
+
+	if in.Spec.Replicas != nil && in.Spec.KThreesConfigSpec.IsEtcdEmbedded() {
+		replicas := *in.Spec.Replicas
+		switch {
+		case replicas == 1:
+			warnings = append(warnings, "spec.replicas: a single control plane replica with embedded etcd does not tolerate the loss of its machine, "+
+				"make sure etcd snapshots are stored outside of it")
+		case replicas > 1 && replicas%2 == 0:
+			warnings = append(warnings, fmt.Sprintf("spec.replicas: %d control plane replicas with embedded etcd tolerate as many failures as %d, "+
+				"use an odd number of replicas", replicas, replicas-1))
+		}
+	}
+
+	return warnings
+}
+
+// validateVersion rejects versions outside of the supported versions matrix. Existing control planes
+// are only checked when their version changes, so they can still be updated after the matrix moves on.
+func (in *KThreesControlPlane) validateVersion(old *KThreesControlPlane) field.ErrorList {
+	if in.Spec.Version == "" || (old != nil && old.Spec.Version == in.Spec.Version) {
+		return nil
+	}
+
+	if _, ok := in.Annotations[SkipVersionCheckAnnotation]; ok {
+		return nil
+	}
+
+	if err := versions.CheckSupported(in.Spec.Version); err != nil {
+		return field.ErrorList{
+			field.Invalid(field.NewPath("spec", "version"), in.Spec.Version,
+				fmt.Sprintf("%v; set the %s annotation to use it anyway", err, SkipVersionCheckAnnotation)),
+		}
+	}
+
+	return nil
+}
+
+func validateValidityPeriod(validityPeriod *metav1.Duration, path *field.Path) field.ErrorList {
+	if validityPeriod != nil && validityPeriod.Duration <= 0 {
+		return field.ErrorList{field.Invalid(path, validityPeriod.Duration.String(), "must be positive")}
+	}
+	return nil
+}
+
+// validateJoinInfo rejects agent token TTLs shorter than minJoinInfoTokenTTL, as the token is rotated by the
+// periodic reconcile of the KThreesControlPlane.
+func validateJoinInfo(joinInfo *JoinInfo, path *field.Path) field.ErrorList {
+	if joinInfo != nil && joinInfo.TokenTTL != nil && joinInfo.TokenTTL.Duration < minJoinInfoTokenTTL {
+		return field.ErrorList{field.Invalid(path.Child("tokenTTL"), joinInfo.TokenTTL.Duration.String(),
+			fmt.Sprintf("must be at least %s", minJoinInfoTokenTTL))}
+	}
+	return nil
 }
 
 // ValidateDelete allows you to add any extra validation when deleting.
@@ -78,11 +179,5 @@ func defaultKThreesControlPlaneSpec(s *KThreesControlPlaneSpec, namespace string
 		s.MachineTemplate.InfrastructureRef.Namespace = namespace
 	}
 
-	if s.KThreesConfigSpec.ServerConfig.DisableCloudController == nil {
-		s.KThreesConfigSpec.ServerConfig.DisableCloudController = ptr.To(true)
-	}
-
-	if s.KThreesConfigSpec.ServerConfig.CloudProviderName == nil {
-		s.KThreesConfigSpec.ServerConfig.CloudProviderName = ptr.To("external")
-	}
+	s.KThreesConfigSpec.Default()
 }
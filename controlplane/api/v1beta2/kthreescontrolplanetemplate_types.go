@@ -54,6 +54,55 @@ type KThreesControlPlaneTemplateResourceSpec struct {
 	// The RemediationStrategy that controls how control plane machine remediation happens.
 	// +optional
 	RemediationStrategy *RemediationStrategy `json:"remediationStrategy,omitempty"`
+
+	// CertificateValidityPeriod is how long the client certificates generated by the KThreesControlPlane,
+	// such as the admin kubeconfig one, are valid for. Defaults to 1 year.
+	// +optional
+	CertificateValidityPeriod *metav1.Duration `json:"certificateValidityPeriod,omitempty"`
+
+	// CACertificateValidityPeriod is how long the certificate authorities generated by the KThreesControlPlane
+	// are valid for. It only applies to certificate authorities generated after it is set. Defaults to 10 years.
+	// +optional
+	CACertificateValidityPeriod *metav1.Duration `json:"caCertificateValidityPeriod,omitempty"`
+
+	// SpareReplicas is the number of spare machines to keep provisioned, joined as tainted agents with the
+	// server configuration staged. A spare machine is promoted to a server when the control plane scales up,
+	// e.g. to replace a remediated machine, which is much faster than provisioning a new machine.
+	// Spare machines are not counted in replicas.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	SpareReplicas *int32 `json:"spareReplicas,omitempty"`
+
+	// The RolloutStrategy that controls how control plane machines are replaced during a rollout.
+	// +optional
+	RolloutStrategy *RolloutStrategy `json:"rolloutStrategy,omitempty"`
+
+	// ClusterInitFailureDomain pins the failure domain of the initial control plane machine, the one initializing
+	// the cluster with --cluster-init, e.g. to run the first etcd member on hardware with local NVMe while the other
+	// servers are virtualized. It must be one of the control plane failure domains of the Cluster; defaults to the
+	// failure domain with the fewest control plane machines.
+	// +optional
+	ClusterInitFailureDomain *string `json:"clusterInitFailureDomain,omitempty"`
+
+	// VersionBuildPolicy is how a plain Kubernetes version, e.g. v1.30.4 set by a ClusterClass topology, is
+	// resolved to a k3s release: FirstBuild uses +k3s1 and LatestKnownBuild the latest build listed in the
+	// supported versions matrix. The resolved release is pinned in status.resolvedVersion until the version
+	// changes. Versions with a k3s build, e.g. v1.30.4+k3s2, are used as is. Defaults to FirstBuild.
+	// +optional
+	VersionBuildPolicy VersionBuildPolicy `json:"versionBuildPolicy,omitempty"`
+
+	// ConfigDriftPolicy is what is done when the k3s configuration files of a server, config.yaml and the private
+	// registry configuration, no longer match the ones it was bootstrapped with: Report surfaces the drift with the
+	// NodeConfigInSync condition and Reapply also writes the files back and restarts k3s, one server at a time.
+	// Defaults to Report.
+	// +optional
+	ConfigDriftPolicy ConfigDriftPolicy `json:"configDriftPolicy,omitempty"`
+
+	// JoinInfo publishes in the <cluster>-join-info secret what externally managed nodes, e.g. appliances or edge
+	// devices which are not Cluster API Machines, need to join the cluster as agents: the server URL, the hash of
+	// the cluster CA and an agent token with a limited TTL, rotated before it expires.
+	// +optional
+	JoinInfo *JoinInfo `json:"joinInfo,omitempty"`
 }
 
 // +kubebuilder:object:root=true
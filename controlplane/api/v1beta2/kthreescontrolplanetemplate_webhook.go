@@ -0,0 +1,109 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta2
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	bootstrapv1beta2 "github.com/k3s-io/cluster-api-k3s/bootstrap/api/v1beta2"
+)
+
+// SetupWebhookWithManager will setup the webhooks for the KThreesControlPlaneTemplate.
+func (in *KThreesControlPlaneTemplate) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(in).
+		WithDefaulter(&KThreesControlPlaneTemplate{}).
+		WithValidator(&KThreesControlPlaneTemplate{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-controlplane-cluster-x-k8s-io-v1beta2-kthreescontrolplanetemplate,mutating=false,failurePolicy=fail,matchPolicy=Equivalent,groups=controlplane.cluster.x-k8s.io,resources=kthreescontrolplanetemplates,versions=v1beta2,name=validation.kthreescontrolplanetemplate.controlplane.cluster.x-k8s.io,sideEffects=None,admissionReviewVersions=v1;v1beta1
+// +kubebuilder:webhook:verbs=create;update,path=/mutate-controlplane-cluster-x-k8s-io-v1beta2-kthreescontrolplanetemplate,mutating=true,failurePolicy=fail,matchPolicy=Equivalent,groups=controlplane.cluster.x-k8s.io,resources=kthreescontrolplanetemplates,versions=v1beta2,name=default.kthreescontrolplanetemplate.controlplane.cluster.x-k8s.io,sideEffects=None,admissionReviewVersions=v1;v1beta1
+
+var _ admission.CustomDefaulter = &KThreesControlPlaneTemplate{}
+var _ admission.CustomValidator = &KThreesControlPlaneTemplate{}
+
+// ValidateCreate will do any extra validation when creating a KThreesControlPlaneTemplate.
+func (in *KThreesControlPlaneTemplate) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	template, ok := obj.(*KThreesControlPlaneTemplate)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a KThreesControlPlaneTemplate but got a %T", obj))
+	}
+
+	return template.warnings(), template.validate(nil)
+}
+
+// ValidateUpdate will do any extra validation when updating a KThreesControlPlaneTemplate.
+func (in *KThreesControlPlaneTemplate) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldTemplate, ok := oldObj.(*KThreesControlPlaneTemplate)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a KThreesControlPlaneTemplate but got a %T", oldObj))
+	}
+	template, ok := newObj.(*KThreesControlPlaneTemplate)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected a KThreesControlPlaneTemplate but got a %T", newObj))
+	}
+
+	return template.warnings(), template.validate(oldTemplate)
+}
+
+// validate runs the KThreesControlPlane validation on the spec of the template, so errors are caught
+// before a control plane is created from it; old is nil on create.
+func (in *KThreesControlPlaneTemplate) validate(old *KThreesControlPlaneTemplate) error {
+	specPath := field.NewPath("spec", "template", "spec")
+	var oldConfigSpec *bootstrapv1beta2.KThreesConfigSpec
+	if old != nil {
+		oldConfigSpec = &old.Spec.Template.Spec.KThreesConfigSpec
+	}
+	allErrs := in.Spec.Template.Spec.KThreesConfigSpec.Validate(specPath.Child("kthreesConfigSpec"), oldConfigSpec)
+	allErrs = append(allErrs, validateValidityPeriod(in.Spec.Template.Spec.CertificateValidityPeriod, specPath.Child("certificateValidityPeriod"))...)
+	allErrs = append(allErrs, validateValidityPeriod(in.Spec.Template.Spec.CACertificateValidityPeriod, specPath.Child("caCertificateValidityPeriod"))...)
+	allErrs = append(allErrs, validateJoinInfo(in.Spec.Template.Spec.JoinInfo, specPath.Child("joinInfo"))...)
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(GroupVersion.WithKind("KThreesControlPlaneTemplate").GroupKind(), in.Name, allErrs)
+}
+
+// warnings returns the warnings about deprecated fields and risky settings of the KThreesControlPlaneTemplate.
+func (in *KThreesControlPlaneTemplate) warnings() admission.Warnings {
+	return in.Spec.Template.Spec.KThreesConfigSpec.Warnings(field.NewPath("spec", "template", "spec", "kthreesConfigSpec"))
+}
+
+// ValidateDelete allows you to add any extra validation when deleting.
+func (in *KThreesControlPlaneTemplate) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return []string{}, nil
+}
+
+// Default will set default values for the KThreesControlPlaneTemplate.
+func (in *KThreesControlPlaneTemplate) Default(_ context.Context, obj runtime.Object) error {
+	template, ok := obj.(*KThreesControlPlaneTemplate)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected a KThreesControlPlaneTemplate but got a %T", obj))
+	}
+
+	template.Spec.Template.Spec.KThreesConfigSpec.Default()
+	return nil
+}
@@ -26,6 +26,110 @@ import (
 	"sigs.k8s.io/cluster-api/api/v1beta1"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertificateExpiry) DeepCopyInto(out *CertificateExpiry) {
+	*out = *in
+	in.NotAfter.DeepCopyInto(&out.NotAfter)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertificateExpiry.
+func (in *CertificateExpiry) DeepCopy() *CertificateExpiry {
+	if in == nil {
+		return nil
+	}
+	out := new(CertificateExpiry)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EtcdCertificateExpiry) DeepCopyInto(out *EtcdCertificateExpiry) {
+	*out = *in
+	in.NotAfter.DeepCopyInto(&out.NotAfter)
+	in.LastChecked.DeepCopyInto(&out.LastChecked)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EtcdCertificateExpiry.
+func (in *EtcdCertificateExpiry) DeepCopy() *EtcdCertificateExpiry {
+	if in == nil {
+		return nil
+	}
+	out := new(EtcdCertificateExpiry)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EtcdSnapshotVerification) DeepCopyInto(out *EtcdSnapshotVerification) {
+	*out = *in
+	in.Timestamp.DeepCopyInto(&out.Timestamp)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EtcdSnapshotVerification.
+func (in *EtcdSnapshotVerification) DeepCopy() *EtcdSnapshotVerification {
+	if in == nil {
+		return nil
+	}
+	out := new(EtcdSnapshotVerification)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FailureDomainMachines) DeepCopyInto(out *FailureDomainMachines) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FailureDomainMachines.
+func (in *FailureDomainMachines) DeepCopy() *FailureDomainMachines {
+	if in == nil {
+		return nil
+	}
+	out := new(FailureDomainMachines)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FailureDomainsStatus) DeepCopyInto(out *FailureDomainsStatus) {
+	*out = *in
+	if in.Machines != nil {
+		in, out := &in.Machines, &out.Machines
+		*out = make([]FailureDomainMachines, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FailureDomainsStatus.
+func (in *FailureDomainsStatus) DeepCopy() *FailureDomainsStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(FailureDomainsStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JoinInfo) DeepCopyInto(out *JoinInfo) {
+	*out = *in
+	if in.TokenTTL != nil {
+		in, out := &in.TokenTTL, &out.TokenTTL
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JoinInfo.
+func (in *JoinInfo) DeepCopy() *JoinInfo {
+	if in == nil {
+		return nil
+	}
+	out := new(JoinInfo)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KThreesControlPlane) DeepCopyInto(out *KThreesControlPlane) {
 	*out = *in
@@ -53,6 +157,21 @@ func (in *KThreesControlPlane) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KThreesControlPlaneInitializationStatus) DeepCopyInto(out *KThreesControlPlaneInitializationStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KThreesControlPlaneInitializationStatus.
+func (in *KThreesControlPlaneInitializationStatus) DeepCopy() *KThreesControlPlaneInitializationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KThreesControlPlaneInitializationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KThreesControlPlaneList) DeepCopyInto(out *KThreesControlPlaneList) {
 	*out = *in
@@ -105,6 +224,11 @@ func (in *KThreesControlPlaneMachineTemplate) DeepCopyInto(out *KThreesControlPl
 		*out = new(v1.Duration)
 		**out = **in
 	}
+	if in.PreDrainDeleteHooks != nil {
+		in, out := &in.PreDrainDeleteHooks, &out.PreDrainDeleteHooks
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KThreesControlPlaneMachineTemplate.
@@ -136,6 +260,36 @@ func (in *KThreesControlPlaneSpec) DeepCopyInto(out *KThreesControlPlaneSpec) {
 		*out = new(RemediationStrategy)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.CertificateValidityPeriod != nil {
+		in, out := &in.CertificateValidityPeriod, &out.CertificateValidityPeriod
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.CACertificateValidityPeriod != nil {
+		in, out := &in.CACertificateValidityPeriod, &out.CACertificateValidityPeriod
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.SpareReplicas != nil {
+		in, out := &in.SpareReplicas, &out.SpareReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.RolloutStrategy != nil {
+		in, out := &in.RolloutStrategy, &out.RolloutStrategy
+		*out = new(RolloutStrategy)
+		**out = **in
+	}
+	if in.ClusterInitFailureDomain != nil {
+		in, out := &in.ClusterInitFailureDomain, &out.ClusterInitFailureDomain
+		*out = new(string)
+		**out = **in
+	}
+	if in.JoinInfo != nil {
+		in, out := &in.JoinInfo, &out.JoinInfo
+		*out = new(JoinInfo)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KThreesControlPlaneSpec.
@@ -156,6 +310,11 @@ func (in *KThreesControlPlaneStatus) DeepCopyInto(out *KThreesControlPlaneStatus
 		*out = new(string)
 		**out = **in
 	}
+	if in.Initialization != nil {
+		in, out := &in.Initialization, &out.Initialization
+		*out = new(KThreesControlPlaneInitializationStatus)
+		**out = **in
+	}
 	if in.FailureMessage != nil {
 		in, out := &in.FailureMessage, &out.FailureMessage
 		*out = new(string)
@@ -173,6 +332,54 @@ func (in *KThreesControlPlaneStatus) DeepCopyInto(out *KThreesControlPlaneStatus
 		*out = new(LastRemediationStatus)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.CertificateExpiries != nil {
+		in, out := &in.CertificateExpiries, &out.CertificateExpiries
+		*out = make([]CertificateExpiry, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RolloutPlan != nil {
+		in, out := &in.RolloutPlan, &out.RolloutPlan
+		*out = make([]MachineRolloutPlan, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.MachineVersions != nil {
+		in, out := &in.MachineVersions, &out.MachineVersions
+		*out = make([]MachineVersion, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastSnapshotVerified != nil {
+		in, out := &in.LastSnapshotVerified, &out.LastSnapshotVerified
+		*out = new(EtcdSnapshotVerification)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Rollout != nil {
+		in, out := &in.Rollout, &out.Rollout
+		*out = new(RolloutStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.FailureDomains != nil {
+		in, out := &in.FailureDomains, &out.FailureDomains
+		*out = new(FailureDomainsStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.EtcdCertificateExpiries != nil {
+		in, out := &in.EtcdCertificateExpiries, &out.EtcdCertificateExpiries
+		*out = make([]EtcdCertificateExpiry, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.NodeConfigDrift != nil {
+		in, out := &in.NodeConfigDrift, &out.NodeConfigDrift
+		*out = make([]NodeConfigDrift, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KThreesControlPlaneStatus.
@@ -274,6 +481,36 @@ func (in *KThreesControlPlaneTemplateResourceSpec) DeepCopyInto(out *KThreesCont
 		*out = new(RemediationStrategy)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.CertificateValidityPeriod != nil {
+		in, out := &in.CertificateValidityPeriod, &out.CertificateValidityPeriod
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.CACertificateValidityPeriod != nil {
+		in, out := &in.CACertificateValidityPeriod, &out.CACertificateValidityPeriod
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.SpareReplicas != nil {
+		in, out := &in.SpareReplicas, &out.SpareReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.RolloutStrategy != nil {
+		in, out := &in.RolloutStrategy, &out.RolloutStrategy
+		*out = new(RolloutStrategy)
+		**out = **in
+	}
+	if in.ClusterInitFailureDomain != nil {
+		in, out := &in.ClusterInitFailureDomain, &out.ClusterInitFailureDomain
+		*out = new(string)
+		**out = **in
+	}
+	if in.JoinInfo != nil {
+		in, out := &in.JoinInfo, &out.JoinInfo
+		*out = new(JoinInfo)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KThreesControlPlaneTemplateResourceSpec.
@@ -318,6 +555,62 @@ func (in *LastRemediationStatus) DeepCopy() *LastRemediationStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MachineRolloutPlan) DeepCopyInto(out *MachineRolloutPlan) {
+	*out = *in
+	if in.Reasons != nil {
+		in, out := &in.Reasons, &out.Reasons
+		*out = make([]RolloutReason, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MachineRolloutPlan.
+func (in *MachineRolloutPlan) DeepCopy() *MachineRolloutPlan {
+	if in == nil {
+		return nil
+	}
+	out := new(MachineRolloutPlan)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MachineVersion) DeepCopyInto(out *MachineVersion) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MachineVersion.
+func (in *MachineVersion) DeepCopy() *MachineVersion {
+	if in == nil {
+		return nil
+	}
+	out := new(MachineVersion)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeConfigDrift) DeepCopyInto(out *NodeConfigDrift) {
+	*out = *in
+	if in.Files != nil {
+		in, out := &in.Files, &out.Files
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.LastChecked.DeepCopyInto(&out.LastChecked)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeConfigDrift.
+func (in *NodeConfigDrift) DeepCopy() *NodeConfigDrift {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeConfigDrift)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RemediationStrategy) DeepCopyInto(out *RemediationStrategy) {
 	*out = *in
@@ -343,3 +636,35 @@ func (in *RemediationStrategy) DeepCopy() *RemediationStrategy {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RolloutStatus) DeepCopyInto(out *RolloutStatus) {
+	*out = *in
+	in.StartTime.DeepCopyInto(&out.StartTime)
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RolloutStatus.
+func (in *RolloutStatus) DeepCopy() *RolloutStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RolloutStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RolloutStrategy) DeepCopyInto(out *RolloutStrategy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RolloutStrategy.
+func (in *RolloutStrategy) DeepCopy() *RolloutStrategy {
+	if in == nil {
+		return nil
+	}
+	out := new(RolloutStrategy)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -23,9 +23,13 @@ const (
 	// all control plane machines have been deleted.
 	deleteRequeueAfter = 30 * time.Second
 
-	// preflightFailedRequeueAfter is how long to wait before trying to scale
+	// defaultPreflightFailedRequeueAfter is how long to wait before trying to scale
 	// up/down if some preflight check for those operation has failed.
-	preflightFailedRequeueAfter = 15 * time.Second
+	defaultPreflightFailedRequeueAfter = 15 * time.Second
+
+	// defaultNotReadyRequeueAfter is how long to wait before checking again the workload
+	// cluster readiness while the control plane is not ready or its components are unhealthy.
+	defaultNotReadyRequeueAfter = 20 * time.Second
 
 	// dependentCertRequeueAfter is how long to wait before checking again to see if
 	// dependent certificates have been created.
@@ -35,6 +39,43 @@ const (
 	// etcd member is successfully removed.
 	etcdRemovalRequeueAfter = 30 * time.Second
 
+	// servingCertsRotationRequeueAfter is how long to wait before checking again to see if
+	// k3s restarted with new serving certificates.
+	servingCertsRotationRequeueAfter = 15 * time.Second
+
+	// etcdCertsRotationRequeueAfter is how long to wait before checking again to see if
+	// the etcd certificates of a server are read or k3s restarted with new ones.
+	etcdCertsRotationRequeueAfter = 15 * time.Second
+
+	// etcdCertsCheckInterval is how often the etcd certificates of the servers are read.
+	etcdCertsCheckInterval = 24 * time.Hour
+
+	// etcdCertsRotationThreshold is how long before the etcd certificates of a server expire they are rotated.
+	etcdCertsRotationThreshold = 30 * 24 * time.Hour
+
+	// nodeConfigRequeueAfter is how long to wait before checking again to see if the k3s
+	// configuration files of a server are read or k3s restarted with the reapplied ones.
+	nodeConfigRequeueAfter = 15 * time.Second
+
+	// nodeConfigCheckInterval is how often the k3s configuration files of the servers are compared.
+	nodeConfigCheckInterval = 10 * time.Minute
+
+	// sparePromotionRequeueAfter is how long to wait before checking again to see if
+	// the node of a promoted spare machine restarted as a server.
+	sparePromotionRequeueAfter = 15 * time.Second
+
+	// defaultJoinInfoTokenTTL is how long the agent token published for externally managed
+	// nodes is valid for when no TTL is configured.
+	defaultJoinInfoTokenTTL = 24 * time.Hour
+
+	// certificatesExpiringSoonThreshold is how long before a certificate expires the
+	// CertificatesExpiringSoon condition is set.
+	certificatesExpiringSoonThreshold = 30 * 24 * time.Hour
+
+	// defaultEtcdSnapshotRetention is the number of scheduled etcd snapshots k3s keeps
+	// when no retention is configured.
+	defaultEtcdSnapshotRetention = 5
+
 	k3sHookName = "k3s"
 
 	kcpManagerName = "capi-kthreescontrolplane"
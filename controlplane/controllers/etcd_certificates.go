@@ -0,0 +1,145 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	controlplanev1 "github.com/k3s-io/cluster-api-k3s/controlplane/api/v1beta2"
+	k3s "github.com/k3s-io/cluster-api-k3s/pkg/k3s"
+)
+
+// reconcileEtcdCertificates records in status.etcdCertificateExpiries when the etcd server and peer certificates of
+// each server expire, reading them again every etcdCertsCheckInterval, and rotates them one server at a time
+// within etcdCertsRotationThreshold of their expiry, so that long-lived clusters do not lose etcd quorum to expired
+// peer certificates.
+func (r *KThreesControlPlaneReconciler) reconcileEtcdCertificates(ctx context.Context, controlPlane *k3s.ControlPlane) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	if !controlPlane.IsEtcdManaged() || !controlPlane.KCP.Status.Initialized {
+		conditions.Delete(controlPlane.KCP, controlplanev1.EtcdCertificatesValidCondition)
+		controlPlane.KCP.Status.EtcdCertificateExpiries = nil
+		return ctrl.Result{}, nil
+	}
+
+	workloadCluster, err := r.managementCluster.GetWorkloadCluster(ctx, util.ObjectKey(controlPlane.Cluster))
+	if err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "cannot get remote client to workload cluster")
+	}
+
+	now := time.Now()
+	expiries := make([]controlplanev1.EtcdCertificateExpiry, 0, controlPlane.Machines.Len())
+	checked := map[string]controlplanev1.EtcdCertificateExpiry{}
+	for _, expiry := range controlPlane.KCP.Status.EtcdCertificateExpiries {
+		checked[expiry.Machine] = expiry
+	}
+
+	pending := false
+	for _, machine := range controlPlane.Machines.SortedByCreationTimestamp() {
+		expiry, ok := checked[machine.Name]
+		if ok && now.Sub(expiry.LastChecked.Time) < etcdCertsCheckInterval {
+			expiries = append(expiries, expiry)
+			continue
+		}
+		if machine.Status.NodeRef == nil {
+			pending = true
+			continue
+		}
+
+		notAfter, done, err := workloadCluster.EtcdCertificatesNotAfter(ctx, machine.Status.NodeRef.Name)
+		if err != nil {
+			log.Error(err, "Failed to read the etcd certificates", "machine", machine.Name)
+			conditions.MarkUnknown(controlPlane.KCP, controlplanev1.EtcdCertificatesValidCondition, controlplanev1.EtcdCertificatesInspectionFailedReason,
+				"Failed to read the etcd certificates of Machine %s", machine.Name)
+		}
+		if err != nil || !done {
+			if ok {
+				expiries = append(expiries, expiry)
+			}
+			pending = true
+			continue
+		}
+
+		expiries = append(expiries, controlplanev1.EtcdCertificateExpiry{
+			Machine:     machine.Name,
+			NotAfter:    metav1.NewTime(notAfter),
+			LastChecked: metav1.NewTime(now),
+		})
+	}
+	sort.Slice(expiries, func(i, j int) bool { return expiries[i].Machine < expiries[j].Machine })
+	controlPlane.KCP.Status.EtcdCertificateExpiries = expiries
+
+	var expiring *controlplanev1.EtcdCertificateExpiry
+	for i := range expiries {
+		if expiries[i].NotAfter.Sub(now) > etcdCertsRotationThreshold {
+			continue
+		}
+		if expiring == nil || expiries[i].NotAfter.Before(&expiring.NotAfter) {
+			expiring = &expiries[i]
+		}
+	}
+
+	if expiring == nil {
+		if pending {
+			return ctrl.Result{RequeueAfter: etcdCertsRotationRequeueAfter}, nil
+		}
+		conditions.MarkTrue(controlPlane.KCP, controlplanev1.EtcdCertificatesValidCondition)
+		return ctrl.Result{}, nil
+	}
+
+	conditions.MarkFalse(controlPlane.KCP, controlplanev1.EtcdCertificatesValidCondition, controlplanev1.EtcdCertificatesRotatingReason, clusterv1.ConditionSeverityWarning,
+		"The etcd certificates of Machine %s expire on %s", expiring.Machine, expiring.NotAfter.UTC().Format(time.RFC3339))
+
+	// Only restart k3s on a healthy control plane, so that a single etcd member is unavailable at a time.
+	if !conditions.IsTrue(controlPlane.KCP, controlplanev1.ControlPlaneComponentsHealthyCondition) ||
+		!conditions.IsTrue(controlPlane.KCP, controlplanev1.EtcdClusterHealthyCondition) {
+		log.Info("Waiting for the control plane to be healthy before rotating etcd certificates")
+		return ctrl.Result{RequeueAfter: etcdCertsRotationRequeueAfter}, nil
+	}
+
+	machine, ok := controlPlane.Machines[expiring.Machine]
+	if !ok || machine.Status.NodeRef == nil {
+		return ctrl.Result{RequeueAfter: etcdCertsRotationRequeueAfter}, nil
+	}
+
+	done, err := workloadCluster.RotateEtcdCerts(ctx, machine.Status.NodeRef.Name)
+	if err != nil {
+		return ctrl.Result{}, errors.Wrapf(err, "failed to rotate etcd certificates of Machine %s", machine.Name)
+	}
+	if !done {
+		log.Info("Rotating etcd certificates", "machine", machine.Name)
+		return ctrl.Result{RequeueAfter: etcdCertsRotationRequeueAfter}, nil
+	}
+
+	// Drop the expiry of the machine so that its new certificates are read on the next reconcile.
+	controlPlane.KCP.Status.EtcdCertificateExpiries = slices.DeleteFunc(expiries, func(expiry controlplanev1.EtcdCertificateExpiry) bool {
+		return expiry.Machine == machine.Name
+	})
+
+	log.Info("Rotated etcd certificates", "machine", machine.Name)
+	return ctrl.Result{Requeue: true}, nil
+}
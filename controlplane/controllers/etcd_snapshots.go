@@ -0,0 +1,203 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	controlplanev1 "github.com/k3s-io/cluster-api-k3s/controlplane/api/v1beta2"
+	k3s "github.com/k3s-io/cluster-api-k3s/pkg/k3s"
+)
+
+// reconcileEtcdSnapshots prunes the etcd snapshots older than spec.kthreesConfigSpec.serverConfig.etcdSnapshots.maxAge
+// and surfaces with the EtcdSnapshotsPruned condition the snapshots kept beyond the retention count, e.g. when k3s
+// fails to prune them. It is best effort and does not block the other control plane operations.
+func (r *KThreesControlPlaneReconciler) reconcileEtcdSnapshots(ctx context.Context, controlPlane *k3s.ControlPlane) {
+	log := ctrl.LoggerFrom(ctx)
+
+	etcdSnapshots := controlPlane.KCP.Spec.KThreesConfigSpec.ServerConfig.EtcdSnapshots
+	if etcdSnapshots == nil || !controlPlane.IsEtcdManaged() || !controlPlane.KCP.Status.Initialized {
+		conditions.Delete(controlPlane.KCP, controlplanev1.EtcdSnapshotsPrunedCondition)
+		controlPlane.KCP.Status.LastSnapshotVerified = nil
+		return
+	}
+
+	workloadCluster, err := r.managementCluster.GetWorkloadCluster(ctx, util.ObjectKey(controlPlane.Cluster))
+	if err != nil {
+		conditions.MarkUnknown(controlPlane.KCP, controlplanev1.EtcdSnapshotsPrunedCondition, controlplanev1.EtcdSnapshotsInspectionFailedReason, "Failed to connect to the workload cluster: %v", err)
+		return
+	}
+
+	snapshots, err := workloadCluster.ListEtcdSnapshots(ctx)
+	if err != nil {
+		conditions.MarkUnknown(controlPlane.KCP, controlplanev1.EtcdSnapshotsPrunedCondition, controlplanev1.EtcdSnapshotsInspectionFailedReason, "Failed to list etcd snapshots: %v", err)
+		return
+	}
+
+	nodeNames := []string{}
+	for _, machine := range controlPlane.Machines {
+		if machine.Status.NodeRef != nil {
+			nodeNames = append(nodeNames, machine.Status.NodeRef.Name)
+		}
+	}
+	sort.Strings(nodeNames)
+
+	if etcdSnapshots.Verify {
+		r.verifyLatestEtcdSnapshot(ctx, controlPlane, workloadCluster, snapshots, nodeNames)
+	} else {
+		controlPlane.KCP.Status.LastSnapshotVerified = nil
+	}
+
+	retention := defaultEtcdSnapshotRetention
+	if etcdSnapshots.Retention != nil {
+		retention = int(*etcdSnapshots.Retention)
+	}
+
+	expired := 0
+	toPrune := map[string][]string{}
+	scheduled := map[string]int{}
+	for _, snapshot := range snapshots {
+		if etcdSnapshots.MaxAge != nil && !snapshot.CreationTime.IsZero() && time.Since(snapshot.CreationTime) > etcdSnapshots.MaxAge.Duration {
+			expired++
+			if nodeName := etcdSnapshotPruneNode(snapshot, nodeNames); nodeName != "" {
+				toPrune[nodeName] = append(toPrune[nodeName], snapshot.Name)
+			}
+			continue
+		}
+		if strings.HasPrefix(snapshot.Name, k3s.ScheduledEtcdSnapshotPrefix) {
+			scheduled[etcdSnapshotLocation(snapshot)]++
+		}
+	}
+
+	for _, nodeName := range nodeNames {
+		names := toPrune[nodeName]
+		if len(names) == 0 {
+			continue
+		}
+		// Local and S3 copies of a snapshot share the same name and are deleted together.
+		sort.Strings(names)
+		names = slices.Compact(names)
+
+		done, err := workloadCluster.PruneEtcdSnapshots(ctx, nodeName, names)
+		if err != nil {
+			log.Error(err, "Failed to prune etcd snapshots", "node", nodeName)
+			continue
+		}
+		if done {
+			log.Info("Pruned etcd snapshots older than the max age", "node", nodeName, "snapshots", names)
+		}
+	}
+
+	problems := []string{}
+	if expired > 0 {
+		problems = append(problems, fmt.Sprintf("%d snapshots older than %s", expired, etcdSnapshots.MaxAge.Duration))
+	}
+	locations := make([]string, 0, len(scheduled))
+	for location := range scheduled {
+		locations = append(locations, location)
+	}
+	sort.Strings(locations)
+	for _, location := range locations {
+		if scheduled[location] > retention {
+			problems = append(problems, fmt.Sprintf("%d scheduled snapshots %s, above the retention of %d", scheduled[location], location, retention))
+		}
+	}
+
+	if len(problems) > 0 {
+		conditions.MarkFalse(controlPlane.KCP, controlplanev1.EtcdSnapshotsPrunedCondition, controlplanev1.EtcdSnapshotsNotPrunedReason, clusterv1.ConditionSeverityWarning, "Etcd snapshots are not pruned: %s", strings.Join(problems, "; "))
+		return
+	}
+	conditions.MarkTrue(controlPlane.KCP, controlplanev1.EtcdSnapshotsPrunedCondition)
+}
+
+// verifyLatestEtcdSnapshot checks the integrity of the latest local snapshot of the servers, if not verified yet,
+// and reports the result in status.lastSnapshotVerified.
+func (r *KThreesControlPlaneReconciler) verifyLatestEtcdSnapshot(ctx context.Context, controlPlane *k3s.ControlPlane, workloadCluster k3s.WorkloadCluster, snapshots []k3s.EtcdSnapshot, nodeNames []string) {
+	log := ctrl.LoggerFrom(ctx)
+
+	var latest *k3s.EtcdSnapshot
+	for i, snapshot := range snapshots {
+		// Compressed snapshots have to be extracted to be verified.
+		if snapshot.S3 || !snapshot.ReadyToUse || strings.HasSuffix(snapshot.Location, ".zip") || !slices.Contains(nodeNames, snapshot.NodeName) {
+			continue
+		}
+		if latest == nil || snapshot.CreationTime.After(latest.CreationTime) {
+			latest = &snapshots[i]
+		}
+	}
+
+	last := controlPlane.KCP.Status.LastSnapshotVerified
+	if latest == nil || (last != nil && last.SnapshotName == latest.Name && last.NodeName == latest.NodeName) {
+		return
+	}
+
+	done, err := workloadCluster.VerifyEtcdSnapshot(ctx, *latest)
+	verification := &controlplanev1.EtcdSnapshotVerification{
+		SnapshotName: latest.Name,
+		NodeName:     latest.NodeName,
+		Timestamp:    metav1.Now(),
+	}
+	switch {
+	case errors.Is(err, k3s.ErrEtcdSnapshotCorrupt):
+		verification.Message = err.Error()
+		r.recorder.Eventf(controlPlane.KCP, corev1.EventTypeWarning, "EtcdSnapshotCorrupt",
+			"Etcd snapshot %s on node %s does not match its checksum", latest.Name, latest.NodeName)
+	case err != nil:
+		log.Error(err, "Failed to verify etcd snapshot", "snapshot", latest.Name, "node", latest.NodeName)
+		return
+	case !done:
+		return
+	default:
+		verification.Verified = true
+		log.Info("Verified etcd snapshot", "snapshot", latest.Name, "node", latest.NodeName)
+	}
+	controlPlane.KCP.Status.LastSnapshotVerified = verification
+}
+
+// etcdSnapshotPruneNode returns the node to prune the snapshot from: the node that took it, or for S3 snapshots of
+// nodes that left the cluster any server, since S3 snapshots are shared. It returns an empty string when the snapshot
+// cannot be pruned.
+func etcdSnapshotPruneNode(snapshot k3s.EtcdSnapshot, nodeNames []string) string {
+	if slices.Contains(nodeNames, snapshot.NodeName) {
+		return snapshot.NodeName
+	}
+	if snapshot.S3 && len(nodeNames) > 0 {
+		return nodeNames[0]
+	}
+	return ""
+}
+
+// etcdSnapshotLocation returns where the snapshot is stored, k3s applying the retention count per location.
+func etcdSnapshotLocation(snapshot k3s.EtcdSnapshot) string {
+	if snapshot.S3 {
+		return fmt.Sprintf("in S3 for node %s", snapshot.NodeName)
+	}
+	return fmt.Sprintf("on node %s", snapshot.NodeName)
+}
@@ -0,0 +1,272 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	bootstrapv1 "github.com/k3s-io/cluster-api-k3s/bootstrap/api/v1beta2"
+	controlplanev1 "github.com/k3s-io/cluster-api-k3s/controlplane/api/v1beta2"
+	k3s "github.com/k3s-io/cluster-api-k3s/pkg/k3s"
+	"github.com/k3s-io/cluster-api-k3s/pkg/util/ssa"
+)
+
+// genericInfrastructureMachineTemplateGVK is the infrastructure machine template kind used by the tests; the
+// infrastructure machines are cloned from it as unstructured objects.
+var genericInfrastructureMachineTemplateGVK = schema.GroupVersionKind{
+	Group:   "infrastructure.cluster.x-k8s.io",
+	Version: "v1beta1",
+	Kind:    "GenericInfrastructureMachineTemplate",
+}
+
+func newTestScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = clusterv1.AddToScheme(scheme)
+	_ = bootstrapv1.AddToScheme(scheme)
+	_ = controlplanev1.AddToScheme(scheme)
+
+	for _, kind := range []string{"GenericInfrastructureMachine", "GenericInfrastructureMachineTemplate"} {
+		gvk := genericInfrastructureMachineTemplateGVK.GroupVersion().WithKind(kind)
+		scheme.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+		scheme.AddKnownTypeWithName(gvk.GroupVersion().WithKind(kind+"List"), &unstructured.UnstructuredList{})
+	}
+	return scheme
+}
+
+// newFakeClient returns a fake client which handles server side apply patches, that the fake client does not
+// support, by creating the object or by setting the applied fields on the existing one. The labels and annotations
+// are replaced, as the KThreesControlPlane is their only manager in the tests.
+func newFakeClient(objs ...client.Object) client.Client {
+	return fake.NewClientBuilder().
+		WithScheme(newTestScheme()).
+		WithObjects(objs...).
+		WithStatusSubresource(&clusterv1.Machine{}, &bootstrapv1.KThreesConfig{}, &controlplanev1.KThreesControlPlane{}).
+		WithInterceptorFuncs(interceptor.Funcs{Patch: applyPatch}).
+		Build()
+}
+
+func applyPatch(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	applied, ok := obj.(*unstructured.Unstructured)
+	if patch.Type() != types.ApplyPatchType || !ok {
+		// the fake client does not track managed fields, so the managed fields clean ups patch the objects on
+		// every reconcile; keep the kind of the object which the fake client resets.
+		gvk := obj.GetObjectKind().GroupVersionKind()
+		if err := c.Patch(ctx, obj, patch, opts...); err != nil {
+			return err
+		}
+		obj.GetObjectKind().SetGroupVersionKind(gvk)
+		return nil
+	}
+
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(applied.GroupVersionKind())
+	if err := c.Get(ctx, client.ObjectKeyFromObject(applied), existing); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		return c.Create(ctx, applied)
+	}
+
+	existing.SetLabels(applied.GetLabels())
+	existing.SetAnnotations(applied.GetAnnotations())
+	if ownerReferences := applied.GetOwnerReferences(); len(ownerReferences) > 0 {
+		existing.SetOwnerReferences(ownerReferences)
+	}
+	for key, value := range applied.Object {
+		switch key {
+		case "apiVersion", "kind", "metadata", "status":
+			continue
+		}
+		existing.Object[key] = mergeAppliedValue(existing.Object[key], value)
+	}
+	if err := c.Update(ctx, existing); err != nil {
+		return err
+	}
+	applied.Object = existing.Object
+	return nil
+}
+
+// mergeAppliedValue sets the applied value over the existing one, merging maps field by field.
+func mergeAppliedValue(existing, applied interface{}) interface{} {
+	existingMap, ok1 := existing.(map[string]interface{})
+	appliedMap, ok2 := applied.(map[string]interface{})
+	if !ok1 || !ok2 {
+		return applied
+	}
+	for key, value := range appliedMap {
+		existingMap[key] = mergeAppliedValue(existingMap[key], value)
+	}
+	return existingMap
+}
+
+// fakeManagementCluster is a management cluster backed by the client of the tests, whose workload cluster is
+// served by a fake client as well.
+type fakeManagementCluster struct {
+	*k3s.Management
+	Workload *k3s.Workload
+}
+
+func (f *fakeManagementCluster) GetWorkloadCluster(_ context.Context, _ client.ObjectKey) (*k3s.Workload, error) {
+	return f.Workload, nil
+}
+
+// newTestReconciler returns a reconciler using c as management cluster, and workloadClient for the workload cluster.
+func newTestReconciler(c client.Client, workloadClient client.Client) *KThreesControlPlaneReconciler {
+	managementCluster := &fakeManagementCluster{
+		Management: &k3s.Management{Client: c},
+		Workload:   &k3s.Workload{Client: workloadClient},
+	}
+	return &KThreesControlPlaneReconciler{
+		Client:                    c,
+		recorder:                  record.NewFakeRecorder(32),
+		PreflightPollInterval:     defaultPreflightFailedRequeueAfter,
+		managementCluster:         managementCluster,
+		managementClusterUncached: managementCluster,
+		ssaCache:                  ssa.NewCache(),
+	}
+}
+
+func newTestCluster() *clusterv1.Cluster {
+	return &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: metav1.NamespaceDefault,
+		},
+		Spec: clusterv1.ClusterSpec{
+			ControlPlaneEndpoint: clusterv1.APIEndpoint{Host: "example.com", Port: 6443},
+		},
+	}
+}
+
+func newTestKCP(cluster *clusterv1.Cluster) *controlplanev1.KThreesControlPlane {
+	return &controlplanev1.KThreesControlPlane{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: controlplanev1.GroupVersion.String(),
+			Kind:       "KThreesControlPlane",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-cp",
+			Namespace: cluster.Namespace,
+			UID:       "kcp-uid",
+		},
+		Spec: controlplanev1.KThreesControlPlaneSpec{
+			Version: "v1.30.4+k3s1",
+			MachineTemplate: controlplanev1.KThreesControlPlaneMachineTemplate{
+				InfrastructureRef: corev1.ObjectReference{
+					APIVersion: genericInfrastructureMachineTemplateGVK.GroupVersion().String(),
+					Kind:       genericInfrastructureMachineTemplateGVK.Kind,
+					Name:       "infra-template",
+					Namespace:  cluster.Namespace,
+				},
+			},
+		},
+		Status: controlplanev1.KThreesControlPlaneStatus{
+			Initialized: true,
+		},
+	}
+}
+
+func newTestInfraMachineTemplate(namespace string) *unstructured.Unstructured {
+	template := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{},
+				},
+			},
+		},
+	}
+	template.SetGroupVersionKind(genericInfrastructureMachineTemplateGVK)
+	template.SetNamespace(namespace)
+	template.SetName("infra-template")
+	return template
+}
+
+// newTestInfraMachine returns the infrastructure machine referenced by the machine of newTestMachine.
+func newTestInfraMachine(machine *clusterv1.Machine) *unstructured.Unstructured {
+	infraMachine := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": map[string]interface{}{},
+		},
+	}
+	infraMachine.SetGroupVersionKind(machine.Spec.InfrastructureRef.GroupVersionKind())
+	infraMachine.SetNamespace(machine.Namespace)
+	infraMachine.SetName(machine.Spec.InfrastructureRef.Name)
+	infraMachine.SetLabels(machine.Labels)
+	return infraMachine
+}
+
+// newTestMachine returns a machine of the KThreesControlPlane, and its KThreesConfig matching the control plane
+// configuration. Spare machines get the spare labels.
+func newTestMachine(cluster *clusterv1.Cluster, kcp *controlplanev1.KThreesControlPlane, name string, spare bool) (*clusterv1.Machine, *bootstrapv1.KThreesConfig) {
+	labels := k3s.ControlPlaneLabelsForCluster(cluster.Name, kcp.Spec.MachineTemplate)
+	if spare {
+		labels = k3s.SpareLabelsForCluster(cluster.Name, kcp.Spec.MachineTemplate)
+	}
+
+	config := &bootstrapv1.KThreesConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: cluster.Namespace,
+			Labels:    labels,
+		},
+		Spec: *kcp.Spec.KThreesConfigSpec.DeepCopy(),
+	}
+	machine := &clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: cluster.Namespace,
+			Labels:    labels,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(kcp, controlplanev1.GroupVersion.WithKind("KThreesControlPlane")),
+			},
+		},
+		Spec: clusterv1.MachineSpec{
+			ClusterName: cluster.Name,
+			Version:     &kcp.Spec.Version,
+			Bootstrap: clusterv1.Bootstrap{
+				ConfigRef: &corev1.ObjectReference{
+					APIVersion: bootstrapv1.GroupVersion.String(),
+					Kind:       "KThreesConfig",
+					Name:       name,
+					Namespace:  cluster.Namespace,
+				},
+			},
+			InfrastructureRef: corev1.ObjectReference{
+				APIVersion: genericInfrastructureMachineTemplateGVK.GroupVersion().String(),
+				Kind:       "GenericInfrastructureMachine",
+				Name:       name,
+				Namespace:  cluster.Namespace,
+			},
+		},
+	}
+	return machine, config
+}
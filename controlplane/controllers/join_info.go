@@ -0,0 +1,144 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	controlplanev1 "github.com/k3s-io/cluster-api-k3s/controlplane/api/v1beta2"
+	k3s "github.com/k3s-io/cluster-api-k3s/pkg/k3s"
+	"github.com/k3s-io/cluster-api-k3s/pkg/secret"
+)
+
+// reconcileJoinInfo publishes, when spec.joinInfo is set, the <cluster>-join-info secret with what externally
+// managed nodes need to join the cluster as agents: the server URL, the hash of the cluster CA and an agent token
+// created in the workload cluster. A new token is published half way through its TTL, or when the server URL or
+// the CA changed; the previous tokens stay valid until they expire. The secret is deleted when spec.joinInfo is unset.
+func (r *KThreesControlPlaneReconciler) reconcileJoinInfo(ctx context.Context, controlPlane *k3s.ControlPlane) error {
+	log := ctrl.LoggerFrom(ctx)
+	kcp, cluster := controlPlane.KCP, controlPlane.Cluster
+
+	joinInfoSecret := &corev1.Secret{}
+	err := r.Client.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: k3s.JoinInfoSecretName(cluster.Name)}, joinInfoSecret)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, "failed to get the join info secret")
+	}
+	exists := err == nil
+
+	// never touch a secret of the same name which is not managed by the KThreesControlPlane.
+	if exists && !util.IsControlledBy(joinInfoSecret, kcp) {
+		return nil
+	}
+
+	if kcp.Spec.JoinInfo == nil {
+		if exists {
+			if err := r.Client.Delete(ctx, joinInfoSecret); err != nil && !apierrors.IsNotFound(err) {
+				return errors.Wrap(err, "failed to delete the join info secret")
+			}
+		}
+		return nil
+	}
+
+	if !kcp.Status.Initialized {
+		return nil
+	}
+
+	ttl := defaultJoinInfoTokenTTL
+	if kcp.Spec.JoinInfo.TokenTTL != nil {
+		ttl = kcp.Spec.JoinInfo.TokenTTL.Duration
+	}
+
+	caSecret, err := secret.GetFromNamespacedName(ctx, r.Client, util.ObjectKey(cluster), secret.ClusterCA)
+	if err != nil {
+		return errors.Wrap(err, "failed to get the cluster CA")
+	}
+	caHash := k3s.CAHash(caSecret.Data[secret.TLSCrtDataName])
+	serverURL := k3s.ServerURL(cluster.Spec.ControlPlaneEndpoint)
+
+	if exists && !joinInfoNeedsRotation(joinInfoSecret, serverURL, caHash, ttl, time.Now()) {
+		return nil
+	}
+
+	workloadCluster, err := r.managementCluster.GetWorkloadCluster(ctx, util.ObjectKey(cluster))
+	if err != nil {
+		return errors.Wrap(err, "cannot get remote client to workload cluster")
+	}
+
+	token, expiration, err := workloadCluster.CreateAgentToken(ctx, ttl)
+	if err != nil {
+		return err
+	}
+	data := map[string][]byte{
+		k3s.JoinInfoServerURLKey:  []byte(serverURL),
+		k3s.JoinInfoCAHashKey:     []byte(caHash),
+		k3s.JoinInfoTokenKey:      []byte(k3s.SecureToken(caHash, token)),
+		k3s.JoinInfoExpirationKey: []byte(expiration.Format(time.RFC3339)),
+	}
+
+	if exists {
+		joinInfoSecret.Data = data
+		if err := r.Client.Update(ctx, joinInfoSecret); err != nil {
+			return errors.Wrap(err, "failed to update the join info secret")
+		}
+		log.Info("Rotated the join info agent token", "expiration", expiration)
+		return nil
+	}
+
+	joinInfoSecret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      k3s.JoinInfoSecretName(cluster.Name),
+			Namespace: cluster.Namespace,
+			Labels: map[string]string{
+				clusterv1.ClusterNameLabel: cluster.Name,
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(kcp, controlplanev1.GroupVersion.WithKind("KThreesControlPlane")),
+			},
+		},
+		Data: data,
+		Type: clusterv1.ClusterSecretType,
+	}
+	if err := r.Client.Create(ctx, joinInfoSecret); err != nil {
+		return errors.Wrap(err, "failed to create the join info secret")
+	}
+	log.Info("Published the join info secret", "secret", joinInfoSecret.Name, "expiration", expiration)
+	return nil
+}
+
+// joinInfoNeedsRotation returns true if the join info secret has to be published again: when half of the token TTL
+// elapsed, the TTL was reduced, or the server URL or the CA of the cluster changed.
+func joinInfoNeedsRotation(joinInfoSecret *corev1.Secret, serverURL, caHash string, ttl time.Duration, now time.Time) bool {
+	if string(joinInfoSecret.Data[k3s.JoinInfoServerURLKey]) != serverURL || string(joinInfoSecret.Data[k3s.JoinInfoCAHashKey]) != caHash {
+		return true
+	}
+
+	expiration, err := time.Parse(time.RFC3339, string(joinInfoSecret.Data[k3s.JoinInfoExpirationKey]))
+	if err != nil {
+		return true
+	}
+	return now.After(expiration.Add(-ttl/2)) || expiration.After(now.Add(ttl))
+}
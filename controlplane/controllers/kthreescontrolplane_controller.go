@@ -19,6 +19,7 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"maps"
 	"strings"
 	"time"
 
@@ -29,13 +30,13 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/controllers/external"
 	"sigs.k8s.io/cluster-api/util"
 	"sigs.k8s.io/cluster-api/util/annotations"
-	"sigs.k8s.io/cluster-api/util/certs"
 	"sigs.k8s.io/cluster-api/util/collections"
 	"sigs.k8s.io/cluster-api/util/conditions"
 	"sigs.k8s.io/cluster-api/util/patch"
@@ -48,14 +49,15 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
+	bootstrapv1 "github.com/k3s-io/cluster-api-k3s/bootstrap/api/v1beta2"
 	controlplanev1 "github.com/k3s-io/cluster-api-k3s/controlplane/api/v1beta2"
 	k3s "github.com/k3s-io/cluster-api-k3s/pkg/k3s"
 	"github.com/k3s-io/cluster-api-k3s/pkg/kubeconfig"
-	"github.com/k3s-io/cluster-api-k3s/pkg/machinefilters"
 	"github.com/k3s-io/cluster-api-k3s/pkg/secret"
 	"github.com/k3s-io/cluster-api-k3s/pkg/token"
 	"github.com/k3s-io/cluster-api-k3s/pkg/util/contract"
 	"github.com/k3s-io/cluster-api-k3s/pkg/util/ssa"
+	"github.com/k3s-io/cluster-api-k3s/pkg/versions"
 )
 
 // KThreesControlPlaneReconciler reconciles a KThreesControlPlane object.
@@ -69,13 +71,20 @@ type KThreesControlPlaneReconciler struct {
 	EtcdDialTimeout time.Duration
 	EtcdCallTimeout time.Duration
 
+	// PreflightPollInterval is how often the preflight checks, e.g. etcd members health, are polled
+	// while waiting to scale up or down the control plane.
+	PreflightPollInterval time.Duration
+	// ReadinessPollInterval is how often the workload cluster readiness is polled while the
+	// control plane is not ready or its components are unhealthy.
+	ReadinessPollInterval time.Duration
+
 	managementCluster         k3s.ManagementCluster
 	managementClusterUncached k3s.ManagementCluster
 	ssaCache                  ssa.Cache
 }
 
 // +kubebuilder:rbac:groups=core,resources=events,verbs=get;list;watch;create;patch
-// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io;bootstrap.cluster.x-k8s.io;controlplane.cluster.x-k8s.io,resources=*,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;clusters/status,verbs=get;list;watch
 // +kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machines;machines/status,verbs=get;list;watch;create;update;patch;delete
@@ -172,7 +181,7 @@ func (r *KThreesControlPlaneReconciler) Reconcile(ctx context.Context, req ctrl.
 		// The alternative solution would be to watch the control plane nodes in the Cluster - similar to how the
 		// MachineSet and MachineHealthCheck controllers watch the nodes under their control.
 		if !kcp.Status.Ready {
-			res = ctrl.Result{RequeueAfter: 20 * time.Second}
+			res = ctrl.Result{RequeueAfter: r.ReadinessPollInterval}
 		}
 
 		// Make KCP requeue if ControlPlaneComponentsHealthyCondition is false so we can check for control plane component
@@ -180,7 +189,7 @@ func (r *KThreesControlPlaneReconciler) Reconcile(ctx context.Context, req ctrl.
 		// Otherwise this condition can lead to a delay in provisioning MachineDeployments when MachineSet preflight checks are enabled.
 		// The alternative solution to this requeue would be watching the relevant pods inside each workload cluster which would be very expensive.
 		if conditions.IsFalse(kcp, controlplanev1.ControlPlaneComponentsHealthyCondition) {
-			res = ctrl.Result{RequeueAfter: 20 * time.Second}
+			res = ctrl.Result{RequeueAfter: r.ReadinessPollInterval}
 		}
 	}
 
@@ -203,6 +212,11 @@ func (r *KThreesControlPlaneReconciler) reconcileDelete(ctx context.Context, clu
 
 	// If no control plane machines remain, remove the finalizer
 	if len(ownedMachines) == 0 {
+		if _, ok := kcp.Annotations[controlplanev1.RetainSecretsAnnotation]; ok {
+			if err := r.retainClusterSecrets(ctx, cluster, kcp); err != nil {
+				return reconcile.Result{}, err
+			}
+		}
 		controllerutil.RemoveFinalizer(kcp, controlplanev1.KThreesControlPlaneFinalizer)
 		return reconcile.Result{}, nil
 	}
@@ -253,6 +267,60 @@ func (r *KThreesControlPlaneReconciler) reconcileDelete(ctx context.Context, clu
 	return ctrl.Result{RequeueAfter: deleteRequeueAfter}, nil
 }
 
+// retainClusterSecrets removes the KThreesControlPlane owner reference from the cluster certificate authorities, the
+// token and the secrets referenced by spec.kthreesConfigSpec.files, so they are not garbage collected with it. The token
+// and the etcd CA are required to restore the etcd snapshots of the cluster. A KThreesControlPlane recreated for the
+// same cluster adopts the token and the certificate authorities, which are marked with secret.RetainedAnnotation.
+func (r *KThreesControlPlaneReconciler) retainClusterSecrets(ctx context.Context, cluster *clusterv1.Cluster, kcp *controlplanev1.KThreesControlPlane) error {
+	logger := r.Log.WithValues("namespace", kcp.Namespace, "KThreesControlPlane", kcp.Name, "cluster", cluster.Name)
+
+	certificates := sets.New[string]()
+	for _, certificate := range secret.NewCertificatesForInitialControlPlane(&kcp.Spec.KThreesConfigSpec) {
+		certificates.Insert(secret.Name(cluster.Name, certificate.Purpose))
+	}
+	names := sets.New[string](token.Name(cluster.Name)).Union(certificates)
+	for _, file := range kcp.Spec.KThreesConfigSpec.Files {
+		if file.ContentFrom != nil {
+			names.Insert(file.ContentFrom.Secret.Name)
+		}
+	}
+
+	for _, name := range sets.List(names) {
+		s := &corev1.Secret{}
+		if err := r.Client.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: name}, s); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return errors.Wrapf(err, "failed to get Secret %s", name)
+		}
+		if !util.IsOwnedByObject(s, kcp) {
+			continue
+		}
+
+		patchHelper, err := patch.NewHelper(s, r.Client)
+		if err != nil {
+			return err
+		}
+		s.SetOwnerReferences(util.RemoveOwnerRef(s.GetOwnerReferences(), metav1.OwnerReference{
+			APIVersion: controlplanev1.GroupVersion.String(),
+			Kind:       "KThreesControlPlane",
+			Name:       kcp.Name,
+		}))
+		if certificates.Has(name) {
+			if s.Annotations == nil {
+				s.Annotations = map[string]string{}
+			}
+			s.Annotations[secret.RetainedAnnotation] = ""
+		}
+		if err := patchHelper.Patch(ctx, s); err != nil {
+			return errors.Wrapf(err, "failed to retain Secret %s", name)
+		}
+		logger.Info("Retained cluster secret", "secret", name)
+	}
+
+	return nil
+}
+
 func patchKThreesControlPlane(ctx context.Context, patchHelper *patch.Helper, kcp *controlplanev1.KThreesControlPlane) error {
 	// Always update the readyCondition by summarizing the state of other conditions.
 	conditions.SetSummary(kcp,
@@ -277,7 +345,13 @@ func patchKThreesControlPlane(ctx context.Context, patchHelper *patch.Helper, kc
 			controlplanev1.MachinesReadyCondition,
 			controlplanev1.AvailableCondition,
 			controlplanev1.CertificatesAvailableCondition,
+			controlplanev1.CertificatesExpiringSoonCondition,
 			controlplanev1.TokenAvailableCondition,
+			controlplanev1.EtcdSnapshotsPrunedCondition,
+			controlplanev1.RemediationBlockedCondition,
+			controlplanev1.EtcdCertificatesValidCondition,
+			controlplanev1.NodeConfigInSyncCondition,
+			controlplanev1.SpecAppliedCondition,
 		}},
 		patch.WithStatusObservedGeneration{},
 	)
@@ -305,6 +379,13 @@ func (r *KThreesControlPlaneReconciler) SetupWithManager(ctx context.Context, mg
 	r.recorder = mgr.GetEventRecorderFor("k3s-control-plane-controller")
 	r.ssaCache = ssa.NewCache()
 
+	if r.PreflightPollInterval <= 0 {
+		r.PreflightPollInterval = defaultPreflightFailedRequeueAfter
+	}
+	if r.ReadinessPollInterval <= 0 {
+		r.ReadinessPollInterval = defaultNotReadyRequeueAfter
+	}
+
 	if r.managementCluster == nil {
 		r.managementCluster = &k3s.Management{
 			Client:          r.Client,
@@ -351,10 +432,15 @@ func (r *KThreesControlPlaneReconciler) updateStatus(ctx context.Context, kcp *c
 	// This is necessary for CRDs including scale subresources.
 	kcp.Status.Selector = selector.String()
 
-	ownedMachines, err := r.managementCluster.GetMachinesForCluster(ctx, util.ObjectKey(cluster), collections.OwnedMachines(kcp))
+	allOwnedMachines, err := r.managementCluster.GetMachinesForCluster(ctx, util.ObjectKey(cluster), collections.OwnedMachines(kcp))
 	if err != nil {
 		return fmt.Errorf("failed to get list of owned machines: %w", err)
 	}
+	// spare machines are not part of the control plane until they are promoted.
+	ownedMachines := allOwnedMachines.Filter(collections.ControlPlaneMachines(cluster.Name))
+	kcp.Status.SpareReplicas = int32(len(allOwnedMachines.Filter(isSpareMachine, collections.Not(collections.HasDeletionTimestamp), func(m *clusterv1.Machine) bool {
+		return m.Status.NodeRef != nil
+	})))
 
 	logger := r.Log.WithValues("namespace", kcp.Namespace, "KThreesControlPlane", kcp.Name, "cluster", cluster.Name)
 	controlPlane, err := k3s.NewControlPlane(ctx, r.Client, cluster, kcp, ownedMachines)
@@ -363,6 +449,8 @@ func (r *KThreesControlPlaneReconciler) updateStatus(ctx context.Context, kcp *c
 		return err
 	}
 	kcp.Status.UpdatedReplicas = int32(len(controlPlane.UpToDateMachines()))
+	kcp.Status.RolloutPlan = controlPlane.RolloutPlan()
+	kcp.Status.FailureDomains = controlPlane.FailureDomainDistribution()
 
 	replicas := int32(len(ownedMachines))
 	desiredReplicas := *kcp.Spec.Replicas
@@ -378,12 +466,6 @@ func (r *KThreesControlPlaneReconciler) updateStatus(ctx context.Context, kcp *c
 		return nil
 	}
 
-	machinesWithAgentHealthy := controlPlane.Machines.Filter(machinefilters.AgentHealthy())
-	lowestVersion := machinesWithAgentHealthy.LowestVersion()
-	if lowestVersion != nil {
-		controlPlane.KCP.Status.Version = lowestVersion
-	}
-
 	switch {
 	// We are scaling up
 	case replicas < desiredReplicas:
@@ -413,10 +495,23 @@ func (r *KThreesControlPlaneReconciler) updateStatus(ctx context.Context, kcp *c
 	logger.Info("ClusterStatus", "workload", status)
 
 	kcp.Status.ReadyReplicas = status.ReadyNodes
+	kcp.Status.MachineVersions = controlPlane.MachineVersions(status.NodeVersions)
+	// MachineSet preflight checks consider the control plane provisioning while status.version is not set, and
+	// upgrading while it is lower than spec.version, so workers are not rolled out until the control plane is stable.
+	// The version is the lowest one running on the nodes, so outdated nodes that are unhealthy or whose machine is
+	// being deleted keep the upgrade in progress.
+	if lowestVersion := k3s.LowestMachineVersion(kcp.Status.MachineVersions); lowestVersion != nil {
+		kcp.Status.Version = lowestVersion
+	}
+	// nodes of deleted machines may still be registered, the scaling contract expects no unavailable replicas then.
 	kcp.Status.UnavailableReplicas = replicas - status.ReadyNodes
+	if kcp.Status.UnavailableReplicas < 0 {
+		kcp.Status.UnavailableReplicas = 0
+	}
 
 	if status.HasK3sServingSecret {
 		kcp.Status.Initialized = true
+		kcp.Status.Initialization = &controlplanev1.KThreesControlPlaneInitializationStatus{ControlPlaneInitialized: true}
 	}
 
 	if kcp.Status.ReadyReplicas > 0 {
@@ -466,7 +561,16 @@ func (r *KThreesControlPlaneReconciler) reconcile(ctx context.Context, cluster *
 		return reconcile.Result{}, err
 	}
 
+	// Resolve the k3s release of plain Kubernetes versions, e.g. set by ClusterClass topologies.
+	if err := reconcileResolvedVersion(kcp); err != nil {
+		logger.Error(err, "failed to resolve the k3s version")
+		return reconcile.Result{}, err
+	}
+
 	certificates := secret.NewCertificatesForInitialControlPlane(&kcp.Spec.KThreesConfigSpec)
+	if kcp.Spec.CACertificateValidityPeriod != nil {
+		certificates.SetValidityPeriod(kcp.Spec.CACertificateValidityPeriod.Duration)
+	}
 	controllerRef := metav1.NewControllerRef(kcp, controlplanev1.GroupVersion.WithKind("KThreesControlPlane"))
 	if err := certificates.LookupOrGenerate(ctx, r.Client, util.ObjectKey(cluster), *controllerRef); err != nil {
 		logger.Error(err, "unable to lookup or create cluster certificates")
@@ -493,6 +597,11 @@ func (r *KThreesControlPlaneReconciler) reconcile(ctx context.Context, cluster *
 		return result, err
 	}
 
+	if err := r.reconcileCertificateExpiries(ctx, util.ObjectKey(cluster), kcp, certificates); err != nil {
+		logger.Error(err, "failed to reconcile certificate expiries")
+		return reconcile.Result{}, err
+	}
+
 	controlPlaneMachines, err := r.managementClusterUncached.GetMachinesForCluster(ctx, util.ObjectKey(cluster), collections.ControlPlaneMachines(cluster.Name))
 	if err != nil {
 		logger.Error(err, "failed to retrieve control plane machines for cluster")
@@ -538,6 +647,32 @@ func (r *KThreesControlPlaneReconciler) reconcile(ctx context.Context, cluster *
 		return reconcile.Result{}, err
 	}
 
+	// Approves the kubelet serving certificate requests of the cluster nodes, if enabled.
+	if err := r.reconcileKubeletServingCSRs(ctx, controlPlane); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// Publishes the join info of the cluster for externally managed nodes, if enabled, rotating its agent token.
+	if err := r.reconcileJoinInfo(ctx, controlPlane); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// Prunes the etcd snapshots older than the configured max age and checks the snapshot retention is effective.
+	r.reconcileEtcdSnapshots(ctx, controlPlane)
+
+	// Compares the key server settings of the spec with the ones the servers run with.
+	r.reconcileSpecApplied(ctx, controlPlane)
+
+	// Restarts k3s as a server on the nodes of the promoted spare machines.
+	if result, err := r.reconcileSparePromotions(ctx, controlPlane); err != nil || !result.IsZero() {
+		return result, err
+	}
+
+	// Recreates the machines whose node did not join the cluster within the provisioning timeout.
+	if result, err := r.reconcileProvisioningTimeouts(ctx, controlPlane); err != nil || !result.IsZero() {
+		return result, err
+	}
+
 	// Reconcile unhealthy machines by triggering deletion and requeue if it is considered safe to remediate,
 	// otherwise continue with the other KCP operations.
 	if result, err := r.reconcileUnhealthyMachines(ctx, controlPlane); err != nil || !result.IsZero() {
@@ -547,6 +682,10 @@ func (r *KThreesControlPlaneReconciler) reconcile(ctx context.Context, cluster *
 	// Control plane machines rollout due to configuration changes (e.g. upgrades) takes precedence over other operations.
 	needRollout := controlPlane.MachinesNeedingRollout()
 	switch {
+	case len(needRollout) > 0 && !isRolloutApproved(kcp):
+		logger.Info("Waiting for rollout approval", "needRollout", needRollout.Names())
+		conditions.MarkFalse(controlPlane.KCP, controlplanev1.MachinesSpecUpToDateCondition, controlplanev1.RolloutWaitingForApprovalReason, clusterv1.ConditionSeverityWarning, "Rolling %d replicas with outdated spec is waiting for the %s annotation", len(needRollout), controlplanev1.ApproveRolloutAnnotation)
+		return reconcile.Result{}, nil
 	case len(needRollout) > 0:
 		logger.Info("Rolling out Control Plane machines", "needRollout", needRollout.Names())
 		conditions.MarkFalse(controlPlane.KCP, controlplanev1.MachinesSpecUpToDateCondition, controlplanev1.RollingUpdateInProgressReason, clusterv1.ConditionSeverityWarning, "Rolling %d replicas with outdated spec (%d replicas up to date)", len(needRollout), len(controlPlane.Machines)-len(needRollout))
@@ -558,6 +697,10 @@ func (r *KThreesControlPlaneReconciler) reconcile(ctx context.Context, cluster *
 		if conditions.Has(controlPlane.KCP, controlplanev1.MachinesSpecUpToDateCondition) {
 			conditions.MarkTrue(controlPlane.KCP, controlplanev1.MachinesSpecUpToDateCondition)
 		}
+		// the approvals only apply to the rollout that just completed.
+		delete(kcp.Annotations, controlplanev1.ApproveRolloutAnnotation)
+		delete(kcp.Annotations, controlplanev1.ApproveRolloutStepAnnotation)
+		kcp.Status.Rollout = nil
 	}
 
 	// If we've made it this far, we can assume that all ownedMachines are up to date
@@ -583,6 +726,26 @@ func (r *KThreesControlPlaneReconciler) reconcile(ctx context.Context, cluster *
 		return r.scaleDownControlPlane(ctx, cluster, kcp, controlPlane, collections.Machines{})
 	}
 
+	// Rotate the serving certificates if requested, once the control plane is stable.
+	if result, err := r.reconcileServingCertsRotation(ctx, controlPlane); err != nil || !result.IsZero() {
+		return result, err
+	}
+
+	// Rotate the etcd certificates of the servers before they expire, once the control plane is stable.
+	if result, err := r.reconcileEtcdCertificates(ctx, controlPlane); err != nil || !result.IsZero() {
+		return result, err
+	}
+
+	// Keep the spare machines ready for the next scale up or remediation.
+	if result, err := r.reconcileSpareMachines(ctx, cluster, kcp); err != nil || !result.IsZero() {
+		return result, err
+	}
+
+	// Detect the drift of the k3s configuration files of the servers, reapplying them if requested.
+	if result, err := r.reconcileNodeConfigDrift(ctx, controlPlane); err != nil || !result.IsZero() {
+		return result, err
+	}
+
 	// Get the workload cluster client.
 	/**
 	workloadCluster, err := r.managementCluster.GetWorkloadCluster(ctx, util.ObjectKey(cluster))
@@ -606,6 +769,40 @@ func (r *KThreesControlPlaneReconciler) reconcile(ctx context.Context, cluster *
 	return reconcile.Result{}, nil
 }
 
+// isRolloutApproved returns true if rollouts do not require an approval, or if the pending rollout was approved.
+func isRolloutApproved(kcp *controlplanev1.KThreesControlPlane) bool {
+	if _, ok := kcp.Annotations[controlplanev1.RequireRolloutApprovalAnnotation]; !ok {
+		return true
+	}
+	_, ok := kcp.Annotations[controlplanev1.ApproveRolloutAnnotation]
+	return ok
+}
+
+// isRolloutStepApproved returns true if the next machine of a rollout can be replaced, which with the Manual
+// approval mode requires the ApproveRolloutStepAnnotation once a machine was already replaced.
+func isRolloutStepApproved(kcp *controlplanev1.KThreesControlPlane, controlPlane *k3s.ControlPlane) bool {
+	if !kcp.Spec.RolloutStrategy.IsManualApproval() || controlPlane.UpToDateMachines().Len() == 0 {
+		return true
+	}
+	_, ok := kcp.Annotations[controlplanev1.ApproveRolloutStepAnnotation]
+	return ok
+}
+
+// reconcileResolvedVersion pins in status.resolvedVersion the k3s release spec.version resolves to, so that
+// machines keep the same release when newer builds are added to the supported versions matrix.
+func reconcileResolvedVersion(kcp *controlplanev1.KThreesControlPlane) error {
+	if kcp.Status.ResolvedVersion != "" && kcp.K3sVersion() == kcp.Status.ResolvedVersion {
+		return nil
+	}
+
+	resolved, err := versions.ResolveK3sBuild(kcp.Spec.Version, kcp.Spec.VersionBuildPolicy == controlplanev1.VersionBuildPolicyLatestKnownBuild)
+	if err != nil {
+		return err
+	}
+	kcp.Status.ResolvedVersion = resolved
+	return nil
+}
+
 func (r *KThreesControlPlaneReconciler) reconcileExternalReference(ctx context.Context, cluster *clusterv1.Cluster, ref corev1.ObjectReference) error {
 	if !strings.HasSuffix(ref.Kind, clusterv1.TemplateSuffix) {
 		return nil
@@ -638,6 +835,11 @@ func (r *KThreesControlPlaneReconciler) reconcileKubeconfig(ctx context.Context,
 		return reconcile.Result{}, nil
 	}
 
+	validityPeriod := kubeconfig.DefaultCertificateValidityPeriod
+	if kcp.Spec.CertificateValidityPeriod != nil {
+		validityPeriod = kcp.Spec.CertificateValidityPeriod.Duration
+	}
+
 	controllerOwnerRef := *metav1.NewControllerRef(kcp, controlplanev1.GroupVersion.WithKind("KThreesControlPlane"))
 	configSecret, err := secret.GetFromNamespacedName(ctx, r.Client, clusterName, secret.Kubeconfig)
 	switch {
@@ -646,8 +848,9 @@ func (r *KThreesControlPlaneReconciler) reconcileKubeconfig(ctx context.Context,
 			ctx,
 			r.Client,
 			clusterName,
-			endpoint.String(),
+			k3s.EndpointString(endpoint),
 			controllerOwnerRef,
+			validityPeriod,
 		)
 		if errors.Is(createErr, kubeconfig.ErrDependentCertificateNotFound) {
 			return ctrl.Result{RequeueAfter: dependentCertRequeueAfter}, nil
@@ -664,14 +867,35 @@ func (r *KThreesControlPlaneReconciler) reconcileKubeconfig(ctx context.Context,
 		return reconcile.Result{}, nil
 	}
 
-	needsRotation, err := kubeconfig.NeedsClientCertRotation(configSecret, certs.ClientCertificateRenewalDuration)
+	// regenerate the kubeconfig when the control plane endpoint changed, e.g. after replacing the load balancer.
+	server, err := kubeconfig.ServerURL(configSecret)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if desired := k3s.ServerURL(endpoint); server != desired {
+		r.Log.Info("regenerating kubeconfig secret for the new control plane endpoint", "previous", server, "server", desired)
+		if err := kubeconfig.RegenerateSecretWithServer(ctx, r.Client, configSecret, desired, validityPeriod); err != nil {
+			return ctrl.Result{}, errors.Wrap(err, "failed to regenerate kubeconfig")
+		}
+		r.recorder.Eventf(kcp, corev1.EventTypeNormal, "ControlPlaneEndpointChanged",
+			"Regenerated the kubeconfig of cluster %s/%s for the control plane endpoint %s, servers bootstrapped with %s are rolled out",
+			clusterName.Namespace, clusterName.Name, desired, server)
+		return reconcile.Result{}, nil
+	}
+
+	// like certs.ClientCertificateRenewalDuration, rotate the client certificate half way through its lifetime.
+	threshold, err := kubeconfig.ClientCertRotationThreshold(ctx, r.Client, clusterName, validityPeriod)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	needsRotation, err := kubeconfig.NeedsClientCertRotation(configSecret, threshold)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
 	if needsRotation {
 		r.Log.Info("rotating kubeconfig secret")
-		if err := kubeconfig.RegenerateSecret(ctx, r.Client, configSecret); err != nil {
+		if err := kubeconfig.RegenerateSecret(ctx, r.Client, configSecret, validityPeriod); err != nil {
 			return ctrl.Result{}, errors.Wrap(err, "failed to regenerate kubeconfig")
 		}
 	}
@@ -679,6 +903,61 @@ func (r *KThreesControlPlaneReconciler) reconcileKubeconfig(ctx context.Context,
 	return reconcile.Result{}, nil
 }
 
+// reconcileCertificateExpiries reports when the cluster certificate authorities and the admin kubeconfig client
+// certificate expire, and whether any of them expires within certificatesExpiringSoonThreshold. Certificates that
+// cannot be decoded, and kubeconfigs not controlled by the KThreesControlPlane, are skipped.
+func (r *KThreesControlPlaneReconciler) reconcileCertificateExpiries(ctx context.Context, clusterName client.ObjectKey, kcp *controlplanev1.KThreesControlPlane, certificates secret.Certificates) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	expiries := []controlplanev1.CertificateExpiry{}
+	for _, certificate := range certificates {
+		notAfter, err := certificate.NotAfter()
+		if err != nil {
+			log.Error(err, "failed to decode certificate, skipping its expiry", "certificate", certificate.Purpose)
+			continue
+		}
+		expiries = append(expiries, controlplanev1.CertificateExpiry{Name: string(certificate.Purpose), NotAfter: metav1.NewTime(notAfter)})
+	}
+
+	configSecret, err := secret.GetFromNamespacedName(ctx, r.Client, clusterName, secret.Kubeconfig)
+	switch {
+	case apierrors.IsNotFound(err):
+		// the kubeconfig is only generated once the control plane endpoint is known.
+	case err != nil:
+		return fmt.Errorf("failed to retrieve kubeconfig Secret: %w", err)
+	case !util.IsControlledBy(configSecret, kcp):
+		// kubeconfigs provided by users, e.g. token or exec based ones, are not managed by the KThreesControlPlane.
+	default:
+		notAfter, err := kubeconfig.ClientCertNotAfter(configSecret)
+		if err != nil {
+			log.Error(err, "failed to decode the kubeconfig client certificate, skipping its expiry")
+			break
+		}
+		expiries = append(expiries, controlplanev1.CertificateExpiry{Name: string(secret.Kubeconfig), NotAfter: metav1.NewTime(notAfter)})
+	}
+	kcp.Status.CertificateExpiries = expiries
+
+	expiring := []string{}
+	for _, e := range expiries {
+		if time.Until(e.NotAfter.Time) < certificatesExpiringSoonThreshold {
+			expiring = append(expiring, e.Name)
+		}
+	}
+
+	if len(expiring) > 0 {
+		conditions.Set(kcp, &clusterv1.Condition{
+			Type:    controlplanev1.CertificatesExpiringSoonCondition,
+			Status:  corev1.ConditionTrue,
+			Reason:  controlplanev1.CertificatesExpiringReason,
+			Message: fmt.Sprintf("Certificates expiring within %s: %s", certificatesExpiringSoonThreshold, strings.Join(expiring, ", ")),
+		})
+		return nil
+	}
+
+	conditions.MarkFalse(kcp, controlplanev1.CertificatesExpiringSoonCondition, controlplanev1.CertificatesValidReason, clusterv1.ConditionSeverityInfo, "")
+	return nil
+}
+
 // syncMachines updates Machines, InfrastructureMachines and KThreesConfigs to propagate in-place mutable fields from KCP.
 // Note: It also cleans up managed fields of all Machines so that Machines that were
 // created/patched before (<= v0.2.0) the controller adopted Server-Side-Apply (SSA) can also work with SSA.
@@ -702,6 +981,9 @@ func (r *KThreesControlPlaneReconciler) syncMachines(ctx context.Context, contro
 		if err := ssa.CleanUpManagedFieldsForSSAAdoption(ctx, r.Client, m, kcpManagerName); err != nil {
 			return errors.Wrapf(err, "failed to update Machine: failed to adjust the managedFields of the Machine %s", klog.KObj(m))
 		}
+		// Labels and annotations from the machine template are propagated in place, they do not require a rollout.
+		labels := machineLabels(controlPlane.Cluster, controlPlane.KCP, m)
+
 		// Update Machine to propagate in-place mutable fields from KCP.
 		updatedMachine, err := r.updateMachine(ctx, m, controlPlane.KCP, controlPlane.Cluster)
 		if err != nil {
@@ -738,7 +1020,7 @@ func (r *KThreesControlPlaneReconciler) syncMachines(ctx context.Context, contro
 				return errors.Wrapf(err, "failed to clean up managedFields of InfrastructureMachine %s", klog.KObj(infraMachine))
 			}
 			// Update in-place mutating fields on InfrastructureMachine.
-			if err := r.updateExternalObject(ctx, infraMachine, controlPlane.KCP, controlPlane.Cluster); err != nil {
+			if err := r.updateExternalObject(ctx, infraMachine, controlPlane.KCP, labels); err != nil {
 				return errors.Wrapf(err, "failed to update InfrastructureMachine %s", klog.KObj(infraMachine))
 			}
 		}
@@ -756,8 +1038,15 @@ func (r *KThreesControlPlaneReconciler) syncMachines(ctx context.Context, contro
 			if err := ssa.DropManagedFields(ctx, r.Client, kthreesConfigs, kcpManagerName, labelsAndAnnotationsManagedFieldPaths); err != nil {
 				return errors.Wrapf(err, "failed to clean up managedFields of kthreesConfigs %s", klog.KObj(kthreesConfigs))
 			}
+			// Keep the spare label on the config of a promoted machine, it is removed by reconcileSparePromotions
+			// once the node is promoted.
+			configLabels := labels
+			if _, ok := kthreesConfigs.Labels[bootstrapv1.SpareControlPlaneLabel]; ok {
+				configLabels = maps.Clone(labels)
+				configLabels[bootstrapv1.SpareControlPlaneLabel] = ""
+			}
 			// Update in-place mutating fields on BootstrapConfig.
-			if err := r.updateExternalObject(ctx, kthreesConfigs, controlPlane.KCP, controlPlane.Cluster); err != nil {
+			if err := r.updateExternalObject(ctx, kthreesConfigs, controlPlane.KCP, configLabels); err != nil {
 				return errors.Wrapf(err, "failed to update KThreesConfigs %s", klog.KObj(kthreesConfigs))
 			}
 		}
@@ -784,6 +1073,7 @@ func (r *KThreesControlPlaneReconciler) reconcileControlPlaneConditions(ctx cont
 	// Update conditions status
 	workloadCluster.UpdateAgentConditions(ctx, controlPlane)
 	workloadCluster.UpdateEtcdConditions(ctx, controlPlane)
+	workloadCluster.UpdateK3sServiceConditions(ctx, controlPlane)
 
 	// Patch machines with the updated conditions.
 	if err := controlPlane.PatchMachines(ctx); err != nil {
@@ -845,6 +1135,93 @@ func (r *KThreesControlPlaneReconciler) reconcileEtcdMembers(ctx context.Context
 	return nil
 }
 
+// reconcileKubeletServingCSRs approves the kubelet serving certificate requests when serverTLSBootstrap is enabled,
+// as kubelets wait for them to be approved before serving with a certificate signed by the cluster.
+func (r *KThreesControlPlaneReconciler) reconcileKubeletServingCSRs(ctx context.Context, controlPlane *k3s.ControlPlane) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	if !controlPlane.KCP.Spec.KThreesConfigSpec.AgentConfig.ServerTLSBootstrap || !controlPlane.KCP.Status.Initialized {
+		return nil
+	}
+
+	workloadCluster, err := r.managementCluster.GetWorkloadCluster(ctx, util.ObjectKey(controlPlane.Cluster))
+	if err != nil {
+		return errors.Wrap(err, "cannot get remote client to workload cluster")
+	}
+
+	approved, err := workloadCluster.ApproveKubeletServingCSRs(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to approve kubelet serving certificate signing requests")
+	}
+
+	if len(approved) > 0 {
+		log.Info("Approved kubelet serving certificate signing requests", "csrs", approved)
+	}
+
+	return nil
+}
+
+// reconcileServingCertsRotation regenerates the serving certificates of the servers one at a time when the
+// RotateServingCertsAnnotation is set, recording on each machine the rotation it went through. Machines created
+// after the time of the rotation already have new serving certificates and are not restarted.
+func (r *KThreesControlPlaneReconciler) reconcileServingCertsRotation(ctx context.Context, controlPlane *k3s.ControlPlane) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	rotation, ok := controlPlane.KCP.Annotations[controlplanev1.RotateServingCertsAnnotation]
+	if !ok || !controlPlane.KCP.Status.Initialized {
+		return ctrl.Result{}, nil
+	}
+
+	rotationTime, err := time.Parse(time.RFC3339, rotation)
+	hasRotationTime := err == nil
+	pending := controlPlane.Machines.Filter(func(m *clusterv1.Machine) bool {
+		if m.Annotations[controlplanev1.ServingCertsRotatedAnnotation] == rotation {
+			return false
+		}
+		return !hasRotationTime || !m.CreationTimestamp.After(rotationTime)
+	})
+	if pending.Len() == 0 {
+		return ctrl.Result{}, nil
+	}
+
+	// Only restart k3s on a healthy control plane, so that a single server is unavailable at a time.
+	if !conditions.IsTrue(controlPlane.KCP, controlplanev1.ControlPlaneComponentsHealthyCondition) ||
+		!conditions.IsTrue(controlPlane.KCP, controlplanev1.EtcdClusterHealthyCondition) {
+		log.Info("Waiting for the control plane to be healthy before rotating serving certificates")
+		return ctrl.Result{RequeueAfter: servingCertsRotationRequeueAfter}, nil
+	}
+
+	machine := pending.Oldest()
+	if machine.Status.NodeRef == nil {
+		return ctrl.Result{RequeueAfter: servingCertsRotationRequeueAfter}, nil
+	}
+
+	workloadCluster, err := r.managementCluster.GetWorkloadCluster(ctx, util.ObjectKey(controlPlane.Cluster))
+	if err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "cannot get remote client to workload cluster")
+	}
+
+	done, err := workloadCluster.RotateServingCerts(ctx, machine.Status.NodeRef.Name)
+	if err != nil {
+		return ctrl.Result{}, errors.Wrapf(err, "failed to rotate serving certificates of Machine %s", machine.Name)
+	}
+	if !done {
+		log.Info("Rotating serving certificates", "machine", machine.Name)
+		return ctrl.Result{RequeueAfter: servingCertsRotationRequeueAfter}, nil
+	}
+
+	if machine.Annotations == nil {
+		machine.Annotations = map[string]string{}
+	}
+	machine.Annotations[controlplanev1.ServingCertsRotatedAnnotation] = rotation
+	if err := controlPlane.PatchMachines(ctx); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	log.Info("Rotated serving certificates", "machine", machine.Name)
+	return ctrl.Result{Requeue: true}, nil
+}
+
 func (r *KThreesControlPlaneReconciler) upgradeControlPlane(
 	ctx context.Context,
 	cluster *clusterv1.Cluster,
@@ -889,8 +1266,71 @@ func (r *KThreesControlPlaneReconciler) upgradeControlPlane(
 	**/
 
 	if controlPlane.Machines.Len() <= int(*kcp.Spec.Replicas) {
+		// With the Manual approval mode, every machine replacement after the first one has to be approved.
+		if !isRolloutStepApproved(kcp, controlPlane) {
+			updateRolloutStatus(kcp, controlplanev1.RolloutPhaseWaitingForApproval, "")
+			ctrl.LoggerFrom(ctx).Info("Waiting for rollout step approval", "needRollout", machinesRequireUpgrade.Names())
+			conditions.MarkFalse(kcp, controlplanev1.MachinesSpecUpToDateCondition, controlplanev1.RolloutWaitingForStepApprovalReason, clusterv1.ConditionSeverityWarning,
+				"Rolling %d replicas with outdated spec is waiting for the %s annotation to replace the next machine", len(machinesRequireUpgrade), controlplanev1.ApproveRolloutStepAnnotation)
+			return ctrl.Result{}, nil
+		}
+		phase, machine := scaleUpRolloutPhase(controlPlane)
+		updateRolloutStatus(kcp, phase, machine)
 		// scaleUp ensures that we don't continue scaling up while waiting for Machines to have NodeRefs
 		return r.scaleUpControlPlane(ctx, cluster, kcp, controlPlane)
 	}
+	phase, machine := scaleDownRolloutPhase(ctx, controlPlane, machinesRequireUpgrade)
+	updateRolloutStatus(kcp, phase, machine)
 	return r.scaleDownControlPlane(ctx, cluster, kcp, controlPlane, machinesRequireUpgrade)
 }
+
+// updateRolloutStatus reports in status.rollout which step the rolling upgrade is at.
+func updateRolloutStatus(kcp *controlplanev1.KThreesControlPlane, phase controlplanev1.RolloutPhase, machine string) {
+	now := metav1.Now()
+	rollout := kcp.Status.Rollout
+	if rollout == nil {
+		rollout = &controlplanev1.RolloutStatus{StartTime: now}
+		kcp.Status.Rollout = rollout
+	}
+	if rollout.Phase != phase || rollout.Machine != machine || rollout.LastTransitionTime.IsZero() {
+		rollout.Phase = phase
+		rollout.Machine = machine
+		rollout.LastTransitionTime = now
+	}
+}
+
+// scaleUpRolloutPhase returns the rollout phase of a rollout creating the replacement of the next machine with
+// scaleUpControlPlane, which first waits for the machines being deleted.
+func scaleUpRolloutPhase(controlPlane *k3s.ControlPlane) (controlplanev1.RolloutPhase, string) {
+	if deleting := controlPlane.Machines.Filter(collections.HasDeletionTimestamp); deleting.Len() > 0 {
+		return controlplanev1.RolloutPhaseDeleting, deleting.Oldest().Name
+	}
+	return controlplanev1.RolloutPhaseSelectingMachine, ""
+}
+
+// scaleDownRolloutPhase returns the rollout phase of a rollout deleting an outdated machine with
+// scaleDownControlPlane, which picks the same machine and waits for the same preflight checks.
+func scaleDownRolloutPhase(ctx context.Context, controlPlane *k3s.ControlPlane, machinesRequireUpgrade collections.Machines) (controlplanev1.RolloutPhase, string) {
+	if deleting := controlPlane.Machines.Filter(collections.HasDeletionTimestamp); deleting.Len() > 0 {
+		return controlplanev1.RolloutPhaseDeleting, deleting.Oldest().Name
+	}
+
+	machineToDelete, err := selectMachineForScaleDown(ctx, controlPlane, machinesRequireUpgrade)
+	if err != nil || machineToDelete == nil {
+		return controlplanev1.RolloutPhaseSelectingMachine, ""
+	}
+
+	// The replacement machine is waited for before etcd, whose members only get healthy once it joined.
+	waitingForEtcd := false
+	for _, failure := range preflightCheckFailures(controlPlane, machineToDelete) {
+		if failure.condition != controlplanev1.MachineEtcdMemberHealthyCondition {
+			return controlplanev1.RolloutPhaseWaitingForNewMachine, machineToDelete.Name
+		}
+		waitingForEtcd = true
+	}
+	if waitingForEtcd {
+		return controlplanev1.RolloutPhaseWaitingForEtcd, machineToDelete.Name
+	}
+
+	return controlplanev1.RolloutPhaseDeleting, machineToDelete.Name
+}
@@ -0,0 +1,666 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/collections"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	bootstrapv1 "github.com/k3s-io/cluster-api-k3s/bootstrap/api/v1beta2"
+	controlplanev1 "github.com/k3s-io/cluster-api-k3s/controlplane/api/v1beta2"
+	k3s "github.com/k3s-io/cluster-api-k3s/pkg/k3s"
+	"github.com/k3s-io/cluster-api-k3s/pkg/kubeconfig"
+	"github.com/k3s-io/cluster-api-k3s/pkg/secret"
+	"github.com/k3s-io/cluster-api-k3s/pkg/token"
+)
+
+func TestReconcileResolvedVersion(t *testing.T) {
+	g := NewWithT(t)
+
+	// a plain Kubernetes version resolves to its first k3s build.
+	kcp := &controlplanev1.KThreesControlPlane{Spec: controlplanev1.KThreesControlPlaneSpec{Version: "v1.30.4"}}
+	g.Expect(reconcileResolvedVersion(kcp)).To(Succeed())
+	g.Expect(kcp.Status.ResolvedVersion).To(Equal("v1.30.4+k3s1"))
+	g.Expect(kcp.K3sVersion()).To(Equal("v1.30.4+k3s1"))
+
+	// the resolved release stays pinned while the version does not change, even with another build policy.
+	kcp.Status.ResolvedVersion = "v1.30.4+k3s2"
+	kcp.Spec.VersionBuildPolicy = controlplanev1.VersionBuildPolicyLatestKnownBuild
+	g.Expect(reconcileResolvedVersion(kcp)).To(Succeed())
+	g.Expect(kcp.Status.ResolvedVersion).To(Equal("v1.30.4+k3s2"))
+	g.Expect(kcp.K3sVersion()).To(Equal("v1.30.4+k3s2"))
+
+	// a new version is resolved again; the latest known build falls back to the first one.
+	kcp.Spec.Version = "v1.30.5"
+	g.Expect(kcp.K3sVersion()).To(Equal("v1.30.5"))
+	g.Expect(reconcileResolvedVersion(kcp)).To(Succeed())
+	g.Expect(kcp.Status.ResolvedVersion).To(Equal("v1.30.5+k3s1"))
+
+	// versions with a k3s build are used as is.
+	kcp.Spec.Version = "v1.30.5+k3s3"
+	g.Expect(kcp.K3sVersion()).To(Equal("v1.30.5+k3s3"))
+	g.Expect(reconcileResolvedVersion(kcp)).To(Succeed())
+	g.Expect(kcp.Status.ResolvedVersion).To(Equal("v1.30.5+k3s3"))
+
+	// invalid versions are rejected.
+	kcp.Spec.Version = "latest"
+	g.Expect(reconcileResolvedVersion(kcp)).ToNot(Succeed())
+}
+
+func TestUpgradeControlPlaneRolloutPhase(t *testing.T) {
+	cluster := newTestCluster()
+
+	healthy := func(machine *clusterv1.Machine, etcdHealthy bool) *clusterv1.Machine {
+		machine.Status.NodeRef = &corev1.ObjectReference{Kind: "Node", Name: machine.Name}
+		conditions.MarkTrue(machine, controlplanev1.MachineAgentHealthyCondition)
+		if etcdHealthy {
+			conditions.MarkTrue(machine, controlplanev1.MachineEtcdMemberHealthyCondition)
+		} else {
+			conditions.MarkFalse(machine, controlplanev1.MachineEtcdMemberHealthyCondition, controlplanev1.EtcdMemberUnhealthyReason, clusterv1.ConditionSeverityError, "")
+		}
+		return machine
+	}
+	newMachines := func(kcp *controlplanev1.KThreesControlPlane, upToDate int, etcdHealthy bool, newMachineHealthy bool) []client.Object {
+		outdatedKCP := kcp.DeepCopy()
+		outdatedKCP.Spec.Version = "v1.29.8+k3s1"
+		outdated, outdatedConfig := newTestMachine(cluster, outdatedKCP, "outdated", false)
+		outdated.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+		objs := []client.Object{healthy(outdated, true), outdatedConfig}
+		for i := 0; i < upToDate; i++ {
+			machine, config := newTestMachine(cluster, kcp, fmt.Sprintf("up-to-date-%d", i), false)
+			if newMachineHealthy {
+				healthy(machine, etcdHealthy)
+			}
+			objs = append(objs, machine, config)
+		}
+		return objs
+	}
+	etcdCA := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: cluster.Namespace, Name: cluster.Name + "-etcd"}}
+
+	tests := []struct {
+		name          string
+		approvalMode  controlplanev1.RolloutApprovalMode
+		approved      bool
+		objs          func(kcp *controlplanev1.KThreesControlPlane) []client.Object
+		expectPhase   controlplanev1.RolloutPhase
+		expectMachine string
+		expectResult  ctrl.Result
+		expectCreated bool
+		expectDeleted bool
+	}{
+		{
+			name: "selects the first machine to replace",
+			objs: func(kcp *controlplanev1.KThreesControlPlane) []client.Object {
+				return newMachines(kcp, 0, true, true)
+			},
+			expectPhase:   controlplanev1.RolloutPhaseSelectingMachine,
+			expectResult:  ctrl.Result{Requeue: true},
+			expectCreated: true,
+		},
+		{
+			name:         "the first machine replacement does not require an approval",
+			approvalMode: controlplanev1.RolloutApprovalModeManual,
+			objs: func(kcp *controlplanev1.KThreesControlPlane) []client.Object {
+				return newMachines(kcp, 0, true, true)
+			},
+			expectPhase:   controlplanev1.RolloutPhaseSelectingMachine,
+			expectResult:  ctrl.Result{Requeue: true},
+			expectCreated: true,
+		},
+		{
+			name:         "waits for the approval of the next machine replacement",
+			approvalMode: controlplanev1.RolloutApprovalModeManual,
+			objs: func(kcp *controlplanev1.KThreesControlPlane) []client.Object {
+				kcp.Spec.Replicas = ptr.To[int32](2)
+				return newMachines(kcp, 1, true, true)
+			},
+			expectPhase:  controlplanev1.RolloutPhaseWaitingForApproval,
+			expectResult: ctrl.Result{},
+		},
+		{
+			name:         "replaces the next machine once approved",
+			approvalMode: controlplanev1.RolloutApprovalModeManual,
+			approved:     true,
+			objs: func(kcp *controlplanev1.KThreesControlPlane) []client.Object {
+				kcp.Spec.Replicas = ptr.To[int32](2)
+				return newMachines(kcp, 1, true, true)
+			},
+			expectPhase:   controlplanev1.RolloutPhaseSelectingMachine,
+			expectResult:  ctrl.Result{Requeue: true},
+			expectCreated: true,
+		},
+		{
+			name: "waits for the new machine",
+			objs: func(kcp *controlplanev1.KThreesControlPlane) []client.Object {
+				return newMachines(kcp, 1, true, false)
+			},
+			expectPhase:   controlplanev1.RolloutPhaseWaitingForNewMachine,
+			expectMachine: "outdated",
+			expectResult:  ctrl.Result{RequeueAfter: defaultPreflightFailedRequeueAfter},
+		},
+		{
+			name: "waits for etcd",
+			objs: func(kcp *controlplanev1.KThreesControlPlane) []client.Object {
+				return append(newMachines(kcp, 1, false, true), etcdCA)
+			},
+			expectPhase:   controlplanev1.RolloutPhaseWaitingForEtcd,
+			expectMachine: "outdated",
+			expectResult:  ctrl.Result{RequeueAfter: defaultPreflightFailedRequeueAfter},
+		},
+		{
+			name: "ignores etcd when it is not managed",
+			objs: func(kcp *controlplanev1.KThreesControlPlane) []client.Object {
+				return newMachines(kcp, 1, false, true)
+			},
+			expectPhase:   controlplanev1.RolloutPhaseDeleting,
+			expectMachine: "outdated",
+			expectResult:  ctrl.Result{Requeue: true},
+			expectDeleted: true,
+		},
+		{
+			name: "deletes the outdated machine",
+			objs: func(kcp *controlplanev1.KThreesControlPlane) []client.Object {
+				return newMachines(kcp, 1, true, true)
+			},
+			expectPhase:   controlplanev1.RolloutPhaseDeleting,
+			expectMachine: "outdated",
+			expectResult:  ctrl.Result{Requeue: true},
+			expectDeleted: true,
+		},
+		{
+			name: "waits for the deleting machine",
+			objs: func(kcp *controlplanev1.KThreesControlPlane) []client.Object {
+				objs := newMachines(kcp, 0, true, true)
+				objs[0].SetDeletionTimestamp(ptr.To(metav1.Now()))
+				objs[0].SetFinalizers([]string{clusterv1.MachineFinalizer})
+				return objs
+			},
+			expectPhase:   controlplanev1.RolloutPhaseDeleting,
+			expectMachine: "outdated",
+			expectResult:  ctrl.Result{RequeueAfter: deleteRequeueAfter},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.TODO()
+
+			kcp := newTestKCP(cluster)
+			kcp.Spec.Replicas = ptr.To[int32](1)
+			kcp.Spec.RolloutStrategy = &controlplanev1.RolloutStrategy{ApprovalMode: tt.approvalMode}
+			if tt.approved {
+				kcp.Annotations = map[string]string{controlplanev1.ApproveRolloutStepAnnotation: ""}
+			}
+			objs := append(tt.objs(kcp), cluster, kcp, newTestInfraMachineTemplate(cluster.Namespace))
+			c := newFakeClient(objs...)
+			r := newTestReconciler(c, nil)
+
+			machines, err := r.managementCluster.GetMachinesForCluster(ctx, client.ObjectKeyFromObject(cluster))
+			g.Expect(err).ToNot(HaveOccurred())
+			controlPlane, err := k3s.NewControlPlane(ctx, c, cluster, kcp, machines)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			result, err := r.upgradeControlPlane(ctx, cluster, kcp, controlPlane, controlPlane.MachinesNeedingRollout())
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result).To(Equal(tt.expectResult))
+			g.Expect(kcp.Status.Rollout).ToNot(BeNil())
+			g.Expect(kcp.Status.Rollout.Phase).To(Equal(tt.expectPhase))
+			g.Expect(kcp.Status.Rollout.Machine).To(Equal(tt.expectMachine))
+			if tt.expectPhase == controlplanev1.RolloutPhaseWaitingForApproval {
+				g.Expect(conditions.GetReason(kcp, controlplanev1.MachinesSpecUpToDateCondition)).To(Equal(controlplanev1.RolloutWaitingForStepApprovalReason))
+			}
+			if tt.approved {
+				// the approval is used up by the replacement machine.
+				g.Expect(kcp.Annotations).ToNot(HaveKey(controlplanev1.ApproveRolloutStepAnnotation))
+			}
+
+			after, err := r.managementCluster.GetMachinesForCluster(ctx, client.ObjectKeyFromObject(cluster))
+			g.Expect(err).ToNot(HaveOccurred())
+			switch {
+			case tt.expectCreated:
+				g.Expect(after.Len()).To(Equal(machines.Len() + 1))
+			case tt.expectDeleted:
+				g.Expect(after.Names()).ToNot(ContainElement("outdated"))
+			default:
+				g.Expect(after.Names()).To(ConsistOf(machines.Names()))
+			}
+		})
+	}
+}
+
+func TestIsRolloutApproved(t *testing.T) {
+	tests := []struct {
+		name           string
+		annotations    map[string]string
+		expectApproved bool
+	}{
+		{
+			name:           "without the require approval annotation",
+			expectApproved: true,
+		},
+		{
+			name:           "approved without the require approval annotation",
+			annotations:    map[string]string{controlplanev1.ApproveRolloutAnnotation: ""},
+			expectApproved: true,
+		},
+		{
+			name:        "waiting for the approval",
+			annotations: map[string]string{controlplanev1.RequireRolloutApprovalAnnotation: ""},
+		},
+		{
+			name: "approved",
+			annotations: map[string]string{
+				controlplanev1.RequireRolloutApprovalAnnotation: "",
+				controlplanev1.ApproveRolloutAnnotation:         "",
+			},
+			expectApproved: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			kcp := newTestKCP(newTestCluster())
+			kcp.Annotations = tt.annotations
+			g.Expect(isRolloutApproved(kcp)).To(Equal(tt.expectApproved))
+		})
+	}
+}
+
+func TestIsRolloutStepApproved(t *testing.T) {
+	cluster := newTestCluster()
+
+	tests := []struct {
+		name             string
+		rolloutStrategy  *controlplanev1.RolloutStrategy
+		upToDateMachines int
+		approved         bool
+		expectApproved   bool
+	}{
+		{
+			name:             "without a rollout strategy",
+			upToDateMachines: 1,
+			expectApproved:   true,
+		},
+		{
+			name:             "with the automatic approval mode",
+			rolloutStrategy:  &controlplanev1.RolloutStrategy{ApprovalMode: controlplanev1.RolloutApprovalModeAutomatic},
+			upToDateMachines: 1,
+			expectApproved:   true,
+		},
+		{
+			name:            "the first machine replacement with the manual approval mode",
+			rolloutStrategy: &controlplanev1.RolloutStrategy{ApprovalMode: controlplanev1.RolloutApprovalModeManual},
+			expectApproved:  true,
+		},
+		{
+			name:             "the next machine replacement with the manual approval mode",
+			rolloutStrategy:  &controlplanev1.RolloutStrategy{ApprovalMode: controlplanev1.RolloutApprovalModeManual},
+			upToDateMachines: 1,
+		},
+		{
+			name:             "an approved machine replacement with the manual approval mode",
+			rolloutStrategy:  &controlplanev1.RolloutStrategy{ApprovalMode: controlplanev1.RolloutApprovalModeManual},
+			upToDateMachines: 1,
+			approved:         true,
+			expectApproved:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.TODO()
+
+			kcp := newTestKCP(cluster)
+			kcp.Spec.RolloutStrategy = tt.rolloutStrategy
+			if tt.approved {
+				kcp.Annotations = map[string]string{controlplanev1.ApproveRolloutStepAnnotation: ""}
+			}
+			outdatedKCP := kcp.DeepCopy()
+			outdatedKCP.Spec.Version = "v1.29.8+k3s1"
+			outdated, outdatedConfig := newTestMachine(cluster, outdatedKCP, "outdated", false)
+			objs := []client.Object{outdated, outdatedConfig}
+			for i := 0; i < tt.upToDateMachines; i++ {
+				machine, config := newTestMachine(cluster, kcp, fmt.Sprintf("up-to-date-%d", i), false)
+				objs = append(objs, machine, config)
+			}
+			c := newFakeClient(objs...)
+			machines := &clusterv1.MachineList{}
+			g.Expect(c.List(ctx, machines)).To(Succeed())
+			controlPlane, err := k3s.NewControlPlane(ctx, c, cluster, kcp, collections.FromMachineList(machines))
+			g.Expect(err).ToNot(HaveOccurred())
+
+			g.Expect(isRolloutStepApproved(kcp, controlPlane)).To(Equal(tt.expectApproved))
+		})
+	}
+}
+
+func TestUpdateStatusInitialization(t *testing.T) {
+	cluster := newTestCluster()
+	servingSecret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "k3s-serving", Namespace: metav1.NamespaceSystem}}
+
+	tests := []struct {
+		name              string
+		workloadObjs      []client.Object
+		expectStatus      *controlplanev1.KThreesControlPlaneInitializationStatus
+		expectInitialized bool
+	}{
+		{
+			name: "k3s serving secret not uploaded yet",
+		},
+		{
+			name:              "k3s serving secret uploaded",
+			workloadObjs:      []client.Object{servingSecret},
+			expectStatus:      &controlplanev1.KThreesControlPlaneInitializationStatus{ControlPlaneInitialized: true},
+			expectInitialized: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.TODO()
+
+			kcp := newTestKCP(cluster)
+			kcp.Spec.Replicas = ptr.To[int32](1)
+			kcp.Status = controlplanev1.KThreesControlPlaneStatus{}
+			machine, config := newTestMachine(cluster, kcp, "machine", false)
+			c := newFakeClient(cluster, kcp, machine, config)
+			r := newTestReconciler(c, fake.NewClientBuilder().WithObjects(tt.workloadObjs...).Build())
+
+			g.Expect(r.updateStatus(ctx, kcp, cluster)).To(Succeed())
+			g.Expect(kcp.Status.Initialized).To(Equal(tt.expectInitialized))
+			g.Expect(kcp.Status.Initialization).To(Equal(tt.expectStatus))
+		})
+	}
+}
+
+func TestReconcileDeleteRetainsClusterSecrets(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.TODO()
+
+	cluster := newTestCluster()
+	kcp := newTestKCP(cluster)
+	kcp.Annotations = map[string]string{controlplanev1.RetainSecretsAnnotation: ""}
+	kcp.Finalizers = []string{controlplanev1.KThreesControlPlaneFinalizer}
+	kcp.Spec.KThreesConfigSpec.Files = []bootstrapv1.File{{
+		Path:        "/etc/rancher/k3s/config.yaml.d/etcd-s3.yaml",
+		ContentFrom: &bootstrapv1.FileSource{Secret: bootstrapv1.SecretFileSource{Name: "etcd-s3", Key: "config"}},
+	}}
+	controllerRef := metav1.NewControllerRef(kcp, controlplanev1.GroupVersion.WithKind("KThreesControlPlane"))
+
+	newSecret := func(name string) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       cluster.Namespace,
+			OwnerReferences: []metav1.OwnerReference{*controllerRef},
+		}}
+	}
+	certificates := secret.NewCertificatesForInitialControlPlane(&kcp.Spec.KThreesConfigSpec)
+	g.Expect(certificates.Generate()).To(Succeed())
+	objs := []client.Object{cluster, kcp, newSecret(token.Name(cluster.Name)), newSecret("etcd-s3"), newSecret(secret.Name(cluster.Name, secret.Kubeconfig))}
+	for _, certificate := range certificates {
+		objs = append(objs, certificate.AsSecret(client.ObjectKeyFromObject(cluster), *controllerRef))
+	}
+	c := newFakeClient(objs...)
+	r := newTestReconciler(c, nil)
+
+	result, err := r.reconcileDelete(ctx, cluster, kcp)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result).To(BeZero())
+	g.Expect(kcp.Finalizers).To(BeEmpty())
+
+	getSecret := func(name string) *corev1.Secret {
+		s := &corev1.Secret{}
+		g.Expect(c.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: name}, s)).To(Succeed())
+		return s
+	}
+	for _, name := range []string{token.Name(cluster.Name), "etcd-s3"} {
+		g.Expect(getSecret(name).OwnerReferences).To(BeEmpty())
+		g.Expect(getSecret(name).Annotations).ToNot(HaveKey(secret.RetainedAnnotation))
+	}
+	for _, certificate := range certificates {
+		s := getSecret(secret.Name(cluster.Name, certificate.Purpose))
+		g.Expect(s.OwnerReferences).To(BeEmpty())
+		g.Expect(s.Annotations).To(HaveKey(secret.RetainedAnnotation))
+	}
+	// the kubeconfig is generated again for the recreated cluster.
+	g.Expect(getSecret(secret.Name(cluster.Name, secret.Kubeconfig)).OwnerReferences).To(ConsistOf(*controllerRef))
+
+	// a control plane recreated for the same cluster adopts the retained certificate authorities and token.
+	recreated := newTestKCP(cluster)
+	recreated.UID = "recreated-kcp-uid"
+	recreatedRef := metav1.NewControllerRef(recreated, controlplanev1.GroupVersion.WithKind("KThreesControlPlane"))
+	lookup := secret.NewCertificatesForInitialControlPlane(&recreated.Spec.KThreesConfigSpec)
+	g.Expect(lookup.LookupOrGenerate(ctx, c, client.ObjectKeyFromObject(cluster), *recreatedRef)).To(Succeed())
+	g.Expect(token.Reconcile(ctx, c, client.ObjectKeyFromObject(cluster), recreated)).To(Succeed())
+	for _, certificate := range lookup {
+		g.Expect(certificate.Generated).To(BeFalse())
+		s := getSecret(secret.Name(cluster.Name, certificate.Purpose))
+		g.Expect(s.OwnerReferences).To(ConsistOf(*recreatedRef))
+		g.Expect(s.Annotations).ToNot(HaveKey(secret.RetainedAnnotation))
+	}
+	g.Expect(getSecret(token.Name(cluster.Name)).OwnerReferences).To(ConsistOf(*recreatedRef))
+	g.Expect(getSecret("etcd-s3").OwnerReferences).To(BeEmpty())
+}
+
+func TestReconcileCertificateExpiries(t *testing.T) {
+	cluster := newTestCluster()
+	clusterName := client.ObjectKeyFromObject(cluster)
+	tokenKubeconfig := []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: cluster
+  cluster:
+    server: https://example.com:6443
+users:
+- name: user
+  user:
+    token: token
+contexts:
+- name: context
+  context:
+    cluster: cluster
+    user: user
+current-context: context
+`)
+
+	tests := []struct {
+		name            string
+		kubeconfig      func(g *WithT, c client.Client, owner metav1.OwnerReference)
+		expectNames     []string
+		expectExpiring  bool
+		expectCondition string
+	}{
+		{
+			name:            "no kubeconfig yet",
+			expectNames:     []string{string(secret.ClusterCA), string(secret.ClientClusterCA)},
+			expectCondition: controlplanev1.CertificatesValidReason,
+		},
+		{
+			name: "kubeconfig controlled by the KThreesControlPlane",
+			kubeconfig: func(g *WithT, c client.Client, owner metav1.OwnerReference) {
+				g.Expect(kubeconfig.CreateSecretWithOwner(context.TODO(), c, clusterName, "example.com:6443", owner, 365*24*time.Hour)).To(Succeed())
+			},
+			expectNames:     []string{string(secret.ClusterCA), string(secret.ClientClusterCA), string(secret.Kubeconfig)},
+			expectCondition: controlplanev1.CertificatesValidReason,
+		},
+		{
+			name: "kubeconfig client certificate expiring soon",
+			kubeconfig: func(g *WithT, c client.Client, owner metav1.OwnerReference) {
+				g.Expect(kubeconfig.CreateSecretWithOwner(context.TODO(), c, clusterName, "example.com:6443", owner, 24*time.Hour)).To(Succeed())
+			},
+			expectNames:     []string{string(secret.ClusterCA), string(secret.ClientClusterCA), string(secret.Kubeconfig)},
+			expectExpiring:  true,
+			expectCondition: controlplanev1.CertificatesExpiringReason,
+		},
+		{
+			name: "kubeconfig not controlled by the KThreesControlPlane is skipped",
+			kubeconfig: func(g *WithT, c client.Client, _ metav1.OwnerReference) {
+				g.Expect(c.Create(context.TODO(), kubeconfig.GenerateSecret(cluster, tokenKubeconfig))).To(Succeed())
+			},
+			expectNames:     []string{string(secret.ClusterCA), string(secret.ClientClusterCA)},
+			expectCondition: controlplanev1.CertificatesValidReason,
+		},
+		{
+			name: "kubeconfig without client certificate is skipped",
+			kubeconfig: func(g *WithT, c client.Client, owner metav1.OwnerReference) {
+				g.Expect(c.Create(context.TODO(), kubeconfig.GenerateSecretWithOwner(clusterName, tokenKubeconfig, owner))).To(Succeed())
+			},
+			expectNames:     []string{string(secret.ClusterCA), string(secret.ClientClusterCA)},
+			expectCondition: controlplanev1.CertificatesValidReason,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.TODO()
+
+			kcp := newTestKCP(cluster)
+			owner := *metav1.NewControllerRef(kcp, controlplanev1.GroupVersion.WithKind("KThreesControlPlane"))
+			certificates := secret.Certificates{&secret.Certificate{Purpose: secret.ClusterCA}, &secret.Certificate{Purpose: secret.ClientClusterCA}}
+			g.Expect(certificates.Generate()).To(Succeed())
+			objs := []client.Object{cluster, kcp}
+			for _, certificate := range certificates {
+				objs = append(objs, certificate.AsSecret(clusterName, owner))
+			}
+			c := newFakeClient(objs...)
+			if tt.kubeconfig != nil {
+				tt.kubeconfig(g, c, owner)
+			}
+			r := newTestReconciler(c, nil)
+
+			g.Expect(r.reconcileCertificateExpiries(ctx, clusterName, kcp, certificates)).To(Succeed())
+			names := []string{}
+			for _, expiry := range kcp.Status.CertificateExpiries {
+				g.Expect(expiry.NotAfter.Time).To(BeTemporally(">", time.Now()))
+				names = append(names, expiry.Name)
+			}
+			g.Expect(names).To(ConsistOf(tt.expectNames))
+
+			condition := conditions.Get(kcp, controlplanev1.CertificatesExpiringSoonCondition)
+			g.Expect(condition).ToNot(BeNil())
+			g.Expect(condition.Reason).To(Equal(tt.expectCondition))
+			if tt.expectExpiring {
+				g.Expect(condition.Status).To(Equal(corev1.ConditionTrue))
+				g.Expect(condition.Message).To(ContainSubstring(string(secret.Kubeconfig)))
+			} else {
+				g.Expect(condition.Status).To(Equal(corev1.ConditionFalse))
+			}
+		})
+	}
+}
+
+func TestReconcileServingCertsRotation(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.TODO()
+
+	rotationTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	rotation := rotationTime.Format(time.RFC3339)
+
+	cluster := newTestCluster()
+	kcp := newTestKCP(cluster)
+	kcp.Annotations = map[string]string{controlplanev1.RotateServingCertsAnnotation: rotation}
+	conditions.MarkTrue(kcp, controlplanev1.ControlPlaneComponentsHealthyCondition)
+	conditions.MarkTrue(kcp, controlplanev1.EtcdClusterHealthyCondition)
+
+	objs := []client.Object{cluster, kcp}
+	var nodes []client.Object
+	for name, created := range map[string]time.Time{
+		"old-0": rotationTime.Add(-2 * time.Hour),
+		"old-1": rotationTime.Add(-time.Hour),
+		"new":   rotationTime.Add(30 * time.Minute),
+	} {
+		machine, config := newTestMachine(cluster, kcp, name, false)
+		machine.CreationTimestamp = metav1.NewTime(created)
+		machine.Status.NodeRef = &corev1.ObjectReference{Kind: "Node", Name: name}
+		objs = append(objs, machine, config)
+		nodes = append(nodes, &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status:     corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}},
+		})
+	}
+	c := newFakeClient(objs...)
+	workloadClient := fake.NewClientBuilder().WithObjects(nodes...).WithStatusSubresource(&corev1.Pod{}).Build()
+	r := newTestReconciler(c, workloadClient)
+
+	reconcile := func() ctrl.Result {
+		machines, err := r.managementCluster.GetMachinesForCluster(ctx, client.ObjectKeyFromObject(cluster))
+		g.Expect(err).ToNot(HaveOccurred())
+		controlPlane, err := k3s.NewControlPlane(ctx, c, cluster, kcp, machines)
+		g.Expect(err).ToNot(HaveOccurred())
+		result, err := r.reconcileServingCertsRotation(ctx, controlPlane)
+		g.Expect(err).ToNot(HaveOccurred())
+		return result
+	}
+	rotatedMachines := func() []string {
+		machines := &clusterv1.MachineList{}
+		g.Expect(c.List(ctx, machines)).To(Succeed())
+		rotated := []string{}
+		for _, machine := range machines.Items {
+			if machine.Annotations[controlplanev1.ServingCertsRotatedAnnotation] == rotation {
+				rotated = append(rotated, machine.Name)
+			}
+		}
+		return rotated
+	}
+
+	// the servers created before the rotation are restarted one at a time, the oldest first.
+	for _, name := range []string{"old-0", "old-1"} {
+		g.Expect(reconcile()).To(Equal(ctrl.Result{RequeueAfter: servingCertsRotationRequeueAfter}))
+		pods := &corev1.PodList{}
+		g.Expect(workloadClient.List(ctx, pods)).To(Succeed())
+		g.Expect(pods.Items).To(HaveLen(1))
+		g.Expect(pods.Items[0].Spec.NodeName).To(Equal(name))
+
+		pods.Items[0].Status.Phase = corev1.PodSucceeded
+		g.Expect(workloadClient.Status().Update(ctx, &pods.Items[0])).To(Succeed())
+		g.Expect(reconcile()).To(Equal(ctrl.Result{Requeue: true}))
+		g.Expect(rotatedMachines()).To(ContainElement(name))
+	}
+
+	// the server created after the rotation already has new serving certificates.
+	g.Expect(reconcile()).To(BeZero())
+	g.Expect(rotatedMachines()).To(ConsistOf("old-0", "old-1"))
+	pods := &corev1.PodList{}
+	g.Expect(workloadClient.List(ctx, pods)).To(Succeed())
+	g.Expect(pods.Items).To(BeEmpty())
+
+	// a rotation which is not a timestamp restarts all the servers.
+	kcp.Annotations[controlplanev1.RotateServingCertsAnnotation] = "again"
+	g.Expect(reconcile()).To(Equal(ctrl.Result{RequeueAfter: servingCertsRotationRequeueAfter}))
+	g.Expect(workloadClient.List(ctx, pods)).To(Succeed())
+	g.Expect(pods.Items).To(HaveLen(1))
+	g.Expect(pods.Items[0].Spec.NodeName).To(Equal("old-0"))
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	bootstrapv1 "github.com/k3s-io/cluster-api-k3s/bootstrap/api/v1beta2"
+	controlplanev1 "github.com/k3s-io/cluster-api-k3s/controlplane/api/v1beta2"
+	k3s "github.com/k3s-io/cluster-api-k3s/pkg/k3s"
+)
+
+// reconcileNodeConfigDrift compares every nodeConfigCheckInterval the k3s configuration files of each server with
+// the ones stored in its bootstrap data secret, recording the result in status.nodeConfigDrift and the
+// NodeConfigInSync condition. With the Reapply config drift policy, the drifted files are written back and k3s
+// restarted, one server at a time.
+func (r *KThreesControlPlaneReconciler) reconcileNodeConfigDrift(ctx context.Context, controlPlane *k3s.ControlPlane) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	if !controlPlane.KCP.Status.Initialized {
+		conditions.Delete(controlPlane.KCP, controlplanev1.NodeConfigInSyncCondition)
+		controlPlane.KCP.Status.NodeConfigDrift = nil
+		return ctrl.Result{}, nil
+	}
+
+	workloadCluster, err := r.managementCluster.GetWorkloadCluster(ctx, util.ObjectKey(controlPlane.Cluster))
+	if err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "cannot get remote client to workload cluster")
+	}
+
+	now := time.Now()
+	results := make([]controlplanev1.NodeConfigDrift, 0, controlPlane.Machines.Len())
+	checked := map[string]controlplanev1.NodeConfigDrift{}
+	for _, result := range controlPlane.KCP.Status.NodeConfigDrift {
+		checked[result.Machine] = result
+	}
+
+	pending := false
+	nodeConfigFiles := map[string][]bootstrapv1.File{}
+	for _, machine := range controlPlane.Machines.SortedByCreationTimestamp() {
+		result, ok := checked[machine.Name]
+		if ok && now.Sub(result.LastChecked.Time) < nodeConfigCheckInterval {
+			results = append(results, result)
+			continue
+		}
+		if machine.Status.NodeRef == nil {
+			pending = true
+			continue
+		}
+
+		files, err := r.getNodeConfigFiles(ctx, machine)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		// Machines bootstrapped before the files were stored in the bootstrap data secret are not compared.
+		if len(files) == 0 {
+			continue
+		}
+		nodeConfigFiles[machine.Name] = files
+
+		drifted, done, err := workloadCluster.NodeConfigDrift(ctx, machine.Status.NodeRef.Name, files)
+		if err != nil {
+			log.Error(err, "Failed to compare the k3s configuration files", "machine", machine.Name)
+			conditions.MarkUnknown(controlPlane.KCP, controlplanev1.NodeConfigInSyncCondition, controlplanev1.NodeConfigInspectionFailedReason,
+				"Failed to compare the k3s configuration files of Machine %s", machine.Name)
+		}
+		if err != nil || !done {
+			if ok {
+				results = append(results, result)
+			}
+			pending = true
+			continue
+		}
+
+		results = append(results, controlplanev1.NodeConfigDrift{
+			Machine:     machine.Name,
+			Files:       drifted,
+			LastChecked: metav1.NewTime(now),
+		})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Machine < results[j].Machine })
+	controlPlane.KCP.Status.NodeConfigDrift = results
+
+	drifted := []string{}
+	for _, result := range results {
+		if len(result.Files) > 0 {
+			drifted = append(drifted, fmt.Sprintf("%s (%s)", result.Machine, strings.Join(result.Files, ", ")))
+		}
+	}
+
+	if len(drifted) == 0 {
+		if pending {
+			return ctrl.Result{RequeueAfter: nodeConfigRequeueAfter}, nil
+		}
+		conditions.MarkTrue(controlPlane.KCP, controlplanev1.NodeConfigInSyncCondition)
+		return ctrl.Result{}, nil
+	}
+
+	if controlPlane.KCP.Spec.ConfigDriftPolicy != controlplanev1.ConfigDriftPolicyReapply {
+		conditions.MarkFalse(controlPlane.KCP, controlplanev1.NodeConfigInSyncCondition, controlplanev1.NodeConfigDriftedReason, clusterv1.ConditionSeverityWarning,
+			"The k3s configuration files of Machines %s drifted", strings.Join(drifted, ", "))
+		if pending {
+			return ctrl.Result{RequeueAfter: nodeConfigRequeueAfter}, nil
+		}
+		return ctrl.Result{}, nil
+	}
+
+	conditions.MarkFalse(controlPlane.KCP, controlplanev1.NodeConfigInSyncCondition, controlplanev1.NodeConfigReapplyingReason, clusterv1.ConditionSeverityInfo,
+		"Reapplying the k3s configuration files of Machines %s", strings.Join(drifted, ", "))
+
+	// Only restart k3s on a healthy control plane, so that a single server is unavailable at a time.
+	if !conditions.IsTrue(controlPlane.KCP, controlplanev1.ControlPlaneComponentsHealthyCondition) ||
+		!conditions.IsTrue(controlPlane.KCP, controlplanev1.EtcdClusterHealthyCondition) {
+		log.Info("Waiting for the control plane to be healthy before reapplying the k3s configuration files")
+		return ctrl.Result{RequeueAfter: nodeConfigRequeueAfter}, nil
+	}
+
+	var machine *clusterv1.Machine
+	for _, result := range results {
+		if len(result.Files) > 0 {
+			machine = controlPlane.Machines[result.Machine]
+			break
+		}
+	}
+	if machine == nil || machine.Status.NodeRef == nil {
+		return ctrl.Result{RequeueAfter: nodeConfigRequeueAfter}, nil
+	}
+
+	files, ok := nodeConfigFiles[machine.Name]
+	if !ok {
+		if files, err = r.getNodeConfigFiles(ctx, machine); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	done, err := workloadCluster.ReapplyNodeConfig(ctx, machine.Status.NodeRef.Name, files)
+	if err != nil {
+		return ctrl.Result{}, errors.Wrapf(err, "failed to reapply the k3s configuration files of Machine %s", machine.Name)
+	}
+	if !done {
+		log.Info("Reapplying the k3s configuration files", "machine", machine.Name)
+		return ctrl.Result{RequeueAfter: nodeConfigRequeueAfter}, nil
+	}
+
+	// Drop the result of the machine so that its files are compared again on the next reconcile.
+	controlPlane.KCP.Status.NodeConfigDrift = slices.DeleteFunc(results, func(result controlplanev1.NodeConfigDrift) bool {
+		return result.Machine == machine.Name
+	})
+
+	log.Info("Reapplied the k3s configuration files", "machine", machine.Name)
+	r.recorder.Eventf(controlPlane.KCP, corev1.EventTypeNormal, "NodeConfigReapplied",
+		"Reapplied the k3s configuration files of Machine %s", machine.Name)
+	return ctrl.Result{Requeue: true}, nil
+}
+
+// getNodeConfigFiles returns the k3s configuration files stored in the bootstrap data secret of the machine, if any.
+func (r *KThreesControlPlaneReconciler) getNodeConfigFiles(ctx context.Context, machine *clusterv1.Machine) ([]bootstrapv1.File, error) {
+	if machine.Spec.Bootstrap.DataSecretName == nil {
+		return nil, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: machine.Namespace, Name: *machine.Spec.Bootstrap.DataSecretName}, secret); err != nil {
+		return nil, errors.Wrapf(err, "failed to get the bootstrap data secret of Machine %s", machine.Name)
+	}
+
+	data, ok := secret.Data[bootstrapv1.NodeConfigFilesSecretKey]
+	if !ok {
+		return nil, nil
+	}
+
+	files := []bootstrapv1.File{}
+	if err := json.Unmarshal(data, &files); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal the k3s configuration files of Machine %s", machine.Name)
+	}
+	return files, nil
+}
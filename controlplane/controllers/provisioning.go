@@ -0,0 +1,58 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	bootstrapv1 "github.com/k3s-io/cluster-api-k3s/bootstrap/api/v1beta2"
+	k3s "github.com/k3s-io/cluster-api-k3s/pkg/k3s"
+)
+
+// reconcileProvisioningTimeouts deletes, one at a time, the control plane machines whose node did not join the cluster
+// within spec.kthreesConfigSpec.provisioningTimeout, so that they are recreated by the scale up.
+func (r *KThreesControlPlaneReconciler) reconcileProvisioningTimeouts(ctx context.Context, controlPlane *k3s.ControlPlane) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	if controlPlane.HasDeletingMachine() {
+		return ctrl.Result{}, nil
+	}
+
+	for _, machine := range controlPlane.Machines {
+		config, ok := controlPlane.KthreesConfigs[machine.Name]
+		if !ok || machine.Status.NodeRef != nil || config.Status.FailureReason != bootstrapv1.ProvisioningTimeoutReason {
+			continue
+		}
+
+		if err := r.Client.Delete(ctx, machine); err != nil && !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, errors.Wrapf(err, "failed to delete Machine %s", machine.Name)
+		}
+
+		log.Info("Deleted control plane machine that timed out provisioning", "machine", machine.Name)
+		r.recorder.Eventf(controlPlane.KCP, corev1.EventTypeWarning, "ProvisioningTimeout",
+			"Deleted control plane Machine %s of cluster %s/%s, its node did not join the cluster: %s",
+			machine.Name, controlPlane.Cluster.Namespace, controlPlane.Cluster.Name, config.Status.FailureMessage)
+		return ctrl.Result{RequeueAfter: deleteRequeueAfter}, nil
+	}
+
+	return ctrl.Result{}, nil
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/collections"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	bootstrapv1 "github.com/k3s-io/cluster-api-k3s/bootstrap/api/v1beta2"
+	controlplanev1 "github.com/k3s-io/cluster-api-k3s/controlplane/api/v1beta2"
+	k3s "github.com/k3s-io/cluster-api-k3s/pkg/k3s"
+)
+
+func TestReconcileProvisioningTimeouts(t *testing.T) {
+	cluster := newTestCluster()
+
+	newMachine := func(kcp *controlplanev1.KThreesControlPlane, name string, timedOut, joined, deleting bool) []client.Object {
+		machine, config := newTestMachine(cluster, kcp, name, false)
+		if timedOut {
+			config.Status.FailureReason = bootstrapv1.ProvisioningTimeoutReason
+			config.Status.FailureMessage = "node of Machine " + name + " did not join the cluster within 10m0s"
+		}
+		if joined {
+			machine.Status.NodeRef = &corev1.ObjectReference{Kind: "Node", Name: name}
+		}
+		if deleting {
+			machine.DeletionTimestamp = &metav1.Time{Time: metav1.Now().Time}
+			machine.Finalizers = []string{clusterv1.MachineFinalizer}
+		}
+		return []client.Object{machine, config}
+	}
+
+	tests := []struct {
+		name          string
+		machines      func(kcp *controlplanev1.KThreesControlPlane) []client.Object
+		expectResult  ctrl.Result
+		expectDeleted int
+	}{
+		{
+			name: "no machine timed out",
+			machines: func(kcp *controlplanev1.KThreesControlPlane) []client.Object {
+				return append(newMachine(kcp, "cp-0", false, true, false), newMachine(kcp, "cp-1", false, false, false)...)
+			},
+		},
+		{
+			name: "one of the machines that timed out is deleted",
+			machines: func(kcp *controlplanev1.KThreesControlPlane) []client.Object {
+				objs := newMachine(kcp, "cp-0", false, true, false)
+				objs = append(objs, newMachine(kcp, "cp-1", true, false, false)...)
+				return append(objs, newMachine(kcp, "cp-2", true, false, false)...)
+			},
+			expectResult:  ctrl.Result{RequeueAfter: deleteRequeueAfter},
+			expectDeleted: 1,
+		},
+		{
+			name: "a machine whose node joined is kept",
+			machines: func(kcp *controlplanev1.KThreesControlPlane) []client.Object {
+				return newMachine(kcp, "cp-0", true, true, false)
+			},
+		},
+		{
+			name: "nothing is deleted while another machine is deleting",
+			machines: func(kcp *controlplanev1.KThreesControlPlane) []client.Object {
+				return append(newMachine(kcp, "cp-0", false, true, true), newMachine(kcp, "cp-1", true, false, false)...)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.TODO()
+
+			kcp := newTestKCP(cluster)
+			objs := tt.machines(kcp)
+			c := newFakeClient(append(objs, cluster, kcp)...)
+			r := newTestReconciler(c, nil)
+
+			machines, err := r.managementCluster.GetMachinesForCluster(ctx, client.ObjectKeyFromObject(cluster), collections.OwnedMachines(kcp))
+			g.Expect(err).ToNot(HaveOccurred())
+			controlPlane, err := k3s.NewControlPlane(ctx, c, cluster, kcp, machines)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			result, err := r.reconcileProvisioningTimeouts(ctx, controlPlane)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result).To(Equal(tt.expectResult))
+
+			remaining := &clusterv1.MachineList{}
+			g.Expect(c.List(ctx, remaining, client.InNamespace(cluster.Namespace))).To(Succeed())
+			g.Expect(remaining.Items).To(HaveLen(len(objs)/2 - tt.expectDeleted))
+		})
+	}
+}
@@ -24,6 +24,7 @@ import (
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/klog/v2"
@@ -79,6 +80,7 @@ func (r *KThreesControlPlaneReconciler) reconcileUnhealthyMachines(ctx context.C
 
 	// If there are no unhealthy machines, return so KCP can proceed with other operations (ctrl.Result nil).
 	if len(unhealthyMachines) == 0 {
+		conditions.Delete(controlPlane.KCP, controlplanev1.RemediationBlockedCondition)
 		return ctrl.Result{}, nil
 	}
 
@@ -102,6 +104,8 @@ func (r *KThreesControlPlaneReconciler) reconcileUnhealthyMachines(ctx context.C
 	// is being deleted to avoid unnecessary logs if no further remediation should be done.
 	if _, ok := controlPlane.KCP.Annotations[controlplanev1.RemediationInProgressAnnotation]; ok {
 		log.Info("Another remediation is already in progress. Skipping remediation.")
+		r.markRemediationBlocked(controlPlane, machineToBeRemediated, controlplanev1.RemediationPreviousInProgressReason,
+			"waiting for the machine replacing the previously remediated one to be created")
 		return ctrl.Result{}, nil
 	}
 
@@ -137,6 +141,8 @@ func (r *KThreesControlPlaneReconciler) reconcileUnhealthyMachines(ctx context.C
 		return ctrl.Result{}, nil
 	}
 
+	// The k3s pre-terminate hook removes the etcd member of the machine once it is drained.
+	preTerminateHook := false
 	if controlPlane.KCP.Status.Initialized {
 		// Executes checks that apply only if the control plane is already initialized; in this case KCP can
 		// remediate only if it can safely assume that the operation preserves the operation state of the
@@ -146,6 +152,8 @@ func (r *KThreesControlPlaneReconciler) reconcileUnhealthyMachines(ctx context.C
 		if controlPlane.Machines.Len() <= 1 {
 			log.Info("A control plane machine needs remediation, but the number of current replicas is less or equal to 1. Skipping remediation", "Replicas", controlPlane.Machines.Len())
 			conditions.MarkFalse(machineToBeRemediated, clusterv1.MachineOwnerRemediatedCondition, clusterv1.WaitingForRemediationReason, clusterv1.ConditionSeverityWarning, "KCP can't remediate if current replicas are less or equal to 1")
+			r.markRemediationBlocked(controlPlane, machineToBeRemediated, controlplanev1.RemediationNotEnoughReplicasReason,
+				"the number of current replicas is less or equal to 1")
 			return ctrl.Result{}, nil
 		}
 
@@ -153,6 +161,8 @@ func (r *KThreesControlPlaneReconciler) reconcileUnhealthyMachines(ctx context.C
 		if controlPlane.HasHealthyMachineStillProvisioning() {
 			log.Info("A control plane machine needs remediation, but there are other control-plane machines being provisioned. Skipping remediation")
 			conditions.MarkFalse(machineToBeRemediated, clusterv1.MachineOwnerRemediatedCondition, clusterv1.WaitingForRemediationReason, clusterv1.ConditionSeverityWarning, "KCP waiting for control plane machine provisioning to complete before triggering remediation")
+			r.markRemediationBlocked(controlPlane, machineToBeRemediated, controlplanev1.RemediationMachinesProvisioningReason,
+				"waiting for other control plane machines to complete provisioning")
 			return ctrl.Result{}, nil
 		}
 
@@ -160,6 +170,8 @@ func (r *KThreesControlPlaneReconciler) reconcileUnhealthyMachines(ctx context.C
 		if controlPlane.HasDeletingMachine() {
 			log.Info("A control plane machine needs remediation, but there are other control-plane machines being deleted. Skipping remediation")
 			conditions.MarkFalse(machineToBeRemediated, clusterv1.MachineOwnerRemediatedCondition, clusterv1.WaitingForRemediationReason, clusterv1.ConditionSeverityWarning, "KCP waiting for control plane machine deletion to complete before triggering remediation")
+			r.markRemediationBlocked(controlPlane, machineToBeRemediated, controlplanev1.RemediationMachinesDeletingReason,
+				"waiting for other control plane machines to complete deletion")
 			return ctrl.Result{}, nil
 		}
 
@@ -174,6 +186,8 @@ func (r *KThreesControlPlaneReconciler) reconcileUnhealthyMachines(ctx context.C
 			if !canSafelyRemediate {
 				log.Info("A control plane machine needs remediation, but removing this machine could result in etcd quorum loss. Skipping remediation")
 				conditions.MarkFalse(machineToBeRemediated, clusterv1.MachineOwnerRemediatedCondition, clusterv1.WaitingForRemediationReason, clusterv1.ConditionSeverityWarning, "KCP can't remediate this machine because this could result in etcd loosing quorum")
+				r.markRemediationBlocked(controlPlane, machineToBeRemediated, controlplanev1.RemediationEtcdQuorumAtRiskReason,
+					"removing its etcd member could result in etcd losing quorum")
 				return ctrl.Result{}, nil
 			}
 		}
@@ -197,6 +211,8 @@ func (r *KThreesControlPlaneReconciler) reconcileUnhealthyMachines(ctx context.C
 				log.Info("A control plane machine needs remediation, but there is no healthy machine to forward etcd leadership to")
 				conditions.MarkFalse(machineToBeRemediated, clusterv1.MachineOwnerRemediatedCondition, clusterv1.RemediationFailedReason, clusterv1.ConditionSeverityWarning,
 					"A control plane machine needs remediation, but there is no healthy machine to forward etcd leadership to. Skipping remediation")
+				r.markRemediationBlocked(controlPlane, machineToBeRemediated, controlplanev1.RemediationNoEtcdLeaderCandidateReason,
+					"there is no healthy machine to forward etcd leadership to")
 				return ctrl.Result{}, nil
 			}
 			if err := workloadCluster.ForwardEtcdLeadership(ctx, machineToBeRemediated, etcdLeaderCandidate); err != nil {
@@ -204,22 +220,32 @@ func (r *KThreesControlPlaneReconciler) reconcileUnhealthyMachines(ctx context.C
 				conditions.MarkFalse(machineToBeRemediated, clusterv1.MachineOwnerRemediatedCondition, clusterv1.RemediationFailedReason, clusterv1.ConditionSeverityError, err.Error())
 				return ctrl.Result{}, err
 			}
+			preTerminateHook = true
+		}
+	}
 
-			patchHelper, err := patch.NewHelper(machineToBeRemediated, r.Client)
-			if err != nil {
-				return ctrl.Result{}, errors.Wrapf(err, "failed to create patch helper for machine")
-			}
+	hooksPatchHelper, err := patch.NewHelper(machineToBeRemediated, r.Client)
+	if err != nil {
+		return ctrl.Result{}, errors.Wrapf(err, "failed to create patch helper for machine")
+	}
 
-			mAnnotations := machineToBeRemediated.GetAnnotations()
-			mAnnotations[clusterv1.PreTerminateDeleteHookAnnotationPrefix] = k3sHookName
-			machineToBeRemediated.SetAnnotations(mAnnotations)
+	mAnnotations := machineToBeRemediated.GetAnnotations()
+	if mAnnotations == nil {
+		mAnnotations = map[string]string{}
+	}
+	if preTerminateHook {
+		mAnnotations[clusterv1.PreTerminateDeleteHookAnnotationPrefix] = k3sHookName
+	}
+	setPreDrainDeleteHooks(controlPlane.KCP, mAnnotations)
+	machineToBeRemediated.SetAnnotations(mAnnotations)
 
-			if err := patchHelper.Patch(ctx, machineToBeRemediated); err != nil {
-				return ctrl.Result{}, errors.Wrapf(err, "failed patch machine for adding preTerminate hook")
-			}
-		}
+	if err := hooksPatchHelper.Patch(ctx, machineToBeRemediated); err != nil {
+		conditions.MarkFalse(machineToBeRemediated, clusterv1.MachineOwnerRemediatedCondition, clusterv1.RemediationFailedReason, clusterv1.ConditionSeverityError, err.Error())
+		return ctrl.Result{}, errors.Wrapf(err, "failed patch machine for adding delete hooks")
 	}
 
+	conditions.Delete(controlPlane.KCP, controlplanev1.RemediationBlockedCondition)
+
 	// Delete the machine
 	if err := r.Client.Delete(ctx, machineToBeRemediated); err != nil {
 		conditions.MarkFalse(machineToBeRemediated, clusterv1.MachineOwnerRemediatedCondition, clusterv1.RemediationFailedReason, clusterv1.ConditionSeverityError, err.Error())
@@ -325,6 +351,8 @@ func (r *KThreesControlPlaneReconciler) checkRetryLimits(log logr.Logger, machin
 	if lastRemediationTime.Add(retryPeriod).After(reconciliationTime) {
 		log.Info(fmt.Sprintf("A control plane machine needs remediation, but the operation already failed in the latest %s. Skipping remediation", retryPeriod))
 		conditions.MarkFalse(machineToBeRemediated, clusterv1.MachineOwnerRemediatedCondition, clusterv1.WaitingForRemediationReason, clusterv1.ConditionSeverityWarning, "KCP can't remediate this machine because the operation already failed in the latest %s (RetryPeriod)", retryPeriod)
+		r.markRemediationBlocked(controlPlane, machineToBeRemediated, controlplanev1.RemediationRetryPeriodNotExpiredReason,
+			"the operation already failed in the latest %s (RetryPeriod)", retryPeriod)
 		return remediationInProgressData, false, nil
 	}
 
@@ -334,6 +362,8 @@ func (r *KThreesControlPlaneReconciler) checkRetryLimits(log logr.Logger, machin
 		if remediationInProgressData.RetryCount >= maxRetry {
 			log.Info(fmt.Sprintf("A control plane machine needs remediation, but the operation already failed %d times (MaxRetry %d). Skipping remediation", remediationInProgressData.RetryCount, maxRetry))
 			conditions.MarkFalse(machineToBeRemediated, clusterv1.MachineOwnerRemediatedCondition, clusterv1.WaitingForRemediationReason, clusterv1.ConditionSeverityWarning, "KCP can't remediate this machine because the operation already failed %d times (MaxRetry)", maxRetry)
+			r.markRemediationBlocked(controlPlane, machineToBeRemediated, controlplanev1.RemediationMaxRetryReachedReason,
+				"the operation already failed %d times (MaxRetry)", maxRetry)
 			return remediationInProgressData, false, nil
 		}
 	}
@@ -344,6 +374,23 @@ func (r *KThreesControlPlaneReconciler) checkRetryLimits(log logr.Logger, machin
 	return remediationInProgressData, true, nil
 }
 
+// markRemediationBlocked sets the RemediationBlocked condition on the KThreesControlPlane explaining why the machine
+// can't be remediated, and emits an event when the blocking rule changes.
+func (r *KThreesControlPlaneReconciler) markRemediationBlocked(controlPlane *k3s.ControlPlane, machineToBeRemediated *clusterv1.Machine, reason string, messageFormat string, messageArgs ...interface{}) {
+	message := fmt.Sprintf("Machine %s can't be remediated: %s", machineToBeRemediated.Name, fmt.Sprintf(messageFormat, messageArgs...))
+
+	if c := conditions.Get(controlPlane.KCP, controlplanev1.RemediationBlockedCondition); c == nil || c.Reason != reason || c.Message != message {
+		r.recorder.Event(controlPlane.KCP, corev1.EventTypeWarning, "RemediationBlocked", message)
+	}
+
+	conditions.Set(controlPlane.KCP, &clusterv1.Condition{
+		Type:    controlplanev1.RemediationBlockedCondition,
+		Status:  corev1.ConditionTrue,
+		Reason:  reason,
+		Message: message,
+	})
+}
+
 // max calculates the maximum duration.
 func max(x, y time.Duration) time.Duration {
 	if x < y {
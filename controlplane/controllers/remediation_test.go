@@ -0,0 +1,209 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	controlplanev1 "github.com/k3s-io/cluster-api-k3s/controlplane/api/v1beta2"
+	k3s "github.com/k3s-io/cluster-api-k3s/pkg/k3s"
+)
+
+func TestReconcileUnhealthyMachinesSetsPreDrainDeleteHooks(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.TODO()
+
+	cluster := newTestCluster()
+	kcp := newTestKCP(cluster)
+	kcp.Spec.MachineTemplate.PreDrainDeleteHooks = []string{"lb-deregistration"}
+	objs := []client.Object{cluster, kcp}
+	for _, name := range []string{"healthy", "unhealthy"} {
+		machine, config := newTestMachine(cluster, kcp, name, false)
+		machine.Finalizers = []string{clusterv1.MachineFinalizer}
+		machine.Status.NodeRef = &corev1.ObjectReference{Kind: "Node", Name: name}
+		if name == "unhealthy" {
+			conditions.MarkFalse(machine, clusterv1.MachineHealthCheckSucceededCondition, clusterv1.MachineHasFailureReason, clusterv1.ConditionSeverityWarning, "")
+			conditions.MarkFalse(machine, clusterv1.MachineOwnerRemediatedCondition, clusterv1.WaitingForRemediationReason, clusterv1.ConditionSeverityWarning, "")
+		}
+		objs = append(objs, machine, config)
+	}
+	c := newFakeClient(objs...)
+	r := newTestReconciler(c, nil)
+
+	machines, err := r.managementCluster.GetMachinesForCluster(ctx, client.ObjectKeyFromObject(cluster))
+	g.Expect(err).ToNot(HaveOccurred())
+	controlPlane, err := k3s.NewControlPlane(ctx, c, cluster, kcp, machines)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	result, err := r.reconcileUnhealthyMachines(ctx, controlPlane)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result).To(Equal(ctrl.Result{Requeue: true}))
+	g.Expect(kcp.Annotations).To(HaveKey(controlplanev1.RemediationInProgressAnnotation))
+	g.Expect(conditions.Has(kcp, controlplanev1.RemediationBlockedCondition)).To(BeFalse())
+
+	// the hooks are set on the remediated machine before it is deleted.
+	remediated := &clusterv1.Machine{}
+	g.Expect(c.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: "unhealthy"}, remediated)).To(Succeed())
+	g.Expect(remediated.DeletionTimestamp.IsZero()).To(BeFalse())
+	g.Expect(remediated.Annotations).To(HaveKeyWithValue(clusterv1.PreDrainDeleteHookAnnotationPrefix+"/lb-deregistration", ""))
+
+	healthy := &clusterv1.Machine{}
+	g.Expect(c.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: "healthy"}, healthy)).To(Succeed())
+	g.Expect(healthy.Annotations).To(BeEmpty())
+}
+
+func TestReconcileUnhealthyMachinesRemediationBlocked(t *testing.T) {
+	cluster := newTestCluster()
+
+	tests := []struct {
+		name          string
+		machines      []string
+		mutate        func(kcp *controlplanev1.KThreesControlPlane, machines map[string]*clusterv1.Machine)
+		retryCount    *int
+		expectReason  string
+		expectMessage string
+	}{
+		{
+			name:     "previous remediation in progress",
+			machines: []string{"healthy", "unhealthy"},
+			mutate: func(kcp *controlplanev1.KThreesControlPlane, _ map[string]*clusterv1.Machine) {
+				kcp.Annotations = map[string]string{controlplanev1.RemediationInProgressAnnotation: "{}"}
+			},
+			expectReason:  controlplanev1.RemediationPreviousInProgressReason,
+			expectMessage: "Machine unhealthy can't be remediated: waiting for the machine replacing the previously remediated one to be created",
+		},
+		{
+			name:     "retry period not expired",
+			machines: []string{"healthy", "unhealthy"},
+			mutate: func(kcp *controlplanev1.KThreesControlPlane, _ map[string]*clusterv1.Machine) {
+				kcp.Spec.RemediationStrategy = &controlplanev1.RemediationStrategy{RetryPeriod: metav1.Duration{Duration: time.Hour}}
+			},
+			retryCount:    ptr.To(0),
+			expectReason:  controlplanev1.RemediationRetryPeriodNotExpiredReason,
+			expectMessage: "Machine unhealthy can't be remediated: the operation already failed in the latest 1h0m0s (RetryPeriod)",
+		},
+		{
+			name:     "max retry reached",
+			machines: []string{"healthy", "unhealthy"},
+			mutate: func(kcp *controlplanev1.KThreesControlPlane, _ map[string]*clusterv1.Machine) {
+				kcp.Spec.RemediationStrategy = &controlplanev1.RemediationStrategy{MaxRetry: ptr.To[int32](1)}
+			},
+			retryCount:    ptr.To(1),
+			expectReason:  controlplanev1.RemediationMaxRetryReachedReason,
+			expectMessage: "Machine unhealthy can't be remediated: the operation already failed 1 times (MaxRetry)",
+		},
+		{
+			name:          "not enough replicas",
+			machines:      []string{"unhealthy"},
+			expectReason:  controlplanev1.RemediationNotEnoughReplicasReason,
+			expectMessage: "Machine unhealthy can't be remediated: the number of current replicas is less or equal to 1",
+		},
+		{
+			name:     "other machines provisioning",
+			machines: []string{"healthy", "unhealthy"},
+			mutate: func(_ *controlplanev1.KThreesControlPlane, machines map[string]*clusterv1.Machine) {
+				machines["healthy"].Status.NodeRef = nil
+			},
+			expectReason:  controlplanev1.RemediationMachinesProvisioningReason,
+			expectMessage: "Machine unhealthy can't be remediated: waiting for other control plane machines to complete provisioning",
+		},
+		{
+			name:     "other machines deleting",
+			machines: []string{"healthy", "unhealthy"},
+			mutate: func(_ *controlplanev1.KThreesControlPlane, machines map[string]*clusterv1.Machine) {
+				machines["healthy"].DeletionTimestamp = ptr.To(metav1.Now())
+			},
+			expectReason:  controlplanev1.RemediationMachinesDeletingReason,
+			expectMessage: "Machine unhealthy can't be remediated: waiting for other control plane machines to complete deletion",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.TODO()
+
+			kcp := newTestKCP(cluster)
+			machines := map[string]*clusterv1.Machine{}
+			objs := []client.Object{cluster, kcp}
+			for _, name := range tt.machines {
+				machine, config := newTestMachine(cluster, kcp, name, false)
+				machine.Finalizers = []string{clusterv1.MachineFinalizer}
+				machine.Status.NodeRef = &corev1.ObjectReference{Kind: "Node", Name: name}
+				if name == "unhealthy" {
+					conditions.MarkFalse(machine, clusterv1.MachineHealthCheckSucceededCondition, clusterv1.MachineHasFailureReason, clusterv1.ConditionSeverityWarning, "")
+					conditions.MarkFalse(machine, clusterv1.MachineOwnerRemediatedCondition, clusterv1.WaitingForRemediationReason, clusterv1.ConditionSeverityWarning, "")
+				}
+				machines[name] = machine
+				objs = append(objs, machine, config)
+			}
+			if tt.retryCount != nil {
+				// the unhealthy machine replaces a machine remediated a minute ago.
+				data, err := (&RemediationData{
+					Machine:    "previous",
+					Timestamp:  metav1.Time{Time: time.Now().UTC().Add(-time.Minute)},
+					RetryCount: *tt.retryCount,
+				}).Marshal()
+				g.Expect(err).ToNot(HaveOccurred())
+				machines["unhealthy"].Annotations = map[string]string{controlplanev1.RemediationForAnnotation: data}
+			}
+			if tt.mutate != nil {
+				tt.mutate(kcp, machines)
+			}
+			c := newFakeClient(objs...)
+			r := newTestReconciler(c, nil)
+			recorder := r.recorder.(*record.FakeRecorder)
+
+			machineCollection, err := r.managementCluster.GetMachinesForCluster(ctx, client.ObjectKeyFromObject(cluster))
+			g.Expect(err).ToNot(HaveOccurred())
+			controlPlane, err := k3s.NewControlPlane(ctx, c, cluster, kcp, machineCollection)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			result, err := r.reconcileUnhealthyMachines(ctx, controlPlane)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result).To(BeZero())
+
+			condition := conditions.Get(kcp, controlplanev1.RemediationBlockedCondition)
+			g.Expect(condition).ToNot(BeNil())
+			g.Expect(condition.Status).To(Equal(corev1.ConditionTrue))
+			g.Expect(condition.Reason).To(Equal(tt.expectReason))
+			g.Expect(condition.Message).To(Equal(tt.expectMessage))
+			g.Expect(recorder.Events).To(Receive(Equal("Warning RemediationBlocked " + tt.expectMessage)))
+
+			// the event is emitted only when the blocking rule changes.
+			_, err = r.reconcileUnhealthyMachines(ctx, controlPlane)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(recorder.Events).ToNot(Receive())
+
+			unhealthy := &clusterv1.Machine{}
+			g.Expect(c.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: "unhealthy"}, unhealthy)).To(Succeed())
+			g.Expect(unhealthy.DeletionTimestamp.IsZero()).To(BeTrue())
+		})
+	}
+}
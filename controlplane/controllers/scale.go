@@ -30,6 +30,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	kerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apiserver/pkg/storage/names"
+	"k8s.io/utils/ptr"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/controllers/external"
 	"sigs.k8s.io/cluster-api/util"
@@ -66,7 +67,15 @@ func (r *KThreesControlPlaneReconciler) initializeControlPlane(ctx context.Conte
 
 	bootstrapSpec := controlPlane.InitialControlPlaneConfig()
 	fd := controlPlane.NextFailureDomainForScaleUp(ctx)
-	if err := r.cloneConfigsAndGenerateMachine(ctx, cluster, kcp, bootstrapSpec, fd); err != nil {
+	if pinned := kcp.Spec.ClusterInitFailureDomain; pinned != nil {
+		if _, ok := controlPlane.FailureDomains().FilterControlPlane()[*pinned]; !ok {
+			err := fmt.Errorf("cluster init failure domain %q is not a control plane failure domain of cluster %s/%s", *pinned, cluster.Namespace, cluster.Name)
+			r.recorder.Eventf(kcp, corev1.EventTypeWarning, "FailedInitialization", "Failed to create initial control plane Machine for cluster %s/%s control plane: %v", cluster.Namespace, cluster.Name, err)
+			return ctrl.Result{}, err
+		}
+		fd = pinned
+	}
+	if err := r.cloneConfigsAndGenerateMachine(ctx, cluster, kcp, bootstrapSpec, fd, false); err != nil {
 		logger.Error(err, "Failed to create initial control plane Machine")
 		r.recorder.Eventf(kcp, corev1.EventTypeWarning, "FailedInitialization", "Failed to create initial control plane Machine for cluster %s/%s control plane: %v", cluster.Namespace, cluster.Name, err)
 		return ctrl.Result{}, err
@@ -84,15 +93,26 @@ func (r *KThreesControlPlaneReconciler) scaleUpControlPlane(ctx context.Context,
 		return result, err
 	}
 
-	// Create the bootstrap configuration
-	bootstrapSpec := controlPlane.JoinControlPlaneConfig()
-	fd := controlPlane.NextFailureDomainForScaleUp(ctx)
-	if err := r.cloneConfigsAndGenerateMachine(ctx, cluster, kcp, bootstrapSpec, fd); err != nil {
-		logger.Error(err, "Failed to create additional control plane Machine")
-		r.recorder.Eventf(kcp, corev1.EventTypeWarning, "FailedScaleUp", "Failed to create additional control plane Machine for cluster %s/%s control plane: %v", cluster.Namespace, cluster.Name, err)
+	// Promote a spare machine if one is available, since it joins faster than a new machine.
+	promoted, err := r.promoteSpareMachine(ctx, cluster, kcp, controlPlane)
+	if err != nil {
 		return ctrl.Result{}, err
 	}
 
+	if !promoted {
+		// Create the bootstrap configuration
+		bootstrapSpec := controlPlane.JoinControlPlaneConfig()
+		fd := controlPlane.NextFailureDomainForScaleUp(ctx)
+		if err := r.cloneConfigsAndGenerateMachine(ctx, cluster, kcp, bootstrapSpec, fd, false); err != nil {
+			logger.Error(err, "Failed to create additional control plane Machine")
+			r.recorder.Eventf(kcp, corev1.EventTypeWarning, "FailedScaleUp", "Failed to create additional control plane Machine for cluster %s/%s control plane: %v", cluster.Namespace, cluster.Name, err)
+			return ctrl.Result{}, err
+		}
+	}
+
+	// The rollout step approval, if any, was used up by the replacement machine.
+	delete(kcp.Annotations, controlplanev1.ApproveRolloutStepAnnotation)
+
 	// Requeue the control plane, in case there are other operations to perform
 	return ctrl.Result{Requeue: true}, nil
 }
@@ -136,19 +156,25 @@ func (r *KThreesControlPlaneReconciler) scaleDownControlPlane(
 			logger.Error(err, "Failed to move leadership to candidate machine", "candidate", etcdLeaderCandidate.Name)
 			return ctrl.Result{}, err
 		}
+	}
 
-		patchHelper, err := patch.NewHelper(machineToDelete, r.Client)
-		if err != nil {
-			return ctrl.Result{}, errors.Wrapf(err, "failed to create patch helper for machine")
-		}
+	patchHelper, err := patch.NewHelper(machineToDelete, r.Client)
+	if err != nil {
+		return ctrl.Result{}, errors.Wrapf(err, "failed to create patch helper for machine")
+	}
 
-		mAnnotations := machineToDelete.GetAnnotations()
+	mAnnotations := machineToDelete.GetAnnotations()
+	if mAnnotations == nil {
+		mAnnotations = map[string]string{}
+	}
+	if controlPlane.IsEtcdManaged() {
 		mAnnotations[clusterv1.PreTerminateDeleteHookAnnotationPrefix] = k3sHookName
-		machineToDelete.SetAnnotations(mAnnotations)
+	}
+	setPreDrainDeleteHooks(kcp, mAnnotations)
+	machineToDelete.SetAnnotations(mAnnotations)
 
-		if err := patchHelper.Patch(ctx, machineToDelete); err != nil {
-			return ctrl.Result{}, errors.Wrapf(err, "failed patch machine for adding preTerminate hook")
-		}
+	if err := patchHelper.Patch(ctx, machineToDelete); err != nil {
+		return ctrl.Result{}, errors.Wrapf(err, "failed patch machine for adding delete hooks")
 	}
 
 	logger = logger.WithValues("machine", machineToDelete)
@@ -163,6 +189,15 @@ func (r *KThreesControlPlaneReconciler) scaleDownControlPlane(
 	return ctrl.Result{Requeue: true}, nil
 }
 
+// setPreDrainDeleteHooks adds the spec.machineTemplate.preDrainDeleteHooks to the annotations of a machine about to be
+// deleted, so that its node is only drained once the external controllers owning the hooks removed them. The hooks
+// are set without a value, as they are owned by these controllers and not by the KThreesControlPlane.
+func setPreDrainDeleteHooks(kcp *controlplanev1.KThreesControlPlane, annotations map[string]string) {
+	for _, hook := range kcp.Spec.MachineTemplate.PreDrainDeleteHooks {
+		annotations[clusterv1.PreDrainDeleteHookAnnotationPrefix+"/"+hook] = ""
+	}
+}
+
 // preflightChecks checks if the control plane is stable before proceeding with a scale up/scale down operation,
 // where stable means that:
 // - There are no machine deletion in progress
@@ -187,6 +222,32 @@ func (r *KThreesControlPlaneReconciler) preflightChecks(_ context.Context, contr
 	}
 
 	// Check machine health conditions; if there are conditions with False or Unknown, then wait.
+	machineErrors := []error{}
+	for _, failure := range preflightCheckFailures(controlPlane, excludeFor...) {
+		machineErrors = append(machineErrors, failure.err)
+	}
+
+	if len(machineErrors) > 0 {
+		aggregatedError := kerrors.NewAggregate(machineErrors)
+		r.recorder.Eventf(controlPlane.KCP, corev1.EventTypeWarning, "ControlPlaneUnhealthy",
+			"Waiting for control plane to pass preflight checks to continue reconciliation: %v", aggregatedError)
+		logger.Info("Waiting for control plane to pass preflight checks", "failures", aggregatedError.Error())
+
+		return ctrl.Result{RequeueAfter: r.PreflightPollInterval}, nil
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// preflightCheckFailure is a health condition of a control plane machine failing the preflight checks.
+type preflightCheckFailure struct {
+	condition clusterv1.ConditionType
+	err       error
+}
+
+// preflightCheckFailures returns the health conditions failing the preflight checks on the control plane machines,
+// except the excludeFor ones.
+func preflightCheckFailures(controlPlane *k3s.ControlPlane, excludeFor ...*clusterv1.Machine) []preflightCheckFailure {
 	allMachineHealthConditions := []clusterv1.ConditionType{controlplanev1.MachineAgentHealthyCondition}
 	if controlPlane.IsEtcdManaged() {
 		allMachineHealthConditions = append(allMachineHealthConditions,
@@ -194,7 +255,7 @@ func (r *KThreesControlPlaneReconciler) preflightChecks(_ context.Context, contr
 		)
 	}
 
-	machineErrors := []error{}
+	failures := []preflightCheckFailure{}
 
 loopmachines:
 	for _, machine := range controlPlane.Machines {
@@ -208,21 +269,11 @@ loopmachines:
 
 		for _, condition := range allMachineHealthConditions {
 			if err := preflightCheckCondition("machine", machine, condition); err != nil {
-				machineErrors = append(machineErrors, err)
+				failures = append(failures, preflightCheckFailure{condition: condition, err: err})
 			}
 		}
 	}
-
-	if len(machineErrors) > 0 {
-		aggregatedError := kerrors.NewAggregate(machineErrors)
-		r.recorder.Eventf(controlPlane.KCP, corev1.EventTypeWarning, "ControlPlaneUnhealthy",
-			"Waiting for control plane to pass preflight checks to continue reconciliation: %v", aggregatedError)
-		logger.Info("Waiting for control plane to pass preflight checks", "failures", aggregatedError.Error())
-
-		return ctrl.Result{RequeueAfter: preflightFailedRequeueAfter}, nil
-	}
-
-	return ctrl.Result{}, nil
+	return failures
 }
 
 func preflightCheckCondition(kind string, obj conditions.Getter, condition clusterv1.ConditionType) error {
@@ -253,7 +304,7 @@ func selectMachineForScaleDown(ctx context.Context, controlPlane *k3s.ControlPla
 	return controlPlane.MachineInFailureDomainWithMostMachines(ctx, machines)
 }
 
-func (r *KThreesControlPlaneReconciler) cloneConfigsAndGenerateMachine(ctx context.Context, cluster *clusterv1.Cluster, kcp *controlplanev1.KThreesControlPlane, bootstrapSpec *bootstrapv1.KThreesConfigSpec, failureDomain *string) error {
+func (r *KThreesControlPlaneReconciler) cloneConfigsAndGenerateMachine(ctx context.Context, cluster *clusterv1.Cluster, kcp *controlplanev1.KThreesControlPlane, bootstrapSpec *bootstrapv1.KThreesConfigSpec, failureDomain *string, spare bool) error {
 	var errs []error
 
 	// Compute desired Machine
@@ -262,6 +313,12 @@ func (r *KThreesControlPlaneReconciler) cloneConfigsAndGenerateMachine(ctx conte
 		return errors.Wrap(err, "failed to create Machine: failed to compute desired Machine")
 	}
 
+	labels := k3s.ControlPlaneLabelsForCluster(cluster.Name, kcp.Spec.MachineTemplate)
+	if spare {
+		labels = k3s.SpareLabelsForCluster(cluster.Name, kcp.Spec.MachineTemplate)
+		machine.SetLabels(labels)
+	}
+
 	// Since the cloned resource should eventually have a controller ref for the Machine, we create an
 	// OwnerReference here without the Controller field set
 	infraCloneOwner := &metav1.OwnerReference{
@@ -278,7 +335,7 @@ func (r *KThreesControlPlaneReconciler) cloneConfigsAndGenerateMachine(ctx conte
 		Namespace:   kcp.Namespace,
 		OwnerRef:    infraCloneOwner,
 		ClusterName: cluster.Name,
-		Labels:      k3s.ControlPlaneLabelsForCluster(cluster.Name, kcp.Spec.MachineTemplate),
+		Labels:      labels,
 	})
 	if err != nil {
 		// Safe to return early here since no resources have been created yet.
@@ -287,7 +344,7 @@ func (r *KThreesControlPlaneReconciler) cloneConfigsAndGenerateMachine(ctx conte
 	machine.Spec.InfrastructureRef = *infraRef
 
 	// Clone the bootstrap configuration
-	bootstrapRef, err := r.generateKThreesConfig(ctx, kcp, cluster, bootstrapSpec)
+	bootstrapRef, err := r.generateKThreesConfig(ctx, kcp, bootstrapSpec, labels)
 	if err != nil {
 		errs = append(errs, fmt.Errorf("failed to generate bootstrap config: %w", err))
 	}
@@ -332,7 +389,7 @@ func (r *KThreesControlPlaneReconciler) cleanupFromGeneration(ctx context.Contex
 	return kerrors.NewAggregate(errs)
 }
 
-func (r *KThreesControlPlaneReconciler) generateKThreesConfig(ctx context.Context, kcp *controlplanev1.KThreesControlPlane, cluster *clusterv1.Cluster, spec *bootstrapv1.KThreesConfigSpec) (*corev1.ObjectReference, error) {
+func (r *KThreesControlPlaneReconciler) generateKThreesConfig(ctx context.Context, kcp *controlplanev1.KThreesControlPlane, spec *bootstrapv1.KThreesConfigSpec, labels map[string]string) (*corev1.ObjectReference, error) {
 	// Create an owner reference without a controller reference because the owning controller is the machine controller
 	owner := metav1.OwnerReference{
 		APIVersion: controlplanev1.GroupVersion.String(),
@@ -345,7 +402,7 @@ func (r *KThreesControlPlaneReconciler) generateKThreesConfig(ctx context.Contex
 		ObjectMeta: metav1.ObjectMeta{
 			Name:            names.SimpleNameGenerator.GenerateName(kcp.Name + "-"),
 			Namespace:       kcp.Namespace,
-			Labels:          k3s.ControlPlaneLabelsForCluster(cluster.Name, kcp.Spec.MachineTemplate),
+			Labels:          labels,
 			OwnerReferences: []metav1.OwnerReference{owner},
 		},
 		Spec: *spec,
@@ -367,7 +424,7 @@ func (r *KThreesControlPlaneReconciler) generateKThreesConfig(ctx context.Contex
 }
 
 // updateExternalObject updates the external object with the labels and annotations from KCP.
-func (r *KThreesControlPlaneReconciler) updateExternalObject(ctx context.Context, obj client.Object, kcp *controlplanev1.KThreesControlPlane, cluster *clusterv1.Cluster) error {
+func (r *KThreesControlPlaneReconciler) updateExternalObject(ctx context.Context, obj client.Object, kcp *controlplanev1.KThreesControlPlane, labels map[string]string) error {
 	updatedObject := &unstructured.Unstructured{}
 	updatedObject.SetGroupVersionKind(obj.GetObjectKind().GroupVersionKind())
 	updatedObject.SetNamespace(obj.GetNamespace())
@@ -377,7 +434,7 @@ func (r *KThreesControlPlaneReconciler) updateExternalObject(ctx context.Context
 	updatedObject.SetUID(obj.GetUID())
 
 	// Update labels
-	updatedObject.SetLabels(k3s.ControlPlaneLabelsForCluster(cluster.Name, kcp.Spec.MachineTemplate))
+	updatedObject.SetLabels(labels)
 	// Update annotations
 	updatedObject.SetAnnotations(kcp.Spec.MachineTemplate.ObjectMeta.Annotations)
 
@@ -427,7 +484,7 @@ func (r *KThreesControlPlaneReconciler) computeDesiredMachine(kcp *controlplanev
 	if existingMachine == nil {
 		// Creating a new machine
 		machineName = names.SimpleNameGenerator.GenerateName(kcp.Name + "-")
-		version = &kcp.Spec.Version
+		version = ptr.To(kcp.K3sVersion())
 
 		// Machine's bootstrap config may be missing ClusterConfiguration if it is not the first machine in the control plane.
 		// We store ClusterConfiguration as annotation here to detect any changes in KCP ClusterConfiguration and rollout the machine if any.
@@ -437,6 +494,11 @@ func (r *KThreesControlPlaneReconciler) computeDesiredMachine(kcp *controlplanev
 		}
 		annotations[controlplanev1.KThreesServerConfigurationAnnotation] = string(serverConfig)
 
+		// Store the control plane endpoint the machine is bootstrapped with, to roll it out if the endpoint changes.
+		if !cluster.Spec.ControlPlaneEndpoint.IsZero() {
+			annotations[controlplanev1.ControlPlaneEndpointAnnotation] = k3s.EndpointString(cluster.Spec.ControlPlaneEndpoint)
+		}
+
 		// In case this machine is being created as a consequence of a remediation, then add an annotation
 		// tracking remediating data.
 		// NOTE: This is required in order to track remediation retries.
@@ -456,6 +518,10 @@ func (r *KThreesControlPlaneReconciler) computeDesiredMachine(kcp *controlplanev
 			annotations[controlplanev1.KThreesServerConfigurationAnnotation] = serverConfig
 		}
 
+		if endpoint, ok := existingMachine.Annotations[controlplanev1.ControlPlaneEndpointAnnotation]; ok {
+			annotations[controlplanev1.ControlPlaneEndpointAnnotation] = endpoint
+		}
+
 		// If the machine already has remediation data then preserve it.
 		// NOTE: This is required in order to track remediation retries.
 		if remediationData, ok := existingMachine.Annotations[controlplanev1.RemediationForAnnotation]; ok {
@@ -469,7 +535,7 @@ func (r *KThreesControlPlaneReconciler) computeDesiredMachine(kcp *controlplanev
 			Name:      machineName,
 			Namespace: kcp.Namespace,
 			UID:       machineUID,
-			Labels:    k3s.ControlPlaneLabelsForCluster(cluster.Name, kcp.Spec.MachineTemplate),
+			Labels:    machineLabels(cluster, kcp, existingMachine),
 			OwnerReferences: []metav1.OwnerReference{
 				*metav1.NewControllerRef(kcp, controlplanev1.GroupVersion.WithKind("KThreesControlPlane")),
 			},
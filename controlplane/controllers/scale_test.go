@@ -0,0 +1,149 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/collections"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	controlplanev1 "github.com/k3s-io/cluster-api-k3s/controlplane/api/v1beta2"
+	k3s "github.com/k3s-io/cluster-api-k3s/pkg/k3s"
+)
+
+func TestScaleUpControlPlaneUsesRolloutStepApproval(t *testing.T) {
+	cluster := newTestCluster()
+
+	newMachine := func(kcp *controlplanev1.KThreesControlPlane, name string, spare bool) []client.Object {
+		machine, config := newTestMachine(cluster, kcp, name, spare)
+		machine.Status.NodeRef = &corev1.ObjectReference{Kind: "Node", Name: name}
+		conditions.MarkTrue(machine, controlplanev1.MachineAgentHealthyCondition)
+		conditions.MarkTrue(machine, controlplanev1.MachineEtcdMemberHealthyCondition)
+		return []client.Object{machine, config}
+	}
+
+	tests := []struct {
+		name          string
+		spare         bool
+		expectPromote bool
+	}{
+		{
+			name: "the replacement machine is created",
+		},
+		{
+			name:          "the replacement machine is a promoted spare",
+			spare:         true,
+			expectPromote: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.TODO()
+
+			kcp := newTestKCP(cluster)
+			kcp.Spec.Replicas = ptr.To[int32](2)
+			kcp.Spec.RolloutStrategy = &controlplanev1.RolloutStrategy{ApprovalMode: controlplanev1.RolloutApprovalModeManual}
+			kcp.Annotations = map[string]string{controlplanev1.ApproveRolloutStepAnnotation: ""}
+			outdatedKCP := kcp.DeepCopy()
+			outdatedKCP.Spec.Version = "v1.29.8+k3s1"
+			objs := append(newMachine(outdatedKCP, "outdated", false), newMachine(kcp, "up-to-date", false)...)
+			if tt.spare {
+				kcp.Spec.SpareReplicas = ptr.To[int32](1)
+				objs = append(objs, newMachine(kcp, "spare", true)...)
+			}
+			c := newFakeClient(append(objs, cluster, kcp, newTestInfraMachineTemplate(cluster.Namespace))...)
+			r := newTestReconciler(c, nil)
+
+			machines, err := r.managementCluster.GetMachinesForCluster(ctx, client.ObjectKeyFromObject(cluster), collections.OwnedMachines(kcp), collections.Not(isSpareMachine))
+			g.Expect(err).ToNot(HaveOccurred())
+			controlPlane, err := k3s.NewControlPlane(ctx, c, cluster, kcp, machines)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(isRolloutStepApproved(kcp, controlPlane)).To(BeTrue())
+
+			result, err := r.scaleUpControlPlane(ctx, cluster, kcp, controlPlane)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result).To(Equal(ctrl.Result{Requeue: true}))
+
+			after, err := r.managementCluster.GetMachinesForCluster(ctx, client.ObjectKeyFromObject(cluster), collections.OwnedMachines(kcp), collections.Not(isSpareMachine))
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(after.Len()).To(Equal(machines.Len() + 1))
+			if tt.expectPromote {
+				g.Expect(after.Names()).To(ContainElement("spare"))
+			}
+
+			// the approval is used up by the replacement machine, the next one has to be approved again.
+			g.Expect(kcp.Annotations).ToNot(HaveKey(controlplanev1.ApproveRolloutStepAnnotation))
+			controlPlane, err = k3s.NewControlPlane(ctx, c, cluster, kcp, after)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(isRolloutStepApproved(kcp, controlPlane)).To(BeFalse())
+		})
+	}
+}
+
+func TestScaleDownControlPlaneSetsPreDrainDeleteHooks(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.TODO()
+
+	cluster := newTestCluster()
+	kcp := newTestKCP(cluster)
+	kcp.Spec.MachineTemplate.PreDrainDeleteHooks = []string{"lb-deregistration", "ingress-drain"}
+	objs := []client.Object{cluster, kcp}
+	for i, name := range []string{"cp-0", "cp-1"} {
+		machine, config := newTestMachine(cluster, kcp, name, false)
+		machine.CreationTimestamp = metav1.NewTime(time.Now().Add(time.Duration(i-2) * time.Hour))
+		machine.Finalizers = []string{clusterv1.MachineFinalizer}
+		machine.Status.NodeRef = &corev1.ObjectReference{Kind: "Node", Name: name}
+		conditions.MarkTrue(machine, controlplanev1.MachineAgentHealthyCondition)
+		conditions.MarkTrue(machine, controlplanev1.MachineEtcdMemberHealthyCondition)
+		objs = append(objs, machine, config)
+	}
+	c := newFakeClient(objs...)
+	r := newTestReconciler(c, nil)
+
+	machines, err := r.managementCluster.GetMachinesForCluster(ctx, client.ObjectKeyFromObject(cluster))
+	g.Expect(err).ToNot(HaveOccurred())
+	controlPlane, err := k3s.NewControlPlane(ctx, c, cluster, kcp, machines)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	result, err := r.scaleDownControlPlane(ctx, cluster, kcp, controlPlane, machines)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result).To(Equal(ctrl.Result{Requeue: true}))
+
+	// the hooks are set on the deleted machine, without a value as they are owned by external controllers.
+	deleted := &clusterv1.Machine{}
+	g.Expect(c.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: "cp-0"}, deleted)).To(Succeed())
+	g.Expect(deleted.DeletionTimestamp.IsZero()).To(BeFalse())
+	g.Expect(deleted.Annotations).To(HaveKeyWithValue(clusterv1.PreDrainDeleteHookAnnotationPrefix+"/lb-deregistration", ""))
+	g.Expect(deleted.Annotations).To(HaveKeyWithValue(clusterv1.PreDrainDeleteHookAnnotationPrefix+"/ingress-drain", ""))
+	g.Expect(deleted.Annotations).ToNot(HaveKey(clusterv1.PreTerminateDeleteHookAnnotationPrefix))
+
+	kept := &clusterv1.Machine{}
+	g.Expect(c.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: "cp-1"}, kept)).To(Succeed())
+	g.Expect(kept.Annotations).To(BeEmpty())
+}
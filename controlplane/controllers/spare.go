@@ -0,0 +1,225 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/collections"
+	"sigs.k8s.io/cluster-api/util/patch"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	bootstrapv1 "github.com/k3s-io/cluster-api-k3s/bootstrap/api/v1beta2"
+	controlplanev1 "github.com/k3s-io/cluster-api-k3s/controlplane/api/v1beta2"
+	k3s "github.com/k3s-io/cluster-api-k3s/pkg/k3s"
+)
+
+// isSpareMachine returns true if the machine is a spare control plane machine that was not promoted yet.
+func isSpareMachine(machine *clusterv1.Machine) bool {
+	_, ok := machine.Labels[bootstrapv1.SpareControlPlaneLabel]
+	return ok
+}
+
+// machineLabels returns the labels managed by the KThreesControlPlane on the machine and on its infrastructure and
+// bootstrap objects, which keep the spare labels until the machine is promoted.
+func machineLabels(cluster *clusterv1.Cluster, kcp *controlplanev1.KThreesControlPlane, machine *clusterv1.Machine) map[string]string {
+	if machine != nil && isSpareMachine(machine) {
+		return k3s.SpareLabelsForCluster(cluster.Name, kcp.Spec.MachineTemplate)
+	}
+	return k3s.ControlPlaneLabelsForCluster(cluster.Name, kcp.Spec.MachineTemplate)
+}
+
+// getSpareControlPlane returns a ControlPlane made of the spare machines of the KThreesControlPlane, so that
+// the rollout helpers can be used to find the spares that are outdated.
+func (r *KThreesControlPlaneReconciler) getSpareControlPlane(ctx context.Context, cluster *clusterv1.Cluster, kcp *controlplanev1.KThreesControlPlane) (*k3s.ControlPlane, error) {
+	spareMachines, err := r.managementClusterUncached.GetMachinesForCluster(ctx, util.ObjectKey(cluster), collections.OwnedMachines(kcp), isSpareMachine)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to retrieve spare machines for cluster")
+	}
+
+	return k3s.NewControlPlane(ctx, r.Client, cluster, kcp, spareMachines)
+}
+
+// reconcileSpareMachines keeps spec.spareReplicas up-to-date spare machines around, creating them one at a time.
+// Spares are only managed once the control plane is initialized and stable, so that they do not compete with
+// the control plane machines.
+func (r *KThreesControlPlaneReconciler) reconcileSpareMachines(ctx context.Context, cluster *clusterv1.Cluster, kcp *controlplanev1.KThreesControlPlane) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	if !kcp.Status.Initialized {
+		return ctrl.Result{}, nil
+	}
+
+	spares, err := r.getSpareControlPlane(ctx, cluster, kcp)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Propagate in-place mutable fields to the spares as well, they are not part of the control plane machines.
+	if err := r.syncMachines(ctx, spares); err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "failed to sync spare Machines")
+	}
+
+	// Wait for deleting spares to go away before creating replacements.
+	if spares.HasDeletingMachine() {
+		return ctrl.Result{RequeueAfter: deleteRequeueAfter}, nil
+	}
+
+	var desiredSpares int
+	if kcp.Spec.SpareReplicas != nil {
+		desiredSpares = int(*kcp.Spec.SpareReplicas)
+	}
+
+	// Delete the outdated spares first, then the newest ones above the desired number.
+	machinesToDelete := spares.MachinesNeedingRollout()
+	if upToDate := spares.Machines.Difference(machinesToDelete); upToDate.Len() > desiredSpares {
+		sorted := upToDate.SortedByCreationTimestamp()
+		machinesToDelete.Insert(sorted[desiredSpares:]...)
+	}
+	if machinesToDelete.Len() > 0 {
+		for _, m := range machinesToDelete {
+			if err := r.Client.Delete(ctx, m); err != nil && !apierrors.IsNotFound(err) {
+				r.recorder.Eventf(kcp, corev1.EventTypeWarning, "FailedDeleteSpare",
+					"Failed to delete spare control plane Machine %s for cluster %s/%s control plane: %v", m.Name, cluster.Namespace, cluster.Name, err)
+				return ctrl.Result{}, errors.Wrapf(err, "failed to delete spare Machine %s", m.Name)
+			}
+		}
+		log.Info("Deleted spare machines", "machines", machinesToDelete.Names())
+		return ctrl.Result{RequeueAfter: deleteRequeueAfter}, nil
+	}
+
+	if spares.Machines.Len() >= desiredSpares {
+		return ctrl.Result{}, nil
+	}
+
+	log.Info("Creating spare control plane machine", "Desired", desiredSpares, "Existing", spares.Machines.Len())
+	bootstrapSpec := spares.JoinControlPlaneConfig()
+	fd := spares.NextFailureDomainForScaleUp(ctx)
+	if err := r.cloneConfigsAndGenerateMachine(ctx, cluster, kcp, bootstrapSpec, fd, true); err != nil {
+		r.recorder.Eventf(kcp, corev1.EventTypeWarning, "FailedCreateSpare", "Failed to create spare control plane Machine for cluster %s/%s control plane: %v", cluster.Namespace, cluster.Name, err)
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{Requeue: true}, nil
+}
+
+// promoteSpareMachine turns an up-to-date spare machine, whose node already joined the cluster, into a control
+// plane machine. It returns false if there is no spare that can be promoted, so that a new machine is created instead.
+func (r *KThreesControlPlaneReconciler) promoteSpareMachine(ctx context.Context, cluster *clusterv1.Cluster, kcp *controlplanev1.KThreesControlPlane, controlPlane *k3s.ControlPlane) (bool, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	if kcp.Spec.SpareReplicas == nil || *kcp.Spec.SpareReplicas == 0 {
+		return false, nil
+	}
+
+	spares, err := r.getSpareControlPlane(ctx, cluster, kcp)
+	if err != nil {
+		return false, err
+	}
+
+	candidates := spares.UpToDateMachines().Filter(
+		collections.Not(collections.HasDeletionTimestamp),
+		func(m *clusterv1.Machine) bool { return m.Status.NodeRef != nil },
+	)
+	if candidates.Len() == 0 {
+		return false, nil
+	}
+
+	// Prefer a spare in the failure domain a new machine would be created in.
+	spare := candidates.Oldest()
+	if fd := controlPlane.NextFailureDomainForScaleUp(ctx); fd != nil {
+		if inFailureDomain := candidates.Filter(collections.InFailureDomains(fd)); inFailureDomain.Len() > 0 {
+			spare = inFailureDomain.Oldest()
+		}
+	}
+
+	// In case the spare replaces a remediated machine, track the remediation on it as if it were created for it.
+	spare = spare.DeepCopy()
+	if remediationData, ok := kcp.Annotations[controlplanev1.RemediationInProgressAnnotation]; ok {
+		if spare.Annotations == nil {
+			spare.Annotations = map[string]string{}
+		}
+		spare.Annotations[controlplanev1.RemediationForAnnotation] = remediationData
+	}
+
+	// Updating the machine replaces the spare labels with the control plane ones; the node itself is promoted
+	// by reconcileSparePromotions once the machine is part of the control plane.
+	delete(spare.Labels, bootstrapv1.SpareControlPlaneLabel)
+	if _, err := r.updateMachine(ctx, spare, kcp, cluster); err != nil {
+		r.recorder.Eventf(kcp, corev1.EventTypeWarning, "FailedScaleUp", "Failed to promote spare control plane Machine %s for cluster %s/%s control plane: %v", spare.Name, cluster.Namespace, cluster.Name, err)
+		return false, errors.Wrapf(err, "failed to promote spare Machine %s", spare.Name)
+	}
+	delete(kcp.Annotations, controlplanev1.RemediationInProgressAnnotation)
+
+	log.Info("Promoted spare machine", "machine", spare.Name)
+	return true, nil
+}
+
+// reconcileSparePromotions restarts k3s as a server on the nodes of promoted spare machines, which are identified
+// by the spare label still being set on their KThreesConfig. The label is removed once the node is a server.
+func (r *KThreesControlPlaneReconciler) reconcileSparePromotions(ctx context.Context, controlPlane *k3s.ControlPlane) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	var pending bool
+	for _, machine := range controlPlane.Machines {
+		config, ok := controlPlane.KthreesConfigs[machine.Name]
+		if !ok || !machine.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if _, ok := config.Labels[bootstrapv1.SpareControlPlaneLabel]; !ok {
+			continue
+		}
+		if machine.Status.NodeRef == nil {
+			pending = true
+			continue
+		}
+
+		workloadCluster, err := r.managementCluster.GetWorkloadCluster(ctx, util.ObjectKey(controlPlane.Cluster))
+		if err != nil {
+			return ctrl.Result{}, errors.Wrap(err, "cannot get remote client to workload cluster")
+		}
+
+		done, err := workloadCluster.PromoteSpareNode(ctx, machine.Status.NodeRef.Name)
+		if err != nil {
+			return ctrl.Result{}, errors.Wrapf(err, "failed to promote the node of Machine %s", machine.Name)
+		}
+		if !done {
+			log.Info("Promoting spare machine node", "machine", machine.Name)
+			pending = true
+			continue
+		}
+
+		patchHelper, err := patch.NewHelper(config, r.Client)
+		if err != nil {
+			return ctrl.Result{}, errors.Wrapf(err, "failed to create patch helper for KThreesConfig %s", config.Name)
+		}
+		delete(config.Labels, bootstrapv1.SpareControlPlaneLabel)
+		if err := patchHelper.Patch(ctx, config); err != nil {
+			return ctrl.Result{}, errors.Wrapf(err, "failed to remove the spare label from KThreesConfig %s", config.Name)
+		}
+	}
+
+	if pending {
+		return ctrl.Result{RequeueAfter: sparePromotionRequeueAfter}, nil
+	}
+	return ctrl.Result{}, nil
+}
@@ -0,0 +1,384 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/controllers/external"
+	"sigs.k8s.io/cluster-api/util/collections"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	bootstrapv1 "github.com/k3s-io/cluster-api-k3s/bootstrap/api/v1beta2"
+	controlplanev1 "github.com/k3s-io/cluster-api-k3s/controlplane/api/v1beta2"
+	k3s "github.com/k3s-io/cluster-api-k3s/pkg/k3s"
+)
+
+func TestPromoteSpareMachine(t *testing.T) {
+	cluster := newTestCluster()
+	cluster.Status.FailureDomains = clusterv1.FailureDomains{
+		"fd1": clusterv1.FailureDomainSpec{ControlPlane: true},
+		"fd2": clusterv1.FailureDomainSpec{ControlPlane: true},
+	}
+
+	newMachine := func(kcp *controlplanev1.KThreesControlPlane, name string, spare bool, fd string, age time.Duration, joined bool) []client.Object {
+		machine, config := newTestMachine(cluster, kcp, name, spare)
+		machine.CreationTimestamp = metav1.NewTime(time.Now().Add(-age))
+		machine.Spec.FailureDomain = ptr.To(fd)
+		if joined {
+			machine.Status.NodeRef = &corev1.ObjectReference{Kind: "Node", Name: name}
+		}
+		return []client.Object{machine, config}
+	}
+
+	tests := []struct {
+		name          string
+		spareReplicas *int32
+		machines      func(kcp *controlplanev1.KThreesControlPlane) []client.Object
+		expectSpare   string
+	}{
+		{
+			name: "no spare without spareReplicas",
+			machines: func(kcp *controlplanev1.KThreesControlPlane) []client.Object {
+				return newMachine(kcp, "spare", true, "fd2", time.Hour, true)
+			},
+		},
+		{
+			name:          "no spare whose node joined",
+			spareReplicas: ptr.To[int32](1),
+			machines: func(kcp *controlplanev1.KThreesControlPlane) []client.Object {
+				return newMachine(kcp, "spare", true, "fd2", time.Hour, false)
+			},
+		},
+		{
+			name:          "no up-to-date spare",
+			spareReplicas: ptr.To[int32](1),
+			machines: func(kcp *controlplanev1.KThreesControlPlane) []client.Object {
+				outdated := kcp.DeepCopy()
+				outdated.Spec.Version = "v1.29.8+k3s1"
+				return newMachine(outdated, "spare", true, "fd2", time.Hour, true)
+			},
+		},
+		{
+			name:          "the oldest spare",
+			spareReplicas: ptr.To[int32](2),
+			machines: func(kcp *controlplanev1.KThreesControlPlane) []client.Object {
+				return append(newMachine(kcp, "spare-old", true, "fd1", 2*time.Hour, true),
+					newMachine(kcp, "spare-new", true, "fd1", time.Hour, true)...)
+			},
+			expectSpare: "spare-old",
+		},
+		{
+			name:          "the spare in the failure domain of the next machine",
+			spareReplicas: ptr.To[int32](2),
+			machines: func(kcp *controlplanev1.KThreesControlPlane) []client.Object {
+				objs := newMachine(kcp, "cp", false, "fd1", 3*time.Hour, true)
+				objs = append(objs, newMachine(kcp, "spare-fd1", true, "fd1", 2*time.Hour, true)...)
+				return append(objs, newMachine(kcp, "spare-fd2", true, "fd2", time.Hour, true)...)
+			},
+			expectSpare: "spare-fd2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.TODO()
+
+			kcp := newTestKCP(cluster)
+			kcp.Spec.SpareReplicas = tt.spareReplicas
+			kcp.Annotations = map[string]string{controlplanev1.RemediationInProgressAnnotation: "remediation-data"}
+			c := newFakeClient(append(tt.machines(kcp), cluster, kcp)...)
+			r := newTestReconciler(c, nil)
+
+			machines, err := r.managementCluster.GetMachinesForCluster(ctx, client.ObjectKeyFromObject(cluster), collections.OwnedMachines(kcp), collections.Not(isSpareMachine))
+			g.Expect(err).ToNot(HaveOccurred())
+			controlPlane, err := k3s.NewControlPlane(ctx, c, cluster, kcp, machines)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			promoted, err := r.promoteSpareMachine(ctx, cluster, kcp, controlPlane)
+			g.Expect(err).ToNot(HaveOccurred())
+			if tt.expectSpare == "" {
+				g.Expect(promoted).To(BeFalse())
+				g.Expect(kcp.Annotations).To(HaveKey(controlplanev1.RemediationInProgressAnnotation))
+				return
+			}
+			g.Expect(promoted).To(BeTrue())
+
+			// the spare becomes a control plane machine tracking the remediation it replaces.
+			spare := &clusterv1.Machine{}
+			g.Expect(c.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: tt.expectSpare}, spare)).To(Succeed())
+			g.Expect(isSpareMachine(spare)).To(BeFalse())
+			g.Expect(spare.Labels).To(HaveKeyWithValue(clusterv1.MachineControlPlaneLabel, ""))
+			g.Expect(spare.Annotations).To(HaveKeyWithValue(controlplanev1.RemediationForAnnotation, "remediation-data"))
+			g.Expect(kcp.Annotations).ToNot(HaveKey(controlplanev1.RemediationInProgressAnnotation))
+
+			// the other spares are left alone.
+			spares, err := r.managementCluster.GetMachinesForCluster(ctx, client.ObjectKeyFromObject(cluster), isSpareMachine)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(spares.Len()).To(Equal(1))
+		})
+	}
+}
+
+func TestReconcileSparePromotions(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.TODO()
+
+	cluster := newTestCluster()
+	kcp := newTestKCP(cluster)
+
+	// promoted spares keep the spare label on their KThreesConfig until their node is a server.
+	promoted, promotedConfig := newTestMachine(cluster, kcp, "promoted", false)
+	promoted.Status.NodeRef = &corev1.ObjectReference{Kind: "Node", Name: "promoted"}
+	promotedConfig.Labels[bootstrapv1.SpareControlPlaneLabel] = ""
+	joining, joiningConfig := newTestMachine(cluster, kcp, "joining", false)
+	joiningConfig.Labels[bootstrapv1.SpareControlPlaneLabel] = ""
+	c := newFakeClient(cluster, kcp, promoted, promotedConfig, joining, joiningConfig)
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "promoted",
+			Labels: map[string]string{bootstrapv1.SpareControlPlaneLabel: "true"},
+		},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+		},
+	}
+	workloadClient := fake.NewClientBuilder().WithObjects(node).Build()
+	r := newTestReconciler(c, workloadClient)
+
+	newControlPlane := func() *k3s.ControlPlane {
+		machines, err := r.managementCluster.GetMachinesForCluster(ctx, client.ObjectKeyFromObject(cluster))
+		g.Expect(err).ToNot(HaveOccurred())
+		controlPlane, err := k3s.NewControlPlane(ctx, c, cluster, kcp, machines)
+		g.Expect(err).ToNot(HaveOccurred())
+		return controlPlane
+	}
+
+	// the promotion script is run on the agent node.
+	result, err := r.reconcileSparePromotions(ctx, newControlPlane())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result).To(Equal(ctrl.Result{RequeueAfter: sparePromotionRequeueAfter}))
+	pods := &corev1.PodList{}
+	g.Expect(workloadClient.List(ctx, pods)).To(Succeed())
+	g.Expect(pods.Items).To(HaveLen(1))
+	g.Expect(pods.Items[0].Spec.NodeName).To(Equal("promoted"))
+
+	// once the node is a server, the spare label is removed from the KThreesConfig.
+	node.Labels["node-role.kubernetes.io/control-plane"] = "true"
+	g.Expect(workloadClient.Update(ctx, node)).To(Succeed())
+	result, err = r.reconcileSparePromotions(ctx, newControlPlane())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result).To(Equal(ctrl.Result{RequeueAfter: sparePromotionRequeueAfter}))
+	g.Expect(c.Get(ctx, client.ObjectKeyFromObject(promotedConfig), promotedConfig)).To(Succeed())
+	g.Expect(promotedConfig.Labels).ToNot(HaveKey(bootstrapv1.SpareControlPlaneLabel))
+
+	// the promotion is pending until the node of the other machine joined.
+	g.Expect(c.Get(ctx, client.ObjectKeyFromObject(joining), joining)).To(Succeed())
+	joining.Status.NodeRef = &corev1.ObjectReference{Kind: "Node", Name: "joining"}
+	g.Expect(c.Status().Update(ctx, joining)).To(Succeed())
+	g.Expect(workloadClient.Create(ctx, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "joining"}})).To(Succeed())
+	result, err = r.reconcileSparePromotions(ctx, newControlPlane())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result).To(Equal(ctrl.Result{}))
+	g.Expect(c.Get(ctx, client.ObjectKeyFromObject(joiningConfig), joiningConfig)).To(Succeed())
+	g.Expect(joiningConfig.Labels).ToNot(HaveKey(bootstrapv1.SpareControlPlaneLabel))
+}
+
+func TestReconcileSpareMachines(t *testing.T) {
+	cluster := newTestCluster()
+
+	newSpare := func(kcp *controlplanev1.KThreesControlPlane, name string, age time.Duration) []client.Object {
+		machine, config := newTestMachine(cluster, kcp, name, true)
+		machine.CreationTimestamp = metav1.NewTime(time.Now().Add(-age))
+		return []client.Object{machine, config}
+	}
+
+	tests := []struct {
+		name          string
+		initialized   bool
+		spareReplicas *int32
+		spares        func(kcp *controlplanev1.KThreesControlPlane) []client.Object
+		expectResult  ctrl.Result
+		expectSpares  []string
+		expectCreated bool
+	}{
+		{
+			name:          "no spares before the control plane is initialized",
+			spareReplicas: ptr.To[int32](1),
+			expectResult:  ctrl.Result{},
+		},
+		{
+			name:          "creates a missing spare",
+			initialized:   true,
+			spareReplicas: ptr.To[int32](1),
+			expectResult:  ctrl.Result{Requeue: true},
+			expectCreated: true,
+		},
+		{
+			name:          "keeps the up-to-date spares",
+			initialized:   true,
+			spareReplicas: ptr.To[int32](1),
+			spares: func(kcp *controlplanev1.KThreesControlPlane) []client.Object {
+				return newSpare(kcp, "spare", time.Hour)
+			},
+			expectResult: ctrl.Result{},
+			expectSpares: []string{"spare"},
+		},
+		{
+			name:          "deletes the newest spares above spareReplicas",
+			initialized:   true,
+			spareReplicas: ptr.To[int32](1),
+			spares: func(kcp *controlplanev1.KThreesControlPlane) []client.Object {
+				return append(newSpare(kcp, "spare-old", 2*time.Hour), newSpare(kcp, "spare-new", time.Hour)...)
+			},
+			expectResult: ctrl.Result{RequeueAfter: deleteRequeueAfter},
+			expectSpares: []string{"spare-old"},
+		},
+		{
+			name:        "deletes the spares when spareReplicas is unset",
+			initialized: true,
+			spares: func(kcp *controlplanev1.KThreesControlPlane) []client.Object {
+				return newSpare(kcp, "spare", time.Hour)
+			},
+			expectResult: ctrl.Result{RequeueAfter: deleteRequeueAfter},
+		},
+		{
+			name:          "deletes the outdated spares before creating new ones",
+			initialized:   true,
+			spareReplicas: ptr.To[int32](1),
+			spares: func(kcp *controlplanev1.KThreesControlPlane) []client.Object {
+				outdated := kcp.DeepCopy()
+				outdated.Spec.Version = "v1.29.8+k3s1"
+				return newSpare(outdated, "spare", time.Hour)
+			},
+			expectResult: ctrl.Result{RequeueAfter: deleteRequeueAfter},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.TODO()
+
+			kcp := newTestKCP(cluster)
+			kcp.Status.Initialized = tt.initialized
+			kcp.Spec.SpareReplicas = tt.spareReplicas
+			objs := []client.Object{cluster, kcp, newTestInfraMachineTemplate(cluster.Namespace)}
+			if tt.spares != nil {
+				objs = append(objs, tt.spares(kcp)...)
+			}
+			c := newFakeClient(objs...)
+			r := newTestReconciler(c, nil)
+
+			result, err := r.reconcileSpareMachines(ctx, cluster, kcp)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(result).To(Equal(tt.expectResult))
+
+			spares, err := r.managementCluster.GetMachinesForCluster(ctx, client.ObjectKeyFromObject(cluster), isSpareMachine)
+			g.Expect(err).ToNot(HaveOccurred())
+			if !tt.expectCreated {
+				g.Expect(spares.Names()).To(ConsistOf(tt.expectSpares))
+				return
+			}
+
+			// the new spare and its KThreesConfig have the spare labels.
+			g.Expect(spares.Len()).To(Equal(1))
+			spare := spares.Oldest()
+			g.Expect(spare.Labels).To(HaveKey(bootstrapv1.SpareControlPlaneLabel))
+			g.Expect(spare.Labels).ToNot(HaveKey(clusterv1.MachineControlPlaneLabel))
+			config := &bootstrapv1.KThreesConfig{}
+			g.Expect(c.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: spare.Spec.Bootstrap.ConfigRef.Name}, config)).To(Succeed())
+			g.Expect(config.Labels).To(HaveKey(bootstrapv1.SpareControlPlaneLabel))
+			infraMachine, err := external.Get(ctx, c, &spare.Spec.InfrastructureRef, cluster.Namespace)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(infraMachine.GetLabels()).To(HaveKey(bootstrapv1.SpareControlPlaneLabel))
+		})
+	}
+}
+
+func TestMachineTemplateMetadataPropagatedInPlace(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.TODO()
+
+	cluster := newTestCluster()
+	kcp := newTestKCP(cluster)
+	kcp.Spec.SpareReplicas = ptr.To[int32](1)
+	machine, config := newTestMachine(cluster, kcp, "machine", false)
+	spare, spareConfig := newTestMachine(cluster, kcp, "spare", true)
+	c := newFakeClient(cluster, kcp, newTestInfraMachineTemplate(cluster.Namespace),
+		machine, config, newTestInfraMachine(machine), spare, spareConfig, newTestInfraMachine(spare))
+	r := newTestReconciler(c, nil)
+
+	// only the metadata of the machine template changes.
+	kcp.Spec.MachineTemplate.ObjectMeta.Labels = map[string]string{"team": "platform"}
+	kcp.Spec.MachineTemplate.ObjectMeta.Annotations = map[string]string{"owner": "platform"}
+
+	expectMetadata := func(name string, spare bool) {
+		m := &clusterv1.Machine{}
+		g.Expect(c.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: name}, m)).To(Succeed())
+		config := &bootstrapv1.KThreesConfig{}
+		g.Expect(c.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: name}, config)).To(Succeed())
+		infraMachine, err := external.Get(ctx, c, &m.Spec.InfrastructureRef, cluster.Namespace)
+		g.Expect(err).ToNot(HaveOccurred())
+
+		for _, obj := range []client.Object{m, config, infraMachine} {
+			g.Expect(obj.GetLabels()).To(HaveKeyWithValue("team", "platform"))
+			g.Expect(obj.GetAnnotations()).To(HaveKeyWithValue("owner", "platform"))
+			if spare {
+				g.Expect(obj.GetLabels()).To(HaveKey(bootstrapv1.SpareControlPlaneLabel))
+				g.Expect(obj.GetLabels()).ToNot(HaveKey(clusterv1.MachineControlPlaneLabel))
+			} else {
+				g.Expect(obj.GetLabels()).To(HaveKey(clusterv1.MachineControlPlaneLabel))
+				g.Expect(obj.GetLabels()).ToNot(HaveKey(bootstrapv1.SpareControlPlaneLabel))
+			}
+		}
+	}
+
+	// the control plane machine is updated in place and does not need a rollout.
+	machines, err := r.managementCluster.GetMachinesForCluster(ctx, client.ObjectKeyFromObject(cluster), collections.OwnedMachines(kcp), collections.Not(isSpareMachine))
+	g.Expect(err).ToNot(HaveOccurred())
+	controlPlane, err := k3s.NewControlPlane(ctx, c, cluster, kcp, machines)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(r.syncMachines(ctx, controlPlane)).To(Succeed())
+	expectMetadata("machine", false)
+
+	controlPlane, err = k3s.NewControlPlane(ctx, c, cluster, kcp, machines)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(controlPlane.MachinesNeedingRollout()).To(BeEmpty())
+
+	// the spare is updated in place as well, and is not replaced.
+	result, err := r.reconcileSpareMachines(ctx, cluster, kcp)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(result).To(BeZero())
+	expectMetadata("spare", true)
+
+	spares, err := r.managementCluster.GetMachinesForCluster(ctx, client.ObjectKeyFromObject(cluster), isSpareMachine)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(spares.Names()).To(ConsistOf("spare"))
+	g.Expect(spares.Oldest().DeletionTimestamp.IsZero()).To(BeTrue())
+}
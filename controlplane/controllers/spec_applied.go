@@ -0,0 +1,109 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	controlplanev1 "github.com/k3s-io/cluster-api-k3s/controlplane/api/v1beta2"
+	k3s "github.com/k3s-io/cluster-api-k3s/pkg/k3s"
+)
+
+// reconcileSpecApplied compares the key settings of spec.kthreesConfigSpec.serverConfig with the arguments k3s
+// runs with on each server, and surfaces with the SpecApplied condition the servers whose settings differ, telling
+// apart the ones the rollout is going to replace from the ones whose settings are not going to change, e.g. the
+// cluster and service CIDRs which k3s cannot change on an existing cluster and which are compared with the
+// KThreesConfig of each server. It is best effort and does not block the other control plane operations.
+func (r *KThreesControlPlaneReconciler) reconcileSpecApplied(ctx context.Context, controlPlane *k3s.ControlPlane) {
+	if !controlPlane.KCP.Status.Initialized {
+		conditions.Delete(controlPlane.KCP, controlplanev1.SpecAppliedCondition)
+		return
+	}
+
+	workloadCluster, err := r.managementCluster.GetWorkloadCluster(ctx, util.ObjectKey(controlPlane.Cluster))
+	if err != nil {
+		conditions.MarkUnknown(controlPlane.KCP, controlplanev1.SpecAppliedCondition, controlplanev1.SpecInspectionFailedReason, "Failed to connect to the workload cluster: %v", err)
+		return
+	}
+
+	nodeArgs, err := workloadCluster.ServerNodeArgs(ctx)
+	if err != nil {
+		conditions.MarkUnknown(controlPlane.KCP, controlplanev1.SpecAppliedCondition, controlplanev1.SpecInspectionFailedReason, "Failed to read the arguments of the servers: %v", err)
+		return
+	}
+
+	desiredServerConfig := controlPlane.KCP.Spec.KThreesConfigSpec.ServerConfig
+	needingRollout := controlPlane.MachinesNeedingRollout()
+	pending, ignored := []string{}, []string{}
+	for _, machine := range controlPlane.Machines.SortedByCreationTimestamp() {
+		if !machine.DeletionTimestamp.IsZero() || machine.Status.NodeRef == nil {
+			continue
+		}
+		args, ok := nodeArgs[machine.Status.NodeRef.Name]
+		if !ok {
+			continue
+		}
+
+		flags := k3s.ParseNodeArgs(args)
+		serverConfig := desiredServerConfig
+		// The settings k3s cannot change are compared with the configuration the server was bootstrapped with,
+		// which also holds the CIDRs the bootstrap controller derives from the cluster network.
+		if config, ok := controlPlane.KthreesConfigs[machine.Name]; ok {
+			if _, immutable := k3s.ServerConfigDrift(config.Spec.ServerConfig, flags); len(immutable) > 0 {
+				ignored = append(ignored, fmt.Sprintf("%s (%s)", machine.Name, strings.Join(immutable, ", ")))
+				continue
+			}
+			if serverConfig.ClusterCidr == "" {
+				serverConfig.ClusterCidr = config.Spec.ServerConfig.ClusterCidr
+			}
+			if serverConfig.ServiceCidr == "" {
+				serverConfig.ServiceCidr = config.Spec.ServerConfig.ServiceCidr
+			}
+		}
+
+		changed, immutable := k3s.ServerConfigDrift(serverConfig, flags)
+		if len(immutable) > 0 {
+			ignored = append(ignored, fmt.Sprintf("%s (%s)", machine.Name, strings.Join(immutable, ", ")))
+			continue
+		}
+		if len(changed) == 0 {
+			continue
+		}
+		if _, ok := needingRollout[machine.Name]; ok {
+			pending = append(pending, fmt.Sprintf("%s (%s)", machine.Name, strings.Join(changed, ", ")))
+		} else {
+			ignored = append(ignored, fmt.Sprintf("%s (%s)", machine.Name, strings.Join(changed, ", ")))
+		}
+	}
+
+	switch {
+	case len(ignored) > 0:
+		conditions.MarkFalse(controlPlane.KCP, controlplanev1.SpecAppliedCondition, controlplanev1.SpecIgnoredReason, clusterv1.ConditionSeverityWarning,
+			"The server settings of Machines %s differ from the spec and are not going to be applied", strings.Join(ignored, ", "))
+	case len(pending) > 0:
+		conditions.MarkFalse(controlPlane.KCP, controlplanev1.SpecAppliedCondition, controlplanev1.SpecRolloutPendingReason, clusterv1.ConditionSeverityInfo,
+			"The server settings of Machines %s are going to be applied by the rollout", strings.Join(pending, ", "))
+	default:
+		conditions.MarkTrue(controlPlane.KCP, controlplanev1.SpecAppliedCondition)
+	}
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/collections"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	bootstrapv1 "github.com/k3s-io/cluster-api-k3s/bootstrap/api/v1beta2"
+	controlplanev1 "github.com/k3s-io/cluster-api-k3s/controlplane/api/v1beta2"
+	k3s "github.com/k3s-io/cluster-api-k3s/pkg/k3s"
+)
+
+func TestReconcileSpecApplied(t *testing.T) {
+	cluster := newTestCluster()
+	ipv6Args := []string{"server", "--cluster-cidr", "fd00:42::/56", "--service-cidr", "fd00:43::/112"}
+
+	tests := []struct {
+		name         string
+		mutateKCP    func(kcp *controlplanev1.KThreesControlPlane)
+		mutateConfig func(config *bootstrapv1.KThreesConfig)
+		nodeArgs     []string
+		expectStatus corev1.ConditionStatus
+		expectReason string
+	}{
+		{
+			name:         "default settings",
+			nodeArgs:     []string{"server"},
+			expectStatus: corev1.ConditionTrue,
+		},
+		{
+			name: "CIDRs derived from the cluster network by the bootstrap controller",
+			mutateConfig: func(config *bootstrapv1.KThreesConfig) {
+				config.Spec.ServerConfig.ClusterCidr = "fd00:42::/56"
+				config.Spec.ServerConfig.ServiceCidr = "fd00:43::/112"
+			},
+			nodeArgs:     ipv6Args,
+			expectStatus: corev1.ConditionTrue,
+		},
+		{
+			name: "CIDRs of the server differing from its configuration",
+			mutateConfig: func(config *bootstrapv1.KThreesConfig) {
+				config.Spec.ServerConfig.ClusterCidr = "fd00:44::/56"
+				config.Spec.ServerConfig.ServiceCidr = "fd00:43::/112"
+			},
+			nodeArgs:     ipv6Args,
+			expectStatus: corev1.ConditionFalse,
+			expectReason: controlplanev1.SpecIgnoredReason,
+		},
+		{
+			name: "CIDRs changed on the KThreesControlPlane",
+			mutateKCP: func(kcp *controlplanev1.KThreesControlPlane) {
+				kcp.Spec.KThreesConfigSpec.ServerConfig.ClusterCidr = "fd00:44::/56"
+			},
+			mutateConfig: func(config *bootstrapv1.KThreesConfig) {
+				config.Spec.ServerConfig.ClusterCidr = "fd00:42::/56"
+				config.Spec.ServerConfig.ServiceCidr = "fd00:43::/112"
+			},
+			nodeArgs:     ipv6Args,
+			expectStatus: corev1.ConditionFalse,
+			expectReason: controlplanev1.SpecIgnoredReason,
+		},
+		{
+			name: "disabled components changed on the KThreesControlPlane",
+			mutateKCP: func(kcp *controlplanev1.KThreesControlPlane) {
+				kcp.Spec.KThreesConfigSpec.ServerConfig.DisableComponents = []string{"traefik"}
+			},
+			mutateConfig: func(config *bootstrapv1.KThreesConfig) {
+				config.Spec.ServerConfig.ClusterCidr = "fd00:42::/56"
+				config.Spec.ServerConfig.ServiceCidr = "fd00:43::/112"
+			},
+			nodeArgs:     ipv6Args,
+			expectStatus: corev1.ConditionFalse,
+			expectReason: controlplanev1.SpecRolloutPendingReason,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.TODO()
+
+			kcp := newTestKCP(cluster)
+			machine, config := newTestMachine(cluster, kcp, "machine", false)
+			machine.Status.NodeRef = &corev1.ObjectReference{Kind: "Node", Name: "node"}
+			if tt.mutateConfig != nil {
+				tt.mutateConfig(config)
+			}
+			if tt.mutateKCP != nil {
+				tt.mutateKCP(kcp)
+			}
+			c := newFakeClient(cluster, kcp, machine, config)
+
+			args, err := json.Marshal(tt.nodeArgs)
+			g.Expect(err).ToNot(HaveOccurred())
+			node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{
+				Name:        "node",
+				Labels:      map[string]string{"node-role.kubernetes.io/master": "true"},
+				Annotations: map[string]string{"k3s.io/node-args": string(args)},
+			}}
+			r := newTestReconciler(c, fake.NewClientBuilder().WithObjects(node).Build())
+
+			machines, err := r.managementCluster.GetMachinesForCluster(ctx, client.ObjectKeyFromObject(cluster), collections.OwnedMachines(kcp))
+			g.Expect(err).ToNot(HaveOccurred())
+			controlPlane, err := k3s.NewControlPlane(ctx, c, cluster, kcp, machines)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			r.reconcileSpecApplied(ctx, controlPlane)
+			condition := conditions.Get(kcp, controlplanev1.SpecAppliedCondition)
+			g.Expect(condition).ToNot(BeNil())
+			g.Expect(condition.Status).To(Equal(tt.expectStatus))
+			g.Expect(condition.Reason).To(Equal(tt.expectReason))
+			if tt.expectStatus == corev1.ConditionFalse {
+				g.Expect(condition.Severity).ToNot(Equal(clusterv1.ConditionSeverityNone))
+			}
+		})
+	}
+}
@@ -29,6 +29,7 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
@@ -38,6 +39,7 @@ import (
 	controlplanev1 "github.com/k3s-io/cluster-api-k3s/controlplane/api/v1beta2"
 	"github.com/k3s-io/cluster-api-k3s/controlplane/controllers"
 	"github.com/k3s-io/cluster-api-k3s/pkg/etcd"
+	"github.com/k3s-io/cluster-api-k3s/pkg/versions"
 )
 
 var (
@@ -59,12 +61,26 @@ func init() {
 
 func main() {
 	var metricsAddr string
+	var secureMetrics bool
+	var metricsCertDir string
+	var profilerAddress string
 	var enableLeaderElection bool
 	var syncPeriod time.Duration
 	var etcdDialTimeout time.Duration
 	var etcdCallTimeout time.Duration
+	var supportedVersionsFile string
+	var preflightPollInterval time.Duration
+	var readinessPollInterval time.Duration
 
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
+	flag.BoolVar(&secureMetrics, "metrics-secure", false,
+		"Serve the metrics endpoint over HTTPS, only to clients authenticated and authorized by the Kubernetes API server "+
+			"(TokenReview and SubjectAccessReview), instead of plain HTTP.")
+	flag.StringVar(&metricsCertDir, "metrics-cert-dir", "",
+		"Directory containing the tls.crt and tls.key serving the secure metrics endpoint. "+
+			"A self-signed certificate is generated when empty.")
+	flag.StringVar(&profilerAddress, "profiler-address", "",
+		"The address the pprof endpoints bind to (e.g. localhost:6060). Profiling is disabled when empty.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
@@ -78,17 +94,41 @@ func main() {
 	flag.DurationVar(&etcdCallTimeout, "etcd-call-timeout-duration", etcd.DefaultCallTimeout,
 		"Duration that the etcd client waits at most for read and write operations to etcd.")
 
+	flag.DurationVar(&preflightPollInterval, "preflight-poll-interval", 15*time.Second,
+		"Interval at which the control plane health, e.g. etcd members, is checked again while waiting to scale up or down the control plane.")
+
+	flag.DurationVar(&readinessPollInterval, "readiness-poll-interval", 20*time.Second,
+		"Interval at which the workload cluster readiness is checked again while the control plane is not ready or its components are unhealthy.")
+
+	flag.StringVar(&supportedVersionsFile, "supported-versions-file", "",
+		"Path to a supported versions matrix, e.g. mounted from a ConfigMap, overriding the embedded one.")
+
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
 
+	if supportedVersionsFile != "" {
+		if err := versions.LoadFile(supportedVersionsFile); err != nil {
+			setupLog.Error(err, "unable to load supported versions matrix")
+			os.Exit(1)
+		}
+	}
+
 	ctx := ctrl.SetupSignalHandler()
 
+	metricsOptions := server.Options{
+		BindAddress: metricsAddr,
+	}
+	if secureMetrics {
+		metricsOptions.SecureServing = true
+		metricsOptions.CertDir = metricsCertDir
+		metricsOptions.FilterProvider = filters.WithAuthenticationAndAuthorization
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme: scheme,
-		Metrics: server.Options{
-			BindAddress: metricsAddr,
-		},
+		Scheme:           scheme,
+		Metrics:          metricsOptions,
+		PprofBindAddress: profilerAddress,
 		WebhookServer: webhook.NewServer(webhook.Options{
 			Port: 9443,
 		}),
@@ -105,11 +145,13 @@ func main() {
 
 	ctrPlaneLogger := ctrl.Log.WithName("controllers").WithName("KThreesControlPlane")
 	if err = (&controllers.KThreesControlPlaneReconciler{
-		Client:          mgr.GetClient(),
-		Log:             ctrPlaneLogger,
-		Scheme:          mgr.GetScheme(),
-		EtcdDialTimeout: etcdDialTimeout,
-		EtcdCallTimeout: etcdCallTimeout,
+		Client:                mgr.GetClient(),
+		Log:                   ctrPlaneLogger,
+		Scheme:                mgr.GetScheme(),
+		EtcdDialTimeout:       etcdDialTimeout,
+		EtcdCallTimeout:       etcdCallTimeout,
+		PreflightPollInterval: preflightPollInterval,
+		ReadinessPollInterval: readinessPollInterval,
 	}).SetupWithManager(ctx, mgr, &ctrPlaneLogger); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "KThreesControlPlane")
 		os.Exit(1)
@@ -132,6 +174,10 @@ func main() {
 			setupLog.Error(err, "unable to create webhook", "webhook", "KThreesControlPlane")
 			os.Exit(1)
 		}
+		if err = (&controlplanev1.KThreesControlPlaneTemplate{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "KThreesControlPlaneTemplate")
+			os.Exit(1)
+		}
 	}
 	// +kubebuilder:scaffold:builder
 
@@ -19,6 +19,7 @@ package cloudinit
 import (
 	"bytes"
 	"fmt"
+	"strconv"
 	"strings"
 	"text/template"
 
@@ -71,6 +72,15 @@ write_files:{{ range . }}
 `
 	sentinelFileCommand               = "mkdir -p /run/cluster-api && echo success > /run/cluster-api/bootstrap-success.complete"
 	defaultAirGappedInstallScriptPath = "/opt/install.sh"
+	defaultHostPathPermissions        = "0755"
+
+	// dockerInstallCommand installs the Docker engine when missing, for nodes running containers with cri-dockerd.
+	dockerInstallCommand = "command -v docker >/dev/null 2>&1 || curl -fsSL https://get.docker.com | sh && systemctl enable --now docker"
+
+	// journaldDebugConfigLocation lifts the journald rate limits of nodes with k3s debug logging.
+	journaldDebugConfigLocation = "/etc/systemd/journald.conf.d/90-k3s-debug.conf"
+	journaldDebugConfig         = "[Journal]\nRateLimitIntervalSec=0\nRateLimitBurst=0\n"
+	journaldRestartCommand      = "systemctl restart systemd-journald"
 )
 
 // BaseUserData is shared across all the various types of files written to disk.
@@ -85,9 +95,12 @@ type BaseUserData struct {
 	AirGapped                  bool
 	AirGappedInstallScriptPath string
 	SentinelFileCommand        string
+	ExtraHostPaths             []bootstrapv1.HostPath
+	Docker                     bool
+	Debug                      bool
 }
 
-func (input *BaseUserData) prepare() {
+func (input *BaseUserData) prepare() error {
 	input.Header = cloudConfigHeader
 	input.WriteFiles = append(input.WriteFiles, input.AdditionalFiles...)
 	input.WriteFiles = append(input.WriteFiles, input.ConfigFile)
@@ -96,6 +109,51 @@ func (input *BaseUserData) prepare() {
 	}
 
 	input.SentinelFileCommand = sentinelFileCommand
+	mkdirCommands, err := hostPathCommands(input.ExtraHostPaths)
+	if err != nil {
+		return err
+	}
+	input.PreK3sCommands = append(mkdirCommands, input.PreK3sCommands...)
+	// Air-gapped nodes are expected to have the Docker engine installed already.
+	if input.Docker && !input.AirGapped {
+		input.PreK3sCommands = append([]string{dockerInstallCommand}, input.PreK3sCommands...)
+	}
+	if input.Debug {
+		input.WriteFiles = append(input.WriteFiles, bootstrapv1.File{
+			Path:        journaldDebugConfigLocation,
+			Content:     journaldDebugConfig,
+			Owner:       "root:root",
+			Permissions: "0644",
+		})
+		input.PreK3sCommands = append([]string{journaldRestartCommand}, input.PreK3sCommands...)
+	}
+	return nil
+}
+
+// hostPathCommands returns the commands creating the directories declared as extra host paths,
+// files are expected to be written by write_files.
+func hostPathCommands(hostPaths []bootstrapv1.HostPath) ([]string, error) {
+	commands := []string{}
+	for _, hostPath := range hostPaths {
+		if hostPath.Type == bootstrapv1.HostPathFile {
+			continue
+		}
+
+		permissions := hostPath.Permissions
+		if permissions == "" {
+			permissions = defaultHostPathPermissions
+		}
+		if mode, err := strconv.ParseUint(permissions, 8, 32); err != nil || mode > 0o7777 {
+			return nil, fmt.Errorf("invalid permissions %q for host path %s: must be an octal mode", permissions, hostPath.Path)
+		}
+		commands = append(commands, fmt.Sprintf("mkdir -p -m %s %s", permissions, shellQuote(hostPath.Path)))
+	}
+	return commands, nil
+}
+
+// shellQuote quotes s as a single shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
 }
 
 func generate(kind string, tpl string, data interface{}) ([]byte, error) {
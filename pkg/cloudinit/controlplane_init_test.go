@@ -81,3 +81,53 @@ func TestControlPlaneInitAirGapped(t *testing.T) {
 	g.Expect(result).To(ContainSubstring("sh /opt/install.sh"))
 	g.Expect(result).NotTo(ContainSubstring("get.k3s.io"))
 }
+
+func TestControlPlaneInitExtraHostPaths(t *testing.T) {
+	g := NewWithT(t)
+
+	cpinput := &ControlPlaneInput{
+		BaseUserData: BaseUserData{
+			PreK3sCommands: []string{"echo pre"},
+			ExtraHostPaths: []infrav1.HostPath{
+				{Path: "/var/log/kubernetes/audit", Permissions: "0700"},
+				{Path: "/etc/kubernetes/oidc"},
+				{Path: "/etc/kubernetes/oidc/ca.crt", Type: infrav1.HostPathFile},
+			},
+		},
+		Certificates: secret.Certificates{},
+	}
+
+	out, err := NewInitControlPlane(cpinput)
+	g.Expect(err).NotTo(HaveOccurred())
+	result := string(out)
+	g.Expect(result).To(ContainSubstring(`- "mkdir -p -m 0700 '/var/log/kubernetes/audit'"
+  - "mkdir -p -m 0755 '/etc/kubernetes/oidc'"
+  - "echo pre"`))
+	g.Expect(result).NotTo(ContainSubstring("ca.crt"))
+}
+
+func TestHostPathCommands(t *testing.T) {
+	g := NewWithT(t)
+
+	commands, err := hostPathCommands([]infrav1.HostPath{
+		{Path: "/var/log/kubernetes/audit dir"},
+		{Path: "/etc/kubernetes/it's; rm -rf /", Permissions: "700"},
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(commands).To(Equal([]string{
+		`mkdir -p -m 0755 '/var/log/kubernetes/audit dir'`,
+		`mkdir -p -m 700 '/etc/kubernetes/it'\''s; rm -rf /'`,
+	}))
+
+	for _, permissions := range []string{"0799", "u+rwx", "0755 /tmp", "17777"} {
+		_, err := hostPathCommands([]infrav1.HostPath{{Path: "/var/log/kubernetes/audit", Permissions: permissions}})
+		g.Expect(err).To(HaveOccurred(), permissions)
+	}
+
+	_, err = NewInitControlPlane(&ControlPlaneInput{
+		BaseUserData: BaseUserData{
+			ExtraHostPaths: []infrav1.HostPath{{Path: "/var/log/kubernetes/audit", Permissions: "rwx"}},
+		},
+	})
+	g.Expect(err).To(HaveOccurred())
+}
@@ -35,7 +35,9 @@ type WorkerInput struct {
 
 // NewInitControlPlane returns the user data string to be used on a controlplane instance.
 func NewWorker(input *WorkerInput) ([]byte, error) {
-	input.BaseUserData.prepare()
+	if err := input.BaseUserData.prepare(); err != nil {
+		return nil, err
+	}
 
 	workerCloudInitWithVersion := fmt.Sprintf(workerCloudInit, input.K3sVersion)
 	userData, err := generate("Worker", workerCloudInitWithVersion, input)
@@ -17,6 +17,7 @@ limitations under the License.
 package cloudinit
 
 import (
+	"strings"
 	"testing"
 
 	. "github.com/onsi/gomega"
@@ -79,3 +80,44 @@ func TestWorkerJoinAirGapped(t *testing.T) {
 	g.Expect(result).To(ContainSubstring("sh /test/install.sh"))
 	g.Expect(result).NotTo(ContainSubstring("get.k3s.io"))
 }
+
+func TestWorkerJoinDocker(t *testing.T) {
+	g := NewWithT(t)
+
+	workerInput := &WorkerInput{
+		BaseUserData: BaseUserData{
+			PreK3sCommands: []string{"echo pre"},
+			Docker:         true,
+		},
+	}
+	out, err := NewWorker(workerInput)
+	g.Expect(err).NotTo(HaveOccurred())
+	result := string(out)
+	g.Expect(result).To(ContainSubstring("get.docker.com"))
+	g.Expect(strings.Index(result, "get.docker.com")).To(BeNumerically("<", strings.Index(result, "echo pre")))
+
+	// air-gapped nodes are expected to have the Docker engine installed already.
+	workerInput = &WorkerInput{
+		BaseUserData: BaseUserData{
+			Docker:    true,
+			AirGapped: true,
+		},
+	}
+	out, err = NewWorker(workerInput)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(out)).NotTo(ContainSubstring("get.docker.com"))
+}
+
+func TestWorkerJoinDebug(t *testing.T) {
+	g := NewWithT(t)
+
+	workerInput := &WorkerInput{
+		BaseUserData: BaseUserData{
+			Debug: true,
+		},
+	}
+	out, err := NewWorker(workerInput)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(out)).To(ContainSubstring(journaldDebugConfigLocation))
+	g.Expect(string(out)).To(ContainSubstring(journaldRestartCommand))
+}
@@ -1,14 +1,42 @@
 package k3s
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"net"
+	"strconv"
 	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 
 	bootstrapv1 "github.com/k3s-io/cluster-api-k3s/bootstrap/api/v1beta2"
 )
 
 const DefaultK3sConfigLocation = "/etc/rancher/k3s/config.yaml"
 
+// DefaultRegistriesConfigLocation is where k3s reads the private registry configuration from by default.
+const DefaultRegistriesConfigLocation = "/etc/rancher/k3s/registries.yaml"
+
+// AuditWebhookConfigLocation is where the kubeconfig of the audit webhook backend is written on servers.
+const AuditWebhookConfigLocation = "/var/lib/rancher/k3s/server/audit-webhook-kubeconfig.yaml"
+
+// VPNAuthLocation is where the VPN authentication passed to k3s is written on nodes.
+const VPNAuthLocation = "/etc/rancher/k3s/vpn-auth"
+
+const (
+	// SpareConfigLocation is where the server configuration is staged on spare control plane machines.
+	SpareConfigLocation = "/etc/rancher/k3s/spare/config.yaml"
+
+	// SparePromotionScriptLocation is the script promoting a spare control plane machine to a server.
+	SparePromotionScriptLocation = "/etc/rancher/k3s/spare/promote.sh"
+)
+
+// ipv6BindAddress is the bind address used for IPv6-only clusters, since k3s defaults to 0.0.0.0.
+const ipv6BindAddress = "::"
+
 type K3sServerConfig struct {
 	DisableCloudController    bool     `json:"disable-cloud-controller,omitempty"`
 	KubeAPIServerArgs         []string `json:"kube-apiserver-arg,omitempty"`
@@ -26,18 +54,45 @@ type K3sServerConfig struct {
 	DisableComponents         []string `json:"disable,omitempty"`
 	ClusterInit               bool     `json:"cluster-init,omitempty"`
 	SystemDefaultRegistry     string   `json:"system-default-registry,omitempty"`
+	EgressSelectorMode        string   `json:"egress-selector-mode,omitempty"`
+	K3sEtcdSnapshotConfig     `json:",inline"`
 	K3sAgentConfig            `json:",inline"`
 }
 
+type K3sEtcdSnapshotConfig struct {
+	EtcdSnapshotScheduleCron string `json:"etcd-snapshot-schedule-cron,omitempty"`
+	EtcdSnapshotRetention    int32  `json:"etcd-snapshot-retention,omitempty"`
+	EtcdS3                   bool   `json:"etcd-s3,omitempty"`
+	EtcdS3Endpoint           string `json:"etcd-s3-endpoint,omitempty"`
+	EtcdS3Bucket             string `json:"etcd-s3-bucket,omitempty"`
+	EtcdS3Folder             string `json:"etcd-s3-folder,omitempty"`
+	EtcdS3Region             string `json:"etcd-s3-region,omitempty"`
+	EtcdS3ConfigSecret       string `json:"etcd-s3-config-secret,omitempty"`
+}
+
 type K3sAgentConfig struct {
-	Token           string   `json:"token,omitempty"`
-	Server          string   `json:"server,omitempty"`
-	KubeletArgs     []string `json:"kubelet-arg,omitempty"`
-	NodeLabels      []string `json:"node-label,omitempty"`
-	NodeTaints      []string `json:"node-taint,omitempty"`
-	PrivateRegistry string   `json:"private-registry,omitempty"`
-	KubeProxyArgs   []string `json:"kube-proxy-arg,omitempty"`
-	NodeName        string   `json:"node-name,omitempty"`
+	Token            string   `json:"token,omitempty"`
+	Server           string   `json:"server,omitempty"`
+	KubeletArgs      []string `json:"kubelet-arg,omitempty"`
+	NodeLabels       []string `json:"node-label,omitempty"`
+	NodeTaints       []string `json:"node-taint,omitempty"`
+	PrivateRegistry  string   `json:"private-registry,omitempty"`
+	KubeProxyArgs    []string `json:"kube-proxy-arg,omitempty"`
+	NodeName         string   `json:"node-name,omitempty"`
+	PreferBundledBin bool     `json:"prefer-bundled-bin,omitempty"`
+	VPNAuthFile      string   `json:"vpn-auth-file,omitempty"`
+	Docker           bool     `json:"docker,omitempty"`
+	ResolvConf       string   `json:"resolv-conf,omitempty"`
+	Debug            bool     `json:"debug,omitempty"`
+	V                int32    `json:"v,omitempty"`
+}
+
+// SetLogging sets the k3s debug logging and log verbosity of the config.
+func (c *K3sAgentConfig) SetLogging(spec bootstrapv1.KThreesConfigSpec) {
+	c.Debug = spec.Debug
+	if spec.LogLevel != nil {
+		c.V = *spec.LogLevel
+	}
 }
 
 func GenerateInitControlPlaneConfig(controlPlaneEndpoint string, token string, serverConfig bootstrapv1.KThreesServerConfig, agentConfig bootstrapv1.KThreesAgentConfig) K3sServerConfig {
@@ -45,11 +100,11 @@ func GenerateInitControlPlaneConfig(controlPlaneEndpoint string, token string, s
 	k3sServerConfig := K3sServerConfig{
 		DisableCloudController:    getDisableCloudController(serverConfig),
 		ClusterInit:               true,
-		KubeAPIServerArgs:         append(serverConfig.KubeAPIServerArgs, "anonymous-auth=true", getTLSCipherSuiteArg()),
-		TLSSan:                    append(serverConfig.TLSSan, controlPlaneEndpoint),
-		KubeControllerManagerArgs: append(serverConfig.KubeControllerManagerArgs, kubeletExtraArgs...),
-		KubeSchedulerArgs:         serverConfig.KubeSchedulerArgs,
-		BindAddress:               serverConfig.BindAddress,
+		KubeAPIServerArgs:         getKubeAPIServerArgs(serverConfig),
+		TLSSan:                    append(serverConfig.TLSSan, trimBrackets(controlPlaneEndpoint)),
+		KubeControllerManagerArgs: append(getKubeControllerManagerArgs(serverConfig), kubeletExtraArgs...),
+		KubeSchedulerArgs:         getKubeSchedulerArgs(serverConfig),
+		BindAddress:               getBindAddress(serverConfig),
 		HTTPSListenPort:           serverConfig.HTTPSListenPort,
 		AdvertiseAddress:          serverConfig.AdvertiseAddress,
 		AdvertisePort:             serverConfig.AdvertisePort,
@@ -59,16 +114,22 @@ func GenerateInitControlPlaneConfig(controlPlaneEndpoint string, token string, s
 		ClusterDomain:             serverConfig.ClusterDomain,
 		DisableComponents:         serverConfig.DisableComponents,
 		SystemDefaultRegistry:     serverConfig.SystemDefaultRegistry,
+		EgressSelectorMode:        serverConfig.EgressSelectorMode,
+		K3sEtcdSnapshotConfig:     getEtcdSnapshotConfig(serverConfig.EtcdSnapshots),
 	}
 
 	k3sServerConfig.K3sAgentConfig = K3sAgentConfig{
-		Token:           token,
-		KubeletArgs:     append(agentConfig.KubeletArgs, kubeletExtraArgs...),
-		NodeLabels:      agentConfig.NodeLabels,
-		NodeTaints:      agentConfig.NodeTaints,
-		PrivateRegistry: agentConfig.PrivateRegistry,
-		KubeProxyArgs:   agentConfig.KubeProxyArgs,
-		NodeName:        agentConfig.NodeName,
+		Token:            token,
+		KubeletArgs:      getKubeletArgs(serverConfig, agentConfig),
+		NodeLabels:       agentConfig.NodeLabels,
+		NodeTaints:       agentConfig.NodeTaints,
+		PrivateRegistry:  agentConfig.PrivateRegistry,
+		KubeProxyArgs:    agentConfig.KubeProxyArgs,
+		NodeName:         agentConfig.NodeName,
+		PreferBundledBin: agentConfig.PreferBundledBin,
+		VPNAuthFile:      getVPNAuthFile(agentConfig),
+		Docker:           agentConfig.Docker,
+		ResolvConf:       getResolvConf(agentConfig),
 	}
 
 	return k3sServerConfig
@@ -78,11 +139,11 @@ func GenerateJoinControlPlaneConfig(serverURL string, token string, controlplane
 	kubeletExtraArgs := getKubeletExtraArgs(serverConfig)
 	k3sServerConfig := K3sServerConfig{
 		DisableCloudController:    getDisableCloudController(serverConfig),
-		KubeAPIServerArgs:         append(serverConfig.KubeAPIServerArgs, "anonymous-auth=true", getTLSCipherSuiteArg()),
-		TLSSan:                    append(serverConfig.TLSSan, controlplaneendpoint),
-		KubeControllerManagerArgs: append(serverConfig.KubeControllerManagerArgs, kubeletExtraArgs...),
-		KubeSchedulerArgs:         serverConfig.KubeSchedulerArgs,
-		BindAddress:               serverConfig.BindAddress,
+		KubeAPIServerArgs:         getKubeAPIServerArgs(serverConfig),
+		TLSSan:                    append(serverConfig.TLSSan, trimBrackets(controlplaneendpoint)),
+		KubeControllerManagerArgs: append(getKubeControllerManagerArgs(serverConfig), kubeletExtraArgs...),
+		KubeSchedulerArgs:         getKubeSchedulerArgs(serverConfig),
+		BindAddress:               getBindAddress(serverConfig),
 		HTTPSListenPort:           serverConfig.HTTPSListenPort,
 		AdvertiseAddress:          serverConfig.AdvertiseAddress,
 		AdvertisePort:             serverConfig.AdvertisePort,
@@ -92,37 +153,214 @@ func GenerateJoinControlPlaneConfig(serverURL string, token string, controlplane
 		ClusterDomain:             serverConfig.ClusterDomain,
 		DisableComponents:         serverConfig.DisableComponents,
 		SystemDefaultRegistry:     serverConfig.SystemDefaultRegistry,
+		EgressSelectorMode:        serverConfig.EgressSelectorMode,
+		K3sEtcdSnapshotConfig:     getEtcdSnapshotConfig(serverConfig.EtcdSnapshots),
 	}
 
 	k3sServerConfig.K3sAgentConfig = K3sAgentConfig{
-		Token:           token,
-		Server:          serverURL,
-		KubeletArgs:     append(agentConfig.KubeletArgs, kubeletExtraArgs...),
-		NodeLabels:      agentConfig.NodeLabels,
-		NodeTaints:      agentConfig.NodeTaints,
-		PrivateRegistry: agentConfig.PrivateRegistry,
-		KubeProxyArgs:   agentConfig.KubeProxyArgs,
-		NodeName:        agentConfig.NodeName,
+		Token:            token,
+		Server:           serverURL,
+		KubeletArgs:      getKubeletArgs(serverConfig, agentConfig),
+		NodeLabels:       agentConfig.NodeLabels,
+		NodeTaints:       agentConfig.NodeTaints,
+		PrivateRegistry:  agentConfig.PrivateRegistry,
+		KubeProxyArgs:    agentConfig.KubeProxyArgs,
+		NodeName:         agentConfig.NodeName,
+		PreferBundledBin: agentConfig.PreferBundledBin,
+		VPNAuthFile:      getVPNAuthFile(agentConfig),
+		Docker:           agentConfig.Docker,
+		ResolvConf:       getResolvConf(agentConfig),
 	}
 
 	return k3sServerConfig
 }
 
 func GenerateWorkerConfig(serverURL string, token string, serverConfig bootstrapv1.KThreesServerConfig, agentConfig bootstrapv1.KThreesAgentConfig) K3sAgentConfig {
-	kubeletExtraArgs := getKubeletExtraArgs(serverConfig)
 	return K3sAgentConfig{
-		Server:          serverURL,
-		Token:           token,
-		KubeletArgs:     append(agentConfig.KubeletArgs, kubeletExtraArgs...),
-		NodeLabels:      agentConfig.NodeLabels,
-		NodeTaints:      agentConfig.NodeTaints,
-		PrivateRegistry: agentConfig.PrivateRegistry,
-		KubeProxyArgs:   agentConfig.KubeProxyArgs,
-		NodeName:        agentConfig.NodeName,
+		Server:           serverURL,
+		Token:            token,
+		KubeletArgs:      getKubeletArgs(serverConfig, agentConfig),
+		NodeLabels:       agentConfig.NodeLabels,
+		NodeTaints:       agentConfig.NodeTaints,
+		PrivateRegistry:  agentConfig.PrivateRegistry,
+		KubeProxyArgs:    agentConfig.KubeProxyArgs,
+		NodeName:         agentConfig.NodeName,
+		PreferBundledBin: agentConfig.PreferBundledBin,
+		VPNAuthFile:      getVPNAuthFile(agentConfig),
+		Docker:           agentConfig.Docker,
+		ResolvConf:       getResolvConf(agentConfig),
+	}
+}
+
+// nodeNameTemplateData are the fields available to the nodeName template of the Template node name strategy.
+type nodeNameTemplateData struct {
+	MachineName string
+	ClusterName string
+	Namespace   string
+}
+
+// NodeName returns the --node-name of the node of a machine according to the node name strategy of the agent config.
+// An empty name lets k3s use the host name.
+func NodeName(agentConfig bootstrapv1.KThreesAgentConfig, machineName, clusterName, namespace string) (string, error) {
+	switch agentConfig.NodeNameStrategy {
+	case bootstrapv1.NodeNameStrategyMachineName:
+		return machineName, nil
+	case bootstrapv1.NodeNameStrategyHostname:
+		return "", nil
+	case bootstrapv1.NodeNameStrategyTemplate:
+		tmpl, err := template.New("nodeName").Option("missingkey=error").Parse(agentConfig.NodeName)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse the node name template: %w", err)
+		}
+
+		var b strings.Builder
+		if err := tmpl.Execute(&b, nodeNameTemplateData{MachineName: machineName, ClusterName: clusterName, Namespace: namespace}); err != nil {
+			return "", fmt.Errorf("failed to render the node name template: %w", err)
+		}
+
+		nodeName := strings.TrimSpace(b.String())
+		if errs := validation.IsDNS1123Subdomain(nodeName); len(errs) > 0 {
+			return "", fmt.Errorf("rendered node name %q is invalid: %s", nodeName, strings.Join(errs, ", "))
+		}
+		return nodeName, nil
+	default:
+		return agentConfig.NodeName, nil
+	}
+}
+
+func getEtcdSnapshotConfig(etcdSnapshots *bootstrapv1.EtcdSnapshots) K3sEtcdSnapshotConfig {
+	if etcdSnapshots == nil {
+		return K3sEtcdSnapshotConfig{}
+	}
+
+	config := K3sEtcdSnapshotConfig{
+		EtcdSnapshotScheduleCron: etcdSnapshots.ScheduleCron,
+	}
+	if etcdSnapshots.Retention != nil {
+		config.EtcdSnapshotRetention = *etcdSnapshots.Retention
+	}
+	if s3 := etcdSnapshots.S3; s3 != nil {
+		config.EtcdS3 = true
+		config.EtcdS3Endpoint = s3.Endpoint
+		config.EtcdS3Bucket = s3.Bucket
+		config.EtcdS3Folder = s3.Folder
+		config.EtcdS3Region = s3.Region
+		config.EtcdS3ConfigSecret = s3.ConfigSecret
+	}
+	return config
+}
+
+func getVPNAuthFile(agentConfig bootstrapv1.KThreesAgentConfig) string {
+	if agentConfig.VPNAuth == nil {
+		return ""
+	}
+	return VPNAuthLocation
+}
+
+func getResolvConf(agentConfig bootstrapv1.KThreesAgentConfig) string {
+	if agentConfig.ResolvConf == nil {
+		return ""
+	}
+	return agentConfig.ResolvConf.Path
+}
+
+// GenerateVPNAuth returns the VPN authentication passed to k3s, given the auth key used to join the VPN.
+func GenerateVPNAuth(vpnAuth bootstrapv1.VPNAuth, joinKey string) string {
+	name := vpnAuth.Name
+	if name == "" {
+		name = "tailscale"
+	}
+
+	auth := fmt.Sprintf("name=%s,joinKey=%s", name, strings.TrimSpace(joinKey))
+	if vpnAuth.ControlServerURL != "" {
+		auth += fmt.Sprintf(",controlServerURL=%s", vpnAuth.ControlServerURL)
+	}
+	return auth
+}
+
+func getKubeAPIServerArgs(serverConfig bootstrapv1.KThreesServerConfig) []string {
+	args := append([]string{}, serverConfig.KubeAPIServerArgs...)
+	args = append(args, "anonymous-auth=true", getTLSCipherSuiteArg(serverConfig))
+	if serverConfig.TLSMinVersion != "" {
+		args = append(args, fmt.Sprintf("tls-min-version=%s", serverConfig.TLSMinVersion))
+	}
+	if serverConfig.KMSEncryption != nil {
+		args = append(args, fmt.Sprintf("encryption-provider-config=%s", KMSEncryptionConfigLocation))
+	}
+	return append(args, getAuditWebhookArgs(serverConfig.AuditWebhook)...)
+}
+
+// getKubeControllerManagerArgs returns the args of the typed controller manager settings, followed by
+// kubeControllerManagerArgs so that the latter take precedence.
+func getKubeControllerManagerArgs(serverConfig bootstrapv1.KThreesServerConfig) []string {
+	args := []string{}
+	if cm := serverConfig.ControllerManager; cm != nil {
+		if cm.NodeCIDRMaskSize != nil {
+			args = append(args, fmt.Sprintf("node-cidr-mask-size=%d", *cm.NodeCIDRMaskSize))
+		}
+		if cm.NodeMonitorGracePeriod != nil {
+			args = append(args, fmt.Sprintf("node-monitor-grace-period=%s", cm.NodeMonitorGracePeriod.Duration))
+		}
+		if cm.BindAddress != "" {
+			args = append(args, fmt.Sprintf("bind-address=%s", cm.BindAddress))
+		}
 	}
+	return append(args, serverConfig.KubeControllerManagerArgs...)
 }
 
-func getTLSCipherSuiteArg() string {
+// getKubeSchedulerArgs returns the args of the typed scheduler settings, followed by kubeSchedulerArgs
+// so that the latter take precedence.
+func getKubeSchedulerArgs(serverConfig bootstrapv1.KThreesServerConfig) []string {
+	args := []string{}
+	if serverConfig.Scheduler != nil && serverConfig.Scheduler.BindAddress != "" {
+		args = append(args, fmt.Sprintf("bind-address=%s", serverConfig.Scheduler.BindAddress))
+	}
+	return append(args, serverConfig.KubeSchedulerArgs...)
+}
+
+func getAuditWebhookArgs(auditWebhook *bootstrapv1.AuditWebhook) []string {
+	if auditWebhook == nil {
+		return nil
+	}
+
+	args := []string{fmt.Sprintf("audit-webhook-config-file=%s", AuditWebhookConfigLocation)}
+	if auditWebhook.Mode != "" {
+		args = append(args, fmt.Sprintf("audit-webhook-mode=%s", auditWebhook.Mode))
+	}
+	if auditWebhook.InitialBackoff != nil {
+		args = append(args, fmt.Sprintf("audit-webhook-initial-backoff=%s", auditWebhook.InitialBackoff.Duration))
+	}
+	if auditWebhook.BatchMaxSize != nil {
+		args = append(args, fmt.Sprintf("audit-webhook-batch-max-size=%d", *auditWebhook.BatchMaxSize))
+	}
+	if auditWebhook.BatchMaxWait != nil {
+		args = append(args, fmt.Sprintf("audit-webhook-batch-max-wait=%s", auditWebhook.BatchMaxWait.Duration))
+	}
+	return args
+}
+
+// getKubeletArgs returns the kubelet arguments. TLS arguments are only set when explicitly
+// configured so kubelets keep their own defaults otherwise.
+func getKubeletArgs(serverConfig bootstrapv1.KThreesServerConfig, agentConfig bootstrapv1.KThreesAgentConfig) []string {
+	args := append([]string{}, agentConfig.KubeletArgs...)
+	args = append(args, getKubeletExtraArgs(serverConfig)...)
+	if agentConfig.ServerTLSBootstrap {
+		args = append(args, "rotate-server-certificates=true")
+	}
+	if len(serverConfig.TLSCipherSuites) > 0 {
+		args = append(args, fmt.Sprintf("tls-cipher-suites=%s", strings.Join(serverConfig.TLSCipherSuites, ",")))
+	}
+	if serverConfig.TLSMinVersion != "" {
+		args = append(args, fmt.Sprintf("tls-min-version=%s", serverConfig.TLSMinVersion))
+	}
+	return args
+}
+
+func getTLSCipherSuiteArg(serverConfig bootstrapv1.KThreesServerConfig) string {
+	if len(serverConfig.TLSCipherSuites) > 0 {
+		return fmt.Sprintf("tls-cipher-suites=%s", strings.Join(serverConfig.TLSCipherSuites, ","))
+	}
+
 	/**
 	Can't use this method because k3s is using older apiserver pkgs that hardcode a subset of ciphers.
 	https://github.com/k3s-io/k3s/blob/master/vendor/k8s.io/component-base/cli/flag/ciphersuites_flag.go#L29
@@ -174,3 +412,100 @@ func getDisableCloudController(serverConfig bootstrapv1.KThreesServerConfig) boo
 	}
 	return *serverConfig.DisableCloudController
 }
+
+func getBindAddress(serverConfig bootstrapv1.KThreesServerConfig) string {
+	if serverConfig.BindAddress == "" && IsIPv6Only(serverConfig.ServiceCidr) {
+		return ipv6BindAddress
+	}
+	return serverConfig.BindAddress
+}
+
+// ServerURL returns the https URL for the given API endpoint, bracketing IPv6 literals.
+func ServerURL(endpoint clusterv1.APIEndpoint) string {
+	return fmt.Sprintf("https://%s", EndpointString(endpoint))
+}
+
+// EndpointString returns the HOST:PORT form of the given API endpoint. Unlike
+// clusterv1.APIEndpoint.String() it tolerates hosts that are already bracketed.
+func EndpointString(endpoint clusterv1.APIEndpoint) string {
+	return net.JoinHostPort(trimBrackets(endpoint.Host), strconv.Itoa(int(endpoint.Port)))
+}
+
+// IsIPv6Only returns true if the given comma separated list of CIDRs is not empty
+// and only contains IPv6 CIDRs.
+func IsIPv6Only(cidrs string) bool {
+	if cidrs == "" {
+		return false
+	}
+	for _, cidr := range strings.Split(cidrs, ",") {
+		ip, _, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil || ip.To4() != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func trimBrackets(host string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+}
+
+// GenerateSpareAgentConfig returns the configuration of the agent running on a spare control plane machine
+// until it is promoted, tainted so that workloads are not scheduled on it.
+func GenerateSpareAgentConfig(serverURL string, token string, serverConfig bootstrapv1.KThreesServerConfig, agentConfig bootstrapv1.KThreesAgentConfig) K3sAgentConfig {
+	spareAgentConfig := agentConfig.DeepCopy()
+	spareAgentConfig.NodeLabels = append(spareAgentConfig.NodeLabels, bootstrapv1.SpareControlPlaneLabel+"=true")
+	spareAgentConfig.NodeTaints = append(spareAgentConfig.NodeTaints, bootstrapv1.SpareControlPlaneLabel+"=true:NoSchedule")
+	return GenerateWorkerConfig(serverURL, token, serverConfig, *spareAgentConfig)
+}
+
+// GenerateSparePromotionScript returns the script promoting a spare control plane machine to a server, by replacing
+// the agent configuration with the staged server one, moving the staged static pod manifests to the static pod path
+// and reinstalling k3s as a server with the binary already there.
+func GenerateSparePromotionScript(agentConfig bootstrapv1.KThreesAgentConfig) string {
+	install := "curl -sfL https://get.k3s.io | INSTALL_K3S_SKIP_DOWNLOAD=true sh -s - server"
+	if agentConfig.AirGapped {
+		installScriptPath := agentConfig.AirGappedInstallScriptPath
+		if installScriptPath == "" {
+			installScriptPath = "/opt/install.sh"
+		}
+		install = fmt.Sprintf("INSTALL_K3S_SKIP_DOWNLOAD=true INSTALL_K3S_EXEC='server' sh %s", installScriptPath)
+	}
+
+	return fmt.Sprintf(`#!/bin/sh
+set -e
+cp %s %s
+if [ -d %[3]s ]; then mkdir -p %[4]s && cp %[3]s/*.yaml %[4]s/; fi
+systemctl disable --now k3s-agent
+%[5]s
+`, SpareConfigLocation, DefaultK3sConfigLocation, SpareStaticPodManifestsLocation, StaticPodManifestsLocation, install)
+}
+
+// NodeConfigFiles returns the k3s configuration files of a node: the k3s configuration file and, when it is
+// part of the files, the private registry configuration. Encoded files are left out, as they are not compared
+// with the files on the node.
+func NodeConfigFiles(configFile bootstrapv1.File, files []bootstrapv1.File, agentConfig bootstrapv1.KThreesAgentConfig) []bootstrapv1.File {
+	registriesPath := agentConfig.PrivateRegistry
+	if registriesPath == "" {
+		registriesPath = DefaultRegistriesConfigLocation
+	}
+
+	nodeConfigFiles := []bootstrapv1.File{configFile}
+	for _, file := range files {
+		if file.Path == registriesPath && file.Encoding == "" {
+			nodeConfigFiles = append(nodeConfigFiles, file)
+		}
+	}
+	return nodeConfigFiles
+}
+
+// NodeConfigContent returns the content of a file as written by cloud-init, which keeps a single trailing newline.
+func NodeConfigContent(content string) string {
+	return strings.TrimRight(content, "\n") + "\n"
+}
+
+// NodeConfigChecksum returns the sha256 checksum of the content of a file as written by cloud-init.
+func NodeConfigChecksum(content string) string {
+	sum := sha256.Sum256([]byte(NodeConfigContent(content)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,104 @@
+package k3s
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	bootstrapv1 "github.com/k3s-io/cluster-api-k3s/bootstrap/api/v1beta2"
+)
+
+func TestGenerateSpareAgentConfig(t *testing.T) {
+	g := NewWithT(t)
+
+	agentConfig := bootstrapv1.KThreesAgentConfig{
+		NodeLabels: []string{"role=spare"},
+		NodeTaints: []string{"example.com/other=true:NoSchedule"},
+	}
+	config := GenerateSpareAgentConfig("https://example.com:6443", "token", bootstrapv1.KThreesServerConfig{}, agentConfig)
+
+	g.Expect(config.Server).To(Equal("https://example.com:6443"))
+	g.Expect(config.Token).To(Equal("token"))
+	g.Expect(config.NodeLabels).To(ConsistOf("role=spare", bootstrapv1.SpareControlPlaneLabel+"=true"))
+	g.Expect(config.NodeTaints).To(ConsistOf("example.com/other=true:NoSchedule", bootstrapv1.SpareControlPlaneLabel+"=true:NoSchedule"))
+
+	// the agent config of the machine template is left untouched.
+	g.Expect(agentConfig.NodeLabels).To(Equal([]string{"role=spare"}))
+	g.Expect(agentConfig.NodeTaints).To(Equal([]string{"example.com/other=true:NoSchedule"}))
+}
+
+func TestGenerateSparePromotionScript(t *testing.T) {
+	tests := []struct {
+		name        string
+		agentConfig bootstrapv1.KThreesAgentConfig
+		install     string
+	}{
+		{
+			name:    "online install",
+			install: "curl -sfL https://get.k3s.io | INSTALL_K3S_SKIP_DOWNLOAD=true sh -s - server",
+		},
+		{
+			name:        "airgapped install with the default install script",
+			agentConfig: bootstrapv1.KThreesAgentConfig{AirGapped: true},
+			install:     "INSTALL_K3S_SKIP_DOWNLOAD=true INSTALL_K3S_EXEC='server' sh /opt/install.sh",
+		},
+		{
+			name:        "airgapped install with a custom install script",
+			agentConfig: bootstrapv1.KThreesAgentConfig{AirGapped: true, AirGappedInstallScriptPath: "/usr/local/bin/install.sh"},
+			install:     "INSTALL_K3S_SKIP_DOWNLOAD=true INSTALL_K3S_EXEC='server' sh /usr/local/bin/install.sh",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			lines := strings.Split(strings.TrimSpace(GenerateSparePromotionScript(tt.agentConfig)), "\n")
+			g.Expect(lines).To(Equal([]string{
+				"#!/bin/sh",
+				"set -e",
+				"cp " + SpareConfigLocation + " " + DefaultK3sConfigLocation,
+				"if [ -d " + SpareStaticPodManifestsLocation + " ]; then mkdir -p " + StaticPodManifestsLocation + " && cp " + SpareStaticPodManifestsLocation + "/*.yaml " + StaticPodManifestsLocation + "/; fi",
+				"systemctl disable --now k3s-agent",
+				tt.install,
+			}))
+		})
+	}
+}
+
+func TestGetAuditWebhookArgs(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(getAuditWebhookArgs(nil)).To(BeEmpty())
+
+	// only the kubeconfig is passed by default, the apiserver defaults apply to the other settings.
+	auditWebhook := &bootstrapv1.AuditWebhook{
+		KubeconfigFrom: bootstrapv1.SecretFileSource{Name: "audit-webhook", Key: "kubeconfig"},
+	}
+	g.Expect(getAuditWebhookArgs(auditWebhook)).To(Equal([]string{"audit-webhook-config-file=" + AuditWebhookConfigLocation}))
+
+	auditWebhook.Mode = "blocking"
+	auditWebhook.InitialBackoff = &metav1.Duration{Duration: 5 * time.Second}
+	auditWebhook.BatchMaxSize = ptr.To[int32](100)
+	auditWebhook.BatchMaxWait = &metav1.Duration{Duration: time.Minute}
+	g.Expect(getAuditWebhookArgs(auditWebhook)).To(Equal([]string{
+		"audit-webhook-config-file=" + AuditWebhookConfigLocation,
+		"audit-webhook-mode=blocking",
+		"audit-webhook-initial-backoff=5s",
+		"audit-webhook-batch-max-size=100",
+		"audit-webhook-batch-max-wait=1m0s",
+	}))
+
+	// the args are passed to the apiserver after the user provided ones.
+	serverConfig := bootstrapv1.KThreesServerConfig{
+		KubeAPIServerArgs: []string{"audit-log-maxage=30"},
+		AuditWebhook:      auditWebhook,
+	}
+	args := GenerateInitControlPlaneConfig("example.com", "token", serverConfig, bootstrapv1.KThreesAgentConfig{}).KubeAPIServerArgs
+	g.Expect(args[0]).To(Equal("audit-log-maxage=30"))
+	g.Expect(args).To(ContainElements(getAuditWebhookArgs(auditWebhook)))
+}
@@ -20,7 +20,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 
+	"github.com/blang/semver/v4"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -122,7 +124,8 @@ func (c *ControlPlane) FailureDomains() clusterv1.FailureDomains {
 
 // Version returns the KThreesControlPlane's version.
 func (c *ControlPlane) Version() *string {
-	return &c.KCP.Spec.Version
+	version := c.KCP.K3sVersion()
+	return &version
 }
 
 // InfrastructureTemplate returns the KThreesControlPlane's infrastructure template.
@@ -234,6 +237,15 @@ func ControlPlaneLabelsForCluster(clusterName string, machineTemplate controlpla
 	return labels
 }
 
+// SpareLabelsForCluster returns a set of labels to add to a spare control plane machine for this specific cluster.
+// Spare machines are not control plane machines until they are promoted, which replaces these labels.
+func SpareLabelsForCluster(clusterName string, machineTemplate controlplanev1.KThreesControlPlaneMachineTemplate) map[string]string {
+	labels := ControlPlaneLabelsForCluster(clusterName, machineTemplate)
+	delete(labels, clusterv1.MachineControlPlaneLabel)
+	labels[bootstrapv1.SpareControlPlaneLabel] = ""
+	return labels
+}
+
 // NewMachine returns a machine configured to be a part of the control plane.
 func (c *ControlPlane) NewMachine(infraRef, bootstrapRef *corev1.ObjectReference, failureDomain *string) *clusterv1.Machine {
 	return &clusterv1.Machine{
@@ -288,9 +300,115 @@ func (c *ControlPlane) MachinesNeedingRollout() collections.Machines {
 		collections.ShouldRolloutAfter(&c.reconciliationTime, c.KCP.Spec.RolloutAfter),
 		// Machines that do not match with KCP config.
 		collections.Not(machinefilters.MatchesKCPConfiguration(c.InfraResources, c.KthreesConfigs, c.KCP)),
+		// Machines bootstrapped with a previous control plane endpoint.
+		collections.Not(machinefilters.MatchesControlPlaneEndpoint(EndpointString(c.Cluster.Spec.ControlPlaneEndpoint))),
 	)
 }
 
+// RolloutPlan returns the machines that need to be rolled out, oldest first, with the reasons why.
+func (c *ControlPlane) RolloutPlan() []controlplanev1.MachineRolloutPlan {
+	checks := []struct {
+		reason  controlplanev1.RolloutReason
+		matches collections.Func
+	}{
+		{controlplanev1.RolloutReasonVersionChanged, machinefilters.MatchesKubernetesVersion(c.KCP.K3sVersion())},
+		{controlplanev1.RolloutReasonInfrastructureTemplateChanged, machinefilters.MatchesTemplateClonedFrom(c.InfraResources, c.KCP)},
+		{controlplanev1.RolloutReasonKThreesConfigChanged, machinefilters.MatchesKThreesBootstrapConfig(c.KthreesConfigs, c.KCP)},
+		{controlplanev1.RolloutReasonRolloutAfterExpired, collections.Not(collections.ShouldRolloutAfter(&c.reconciliationTime, c.KCP.Spec.RolloutAfter))},
+		{controlplanev1.RolloutReasonControlPlaneEndpointChanged, machinefilters.MatchesControlPlaneEndpoint(EndpointString(c.Cluster.Spec.ControlPlaneEndpoint))},
+	}
+
+	plan := []controlplanev1.MachineRolloutPlan{}
+	for _, machine := range c.MachinesNeedingRollout().SortedByCreationTimestamp() {
+		reasons := []controlplanev1.RolloutReason{}
+		for _, check := range checks {
+			if !check.matches(machine) {
+				reasons = append(reasons, check.reason)
+			}
+		}
+		plan = append(plan, controlplanev1.MachineRolloutPlan{Machine: machine.Name, Reasons: reasons})
+	}
+	return plan
+}
+
+// MachineVersions returns the k3s versions running on the nodes of the machines, sorted by machine name,
+// given the versions reported by the nodes by node name. Machines without a node are skipped.
+func (c *ControlPlane) MachineVersions(nodeVersions map[string]string) []controlplanev1.MachineVersion {
+	versions := []controlplanev1.MachineVersion{}
+	for _, machine := range c.Machines {
+		if machine.Status.NodeRef == nil {
+			continue
+		}
+		if version, ok := nodeVersions[machine.Status.NodeRef.Name]; ok {
+			versions = append(versions, controlplanev1.MachineVersion{Machine: machine.Name, Version: version})
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Machine < versions[j].Machine
+	})
+	return versions
+}
+
+// FailureDomainDistribution returns the number of machines, ignoring the ones being deleted, in each control plane
+// failure domain of the cluster, sorted by failure domain, or nil if the cluster has no control plane failure domains.
+func (c *ControlPlane) FailureDomainDistribution() *controlplanev1.FailureDomainsStatus {
+	failureDomains := c.FailureDomains().FilterControlPlane()
+	if len(failureDomains) == 0 {
+		return nil
+	}
+
+	counts := map[string]int32{}
+	for id := range failureDomains {
+		counts[id] = 0
+	}
+	balanced := true
+	for _, machine := range c.Machines.Filter(collections.Not(collections.HasDeletionTimestamp)) {
+		if machine.Spec.FailureDomain == nil {
+			balanced = false
+			continue
+		}
+		if _, ok := counts[*machine.Spec.FailureDomain]; !ok {
+			balanced = false
+			continue
+		}
+		counts[*machine.Spec.FailureDomain]++
+	}
+
+	status := &controlplanev1.FailureDomainsStatus{}
+	minMachines, maxMachines := int32(-1), int32(0)
+	for id, count := range counts {
+		status.Machines = append(status.Machines, controlplanev1.FailureDomainMachines{Name: id, Machines: count})
+		if minMachines < 0 || count < minMachines {
+			minMachines = count
+		}
+		if count > maxMachines {
+			maxMachines = count
+		}
+	}
+	sort.Slice(status.Machines, func(i, j int) bool {
+		return status.Machines[i].Name < status.Machines[j].Name
+	})
+	status.Balanced = balanced && maxMachines-minMachines <= 1
+	return status
+}
+
+// LowestMachineVersion returns the lowest of the machine versions, or nil if none of them is a valid version.
+func LowestMachineVersion(versions []controlplanev1.MachineVersion) *string {
+	var lowest *string
+	var lowestVersion semver.Version
+	for i := range versions {
+		v, err := semver.ParseTolerant(versions[i].Version)
+		if err != nil {
+			continue
+		}
+		if lowest == nil || v.LT(lowestVersion) {
+			lowest = &versions[i].Version
+			lowestVersion = v
+		}
+	}
+	return lowest
+}
+
 // UpToDateMachines returns the machines that are up to date with the control
 // plane's configuration and therefore do not require rollout.
 func (c *ControlPlane) UpToDateMachines() collections.Machines {
@@ -361,6 +479,7 @@ func (c *ControlPlane) PatchMachines(ctx context.Context) error {
 			if err := helper.Patch(ctx, machine, patch.WithOwnedConditions{Conditions: []clusterv1.ConditionType{
 				controlplanev1.MachineAgentHealthyCondition,
 				controlplanev1.MachineEtcdMemberHealthyCondition,
+				controlplanev1.MachineK3sServiceHealthyCondition,
 			}}); err != nil {
 				errList = append(errList, fmt.Errorf("failed to patch machine %s: %w", machine.Name, err))
 			}
@@ -0,0 +1,263 @@
+package k3s
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/collections"
+
+	bootstrapv1 "github.com/k3s-io/cluster-api-k3s/bootstrap/api/v1beta2"
+	controlplanev1 "github.com/k3s-io/cluster-api-k3s/controlplane/api/v1beta2"
+)
+
+// newTestControlPlane returns a control plane whose machines are up to date with the KThreesControlPlane.
+func newTestControlPlane(names ...string) *ControlPlane {
+	kcp := &controlplanev1.KThreesControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "kcp", Namespace: metav1.NamespaceDefault},
+		Spec: controlplanev1.KThreesControlPlaneSpec{
+			Version: "v1.30.4+k3s1",
+			MachineTemplate: controlplanev1.KThreesControlPlaneMachineTemplate{
+				InfrastructureRef: corev1.ObjectReference{Kind: "GenericInfrastructureMachineTemplate", Name: "infra-template"},
+			},
+		},
+	}
+	c := &ControlPlane{
+		KCP:            kcp,
+		Cluster:        &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: metav1.NamespaceDefault}},
+		Machines:       collections.New(),
+		KthreesConfigs: map[string]*bootstrapv1.KThreesConfig{},
+		InfraResources: map[string]*unstructured.Unstructured{},
+
+		reconciliationTime: metav1.Now(),
+	}
+	for i, name := range names {
+		machine := &clusterv1.Machine{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         kcp.Namespace,
+				CreationTimestamp: metav1.Unix(int64(i), 0),
+			},
+			Spec: clusterv1.MachineSpec{
+				Version: ptr.To(kcp.Spec.Version),
+				Bootstrap: clusterv1.Bootstrap{
+					ConfigRef: &corev1.ObjectReference{Kind: "KThreesConfig", Name: name},
+				},
+			},
+		}
+		c.Machines.Insert(machine)
+		c.KthreesConfigs[name] = &bootstrapv1.KThreesConfig{Spec: *kcp.Spec.KThreesConfigSpec.DeepCopy()}
+		infraMachine := &unstructured.Unstructured{}
+		infraMachine.SetAnnotations(map[string]string{
+			clusterv1.TemplateClonedFromNameAnnotation:      kcp.Spec.MachineTemplate.InfrastructureRef.Name,
+			clusterv1.TemplateClonedFromGroupKindAnnotation: kcp.Spec.MachineTemplate.InfrastructureRef.GroupVersionKind().GroupKind().String(),
+		})
+		c.InfraResources[name] = infraMachine
+	}
+	return c
+}
+
+func TestMachinesNeedingRollout(t *testing.T) {
+	tests := []struct {
+		name          string
+		mutate        func(c *ControlPlane)
+		expectRollout []string
+	}{
+		{
+			name: "up to date machines",
+		},
+		{
+			name: "IPv6 CIDRs derived from the cluster network by the bootstrap controller",
+			mutate: func(c *ControlPlane) {
+				for _, config := range c.KthreesConfigs {
+					config.Spec.ServerConfig.ClusterCidr = "fd00:42::/56"
+					config.Spec.ServerConfig.ServiceCidr = "fd00:43::/112"
+				}
+			},
+		},
+		{
+			name: "CIDRs changed on the KThreesControlPlane",
+			mutate: func(c *ControlPlane) {
+				c.KCP.Spec.KThreesConfigSpec.ServerConfig.ClusterCidr = "fd00:44::/56"
+				c.KthreesConfigs["m1"].Spec.ServerConfig.ClusterCidr = "fd00:44::/56"
+			},
+			expectRollout: []string{"m2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			c := newTestControlPlane("m1", "m2")
+			if tt.mutate != nil {
+				tt.mutate(c)
+			}
+			g.Expect(c.MachinesNeedingRollout().Names()).To(ConsistOf(tt.expectRollout))
+		})
+	}
+}
+
+func TestRolloutPlan(t *testing.T) {
+	tests := []struct {
+		name       string
+		mutate     func(c *ControlPlane)
+		expectPlan []controlplanev1.MachineRolloutPlan
+	}{
+		{
+			name:       "up to date machines",
+			expectPlan: []controlplanev1.MachineRolloutPlan{},
+		},
+		{
+			name: "version changed",
+			mutate: func(c *ControlPlane) {
+				c.KCP.Spec.Version = "v1.31.0+k3s1"
+			},
+			expectPlan: []controlplanev1.MachineRolloutPlan{
+				{Machine: "m1", Reasons: []controlplanev1.RolloutReason{controlplanev1.RolloutReasonVersionChanged}},
+				{Machine: "m2", Reasons: []controlplanev1.RolloutReason{controlplanev1.RolloutReasonVersionChanged}},
+			},
+		},
+		{
+			name: "infrastructure template changed",
+			mutate: func(c *ControlPlane) {
+				c.KCP.Spec.MachineTemplate.InfrastructureRef.Name = "infra-template-v2"
+			},
+			expectPlan: []controlplanev1.MachineRolloutPlan{
+				{Machine: "m1", Reasons: []controlplanev1.RolloutReason{controlplanev1.RolloutReasonInfrastructureTemplateChanged}},
+				{Machine: "m2", Reasons: []controlplanev1.RolloutReason{controlplanev1.RolloutReasonInfrastructureTemplateChanged}},
+			},
+		},
+		{
+			name: "config changed on a single machine",
+			mutate: func(c *ControlPlane) {
+				c.KthreesConfigs["m2"].Spec.PostK3sCommands = []string{"echo done"}
+			},
+			expectPlan: []controlplanev1.MachineRolloutPlan{
+				{Machine: "m2", Reasons: []controlplanev1.RolloutReason{controlplanev1.RolloutReasonKThreesConfigChanged}},
+			},
+		},
+		{
+			name: "rolloutAfter expired",
+			mutate: func(c *ControlPlane) {
+				c.KCP.Spec.RolloutAfter = &metav1.Time{Time: c.reconciliationTime.Add(-time.Minute)}
+			},
+			expectPlan: []controlplanev1.MachineRolloutPlan{
+				{Machine: "m1", Reasons: []controlplanev1.RolloutReason{controlplanev1.RolloutReasonRolloutAfterExpired}},
+				{Machine: "m2", Reasons: []controlplanev1.RolloutReason{controlplanev1.RolloutReasonRolloutAfterExpired}},
+			},
+		},
+		{
+			name: "control plane endpoint changed and several reasons, oldest machine first",
+			mutate: func(c *ControlPlane) {
+				c.Machines["m1"].Annotations = map[string]string{controlplanev1.ControlPlaneEndpointAnnotation: "old.example.com:6443"}
+				c.Machines["m1"].Spec.Version = ptr.To("v1.29.8+k3s1")
+				c.Machines["m2"].Spec.Version = ptr.To("v1.29.8+k3s1")
+			},
+			expectPlan: []controlplanev1.MachineRolloutPlan{
+				{Machine: "m1", Reasons: []controlplanev1.RolloutReason{controlplanev1.RolloutReasonVersionChanged, controlplanev1.RolloutReasonControlPlaneEndpointChanged}},
+				{Machine: "m2", Reasons: []controlplanev1.RolloutReason{controlplanev1.RolloutReasonVersionChanged}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			c := newTestControlPlane("m1", "m2")
+			if tt.mutate != nil {
+				tt.mutate(c)
+			}
+			g.Expect(c.RolloutPlan()).To(Equal(tt.expectPlan))
+		})
+	}
+}
+
+func TestFailureDomainDistribution(t *testing.T) {
+	failureDomains := clusterv1.FailureDomains{
+		"fd1":     clusterv1.FailureDomainSpec{ControlPlane: true},
+		"fd2":     clusterv1.FailureDomainSpec{ControlPlane: true},
+		"workers": clusterv1.FailureDomainSpec{},
+	}
+
+	tests := []struct {
+		name           string
+		failureDomains clusterv1.FailureDomains
+		machines       map[string]*string
+		deleting       []string
+		expectStatus   *controlplanev1.FailureDomainsStatus
+	}{
+		{
+			name:     "no control plane failure domains",
+			machines: map[string]*string{"m1": nil},
+		},
+		{
+			name:           "balanced machines",
+			failureDomains: failureDomains,
+			machines:       map[string]*string{"m1": ptr.To("fd1"), "m2": ptr.To("fd2"), "m3": ptr.To("fd1")},
+			expectStatus: &controlplanev1.FailureDomainsStatus{
+				Machines: []controlplanev1.FailureDomainMachines{{Name: "fd1", Machines: 2}, {Name: "fd2", Machines: 1}},
+				Balanced: true,
+			},
+		},
+		{
+			name:           "spread above one",
+			failureDomains: failureDomains,
+			machines:       map[string]*string{"m1": ptr.To("fd1"), "m2": ptr.To("fd1"), "m3": ptr.To("fd1")},
+			expectStatus: &controlplanev1.FailureDomainsStatus{
+				Machines: []controlplanev1.FailureDomainMachines{{Name: "fd1", Machines: 3}, {Name: "fd2", Machines: 0}},
+			},
+		},
+		{
+			name:           "machine without failure domain",
+			failureDomains: failureDomains,
+			machines:       map[string]*string{"m1": ptr.To("fd1"), "m2": nil},
+			expectStatus: &controlplanev1.FailureDomainsStatus{
+				Machines: []controlplanev1.FailureDomainMachines{{Name: "fd1", Machines: 1}, {Name: "fd2", Machines: 0}},
+			},
+		},
+		{
+			name:           "machine in an unknown failure domain",
+			failureDomains: failureDomains,
+			machines:       map[string]*string{"m1": ptr.To("fd1"), "m2": ptr.To("fd3")},
+			expectStatus: &controlplanev1.FailureDomainsStatus{
+				Machines: []controlplanev1.FailureDomainMachines{{Name: "fd1", Machines: 1}, {Name: "fd2", Machines: 0}},
+			},
+		},
+		{
+			name:           "machines being deleted are not counted",
+			failureDomains: failureDomains,
+			machines:       map[string]*string{"m1": ptr.To("fd1"), "m2": ptr.To("fd2"), "m3": ptr.To("fd1"), "m4": ptr.To("fd1"), "m5": nil},
+			deleting:       []string{"m3", "m5"},
+			expectStatus: &controlplanev1.FailureDomainsStatus{
+				Machines: []controlplanev1.FailureDomainMachines{{Name: "fd1", Machines: 2}, {Name: "fd2", Machines: 1}},
+				Balanced: true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			c := newTestControlPlane()
+			c.Cluster.Status.FailureDomains = tt.failureDomains
+			for name, failureDomain := range tt.machines {
+				c.Machines.Insert(&clusterv1.Machine{
+					ObjectMeta: metav1.ObjectMeta{Name: name},
+					Spec:       clusterv1.MachineSpec{FailureDomain: failureDomain},
+				})
+			}
+			for _, name := range tt.deleting {
+				c.Machines[name].DeletionTimestamp = ptr.To(metav1.Now())
+			}
+			g.Expect(c.FailureDomainDistribution()).To(Equal(tt.expectStatus))
+		})
+	}
+}
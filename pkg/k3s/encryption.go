@@ -0,0 +1,112 @@
+package k3s
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/yaml"
+
+	bootstrapv1 "github.com/k3s-io/cluster-api-k3s/bootstrap/api/v1beta2"
+)
+
+const (
+	// KMSEncryptionConfigLocation is where the EncryptionConfiguration using the KMS provider is written on servers.
+	KMSEncryptionConfigLocation = "/var/lib/rancher/k3s/server/kms-encryption-config.yaml"
+
+	// KMSPluginManifestsLocation is where the KMS plugin manifests are written, so k3s deploys them on start.
+	KMSPluginManifestsLocation = "/var/lib/rancher/k3s/server/manifests/kms-plugin.yaml"
+
+	defaultKMSTimeout = "3s"
+)
+
+var defaultKMSResources = []string{"secrets"}
+
+type encryptionConfiguration struct {
+	APIVersion string                  `json:"apiVersion"`
+	Kind       string                  `json:"kind"`
+	Resources  []resourceConfiguration `json:"resources"`
+}
+
+type resourceConfiguration struct {
+	Resources []string                `json:"resources"`
+	Providers []providerConfiguration `json:"providers"`
+}
+
+type providerConfiguration struct {
+	KMS      *kmsConfiguration `json:"kms,omitempty"`
+	Identity *struct{}         `json:"identity,omitempty"`
+}
+
+type kmsConfiguration struct {
+	APIVersion string `json:"apiVersion"`
+	Name       string `json:"name"`
+	Endpoint   string `json:"endpoint"`
+	Timeout    string `json:"timeout"`
+}
+
+// GenerateKMSEncryptionFiles returns the files needed on servers to encrypt resources with the configured
+// KMS v2 provider: the EncryptionConfiguration and, if any, the KMS plugin manifests.
+func GenerateKMSEncryptionFiles(serverConfig bootstrapv1.KThreesServerConfig) ([]bootstrapv1.File, error) {
+	kms := serverConfig.KMSEncryption
+	if kms == nil {
+		return nil, nil
+	}
+
+	resources := kms.Resources
+	if len(resources) == 0 {
+		resources = defaultKMSResources
+	}
+
+	timeout := defaultKMSTimeout
+	if kms.Timeout != nil {
+		timeout = kms.Timeout.Duration.String()
+	}
+
+	// identity is kept as the last provider so resources written before KMS was enabled can still be read.
+	config := encryptionConfiguration{
+		APIVersion: "apiserver.config.k8s.io/v1",
+		Kind:       "EncryptionConfiguration",
+		Resources: []resourceConfiguration{
+			{
+				Resources: resources,
+				Providers: []providerConfiguration{
+					{
+						KMS: &kmsConfiguration{
+							APIVersion: "v2",
+							Name:       kms.Name,
+							Endpoint:   kms.Endpoint,
+							Timeout:    timeout,
+						},
+					},
+					{
+						Identity: &struct{}{},
+					},
+				},
+			},
+		},
+	}
+
+	b, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal encryption configuration: %w", err)
+	}
+
+	files := []bootstrapv1.File{
+		{
+			Path:        KMSEncryptionConfigLocation,
+			Content:     string(b),
+			Owner:       "root:root",
+			Permissions: "0600",
+		},
+	}
+
+	if kms.PluginManifests != "" {
+		files = append(files, bootstrapv1.File{
+			Path:        KMSPluginManifestsLocation,
+			Content:     kms.PluginManifests,
+			Owner:       "root:root",
+			Permissions: "0640",
+		})
+	}
+
+	return files, nil
+}
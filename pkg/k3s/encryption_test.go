@@ -0,0 +1,70 @@
+package k3s
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	bootstrapv1 "github.com/k3s-io/cluster-api-k3s/bootstrap/api/v1beta2"
+)
+
+func TestGenerateKMSEncryptionFiles(t *testing.T) {
+	g := NewWithT(t)
+
+	// without a KMS provider the k3s built-in secrets encryption is used.
+	files, err := GenerateKMSEncryptionFiles(bootstrapv1.KThreesServerConfig{})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(files).To(BeEmpty())
+
+	// the EncryptionConfiguration defaults to encrypting secrets, keeping identity to read unencrypted resources.
+	serverConfig := bootstrapv1.KThreesServerConfig{
+		KMSEncryption: &bootstrapv1.KMSEncryption{
+			Name:     "vault",
+			Endpoint: "unix:///var/run/kmsplugin/socket.sock",
+		},
+	}
+	files, err = GenerateKMSEncryptionFiles(serverConfig)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(files).To(HaveLen(1))
+	g.Expect(files[0].Path).To(Equal(KMSEncryptionConfigLocation))
+	g.Expect(files[0].Permissions).To(Equal("0600"))
+
+	config := encryptionConfiguration{}
+	g.Expect(yaml.Unmarshal([]byte(files[0].Content), &config)).To(Succeed())
+	g.Expect(config.APIVersion).To(Equal("apiserver.config.k8s.io/v1"))
+	g.Expect(config.Kind).To(Equal("EncryptionConfiguration"))
+	g.Expect(config.Resources).To(HaveLen(1))
+	g.Expect(config.Resources[0].Resources).To(Equal([]string{"secrets"}))
+	g.Expect(config.Resources[0].Providers).To(HaveLen(2))
+	g.Expect(config.Resources[0].Providers[0].KMS).To(Equal(&kmsConfiguration{
+		APIVersion: "v2",
+		Name:       "vault",
+		Endpoint:   "unix:///var/run/kmsplugin/socket.sock",
+		Timeout:    "3s",
+	}))
+	g.Expect(config.Resources[0].Providers[1].Identity).ToNot(BeNil())
+
+	// the apiserver is configured with the EncryptionConfiguration.
+	g.Expect(GenerateInitControlPlaneConfig("example.com", "token", serverConfig, bootstrapv1.KThreesAgentConfig{}).KubeAPIServerArgs).
+		To(ContainElement("encryption-provider-config=" + KMSEncryptionConfigLocation))
+	g.Expect(GenerateJoinControlPlaneConfig("https://example.com:6443", "token", "example.com", serverConfig, bootstrapv1.KThreesAgentConfig{}).KubeAPIServerArgs).
+		To(ContainElement("encryption-provider-config=" + KMSEncryptionConfigLocation))
+	g.Expect(GenerateInitControlPlaneConfig("example.com", "token", bootstrapv1.KThreesServerConfig{}, bootstrapv1.KThreesAgentConfig{}).KubeAPIServerArgs).
+		ToNot(ContainElement(HavePrefix("encryption-provider-config=")))
+
+	// the configured resources, timeout and plugin manifests are used.
+	serverConfig.KMSEncryption.Timeout = &metav1.Duration{Duration: 10 * time.Second}
+	serverConfig.KMSEncryption.Resources = []string{"secrets", "configmaps"}
+	serverConfig.KMSEncryption.PluginManifests = "apiVersion: apps/v1\nkind: DaemonSet\n"
+	files, err = GenerateKMSEncryptionFiles(serverConfig)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(files).To(HaveLen(2))
+	g.Expect(yaml.Unmarshal([]byte(files[0].Content), &config)).To(Succeed())
+	g.Expect(config.Resources[0].Resources).To(Equal([]string{"secrets", "configmaps"}))
+	g.Expect(config.Resources[0].Providers[0].KMS.Timeout).To(Equal("10s"))
+	g.Expect(files[1].Path).To(Equal(KMSPluginManifestsLocation))
+	g.Expect(files[1].Content).To(Equal("apiVersion: apps/v1\nkind: DaemonSet\n"))
+}
@@ -90,8 +90,9 @@ func (m *Management) GetWorkloadCluster(ctx context.Context, clusterKey client.O
 	}
 
 	workload := &Workload{
-		Client:          c,
-		CoreDNSMigrator: &CoreDNSMigrator{},
+		Client:           c,
+		ClientRestConfig: restConfig,
+		CoreDNSMigrator:  &CoreDNSMigrator{},
 	}
 
 	// Retrieves the etcd CA key Pair
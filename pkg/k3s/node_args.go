@@ -0,0 +1,100 @@
+package k3s
+
+import (
+	"slices"
+	"strings"
+
+	bootstrapv1 "github.com/k3s-io/cluster-api-k3s/bootstrap/api/v1beta2"
+)
+
+const (
+	// defaultClusterCidr and defaultServiceCidr are the CIDRs k3s uses when none is configured.
+	defaultClusterCidr = "10.42.0.0/16"
+	defaultServiceCidr = "10.43.0.0/16"
+)
+
+// ParseNodeArgs returns the values of each flag of the arguments k3s runs with, as listed in the k3s.io/node-args
+// annotation of the nodes, flags set in the k3s configuration file included. Both --flag value and --flag=value
+// forms are supported.
+func ParseNodeArgs(args []string) map[string][]string {
+	flags := map[string][]string{}
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "--") {
+			continue
+		}
+
+		name, value, ok := strings.Cut(strings.TrimPrefix(args[i], "--"), "=")
+		if !ok && i+1 < len(args) && !strings.HasPrefix(args[i+1], "--") {
+			value = args[i+1]
+			i++
+		}
+		flags[name] = append(flags[name], value)
+	}
+	return flags
+}
+
+// ServerConfigDrift compares the settings of the server configuration that k3s only reads on start, or never
+// changes on an existing cluster, with the flags of a server. It returns the names of the settings that differ and,
+// among them, the ones that cannot be changed on an existing cluster.
+func ServerConfigDrift(serverConfig bootstrapv1.KThreesServerConfig, flags map[string][]string) ([]string, []string) {
+	changed, immutable := []string{}, []string{}
+
+	if !cidrsEqual(serverConfig.ClusterCidr, lastFlag(flags, "cluster-cidr"), defaultClusterCidr) {
+		changed = append(changed, "clusterCidr")
+		immutable = append(immutable, "clusterCidr")
+	}
+	if !cidrsEqual(serverConfig.ServiceCidr, lastFlag(flags, "service-cidr"), defaultServiceCidr) {
+		changed = append(changed, "serviceCidr")
+		immutable = append(immutable, "serviceCidr")
+	}
+
+	disabled := []string{}
+	for _, value := range flags["disable"] {
+		disabled = append(disabled, splitList(value)...)
+	}
+	desiredDisabled := slices.Clone(serverConfig.DisableComponents)
+	slices.Sort(disabled)
+	slices.Sort(desiredDisabled)
+	if !slices.Equal(slices.Compact(disabled), slices.Compact(desiredDisabled)) {
+		changed = append(changed, "disableComponents")
+	}
+
+	kmsEncryption := slices.ContainsFunc(flags["kube-apiserver-arg"], func(arg string) bool {
+		return strings.HasPrefix(arg, "encryption-provider-config=")
+	})
+	if kmsEncryption != (serverConfig.KMSEncryption != nil) {
+		changed = append(changed, "kmsEncryption")
+	}
+
+	return changed, immutable
+}
+
+// lastFlag returns the last value of a flag, the one k3s uses, or an empty string if it is not set.
+func lastFlag(flags map[string][]string, name string) string {
+	values := flags[name]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
+
+// cidrsEqual compares two comma separated lists of CIDRs, an empty list standing for the default CIDR.
+func cidrsEqual(a, b, defaultCIDR string) bool {
+	if a == "" {
+		a = defaultCIDR
+	}
+	if b == "" {
+		b = defaultCIDR
+	}
+	return slices.Equal(splitList(a), splitList(b))
+}
+
+func splitList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
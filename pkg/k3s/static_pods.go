@@ -0,0 +1,30 @@
+package k3s
+
+import (
+	"path"
+
+	bootstrapv1 "github.com/k3s-io/cluster-api-k3s/bootstrap/api/v1beta2"
+)
+
+const (
+	// StaticPodManifestsLocation is the static pod path of the kubelet embedded in k3s.
+	StaticPodManifestsLocation = "/var/lib/rancher/k3s/agent/pod-manifests"
+
+	// SpareStaticPodManifestsLocation is where the static pod manifests are staged on spare control plane machines,
+	// so that they only run once the machine is promoted to a server.
+	SpareStaticPodManifestsLocation = "/etc/rancher/k3s/spare/pod-manifests"
+)
+
+// GenerateStaticPodFiles returns the manifests of the static pods of the servers, written to dir.
+func GenerateStaticPodFiles(serverConfig bootstrapv1.KThreesServerConfig, dir string) []bootstrapv1.File {
+	files := make([]bootstrapv1.File, 0, len(serverConfig.StaticPods))
+	for _, staticPod := range serverConfig.StaticPods {
+		files = append(files, bootstrapv1.File{
+			Path:        path.Join(dir, staticPod.Name+".yaml"),
+			Content:     staticPod.Manifest,
+			Owner:       "root:root",
+			Permissions: "0600",
+		})
+	}
+	return files
+}
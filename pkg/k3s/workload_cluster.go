@@ -8,6 +8,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/json"
 	"fmt"
 	"math/big"
 	"strings"
@@ -27,6 +28,7 @@ import (
 	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
+	bootstrapv1 "github.com/k3s-io/cluster-api-k3s/bootstrap/api/v1beta2"
 	controlplanev1 "github.com/k3s-io/cluster-api-k3s/controlplane/api/v1beta2"
 	"github.com/k3s-io/cluster-api-k3s/pkg/etcd"
 	etcdutil "github.com/k3s-io/cluster-api-k3s/pkg/etcd/util"
@@ -36,6 +38,9 @@ const (
 	kubeProxyKey              = "kube-proxy"
 	labelNodeRoleControlPlane = "node-role.kubernetes.io/master"
 	k3sServingSecretKey       = "k3s-serving"
+
+	// nodeArgsAnnotation is set by k3s on its node to the JSON encoded arguments it runs with.
+	nodeArgsAnnotation = "k3s.io/node-args"
 )
 
 var (
@@ -48,13 +53,32 @@ var (
 type WorkloadCluster interface {
 	// Basic health and status checks.
 	ClusterStatus(ctx context.Context) (ClusterStatus, error)
+	ServerNodeArgs(ctx context.Context) (map[string][]string, error)
+	CreateAgentToken(ctx context.Context, ttl time.Duration) (string, time.Time, error)
 	UpdateAgentConditions(ctx context.Context, controlPlane *ControlPlane)
 	UpdateEtcdConditions(ctx context.Context, controlPlane *ControlPlane)
+	UpdateK3sServiceConditions(ctx context.Context, controlPlane *ControlPlane)
 
 	// Etcd tasks
 	RemoveEtcdMemberForMachine(ctx context.Context, machine *clusterv1.Machine) (bool, error)
 	ForwardEtcdLeadership(ctx context.Context, machine *clusterv1.Machine, leaderCandidate *clusterv1.Machine) error
 	ReconcileEtcdMembers(ctx context.Context, nodeNames []string) ([]string, error)
+	ListEtcdSnapshots(ctx context.Context) ([]EtcdSnapshot, error)
+	PruneEtcdSnapshots(ctx context.Context, nodeName string, names []string) (bool, error)
+	VerifyEtcdSnapshot(ctx context.Context, snapshot EtcdSnapshot) (bool, error)
+
+	// Certificate tasks
+	ApproveKubeletServingCSRs(ctx context.Context) ([]string, error)
+	RotateServingCerts(ctx context.Context, nodeName string) (bool, error)
+	EtcdCertificatesNotAfter(ctx context.Context, nodeName string) (time.Time, bool, error)
+	RotateEtcdCerts(ctx context.Context, nodeName string) (bool, error)
+
+	// Spare machine tasks
+	PromoteSpareNode(ctx context.Context, nodeName string) (bool, error)
+
+	// Node configuration tasks
+	NodeConfigDrift(ctx context.Context, nodeName string, files []bootstrapv1.File) ([]string, bool, error)
+	ReapplyNodeConfig(ctx context.Context, nodeName string, files []bootstrapv1.File) (bool, error)
 
 	// AllowBootstrapTokensToGetNodes(ctx context.Context) error
 }
@@ -78,6 +102,8 @@ type ClusterStatus struct {
 	ReadyNodes int32
 	// HasK3sServingSecret will be true if the k3s-serving secret has been uploaded, false otherwise.
 	HasK3sServingSecret bool
+	// NodeVersions are the k3s versions reported by the kubelet of the nodes, by node name
+	NodeVersions map[string]string
 }
 
 func (w *Workload) getControlPlaneNodes(ctx context.Context) (*corev1.NodeList, error) {
@@ -93,7 +119,7 @@ func (w *Workload) getControlPlaneNodes(ctx context.Context) (*corev1.NodeList,
 
 // ClusterStatus returns the status of the cluster.
 func (w *Workload) ClusterStatus(ctx context.Context) (ClusterStatus, error) {
-	status := ClusterStatus{}
+	status := ClusterStatus{NodeVersions: map[string]string{}}
 
 	// count the control plane nodes
 	nodes, err := w.getControlPlaneNodes(ctx)
@@ -107,6 +133,9 @@ func (w *Workload) ClusterStatus(ctx context.Context) (ClusterStatus, error) {
 		if util.IsNodeReady(&nodeCopy) {
 			status.ReadyNodes++
 		}
+		if node.Status.NodeInfo.KubeletVersion != "" {
+			status.NodeVersions[node.Name] = node.Status.NodeInfo.KubeletVersion
+		}
 	}
 
 	// Get the 'k3s-serving' secret in the 'kube-system' namespace.
@@ -134,6 +163,30 @@ func (w *Workload) ClusterStatus(ctx context.Context) (ClusterStatus, error) {
 	return status, nil
 }
 
+// ServerNodeArgs returns the arguments k3s runs with on the control plane nodes, by node name. Nodes without
+// the k3s.io/node-args annotation are skipped.
+func (w *Workload) ServerNodeArgs(ctx context.Context) (map[string][]string, error) {
+	nodes, err := w.getControlPlaneNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeArgs := map[string][]string{}
+	for _, node := range nodes.Items {
+		annotation, ok := node.Annotations[nodeArgsAnnotation]
+		if !ok {
+			continue
+		}
+
+		args := []string{}
+		if err := json.Unmarshal([]byte(annotation), &args); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse the %s annotation of node %s", nodeArgsAnnotation, node.Name)
+		}
+		nodeArgs[node.Name] = args
+	}
+	return nodeArgs, nil
+}
+
 func hasProvisioningMachine(machines collections.Machines) bool {
 	for _, machine := range machines {
 		if machine.Status.NodeRef == nil {
@@ -143,6 +196,26 @@ func hasProvisioningMachine(machines collections.Machines) bool {
 	return false
 }
 
+// machineForNode returns the machine of a node. Machines are matched by their nodeRef, falling back to
+// the providerID since the node name can differ from the one expected from the Machine, e.g. on clouds
+// assigning FQDN host names.
+func machineForNode(machines collections.Machines, node corev1.Node) *clusterv1.Machine {
+	for _, m := range machines {
+		if m.Status.NodeRef != nil && m.Status.NodeRef.Name == node.Name {
+			return m
+		}
+	}
+	if node.Spec.ProviderID == "" {
+		return nil
+	}
+	for _, m := range machines {
+		if m.Spec.ProviderID != nil && *m.Spec.ProviderID == node.Spec.ProviderID {
+			return m
+		}
+	}
+	return nil
+}
+
 // nodeHasUnreachableTaint returns true if the node has is unreachable from the node controller.
 func nodeHasUnreachableTaint(node corev1.Node) bool {
 	for _, taint := range node.Spec.Taints {
@@ -179,13 +252,7 @@ func (w *Workload) UpdateAgentConditions(ctx context.Context, controlPlane *Cont
 
 	for _, node := range controlPlaneNodes.Items {
 		// Search for the machine corresponding to the node.
-		var machine *clusterv1.Machine
-		for _, m := range controlPlane.Machines {
-			if m.Status.NodeRef != nil && m.Status.NodeRef.Name == node.Name {
-				machine = m
-				break
-			}
-		}
+		machine := machineForNode(controlPlane.Machines, node)
 
 		// If there is no machine corresponding to a node, determine if this is an error or not.
 		if machine == nil {
@@ -248,7 +315,7 @@ func (w *Workload) UpdateAgentConditions(ctx context.Context, controlPlane *Cont
 		}
 		found := false
 		for _, node := range controlPlaneNodes.Items {
-			if machine.Status.NodeRef.Name == node.Name {
+			if machineForNode(collections.FromMachines(machine), node) != nil {
 				found = true
 				break
 			}
@@ -385,12 +452,7 @@ func (w *Workload) updateManagedEtcdConditions(ctx context.Context, controlPlane
 
 	for _, node := range controlPlaneNodes.Items {
 		// Search for the machine corresponding to the node.
-		var machine *clusterv1.Machine
-		for _, m := range controlPlane.Machines {
-			if m.Status.NodeRef != nil && m.Status.NodeRef.Name == node.Name {
-				machine = m
-			}
-		}
+		machine := machineForNode(controlPlane.Machines, node)
 
 		if machine == nil {
 			// If there are machines still provisioning there is the chance that a chance that a node might be linked to a machine soon,
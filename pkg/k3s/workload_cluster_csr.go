@@ -0,0 +1,154 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k3s
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	nodeUserPrefix = "system:node:"
+	nodesGroup     = "system:nodes"
+
+	kubeletServingCSRApprovedReason = "KThreesControlPlaneApproved"
+)
+
+// ApproveKubeletServingCSRs approves the pending kubelet serving certificate signing requests created by
+// kubelets running with rotate-server-certificates. A request is only approved if it was made by the node
+// it is for and only asks for names and addresses that node reports; others are left pending.
+func (w *Workload) ApproveKubeletServingCSRs(ctx context.Context) ([]string, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	csrs := &certificatesv1.CertificateSigningRequestList{}
+	if err := w.Client.List(ctx, csrs); err != nil {
+		return nil, errors.Wrap(err, "failed to list certificate signing requests")
+	}
+
+	approved := []string{}
+	allErrs := []error{}
+	for i := range csrs.Items {
+		csr := &csrs.Items[i]
+		if csr.Spec.SignerName != certificatesv1.KubeletServingSignerName || isCSRDecided(csr) {
+			continue
+		}
+
+		nodeName := strings.TrimPrefix(csr.Spec.Username, nodeUserPrefix)
+		node := &corev1.Node{}
+		if err := w.Client.Get(ctx, ctrlclient.ObjectKey{Name: nodeName}, node); err != nil {
+			// the node may not be registered yet, the request is checked again on the next reconcile.
+			log.V(4).Info("Skipping kubelet serving CSR, node not found", "csr", csr.Name, "node", nodeName)
+			continue
+		}
+
+		if err := validateKubeletServingCSR(csr, node); err != nil {
+			log.Info("Not approving kubelet serving CSR", "csr", csr.Name, "reason", err.Error())
+			continue
+		}
+
+		csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+			Type:           certificatesv1.CertificateApproved,
+			Status:         corev1.ConditionTrue,
+			Reason:         kubeletServingCSRApprovedReason,
+			Message:        "Kubelet serving certificate approved by the KThreesControlPlane controller",
+			LastUpdateTime: metav1.Now(),
+		})
+		if err := w.Client.SubResource("approval").Update(ctx, csr); err != nil {
+			allErrs = append(allErrs, errors.Wrapf(err, "failed to approve certificate signing request %s", csr.Name))
+			continue
+		}
+		approved = append(approved, csr.Name)
+	}
+
+	return approved, kerrors.NewAggregate(allErrs)
+}
+
+func isCSRDecided(csr *certificatesv1.CertificateSigningRequest) bool {
+	for _, c := range csr.Status.Conditions {
+		if c.Type == certificatesv1.CertificateApproved || c.Type == certificatesv1.CertificateDenied || c.Type == certificatesv1.CertificateFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// validateKubeletServingCSR checks the request is a kubelet serving certificate request for node,
+// made by that node, and that it only contains the node hostnames and addresses.
+func validateKubeletServingCSR(csr *certificatesv1.CertificateSigningRequest, node *corev1.Node) error {
+	if csr.Spec.Username != nodeUserPrefix+node.Name {
+		return fmt.Errorf("requested by %q instead of the node", csr.Spec.Username)
+	}
+
+	if !sets.New(csr.Spec.Groups...).Has(nodesGroup) {
+		return fmt.Errorf("requester is not in the %s group", nodesGroup)
+	}
+
+	block, _ := pem.Decode(csr.Spec.Request)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return errors.New("request is not a PEM encoded certificate request")
+	}
+	req, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse certificate request")
+	}
+
+	if req.Subject.CommonName != csr.Spec.Username {
+		return fmt.Errorf("common name %q does not match the requester", req.Subject.CommonName)
+	}
+	if len(req.Subject.Organization) != 1 || req.Subject.Organization[0] != nodesGroup {
+		return fmt.Errorf("organization must be %s", nodesGroup)
+	}
+	if len(req.EmailAddresses) > 0 || len(req.URIs) > 0 {
+		return errors.New("email and URI subject alternative names are not allowed")
+	}
+
+	hostnames := sets.New[string]()
+	addresses := sets.New[string]()
+	for _, a := range node.Status.Addresses {
+		switch a.Type {
+		case corev1.NodeHostName, corev1.NodeInternalDNS, corev1.NodeExternalDNS:
+			hostnames.Insert(a.Address)
+		case corev1.NodeInternalIP, corev1.NodeExternalIP:
+			addresses.Insert(a.Address)
+		}
+	}
+
+	for _, name := range req.DNSNames {
+		if !hostnames.Has(name) {
+			return fmt.Errorf("DNS name %q is not a node hostname", name)
+		}
+	}
+	for _, ip := range req.IPAddresses {
+		if !addresses.Has(ip.String()) {
+			return fmt.Errorf("IP address %s is not a node address", ip)
+		}
+	}
+
+	return nil
+}
@@ -18,13 +18,22 @@ package k3s
 
 import (
 	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/util/patch"
 	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/k3s-io/cluster-api-k3s/pkg/etcd"
 	etcdutil "github.com/k3s-io/cluster-api-k3s/pkg/etcd/util"
@@ -33,8 +42,46 @@ import (
 const (
 	EtcdRemoveAnnotation      = "etcd.k3s.cattle.io/remove"
 	EtcdRemovedNodeAnnotation = "etcd.k3s.cattle.io/removed-node-name"
+
+	etcdSnapshotPodPrefix       = "k3s-etcd-snapshot-"
+	etcdSnapshotPrunePodPrefix  = "k3s-etcd-snapshot-prune-"
+	etcdSnapshotVerifyPodPrefix = "k3s-etcd-snapshot-verify-"
+
+	// etcdSnapshotCorruptExitCode is the exit code of the verify pod when the snapshot does not match its checksum.
+	etcdSnapshotCorruptExitCode = 3
+
+	// ScheduledEtcdSnapshotPrefix is the name prefix of the snapshots taken by k3s on the snapshot schedule,
+	// the ones subject to the snapshot retention count.
+	ScheduledEtcdSnapshotPrefix = "etcd-snapshot-"
 )
 
+// etcdSnapshotFileListGVK is the list kind of the resources k3s records its etcd snapshots with.
+var etcdSnapshotFileListGVK = schema.GroupVersionKind{Group: "k3s.cattle.io", Version: "v1", Kind: "ETCDSnapshotFileList"}
+
+// EtcdSnapshot is an etcd snapshot as recorded by k3s.
+type EtcdSnapshot struct {
+	// Name is the snapshot name, e.g. etcd-snapshot-<node>-<timestamp> for scheduled snapshots.
+	Name string
+	// NodeName is the name of the node that took the snapshot.
+	NodeName string
+	// S3 is true for snapshots stored in S3, false for snapshots stored on the node.
+	S3 bool
+	// Location is the URI of the snapshot, e.g. file:///var/lib/rancher/k3s/server/db/snapshots/<name>.
+	Location string
+	// ReadyToUse is true once the snapshot was completely saved.
+	ReadyToUse bool
+	// CreationTime is the time the snapshot was taken, zero if not reported yet.
+	CreationTime time.Time
+}
+
+var errEtcdClientUnavailable = errors.New("etcd client is not available, the cluster does not have an etcd CA")
+
+// ErrEtcdSnapshotCorrupt is returned by VerifyEtcdSnapshot when the snapshot content does not match its checksum.
+var ErrEtcdSnapshotCorrupt = errors.New("etcd snapshot does not match its checksum")
+
+// etcdSnapshotPathRegexp matches the local snapshot paths that are safe to pass to a shell.
+var etcdSnapshotPathRegexp = regexp.MustCompile(`^/[A-Za-z0-9._/-]+$`)
+
 type etcdClientFor interface {
 	forFirstAvailableNode(ctx context.Context, nodeNames []string) (*etcd.Client, error)
 	forLeader(ctx context.Context, nodeNames []string) (*etcd.Client, error)
@@ -245,6 +292,10 @@ func (w *Workload) ForwardEtcdLeadership(ctx context.Context, machine *clusterv1
 // but then it relies on etcd as ultimate source of truth for the list of members.
 // This is intended to allow informed decisions on actions impacting etcd quorum.
 func (w *Workload) EtcdMembers(ctx context.Context) ([]string, error) {
+	if w.etcdClientGenerator == nil {
+		return nil, errEtcdClientUnavailable
+	}
+
 	nodes, err := w.getControlPlaneNodes(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to list control plane nodes")
@@ -271,3 +322,117 @@ func (w *Workload) EtcdMembers(ctx context.Context) ([]string, error) {
 	}
 	return names, nil
 }
+
+// SaveEtcdSnapshot takes an on-demand etcd snapshot named name on the node, by running k3s etcd-snapshot save
+// through a privileged pod scheduled on it. Snapshots are stored and uploaded as configured for the k3s server.
+// It returns true once the snapshot was saved; it is meant to be called again until then.
+func (w *Workload) SaveEtcdSnapshot(ctx context.Context, nodeName, name string) (bool, error) {
+	if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+		return false, errors.Errorf("invalid snapshot name %q: %s", name, strings.Join(errs, ", "))
+	}
+
+	key := ctrlclient.ObjectKey{Namespace: metav1.NamespaceSystem, Name: hostCommandPodName(etcdSnapshotPodPrefix, nodeName)}
+	phase, err := w.runHostCommand(ctx, key, nodeName, "k3s etcd-snapshot save --name "+name)
+	if err != nil || phase != corev1.PodSucceeded {
+		return false, err
+	}
+
+	return true, w.deleteHostCommandPod(ctx, key)
+}
+
+// ListEtcdSnapshots returns the etcd snapshots recorded by k3s in ETCDSnapshotFile resources, both the local
+// snapshots of every server and the ones stored in S3.
+func (w *Workload) ListEtcdSnapshots(ctx context.Context) ([]EtcdSnapshot, error) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(etcdSnapshotFileListGVK)
+	if err := w.Client.List(ctx, list); err != nil {
+		return nil, errors.Wrap(err, "failed to list etcd snapshot files")
+	}
+
+	snapshots := make([]EtcdSnapshot, 0, len(list.Items))
+	for _, item := range list.Items {
+		name, _, _ := unstructured.NestedString(item.Object, "spec", "snapshotName")
+		nodeName, _, _ := unstructured.NestedString(item.Object, "spec", "nodeName")
+		_, isS3, _ := unstructured.NestedMap(item.Object, "spec", "s3")
+		location, _, _ := unstructured.NestedString(item.Object, "spec", "location")
+		readyToUse, _, _ := unstructured.NestedBool(item.Object, "status", "readyToUse")
+		snapshot := EtcdSnapshot{Name: name, NodeName: nodeName, S3: isS3, Location: location, ReadyToUse: readyToUse}
+		if creationTime, ok, _ := unstructured.NestedString(item.Object, "status", "creationTime"); ok {
+			if t, err := time.Parse(time.RFC3339, creationTime); err == nil {
+				snapshot.CreationTime = t
+			}
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, nil
+}
+
+// PruneEtcdSnapshots deletes the named etcd snapshots, by running k3s etcd-snapshot delete through a privileged pod
+// scheduled on the node. Local snapshots have to be pruned on the node that took them, while S3 snapshots can be
+// pruned from any server. It returns true once the snapshots were deleted; it is meant to be called again until then.
+func (w *Workload) PruneEtcdSnapshots(ctx context.Context, nodeName string, names []string) (bool, error) {
+	if len(names) == 0 {
+		return true, nil
+	}
+	for _, name := range names {
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+			return false, errors.Errorf("invalid snapshot name %q: %s", name, strings.Join(errs, ", "))
+		}
+	}
+
+	key := ctrlclient.ObjectKey{Namespace: metav1.NamespaceSystem, Name: hostCommandPodName(etcdSnapshotPrunePodPrefix, nodeName)}
+	phase, err := w.runHostCommand(ctx, key, nodeName, "k3s etcd-snapshot delete "+strings.Join(names, " "))
+	if err != nil || phase != corev1.PodSucceeded {
+		return false, err
+	}
+
+	return true, w.deleteHostCommandPod(ctx, key)
+}
+
+// VerifyEtcdSnapshot checks the integrity of a local snapshot through a privileged pod scheduled on its node, the way
+// etcdutl snapshot status does: etcd appends the sha256 checksum of the database to the snapshots it saves.
+// It returns true once the check completed, with an error wrapping ErrEtcdSnapshotCorrupt if the snapshot is corrupt;
+// it is meant to be called again until then.
+func (w *Workload) VerifyEtcdSnapshot(ctx context.Context, snapshot EtcdSnapshot) (bool, error) {
+	path, ok := strings.CutPrefix(snapshot.Location, "file://")
+	if snapshot.S3 || !ok || !etcdSnapshotPathRegexp.MatchString(path) || strings.Contains(path, "..") {
+		return false, errors.Errorf("snapshot %s is not a local snapshot: %q", snapshot.Name, snapshot.Location)
+	}
+
+	script := fmt.Sprintf(`f=%s
+size=$(stat -c %%s "$f") || exit 1
+[ $((size %% 512)) -eq 32 ] || exit %[2]d
+[ "$(head -c $((size - 32)) "$f" | sha256sum | cut -d ' ' -f 1)" = "$(tail -c 32 "$f" | od -A n -v -t x1 | tr -d ' \n')" ] || exit %[2]d`,
+		path, etcdSnapshotCorruptExitCode)
+
+	key := ctrlclient.ObjectKey{Namespace: metav1.NamespaceSystem, Name: hostCommandPodName(etcdSnapshotVerifyPodPrefix, snapshot.NodeName)}
+	pod := &corev1.Pod{}
+	if err := w.Client.Get(ctx, key, pod); err == nil {
+		// The pod may still verify a previous snapshot of the node.
+		if command := pod.Spec.Containers[0].Command; command[len(command)-1] != script {
+			return false, w.deleteHostCommandPod(ctx, key)
+		}
+		if pod.Status.Phase == corev1.PodFailed && isEtcdSnapshotCorrupt(pod) {
+			if err := w.deleteHostCommandPod(ctx, key); err != nil {
+				return false, err
+			}
+			return true, errors.Wrapf(ErrEtcdSnapshotCorrupt, "snapshot %s on node %s", snapshot.Name, snapshot.NodeName)
+		}
+	}
+
+	phase, err := w.runHostCommand(ctx, key, snapshot.NodeName, script)
+	if err != nil || phase != corev1.PodSucceeded {
+		return false, err
+	}
+
+	return true, w.deleteHostCommandPod(ctx, key)
+}
+
+func isEtcdSnapshotCorrupt(pod *corev1.Pod) bool {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Terminated != nil && status.State.Terminated.ExitCode == etcdSnapshotCorruptExitCode {
+			return true
+		}
+	}
+	return false
+}
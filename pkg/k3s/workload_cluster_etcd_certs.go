@@ -0,0 +1,120 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k3s
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/cluster-api/util"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	etcdCertsCheckPodPrefix    = "k3s-etcd-certs-check-"
+	etcdCertsRotationPodPrefix = "k3s-etcd-certs-rotation-"
+
+	// etcdCertsDir is where k3s stores the certificates of the embedded etcd.
+	etcdCertsDir = "/var/lib/rancher/k3s/server/tls/etcd"
+
+	// etcdCertsRotationScript runs in the host namespaces; k3s has to be stopped for k3s certificate rotate to
+	// renew the etcd certificates, which are then loaded when k3s starts again. k3s is started again whatever the
+	// result of the rotation, while the exit code of the rotation is kept so that a failed rotation fails the pod.
+	etcdCertsRotationScript = "systemctl stop k3s && { k3s certificate rotate --service etcd; rc=$?; systemctl start k3s; exit $rc; }"
+)
+
+// etcdCertFiles are the etcd server and peer certificates of a k3s server, the ones k3s rotates but the CAs.
+var etcdCertFiles = []string{"server-client.crt", "peer-server-client.crt"}
+
+// EtcdCertificatesNotAfter returns the earliest expiry of the etcd server and peer certificates of the k3s server
+// running on the node, read through a pod scheduled on it. It returns true once the certificates are read;
+// it is meant to be called again until then.
+func (w *Workload) EtcdCertificatesNotAfter(ctx context.Context, nodeName string) (time.Time, bool, error) {
+	key := ctrlclient.ObjectKey{Namespace: metav1.NamespaceSystem, Name: hostCommandPodName(etcdCertsCheckPodPrefix, nodeName)}
+	content, done, err := w.readHostFiles(ctx, key, nodeName, etcdCertsDir, etcdCertFiles)
+	if err != nil || !done {
+		return time.Time{}, false, err
+	}
+
+	if err := w.deleteHostCommandPod(ctx, key); err != nil {
+		return time.Time{}, false, err
+	}
+
+	notAfter, err := leafCertificatesNotAfter([]byte(content))
+	if err != nil {
+		return time.Time{}, false, errors.Wrapf(err, "failed to parse the etcd certificates of node %s", nodeName)
+	}
+	return notAfter, true, nil
+}
+
+// leafCertificatesNotAfter returns the earliest expiry of the PEM encoded certificates, CA certificates bundled with
+// them excluded.
+func leafCertificatesNotAfter(data []byte) (time.Time, error) {
+	var notAfter time.Time
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if cert.IsCA {
+			continue
+		}
+		if notAfter.IsZero() || cert.NotAfter.Before(notAfter) {
+			notAfter = cert.NotAfter
+		}
+	}
+
+	if notAfter.IsZero() {
+		return time.Time{}, errors.New("no certificate found")
+	}
+	return notAfter, nil
+}
+
+// RotateEtcdCerts renews the etcd server and peer certificates of the k3s server running on the node by restarting
+// k3s through a privileged pod scheduled on it. It returns true once the restart completed and the node is ready
+// again; it is meant to be called again until then.
+func (w *Workload) RotateEtcdCerts(ctx context.Context, nodeName string) (bool, error) {
+	key := ctrlclient.ObjectKey{Namespace: metav1.NamespaceSystem, Name: hostCommandPodName(etcdCertsRotationPodPrefix, nodeName)}
+	phase, err := w.runHostCommand(ctx, key, nodeName, etcdCertsRotationScript)
+	if err != nil || phase != corev1.PodSucceeded {
+		return false, err
+	}
+
+	node := &corev1.Node{}
+	if err := w.Client.Get(ctx, ctrlclient.ObjectKey{Name: nodeName}, node); err != nil {
+		return false, errors.Wrapf(err, "failed to get node %s", nodeName)
+	}
+	if !util.IsNodeReady(node) {
+		return false, nil
+	}
+
+	return true, w.deleteHostCommandPod(ctx, key)
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k3s
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/utils/ptr"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// hostCommandImage is preloaded by k3s, so commands can also be run on air-gapped nodes.
+const hostCommandImage = "rancher/mirrored-library-busybox:1.36.1"
+
+// runHostCommand runs script in the host namespaces of the node through a privileged pod, creating the pod
+// if it does not exist yet, and returns the pod phase. A failed pod is deleted so the command is retried on
+// the next call; a succeeded pod is kept until the caller deletes it with deleteHostCommandPod.
+func (w *Workload) runHostCommand(ctx context.Context, key ctrlclient.ObjectKey, nodeName, script string) (corev1.PodPhase, error) {
+	pod := &corev1.Pod{}
+	if err := w.Client.Get(ctx, key, pod); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return "", errors.Wrapf(err, "failed to get pod %s", key.Name)
+		}
+		if err := w.Client.Create(ctx, newHostCommandPod(key, nodeName, script)); err != nil {
+			return "", errors.Wrapf(err, "failed to create pod %s", key.Name)
+		}
+		return corev1.PodPending, nil
+	}
+
+	// Do not trust a pod of the same name that ran on another node, recreate it on the next call instead.
+	if pod.Spec.NodeName != nodeName {
+		if err := w.deleteHostCommandPod(ctx, key); err != nil {
+			return "", err
+		}
+		return corev1.PodPending, nil
+	}
+
+	if pod.Status.Phase == corev1.PodFailed {
+		if err := w.deleteHostCommandPod(ctx, key); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("pod %s failed on node %s", key.Name, nodeName)
+	}
+
+	return pod.Status.Phase, nil
+}
+
+// readHostFiles reads files of a directory of the node through a pod mounting the directory read-only, creating
+// the pod if it does not exist yet. It returns the concatenated content of the files once the pod succeeded, and
+// keeps the pod until the caller deletes it with deleteHostCommandPod. The content is passed back with the
+// termination message of the pod, so it is limited to 4096 bytes.
+func (w *Workload) readHostFiles(ctx context.Context, key ctrlclient.ObjectKey, nodeName, dir string, names []string) (string, bool, error) {
+	paths := make([]string, 0, len(names))
+	for _, name := range names {
+		paths = append(paths, "/host/"+name)
+	}
+	return w.readHostOutput(ctx, key, nodeName, dir, fmt.Sprintf("cat %s", strings.Join(paths, " ")))
+}
+
+// readHostOutput runs script through a pod mounting the directory of the node read-only at /host, like
+// readHostFiles, and returns the output of the script.
+func (w *Workload) readHostOutput(ctx context.Context, key ctrlclient.ObjectKey, nodeName, dir, script string) (string, bool, error) {
+	pod := &corev1.Pod{}
+	if err := w.Client.Get(ctx, key, pod); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return "", false, errors.Wrapf(err, "failed to get pod %s", key.Name)
+		}
+		if err := w.Client.Create(ctx, newHostFilesPod(key, nodeName, dir, script)); err != nil {
+			return "", false, errors.Wrapf(err, "failed to create pod %s", key.Name)
+		}
+		return "", false, nil
+	}
+
+	if pod.Spec.NodeName != nodeName {
+		return "", false, w.deleteHostCommandPod(ctx, key)
+	}
+
+	switch pod.Status.Phase {
+	case corev1.PodFailed:
+		if err := w.deleteHostCommandPod(ctx, key); err != nil {
+			return "", false, err
+		}
+		return "", false, fmt.Errorf("pod %s failed on node %s", key.Name, nodeName)
+	case corev1.PodSucceeded:
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.State.Terminated != nil {
+				return status.State.Terminated.Message, true, nil
+			}
+		}
+	}
+
+	return "", false, nil
+}
+
+func (w *Workload) deleteHostCommandPod(ctx context.Context, key ctrlclient.ObjectKey) error {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}}
+	if err := w.Client.Delete(ctx, pod); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to delete pod %s", key.Name)
+	}
+	return nil
+}
+
+// hostCommandPodName returns the name of the pod running a host command on the node. Names longer than the
+// 253 characters allowed for pods are truncated and suffixed with a hash of the node name, so that the pods of
+// nodes sharing a long name prefix do not collide.
+func hostCommandPodName(prefix, nodeName string) string {
+	name := prefix + nodeName
+	if len(name) <= validation.DNS1123SubdomainMaxLength {
+		return name
+	}
+
+	hasher := fnv.New32a()
+	_, _ = hasher.Write([]byte(nodeName))
+	suffix := fmt.Sprintf("-%08x", hasher.Sum32())
+	return strings.TrimRight(name[:validation.DNS1123SubdomainMaxLength-len(suffix)], "-.") + suffix
+}
+
+func newHostCommandPod(key ctrlclient.ObjectKey, nodeName, script string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      key.Name,
+			Namespace: key.Namespace,
+		},
+		Spec: corev1.PodSpec{
+			NodeName:      nodeName,
+			HostPID:       true,
+			RestartPolicy: corev1.RestartPolicyNever,
+			Tolerations: []corev1.Toleration{
+				{Operator: corev1.TolerationOpExists},
+			},
+			Containers: []corev1.Container{
+				{
+					Name:    "run",
+					Image:   hostCommandImage,
+					Command: []string{"nsenter", "-t", "1", "-m", "-u", "-i", "-n", "-p", "--", "sh", "-c", script},
+					SecurityContext: &corev1.SecurityContext{
+						Privileged: ptr.To(true),
+					},
+				},
+			},
+		},
+	}
+}
+
+func newHostFilesPod(key ctrlclient.ObjectKey, nodeName, dir, script string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      key.Name,
+			Namespace: key.Namespace,
+		},
+		Spec: corev1.PodSpec{
+			NodeName:      nodeName,
+			RestartPolicy: corev1.RestartPolicyNever,
+			Tolerations: []corev1.Toleration{
+				{Operator: corev1.TolerationOpExists},
+			},
+			Containers: []corev1.Container{
+				{
+					Name:    "read",
+					Image:   hostCommandImage,
+					Command: []string{"sh", "-c", fmt.Sprintf("{ %s; } > /dev/termination-log", script)},
+					VolumeMounts: []corev1.VolumeMount{
+						{Name: "host", MountPath: "/host", ReadOnly: true},
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: "host",
+					VolumeSource: corev1.VolumeSource{
+						HostPath: &corev1.HostPathVolumeSource{Path: dir},
+					},
+				},
+			},
+		},
+	}
+}
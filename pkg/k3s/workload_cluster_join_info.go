@@ -0,0 +1,111 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k3s
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// JoinInfoServerURLKey, JoinInfoCAHashKey, JoinInfoTokenKey and JoinInfoExpirationKey are the keys of the
+	// join information secret published for externally managed nodes.
+	JoinInfoServerURLKey  = "server-url"
+	JoinInfoCAHashKey     = "ca-hash"
+	JoinInfoTokenKey      = "token"
+	JoinInfoExpirationKey = "expiration"
+
+	// agentTokenGroup is the group k3s grants to the nodes joining with a bootstrap token, as set by k3s token create.
+	agentTokenGroup = "system:bootstrappers:k3s:default-node-token"
+
+	bootstrapTokenSecretPrefix = "bootstrap-token-"
+	bootstrapTokenChars        = "abcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+// JoinInfoSecretName returns the name of the join information secret of a cluster.
+func JoinInfoSecretName(clusterName string) string {
+	return fmt.Sprintf("%s-join-info", clusterName)
+}
+
+// CAHash returns the hash of the cluster CA certificates which k3s agents compare with the ones served by the
+// server they join, the sha256 checksum of the server-ca.crt file.
+func CAHash(caCert []byte) string {
+	sum := sha256.Sum256(caCert)
+	return hex.EncodeToString(sum[:])
+}
+
+// SecureToken returns the k3s secure token format of a token, which pins the CA of the cluster.
+func SecureToken(caHash, token string) string {
+	return fmt.Sprintf("K10%s::%s", caHash, token)
+}
+
+// CreateAgentToken creates a bootstrap token which k3s accepts to join agents, like k3s token create does,
+// valid for ttl. It returns the token and when it expires.
+func (w *Workload) CreateAgentToken(ctx context.Context, ttl time.Duration) (string, time.Time, error) {
+	tokenID, err := randomBootstrapTokenString(6)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "failed to generate the agent token")
+	}
+	tokenSecret, err := randomBootstrapTokenString(16)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "failed to generate the agent token")
+	}
+	expiration := time.Now().Add(ttl).UTC().Truncate(time.Second)
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      bootstrapTokenSecretPrefix + tokenID,
+			Namespace: metav1.NamespaceSystem,
+		},
+		Type: corev1.SecretTypeBootstrapToken,
+		StringData: map[string]string{
+			"description":                    "Agent token published for externally managed nodes by the KThreesControlPlane",
+			"token-id":                       tokenID,
+			"token-secret":                   tokenSecret,
+			"expiration":                     expiration.Format(time.RFC3339),
+			"usage-bootstrap-authentication": "true",
+			"usage-bootstrap-signing":        "true",
+			"auth-extra-groups":              agentTokenGroup,
+		},
+	}
+	if err := w.Client.Create(ctx, secret); err != nil {
+		return "", time.Time{}, errors.Wrap(err, "failed to create the agent token")
+	}
+	return tokenID + "." + tokenSecret, expiration, nil
+}
+
+// randomBootstrapTokenString returns a random string of the characters allowed in bootstrap tokens.
+func randomBootstrapTokenString(length int) (string, error) {
+	b := make([]byte, length)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(bootstrapTokenChars))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = bootstrapTokenChars[n.Int64()]
+	}
+	return string(b), nil
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k3s
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/cluster-api/util"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	bootstrapv1 "github.com/k3s-io/cluster-api-k3s/bootstrap/api/v1beta2"
+)
+
+const (
+	nodeConfigCheckPodPrefix   = "k3s-config-check-"
+	nodeConfigReapplyPodPrefix = "k3s-config-reapply-"
+
+	// missingFileChecksum is printed instead of the checksum of a file missing on the node.
+	missingFileChecksum = "-"
+)
+
+// NodeConfigDrift returns the paths of the k3s configuration files whose content on the node differs from the
+// expected one, comparing their checksums computed on the node through a pod scheduled on it. It returns true
+// once the checksums are read; it is meant to be called again until then.
+func (w *Workload) NodeConfigDrift(ctx context.Context, nodeName string, files []bootstrapv1.File) ([]string, bool, error) {
+	key := ctrlclient.ObjectKey{Namespace: metav1.NamespaceSystem, Name: hostCommandPodName(nodeConfigCheckPodPrefix, nodeName)}
+	output, done, err := w.readHostOutput(ctx, key, nodeName, "/", nodeConfigChecksumScript(files))
+	if err != nil || !done {
+		return nil, false, err
+	}
+
+	if err := w.deleteHostCommandPod(ctx, key); err != nil {
+		return nil, false, err
+	}
+
+	checksums := parseNodeConfigChecksums(output)
+	drifted := []string{}
+	for _, file := range files {
+		if checksums[file.Path] != NodeConfigChecksum(file.Content) {
+			drifted = append(drifted, file.Path)
+		}
+	}
+	return drifted, true, nil
+}
+
+// nodeConfigChecksumScript prints the sha256 checksum of each file, or missingFileChecksum if it is missing.
+func nodeConfigChecksumScript(files []bootstrapv1.File) string {
+	commands := make([]string, 0, len(files))
+	for _, file := range files {
+		commands = append(commands, fmt.Sprintf("sha256sum '/host%[1]s' 2>/dev/null || echo '%[2]s  /host%[1]s'", file.Path, missingFileChecksum))
+	}
+	return strings.Join(commands, "; ")
+}
+
+// parseNodeConfigChecksums parses the sha256sum output of nodeConfigChecksumScript into checksums by path.
+func parseNodeConfigChecksums(output string) map[string]string {
+	checksums := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		checksum, filePath, ok := strings.Cut(line, "  ")
+		if !ok {
+			continue
+		}
+		checksums[strings.TrimPrefix(filePath, "/host")] = checksum
+	}
+	return checksums
+}
+
+// ReapplyNodeConfig writes the k3s configuration files back on the node and restarts k3s through a privileged pod
+// scheduled on it. It returns true once the restart completed and the node is ready again; it is meant to be
+// called again until then.
+func (w *Workload) ReapplyNodeConfig(ctx context.Context, nodeName string, files []bootstrapv1.File) (bool, error) {
+	key := ctrlclient.ObjectKey{Namespace: metav1.NamespaceSystem, Name: hostCommandPodName(nodeConfigReapplyPodPrefix, nodeName)}
+	phase, err := w.runHostCommand(ctx, key, nodeName, nodeConfigReapplyScript(files))
+	if err != nil || phase != corev1.PodSucceeded {
+		return false, err
+	}
+
+	node := &corev1.Node{}
+	if err := w.Client.Get(ctx, ctrlclient.ObjectKey{Name: nodeName}, node); err != nil {
+		return false, errors.Wrapf(err, "failed to get node %s", nodeName)
+	}
+	if !util.IsNodeReady(node) {
+		return false, nil
+	}
+
+	return true, w.deleteHostCommandPod(ctx, key)
+}
+
+// nodeConfigReapplyScript writes the files, base64 encoded to be passed safely through the shell, and restarts k3s.
+func nodeConfigReapplyScript(files []bootstrapv1.File) string {
+	commands := make([]string, 0, len(files)+1)
+	for _, file := range files {
+		command := fmt.Sprintf("mkdir -p '%s' && echo '%s' | base64 -d > '%s'",
+			path.Dir(file.Path), base64.StdEncoding.EncodeToString([]byte(NodeConfigContent(file.Content))), file.Path)
+		if file.Permissions != "" {
+			command += fmt.Sprintf(" && chmod %s '%s'", file.Permissions, file.Path)
+		}
+		if file.Owner != "" {
+			command += fmt.Sprintf(" && chown %s '%s'", file.Owner, file.Path)
+		}
+		commands = append(commands, command)
+	}
+	commands = append(commands, "systemctl restart k3s")
+	return strings.Join(commands, " && ")
+}
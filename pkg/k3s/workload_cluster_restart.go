@@ -0,0 +1,58 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k3s
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/cluster-api/util"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	servingCertRotationPodPrefix = "k3s-serving-cert-rotation-"
+
+	// servingCertRotationScript runs in the host namespaces; deleting the k3s-serving secret and the cached
+	// dynamic listener certificate makes k3s regenerate its serving certificate when it restarts.
+	servingCertRotationScript = "k3s kubectl -n kube-system delete secret k3s-serving --ignore-not-found && " +
+		"rm -f /var/lib/rancher/k3s/server/tls/dynamic-cert.json && " +
+		"systemctl restart k3s"
+)
+
+// RotateServingCerts regenerates the dynamic serving certificate of the k3s server running on the node by
+// restarting k3s through a privileged pod scheduled on it. It returns true once the restart completed
+// and the node is ready again; it is meant to be called again until then.
+func (w *Workload) RotateServingCerts(ctx context.Context, nodeName string) (bool, error) {
+	key := ctrlclient.ObjectKey{Namespace: metav1.NamespaceSystem, Name: hostCommandPodName(servingCertRotationPodPrefix, nodeName)}
+	phase, err := w.runHostCommand(ctx, key, nodeName, servingCertRotationScript)
+	if err != nil || phase != corev1.PodSucceeded {
+		return false, err
+	}
+
+	node := &corev1.Node{}
+	if err := w.Client.Get(ctx, ctrlclient.ObjectKey{Name: nodeName}, node); err != nil {
+		return false, errors.Wrapf(err, "failed to get node %s", nodeName)
+	}
+	if !util.IsNodeReady(node) {
+		return false, nil
+	}
+
+	return true, w.deleteHostCommandPod(ctx, key)
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k3s
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	controlplanev1 "github.com/k3s-io/cluster-api-k3s/controlplane/api/v1beta2"
+)
+
+// kubeletHealthzTimeout is how long to wait for the kubelet of a node to answer its health check.
+const kubeletHealthzTimeout = 5 * time.Second
+
+var errNoRestConfig = errors.New("no rest config for the workload cluster")
+
+// UpdateK3sServiceConditions is responsible for updating the K3sServiceHealthy condition of the control plane machines.
+// The kubelet runs in the k3s process, so a node posting its status means k3s is running; when the node status is
+// stale, the kubelet health endpoint is probed through the API server to check if k3s answers. A machine whose
+// infrastructure is ready but whose k3s does not answer is reported as down.
+// This operation is best effort, in case of problems in inspecting the node it sets the condition to Unknown.
+func (w *Workload) UpdateK3sServiceConditions(ctx context.Context, controlPlane *ControlPlane) {
+	for _, machine := range controlPlane.Machines {
+		if !machine.DeletionTimestamp.IsZero() {
+			conditions.MarkFalse(machine, controlplanev1.MachineK3sServiceHealthyCondition, clusterv1.DeletingReason, clusterv1.ConditionSeverityInfo, "")
+			continue
+		}
+
+		// Machines without a node are still provisioning.
+		if machine.Status.NodeRef == nil {
+			continue
+		}
+
+		node := &corev1.Node{}
+		if err := w.Client.Get(ctx, ctrlclient.ObjectKey{Name: machine.Status.NodeRef.Name}, node); err != nil {
+			conditions.MarkUnknown(machine, controlplanev1.MachineK3sServiceHealthyCondition, controlplanev1.K3sServiceInspectionFailedReason, "Failed to get node %s: %v", machine.Status.NodeRef.Name, err)
+			continue
+		}
+
+		// A ready or not ready node is reported by the kubelet, only an unknown status means the kubelet stopped posting it.
+		if ready := nodeReadyCondition(node); ready != nil && ready.Status != corev1.ConditionUnknown {
+			conditions.MarkTrue(machine, controlplanev1.MachineK3sServiceHealthyCondition)
+			continue
+		}
+
+		err := w.probeKubeletHealthz(ctx, node.Name)
+		switch {
+		case err == nil:
+			conditions.MarkTrue(machine, controlplanev1.MachineK3sServiceHealthyCondition)
+		case errors.Is(err, errNoRestConfig):
+			conditions.MarkUnknown(machine, controlplanev1.MachineK3sServiceHealthyCondition, controlplanev1.K3sServiceInspectionFailedReason, "Failed to probe node %s: %v", node.Name, err)
+		case !conditions.IsTrue(machine, clusterv1.InfrastructureReadyCondition):
+			// The node may not be running at all, which is not a k3s service issue.
+			conditions.MarkUnknown(machine, controlplanev1.MachineK3sServiceHealthyCondition, controlplanev1.K3sServiceInspectionFailedReason, "Node %s is not responding and the machine infrastructure is not ready", node.Name)
+		default:
+			conditions.MarkFalse(machine, controlplanev1.MachineK3sServiceHealthyCondition, controlplanev1.K3sServiceDownReason, clusterv1.ConditionSeverityError,
+				"Node %s stopped reporting its status and k3s is not responding: %v", node.Name, err)
+		}
+	}
+}
+
+// probeKubeletHealthz checks the health endpoint of the kubelet of the node through the API server node proxy.
+func (w *Workload) probeKubeletHealthz(ctx context.Context, nodeName string) error {
+	if w.ClientRestConfig == nil {
+		return errNoRestConfig
+	}
+	clientset, err := kubernetes.NewForConfig(w.ClientRestConfig)
+	if err != nil {
+		return errors.Wrap(err, "failed to create client")
+	}
+
+	return clientset.CoreV1().RESTClient().Get().
+		Resource("nodes").
+		Name(nodeName).
+		SubResource("proxy").
+		Suffix("healthz").
+		Timeout(kubeletHealthzTimeout).
+		Do(ctx).
+		Error()
+}
+
+// nodeReadyCondition returns the Ready condition of the node, if any.
+func nodeReadyCondition(node *corev1.Node) *corev1.NodeCondition {
+	for i := range node.Status.Conditions {
+		if node.Status.Conditions[i].Type == corev1.NodeReady {
+			return &node.Status.Conditions[i]
+		}
+	}
+	return nil
+}
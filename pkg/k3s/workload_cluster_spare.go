@@ -0,0 +1,72 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k3s
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/cluster-api/util"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	bootstrapv1 "github.com/k3s-io/cluster-api-k3s/bootstrap/api/v1beta2"
+)
+
+const (
+	sparePromotionPodPrefix = "k3s-spare-promotion-"
+
+	// labelNodeRoleServer is set by k3s servers on their node when they start.
+	labelNodeRoleServer = "node-role.kubernetes.io/control-plane"
+)
+
+// PromoteSpareNode promotes the node of a spare control plane machine to a server by running the promotion
+// script staged on it, which restarts k3s as a server. Once the node is a ready server, the spare label and
+// taint are removed from it and true is returned; it is meant to be called again until then.
+// Nodes without the spare label are considered promoted.
+func (w *Workload) PromoteSpareNode(ctx context.Context, nodeName string) (bool, error) {
+	node := &corev1.Node{}
+	if err := w.Client.Get(ctx, ctrlclient.ObjectKey{Name: nodeName}, node); err != nil {
+		return false, errors.Wrapf(err, "failed to get node %s", nodeName)
+	}
+	if _, ok := node.Labels[bootstrapv1.SpareControlPlaneLabel]; !ok {
+		return true, nil
+	}
+
+	key := ctrlclient.ObjectKey{Namespace: metav1.NamespaceSystem, Name: hostCommandPodName(sparePromotionPodPrefix, nodeName)}
+	if _, ok := node.Labels[labelNodeRoleServer]; !ok || !util.IsNodeReady(node) {
+		// the promotion script is run detached, since it stops the agent running the pod.
+		_, err := w.runHostCommand(ctx, key, nodeName, "systemd-run --unit k3s-spare-promotion "+SparePromotionScriptLocation)
+		return false, err
+	}
+
+	patchNode := node.DeepCopy()
+	delete(patchNode.Labels, bootstrapv1.SpareControlPlaneLabel)
+	taints := []corev1.Taint{}
+	for _, taint := range patchNode.Spec.Taints {
+		if taint.Key != bootstrapv1.SpareControlPlaneLabel {
+			taints = append(taints, taint)
+		}
+	}
+	patchNode.Spec.Taints = taints
+	if err := w.Client.Patch(ctx, patchNode, ctrlclient.MergeFrom(node)); err != nil {
+		return false, errors.Wrapf(err, "failed to remove the spare label and taint from node %s", nodeName)
+	}
+
+	return true, w.deleteHostCommandPod(ctx, key)
+}
@@ -2,13 +2,34 @@ package k3s
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"strings"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	certificatesv1 "k8s.io/api/certificates/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/collections"
+	"sigs.k8s.io/cluster-api/util/conditions"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	bootstrapv1 "github.com/k3s-io/cluster-api-k3s/bootstrap/api/v1beta2"
+	controlplanev1 "github.com/k3s-io/cluster-api-k3s/controlplane/api/v1beta2"
 )
 
 func TestClusterStatus(t *testing.T) {
@@ -24,6 +45,9 @@ func TestClusterStatus(t *testing.T) {
 				Type:   corev1.NodeReady,
 				Status: corev1.ConditionTrue,
 			}},
+			NodeInfo: corev1.NodeSystemInfo{
+				KubeletVersion: "v1.30.2+k3s1",
+			},
 		},
 	}
 	node2 := &corev1.Node{
@@ -76,6 +100,593 @@ func TestClusterStatus(t *testing.T) {
 			g.Expect(status.Nodes).To(BeEquivalentTo(2))
 			g.Expect(status.ReadyNodes).To(BeEquivalentTo(1))
 			g.Expect(status.HasK3sServingSecret).To(Equal(tt.expectHasSecret))
+			g.Expect(status.NodeVersions).To(Equal(map[string]string{"node1": "v1.30.2+k3s1"}))
+		})
+	}
+}
+
+func TestUpdateK3sServiceConditions(t *testing.T) {
+	nodeWithReady := func(name string, status corev1.ConditionStatus) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: status}},
+			},
+		}
+	}
+	machineWithNode := func(name, nodeName string) *clusterv1.Machine {
+		m := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if nodeName != "" {
+			m.Status.NodeRef = &corev1.ObjectReference{Name: nodeName}
+		}
+		return m
+	}
+	deleting := machineWithNode("deleting", "node1")
+	deleting.DeletionTimestamp = &metav1.Time{Time: metav1.Now().Time}
+
+	tests := []struct {
+		name           string
+		machine        *clusterv1.Machine
+		expectStatus   corev1.ConditionStatus
+		expectReason   string
+		expectNotFound bool
+	}{
+		{
+			name:         "ready node",
+			machine:      machineWithNode("m1", "node1"),
+			expectStatus: corev1.ConditionTrue,
+		},
+		{
+			name:         "not ready node still reported by k3s",
+			machine:      machineWithNode("m2", "node2"),
+			expectStatus: corev1.ConditionTrue,
+		},
+		{
+			name:         "stale node status cannot be probed",
+			machine:      machineWithNode("m3", "node3"),
+			expectStatus: corev1.ConditionUnknown,
+			expectReason: controlplanev1.K3sServiceInspectionFailedReason,
+		},
+		{
+			name:         "missing node",
+			machine:      machineWithNode("m4", "node4"),
+			expectStatus: corev1.ConditionUnknown,
+			expectReason: controlplanev1.K3sServiceInspectionFailedReason,
+		},
+		{
+			name:         "deleting machine",
+			machine:      deleting,
+			expectStatus: corev1.ConditionFalse,
+			expectReason: clusterv1.DeletingReason,
+		},
+		{
+			name:           "provisioning machine",
+			machine:        machineWithNode("m5", ""),
+			expectNotFound: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			fakeClient := fake.NewClientBuilder().WithObjects(
+				nodeWithReady("node1", corev1.ConditionTrue),
+				nodeWithReady("node2", corev1.ConditionFalse),
+				nodeWithReady("node3", corev1.ConditionUnknown),
+			).Build()
+			w := &Workload{
+				Client: fakeClient,
+			}
+			controlPlane := &ControlPlane{Machines: collections.FromMachines(tt.machine)}
+			w.UpdateK3sServiceConditions(context.TODO(), controlPlane)
+
+			condition := conditions.Get(tt.machine, controlplanev1.MachineK3sServiceHealthyCondition)
+			if tt.expectNotFound {
+				g.Expect(condition).To(BeNil())
+				return
+			}
+			g.Expect(condition).ToNot(BeNil())
+			g.Expect(condition.Status).To(Equal(tt.expectStatus))
+			g.Expect(condition.Reason).To(Equal(tt.expectReason))
+		})
+	}
+}
+
+func TestValidateKubeletServingCSR(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: "node1"},
+				{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		username  string
+		subject   pkix.Name
+		dnsNames  []string
+		ips       []net.IP
+		expectErr bool
+	}{
+		{
+			name:     "node serving request",
+			username: "system:node:node1",
+			subject:  pkix.Name{CommonName: "system:node:node1", Organization: []string{"system:nodes"}},
+			dnsNames: []string{"node1"},
+			ips:      []net.IP{net.ParseIP("10.0.0.1")},
+		},
+		{
+			name:      "requested by another node",
+			username:  "system:node:node2",
+			subject:   pkix.Name{CommonName: "system:node:node2", Organization: []string{"system:nodes"}},
+			expectErr: true,
+		},
+		{
+			name:      "common name does not match requester",
+			username:  "system:node:node1",
+			subject:   pkix.Name{CommonName: "system:node:node2", Organization: []string{"system:nodes"}},
+			expectErr: true,
+		},
+		{
+			name:      "unknown hostname",
+			username:  "system:node:node1",
+			subject:   pkix.Name{CommonName: "system:node:node1", Organization: []string{"system:nodes"}},
+			dnsNames:  []string{"kubernetes.default"},
+			expectErr: true,
+		},
+		{
+			name:      "unknown IP address",
+			username:  "system:node:node1",
+			subject:   pkix.Name{CommonName: "system:node:node1", Organization: []string{"system:nodes"}},
+			ips:       []net.IP{net.ParseIP("10.0.0.2")},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			g.Expect(err).ToNot(HaveOccurred())
+			der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+				Subject:     tt.subject,
+				DNSNames:    tt.dnsNames,
+				IPAddresses: tt.ips,
+			}, key)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			csr := &certificatesv1.CertificateSigningRequest{
+				Spec: certificatesv1.CertificateSigningRequestSpec{
+					Request:    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}),
+					SignerName: certificatesv1.KubeletServingSignerName,
+					Username:   tt.username,
+					Groups:     []string{"system:nodes", "system:authenticated"},
+				},
+			}
+
+			err = validateKubeletServingCSR(csr, node)
+			if tt.expectErr {
+				g.Expect(err).To(HaveOccurred())
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
 		})
 	}
 }
+
+func TestRotateServingCerts(t *testing.T) {
+	g := NewWithT(t)
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{{
+				Type:   corev1.NodeReady,
+				Status: corev1.ConditionTrue,
+			}},
+		},
+	}
+	w := &Workload{
+		Client: fake.NewClientBuilder().WithObjects(node).Build(),
+	}
+
+	// the first call schedules the restart pod on the node.
+	done, err := w.RotateServingCerts(context.TODO(), "node1")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(done).To(BeFalse())
+
+	pod := &corev1.Pod{}
+	key := client.ObjectKey{Namespace: metav1.NamespaceSystem, Name: hostCommandPodName(servingCertRotationPodPrefix, "node1")}
+	g.Expect(w.Client.Get(context.TODO(), key, pod)).To(Succeed())
+	g.Expect(pod.Spec.NodeName).To(Equal("node1"))
+
+	done, err = w.RotateServingCerts(context.TODO(), "node1")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(done).To(BeFalse())
+
+	// once the pod succeeded and the node is ready, the pod is cleaned up.
+	pod.Status.Phase = corev1.PodSucceeded
+	g.Expect(w.Client.Status().Update(context.TODO(), pod)).To(Succeed())
+
+	done, err = w.RotateServingCerts(context.TODO(), "node1")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(done).To(BeTrue())
+	g.Expect(w.Client.Get(context.TODO(), key, pod)).ToNot(Succeed())
+}
+
+func TestHostCommandPodName(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(hostCommandPodName(etcdSnapshotPodPrefix, "node1")).To(Equal(etcdSnapshotPodPrefix + "node1"))
+
+	// long node names sharing a prefix get distinct valid names.
+	prefix := strings.Repeat("a", 240)
+	name1 := hostCommandPodName(etcdSnapshotPodPrefix, prefix+"-node1")
+	name2 := hostCommandPodName(etcdSnapshotPodPrefix, prefix+"-node2")
+	g.Expect(name1).ToNot(Equal(name2))
+	for _, name := range []string{name1, name2} {
+		g.Expect(validation.IsDNS1123Subdomain(name)).To(BeEmpty())
+	}
+}
+
+func TestRunHostCommandOnAnotherNode(t *testing.T) {
+	g := NewWithT(t)
+
+	key := client.ObjectKey{Namespace: metav1.NamespaceSystem, Name: "host-command"}
+	pod := newHostCommandPod(key, "node2", "true")
+	pod.Status.Phase = corev1.PodSucceeded
+	w := &Workload{
+		Client: fake.NewClientBuilder().WithObjects(pod).Build(),
+	}
+
+	// the pod of another node is deleted instead of reporting its result.
+	phase, err := w.runHostCommand(context.TODO(), key, "node1", "true")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(phase).To(Equal(corev1.PodPending))
+	g.Expect(w.Client.Get(context.TODO(), key, &corev1.Pod{})).ToNot(Succeed())
+
+	phase, err = w.runHostCommand(context.TODO(), key, "node1", "true")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(phase).To(Equal(corev1.PodPending))
+	g.Expect(w.Client.Get(context.TODO(), key, pod)).To(Succeed())
+	g.Expect(pod.Spec.NodeName).To(Equal("node1"))
+}
+
+func TestLeafCertificatesNotAfter(t *testing.T) {
+	g := NewWithT(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	now := time.Now().Truncate(time.Second)
+	encode := func(notAfter time.Time, isCA bool) []byte {
+		tmpl := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: "etcd"},
+			NotBefore:             now,
+			NotAfter:              notAfter,
+			IsCA:                  isCA,
+			BasicConstraintsValid: true,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+		g.Expect(err).ToNot(HaveOccurred())
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+
+	// the CA certificate bundled with the leaf certificates is ignored.
+	var data []byte
+	data = append(data, encode(now.Add(365*24*time.Hour), false)...)
+	data = append(data, encode(now.Add(24*time.Hour), true)...)
+	data = append(data, encode(now.Add(30*24*time.Hour), false)...)
+
+	notAfter, err := leafCertificatesNotAfter(data)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(notAfter.Equal(now.Add(30 * 24 * time.Hour))).To(BeTrue())
+
+	_, err = leafCertificatesNotAfter(encode(now.Add(24*time.Hour), true))
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestSaveEtcdSnapshot(t *testing.T) {
+	g := NewWithT(t)
+
+	w := &Workload{
+		Client: fake.NewClientBuilder().Build(),
+	}
+
+	_, err := w.SaveEtcdSnapshot(context.TODO(), "node1", "snapshot; reboot")
+	g.Expect(err).To(HaveOccurred())
+
+	// the first call schedules the snapshot pod on the node.
+	done, err := w.SaveEtcdSnapshot(context.TODO(), "node1", "before-upgrade")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(done).To(BeFalse())
+
+	pod := &corev1.Pod{}
+	key := client.ObjectKey{Namespace: metav1.NamespaceSystem, Name: hostCommandPodName(etcdSnapshotPodPrefix, "node1")}
+	g.Expect(w.Client.Get(context.TODO(), key, pod)).To(Succeed())
+	g.Expect(pod.Spec.NodeName).To(Equal("node1"))
+	g.Expect(pod.Spec.Containers[0].Command).To(ContainElement("k3s etcd-snapshot save --name before-upgrade"))
+
+	// a failed pod is cleaned up so the snapshot is retried.
+	pod.Status.Phase = corev1.PodFailed
+	g.Expect(w.Client.Status().Update(context.TODO(), pod)).To(Succeed())
+
+	_, err = w.SaveEtcdSnapshot(context.TODO(), "node1", "before-upgrade")
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(w.Client.Get(context.TODO(), key, pod)).ToNot(Succeed())
+}
+
+func TestPruneEtcdSnapshots(t *testing.T) {
+	g := NewWithT(t)
+
+	w := &Workload{
+		Client: fake.NewClientBuilder().Build(),
+	}
+
+	_, err := w.PruneEtcdSnapshots(context.TODO(), "node1", []string{"etcd-snapshot-node1-1700000000", "snapshot; reboot"})
+	g.Expect(err).To(HaveOccurred())
+
+	// the first call schedules the prune pod on the node.
+	done, err := w.PruneEtcdSnapshots(context.TODO(), "node1", []string{"etcd-snapshot-node1-1700000000", "on-demand-node1-1700000000.zip"})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(done).To(BeFalse())
+
+	pod := &corev1.Pod{}
+	key := client.ObjectKey{Namespace: metav1.NamespaceSystem, Name: hostCommandPodName(etcdSnapshotPrunePodPrefix, "node1")}
+	g.Expect(w.Client.Get(context.TODO(), key, pod)).To(Succeed())
+	g.Expect(pod.Spec.NodeName).To(Equal("node1"))
+	g.Expect(pod.Spec.Containers[0].Command).To(ContainElement("k3s etcd-snapshot delete etcd-snapshot-node1-1700000000 on-demand-node1-1700000000.zip"))
+
+	// once the pod succeeded, it is cleaned up.
+	pod.Status.Phase = corev1.PodSucceeded
+	g.Expect(w.Client.Status().Update(context.TODO(), pod)).To(Succeed())
+
+	done, err = w.PruneEtcdSnapshots(context.TODO(), "node1", []string{"etcd-snapshot-node1-1700000000"})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(done).To(BeTrue())
+	g.Expect(w.Client.Get(context.TODO(), key, pod)).ToNot(Succeed())
+}
+
+func TestVerifyEtcdSnapshot(t *testing.T) {
+	g := NewWithT(t)
+
+	w := &Workload{
+		Client: fake.NewClientBuilder().Build(),
+	}
+	snapshot := EtcdSnapshot{
+		Name:     "etcd-snapshot-node1-1700000000",
+		NodeName: "node1",
+		Location: "file:///var/lib/rancher/k3s/server/db/snapshots/etcd-snapshot-node1-1700000000",
+	}
+
+	_, err := w.VerifyEtcdSnapshot(context.TODO(), EtcdSnapshot{Name: "s3", NodeName: "node1", S3: true, Location: "s3://bucket/s3"})
+	g.Expect(err).To(HaveOccurred())
+	_, err = w.VerifyEtcdSnapshot(context.TODO(), EtcdSnapshot{Name: "bad", NodeName: "node1", Location: "file:///tmp/x; reboot"})
+	g.Expect(err).To(HaveOccurred())
+
+	// the first call schedules the verify pod on the node.
+	done, err := w.VerifyEtcdSnapshot(context.TODO(), snapshot)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(done).To(BeFalse())
+
+	pod := &corev1.Pod{}
+	key := client.ObjectKey{Namespace: metav1.NamespaceSystem, Name: hostCommandPodName(etcdSnapshotVerifyPodPrefix, "node1")}
+	g.Expect(w.Client.Get(context.TODO(), key, pod)).To(Succeed())
+	g.Expect(pod.Spec.NodeName).To(Equal("node1"))
+
+	// a pod failing with the corrupt exit code reports the snapshot as corrupt.
+	pod.Status.Phase = corev1.PodFailed
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name:  "run",
+		State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: etcdSnapshotCorruptExitCode}},
+	}}
+	g.Expect(w.Client.Status().Update(context.TODO(), pod)).To(Succeed())
+
+	done, err = w.VerifyEtcdSnapshot(context.TODO(), snapshot)
+	g.Expect(errors.Is(err, ErrEtcdSnapshotCorrupt)).To(BeTrue())
+	g.Expect(done).To(BeTrue())
+	g.Expect(w.Client.Get(context.TODO(), key, pod)).ToNot(Succeed())
+}
+
+func TestNodeConfigDrift(t *testing.T) {
+	g := NewWithT(t)
+
+	w := &Workload{
+		Client: fake.NewClientBuilder().Build(),
+	}
+	files := []bootstrapv1.File{
+		{Path: DefaultK3sConfigLocation, Content: "token: abc\n"},
+		{Path: DefaultRegistriesConfigLocation, Content: "mirrors: {}"},
+	}
+
+	// the first call schedules the check pod on the node.
+	drifted, done, err := w.NodeConfigDrift(context.TODO(), "node1", files)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(done).To(BeFalse())
+	g.Expect(drifted).To(BeEmpty())
+
+	pod := &corev1.Pod{}
+	key := client.ObjectKey{Namespace: metav1.NamespaceSystem, Name: hostCommandPodName(nodeConfigCheckPodPrefix, "node1")}
+	g.Expect(w.Client.Get(context.TODO(), key, pod)).To(Succeed())
+	g.Expect(pod.Spec.NodeName).To(Equal("node1"))
+
+	// config.yaml is unchanged while registries.yaml is missing on the node.
+	pod.Status.Phase = corev1.PodSucceeded
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name: "read",
+		State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+			Message: NodeConfigChecksum("token: abc") + "  /host" + DefaultK3sConfigLocation + "\n" +
+				missingFileChecksum + "  /host" + DefaultRegistriesConfigLocation + "\n",
+		}},
+	}}
+	g.Expect(w.Client.Status().Update(context.TODO(), pod)).To(Succeed())
+
+	drifted, done, err = w.NodeConfigDrift(context.TODO(), "node1", files)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(done).To(BeTrue())
+	g.Expect(drifted).To(Equal([]string{DefaultRegistriesConfigLocation}))
+	g.Expect(w.Client.Get(context.TODO(), key, pod)).ToNot(Succeed())
+}
+
+func TestNodeConfigFiles(t *testing.T) {
+	g := NewWithT(t)
+
+	configFile := bootstrapv1.File{Path: DefaultK3sConfigLocation, Content: "token: abc"}
+	registries := bootstrapv1.File{Path: "/etc/k3s/registries.yaml", Content: "mirrors: {}"}
+	files := []bootstrapv1.File{
+		{Path: "/etc/motd", Content: "hello"},
+		registries,
+		{Path: DefaultRegistriesConfigLocation, Content: "mirrors: {}"},
+	}
+
+	g.Expect(NodeConfigFiles(configFile, files, bootstrapv1.KThreesAgentConfig{PrivateRegistry: registries.Path})).To(Equal([]bootstrapv1.File{configFile, registries}))
+	g.Expect(NodeConfigFiles(configFile, files[:2], bootstrapv1.KThreesAgentConfig{})).To(Equal([]bootstrapv1.File{configFile}))
+
+	// encoded files are not compared with the files on the node.
+	registries.Encoding = bootstrapv1.Base64
+	g.Expect(NodeConfigFiles(configFile, []bootstrapv1.File{registries}, bootstrapv1.KThreesAgentConfig{PrivateRegistry: registries.Path})).To(Equal([]bootstrapv1.File{configFile}))
+}
+
+func TestParseNodeArgs(t *testing.T) {
+	g := NewWithT(t)
+
+	flags := ParseNodeArgs([]string{"server", "--cluster-init", "--disable", "traefik", "--disable=servicelb", "--cluster-cidr", "10.0.0.0/16", "--write-kubeconfig-mode", "0644"})
+	g.Expect(flags).To(Equal(map[string][]string{
+		"cluster-init":          {""},
+		"disable":               {"traefik", "servicelb"},
+		"cluster-cidr":          {"10.0.0.0/16"},
+		"write-kubeconfig-mode": {"0644"},
+	}))
+}
+
+func TestServerConfigDrift(t *testing.T) {
+	g := NewWithT(t)
+
+	flags := ParseNodeArgs([]string{"server", "--disable", "traefik,servicelb", "--service-cidr", "10.43.0.0/16"})
+
+	changed, immutable := ServerConfigDrift(bootstrapv1.KThreesServerConfig{DisableComponents: []string{"servicelb", "traefik"}}, flags)
+	g.Expect(changed).To(BeEmpty())
+	g.Expect(immutable).To(BeEmpty())
+
+	changed, immutable = ServerConfigDrift(bootstrapv1.KThreesServerConfig{
+		DisableComponents: []string{"traefik"},
+		ClusterCidr:       "10.0.0.0/16",
+		KMSEncryption:     &bootstrapv1.KMSEncryption{},
+	}, flags)
+	g.Expect(changed).To(Equal([]string{"clusterCidr", "disableComponents", "kmsEncryption"}))
+	g.Expect(immutable).To(Equal([]string{"clusterCidr"}))
+}
+
+func TestCreateAgentToken(t *testing.T) {
+	g := NewWithT(t)
+
+	w := &Workload{
+		Client: fake.NewClientBuilder().Build(),
+	}
+
+	token, expiration, err := w.CreateAgentToken(context.TODO(), time.Hour)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(token).To(MatchRegexp(`^[a-z0-9]{6}\.[a-z0-9]{16}$`))
+	g.Expect(expiration).To(BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+
+	tokenID, tokenSecret, _ := strings.Cut(token, ".")
+	secret := &corev1.Secret{}
+	g.Expect(w.Client.Get(context.TODO(), client.ObjectKey{Namespace: metav1.NamespaceSystem, Name: "bootstrap-token-" + tokenID}, secret)).To(Succeed())
+	g.Expect(secret.Type).To(Equal(corev1.SecretTypeBootstrapToken))
+	g.Expect(secret.StringData).To(HaveKeyWithValue("token-secret", tokenSecret))
+	g.Expect(secret.StringData).To(HaveKeyWithValue("expiration", expiration.Format(time.RFC3339)))
+	g.Expect(secret.StringData).To(HaveKeyWithValue("auth-extra-groups", agentTokenGroup))
+
+	g.Expect(SecureToken(CAHash([]byte("ca")), token)).To(Equal("K106959097001d10501ac7d54c0bdb8db61420f658f2922cc26e46d536119a31126::" + token))
+}
+
+func TestMachineForNode(t *testing.T) {
+	g := NewWithT(t)
+
+	m1 := &clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: "m1"},
+		Spec:       clusterv1.MachineSpec{ProviderID: ptr.To("aws:///us-east-1a/i-1")},
+		Status:     clusterv1.MachineStatus{NodeRef: &corev1.ObjectReference{Name: "m1"}},
+	}
+	m2 := &clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: "m2"},
+		Spec:       clusterv1.MachineSpec{ProviderID: ptr.To("aws:///us-east-1a/i-2")},
+	}
+	machines := collections.FromMachines(m1, m2)
+
+	node := func(name, providerID string) corev1.Node {
+		return corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: corev1.NodeSpec{ProviderID: providerID}}
+	}
+
+	g.Expect(machineForNode(machines, node("m1", ""))).To(Equal(m1))
+	g.Expect(machineForNode(machines, node("ip-10-0-0-2.ec2.internal", "aws:///us-east-1a/i-2"))).To(Equal(m2))
+	g.Expect(machineForNode(machines, node("ip-10-0-0-3.ec2.internal", "aws:///us-east-1a/i-3"))).To(BeNil())
+	g.Expect(machineForNode(machines, node("ip-10-0-0-3.ec2.internal", ""))).To(BeNil())
+}
+
+func TestPromoteSpareNode(t *testing.T) {
+	g := NewWithT(t)
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "spare",
+			Labels: map[string]string{bootstrapv1.SpareControlPlaneLabel: "true"},
+		},
+		Spec: corev1.NodeSpec{
+			Taints: []corev1.Taint{
+				{Key: bootstrapv1.SpareControlPlaneLabel, Value: "true", Effect: corev1.TaintEffectNoSchedule},
+				{Key: "example.com/other", Effect: corev1.TaintEffectNoSchedule},
+			},
+		},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+		},
+	}
+	w := &Workload{
+		Client: fake.NewClientBuilder().WithObjects(node).Build(),
+	}
+	podKey := client.ObjectKey{Namespace: metav1.NamespaceSystem, Name: sparePromotionPodPrefix + "spare"}
+
+	// the promotion script is run on an agent node.
+	done, err := w.PromoteSpareNode(context.TODO(), "spare")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(done).To(BeFalse())
+	pod := &corev1.Pod{}
+	g.Expect(w.Client.Get(context.TODO(), podKey, pod)).To(Succeed())
+	g.Expect(pod.Spec.NodeName).To(Equal("spare"))
+	g.Expect(pod.Spec.Containers[0].Command).To(ContainElement("systemd-run --unit k3s-spare-promotion " + SparePromotionScriptLocation))
+
+	// the node is not promoted until it is a ready server.
+	g.Expect(w.Client.Get(context.TODO(), client.ObjectKey{Name: "spare"}, node)).To(Succeed())
+	node.Labels[labelNodeRoleServer] = "true"
+	g.Expect(w.Client.Update(context.TODO(), node)).To(Succeed())
+	node.Status.Conditions[0].Status = corev1.ConditionFalse
+	g.Expect(w.Client.Status().Update(context.TODO(), node)).To(Succeed())
+	done, err = w.PromoteSpareNode(context.TODO(), "spare")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(done).To(BeFalse())
+
+	// once it is, the spare label and taint are removed and the pod is deleted.
+	node.Status.Conditions[0].Status = corev1.ConditionTrue
+	g.Expect(w.Client.Status().Update(context.TODO(), node)).To(Succeed())
+	done, err = w.PromoteSpareNode(context.TODO(), "spare")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(done).To(BeTrue())
+	g.Expect(w.Client.Get(context.TODO(), client.ObjectKey{Name: "spare"}, node)).To(Succeed())
+	g.Expect(node.Labels).ToNot(HaveKey(bootstrapv1.SpareControlPlaneLabel))
+	g.Expect(node.Spec.Taints).To(ConsistOf(corev1.Taint{Key: "example.com/other", Effect: corev1.TaintEffectNoSchedule}))
+	g.Expect(apierrors.IsNotFound(w.Client.Get(context.TODO(), podKey, pod))).To(BeTrue())
+
+	// nodes without the spare label are promoted.
+	done, err = w.PromoteSpareNode(context.TODO(), "spare")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(done).To(BeTrue())
+
+	_, err = w.PromoteSpareNode(context.TODO(), "missing")
+	g.Expect(err).To(HaveOccurred())
+}
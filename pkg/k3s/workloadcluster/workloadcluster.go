@@ -0,0 +1,148 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package workloadcluster provides access to the workload cluster of a Cluster API cluster with a
+KThreesControlPlane, for controllers and operators built on top of this provider.
+
+It connects to the workload cluster with the kubeconfig and etcd CA secrets stored in the management
+cluster, the same way the KThreesControlPlane controller does.
+*/
+package workloadcluster
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/k3s-io/cluster-api-k3s/pkg/etcd"
+	"github.com/k3s-io/cluster-api-k3s/pkg/k3s"
+)
+
+const (
+	// DefaultEtcdDialTimeout is the default timeout to connect to an etcd member.
+	DefaultEtcdDialTimeout = 10 * time.Second
+
+	// DefaultEtcdCallTimeout is the default timeout of calls to etcd.
+	DefaultEtcdCallTimeout = etcd.DefaultCallTimeout
+
+	labelNodeRoleControlPlane = "node-role.kubernetes.io/control-plane"
+)
+
+// Cluster gives access to a workload cluster.
+type Cluster struct {
+	workload *k3s.Workload
+}
+
+// NodeHealth is the health of a workload cluster node.
+type NodeHealth struct {
+	// Name is the name of the node.
+	Name string
+
+	// ControlPlane is true if the node is a k3s server.
+	ControlPlane bool
+
+	// Ready is true if the node is reporting ready.
+	Ready bool
+
+	// Unreachable is true if the node controller cannot reach the node.
+	Unreachable bool
+}
+
+// New returns a Cluster for the workload cluster of the Cluster identified by clusterKey,
+// using c to read the kubeconfig and etcd CA secrets from the management cluster.
+func New(ctx context.Context, c client.Reader, clusterKey client.ObjectKey) (*Cluster, error) {
+	return NewWithTimeouts(ctx, c, clusterKey, DefaultEtcdDialTimeout, DefaultEtcdCallTimeout)
+}
+
+// NewWithTimeouts returns a Cluster like New, with the given etcd dial and call timeouts.
+func NewWithTimeouts(ctx context.Context, c client.Reader, clusterKey client.ObjectKey, etcdDialTimeout, etcdCallTimeout time.Duration) (*Cluster, error) {
+	m := &k3s.Management{
+		Client:          c,
+		EtcdDialTimeout: etcdDialTimeout,
+		EtcdCallTimeout: etcdCallTimeout,
+	}
+
+	w, err := m.GetWorkloadCluster(ctx, clusterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cluster{workload: w}, nil
+}
+
+// Client returns a client for the workload cluster.
+func (c *Cluster) Client() client.Client {
+	return c.workload.Client
+}
+
+// EtcdMembers returns the node names of the members of the embedded etcd cluster, as reported by the etcd leader.
+func (c *Cluster) EtcdMembers(ctx context.Context) ([]string, error) {
+	return c.workload.EtcdMembers(ctx)
+}
+
+// NodeHealth returns the health of all the workload cluster nodes.
+func (c *Cluster) NodeHealth(ctx context.Context) ([]NodeHealth, error) {
+	nodes := &corev1.NodeList{}
+	if err := c.workload.Client.List(ctx, nodes); err != nil {
+		return nil, errors.Wrap(err, "failed to list nodes")
+	}
+
+	health := make([]NodeHealth, 0, len(nodes.Items))
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		h := NodeHealth{
+			Name:  node.Name,
+			Ready: util.IsNodeReady(node),
+		}
+		_, h.ControlPlane = node.Labels[labelNodeRoleControlPlane]
+		for _, taint := range node.Spec.Taints {
+			if taint.Key == corev1.TaintNodeUnreachable {
+				h.Unreachable = true
+			}
+		}
+		health = append(health, h)
+	}
+
+	return health, nil
+}
+
+// Version returns the version reported by the workload cluster API server, e.g. v1.30.2+k3s1.
+func (c *Cluster) Version(ctx context.Context) (string, error) {
+	dc, err := discovery.NewDiscoveryClientForConfig(c.workload.ClientRestConfig)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create discovery client")
+	}
+
+	info, err := dc.ServerVersion()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get server version")
+	}
+
+	return info.GitVersion, nil
+}
+
+// TriggerSnapshot takes an on-demand etcd snapshot named name on the given server node.
+// It returns true once the snapshot was saved; it is meant to be called again until then,
+// with the same arguments.
+func (c *Cluster) TriggerSnapshot(ctx context.Context, nodeName, name string) (bool, error) {
+	return c.workload.SaveEtcdSnapshot(ctx, nodeName, name)
+}
@@ -0,0 +1,76 @@
+package workloadcluster
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/k3s-io/cluster-api-k3s/pkg/k3s"
+)
+
+func TestNodeHealth(t *testing.T) {
+	g := NewWithT(t)
+
+	newNode := func(name string, controlPlane bool, ready corev1.ConditionStatus, taints ...corev1.Taint) *corev1.Node {
+		node := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       corev1.NodeSpec{Taints: taints},
+			Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: ready},
+			}},
+		}
+		if controlPlane {
+			node.Labels = map[string]string{labelNodeRoleControlPlane: "true"}
+		}
+		return node
+	}
+	c := &Cluster{workload: &k3s.Workload{Client: fake.NewClientBuilder().WithObjects(
+		newNode("server", true, corev1.ConditionTrue),
+		newNode("agent", false, corev1.ConditionTrue),
+		newNode("unreachable", false, corev1.ConditionUnknown, corev1.Taint{Key: corev1.TaintNodeUnreachable, Effect: corev1.TaintEffectNoExecute}),
+	).Build()}}
+
+	health, err := c.NodeHealth(context.TODO())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(health).To(ConsistOf(
+		NodeHealth{Name: "server", ControlPlane: true, Ready: true},
+		NodeHealth{Name: "agent", Ready: true},
+		NodeHealth{Name: "unreachable", Unreachable: true},
+	))
+}
+
+func TestTriggerSnapshot(t *testing.T) {
+	g := NewWithT(t)
+
+	c := &Cluster{workload: &k3s.Workload{Client: fake.NewClientBuilder().Build()}}
+
+	_, err := c.TriggerSnapshot(context.TODO(), "server", "snapshot; reboot")
+	g.Expect(err).To(HaveOccurred())
+
+	// the first call schedules the snapshot on the node.
+	done, err := c.TriggerSnapshot(context.TODO(), "server", "before-upgrade")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(done).To(BeFalse())
+
+	pods := &corev1.PodList{}
+	g.Expect(c.Client().List(context.TODO(), pods, client.InNamespace(metav1.NamespaceSystem))).To(Succeed())
+	g.Expect(pods.Items).To(HaveLen(1))
+	pod := &pods.Items[0]
+	g.Expect(pod.Spec.NodeName).To(Equal("server"))
+	g.Expect(pod.Spec.Containers[0].Command).To(ContainElement("k3s etcd-snapshot save --name before-upgrade"))
+
+	// the snapshot is taken once the pod succeeded, which is then cleaned up.
+	pod.Status.Phase = corev1.PodSucceeded
+	g.Expect(c.Client().Status().Update(context.TODO(), pod)).To(Succeed())
+
+	done, err = c.TriggerSnapshot(context.TODO(), "server", "before-upgrade")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(done).To(BeTrue())
+	g.Expect(c.Client().List(context.TODO(), pods, client.InNamespace(metav1.NamespaceSystem))).To(Succeed())
+	g.Expect(pods.Items).To(BeEmpty())
+}
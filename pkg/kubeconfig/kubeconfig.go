@@ -3,8 +3,12 @@ package kubeconfig
 import (
 	"context"
 	"crypto"
+	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"fmt"
+	"math"
+	"math/big"
 	"time"
 
 	"github.com/pkg/errors"
@@ -21,13 +25,16 @@ import (
 	"github.com/k3s-io/cluster-api-k3s/pkg/secret"
 )
 
+// DefaultCertificateValidityPeriod is how long the kubeconfig client certificates are valid for by default.
+const DefaultCertificateValidityPeriod = certs.DefaultCertDuration
+
 var (
 	ErrDependentCertificateNotFound = errors.New("could not find secret ca")
 	ErrCertNotInKubeconfig          = errors.New("certificate not found in config")
 	ErrCAPrivateKeyNotFound         = errors.New("CA private key not found")
 )
 
-func generateKubeconfig(ctx context.Context, c client.Client, clusterName client.ObjectKey, endpoint string) ([]byte, error) {
+func generateKubeconfig(ctx context.Context, c client.Client, clusterName client.ObjectKey, endpoint string, validityPeriod time.Duration) ([]byte, error) {
 	clusterCA, err := secret.GetFromNamespacedName(ctx, c, clusterName, secret.ClusterCA)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
@@ -65,7 +72,7 @@ func generateKubeconfig(ctx context.Context, c client.Client, clusterName client
 		return nil, ErrCertNotInKubeconfig
 	}
 
-	cfg, err := New(clusterName.Name, endpoint, clientCACert, clientCAKey, serverCACert)
+	cfg, err := New(clusterName.Name, endpoint, clientCACert, clientCAKey, serverCACert, validityPeriod)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to generate a kubeconfig")
 	}
@@ -77,20 +84,15 @@ func generateKubeconfig(ctx context.Context, c client.Client, clusterName client
 	return out, nil
 }
 
-// New creates a new Kubeconfig using the cluster name and specified endpoint.
-func New(clusterName, endpoint string, clientCACert *x509.Certificate, clientCAKey crypto.Signer, serverCACert *x509.Certificate) (*api.Config, error) {
-	cfg := &certs.Config{
-		CommonName:   "kubernetes-admin",
-		Organization: []string{"system:masters"},
-		Usages:       []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
-	}
-
+// New creates a new Kubeconfig using the cluster name and specified endpoint, with a client certificate
+// valid for validityPeriod, or DefaultCertificateValidityPeriod if zero.
+func New(clusterName, endpoint string, clientCACert *x509.Certificate, clientCAKey crypto.Signer, serverCACert *x509.Certificate, validityPeriod time.Duration) (*api.Config, error) {
 	clientKey, err := certs.NewPrivateKey()
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to create private key")
 	}
 
-	clientCert, err := cfg.NewSignedCert(clientKey, clientCACert, clientCAKey)
+	clientCert, err := newAdminClientCert(clientKey, clientCACert, clientCAKey, validityPeriod)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to sign certificate")
 	}
@@ -121,6 +123,42 @@ func New(clusterName, endpoint string, clientCACert *x509.Certificate, clientCAK
 	}, nil
 }
 
+// newAdminClientCert signs a cluster admin client certificate, which never outlives the CA signing it.
+func newAdminClientCert(key crypto.Signer, caCert *x509.Certificate, caKey crypto.Signer, validityPeriod time.Duration) (*x509.Certificate, error) {
+	if validityPeriod == 0 {
+		validityPeriod = DefaultCertificateValidityPeriod
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).SetInt64(math.MaxInt64-1))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate random integer for signed certificate")
+	}
+
+	notAfter := time.Now().Add(validityPeriod).UTC()
+	if notAfter.After(caCert.NotAfter) {
+		notAfter = caCert.NotAfter
+	}
+
+	tmpl := x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:   "kubernetes-admin",
+			Organization: []string{"system:masters"},
+		},
+		SerialNumber: serial,
+		NotBefore:    caCert.NotBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	b, err := x509.CreateCertificate(rand.Reader, &tmpl, caCert, key.Public(), caKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create signed certificate")
+	}
+
+	return x509.ParseCertificate(b)
+}
+
 // CreateSecret creates the Kubeconfig secret for the given cluster.
 func CreateSecret(ctx context.Context, c client.Client, cluster *clusterv1.Cluster) error {
 	name := util.ObjectKey(cluster)
@@ -129,13 +167,14 @@ func CreateSecret(ctx context.Context, c client.Client, cluster *clusterv1.Clust
 		Kind:       "Cluster",
 		Name:       cluster.Name,
 		UID:        cluster.UID,
-	})
+	}, DefaultCertificateValidityPeriod)
 }
 
-// CreateSecretWithOwner creates the Kubeconfig secret for the given cluster name, namespace, endpoint, and owner reference.
-func CreateSecretWithOwner(ctx context.Context, c client.Client, clusterName client.ObjectKey, endpoint string, owner metav1.OwnerReference) error {
+// CreateSecretWithOwner creates the Kubeconfig secret for the given cluster name, namespace, endpoint, and owner reference,
+// with a client certificate valid for validityPeriod.
+func CreateSecretWithOwner(ctx context.Context, c client.Client, clusterName client.ObjectKey, endpoint string, owner metav1.OwnerReference, validityPeriod time.Duration) error {
 	server := fmt.Sprintf("https://%s", endpoint)
-	out, err := generateKubeconfig(ctx, c, clusterName, server)
+	out, err := generateKubeconfig(ctx, c, clusterName, server, validityPeriod)
 	if err != nil {
 		return err
 	}
@@ -175,49 +214,121 @@ func GenerateSecretWithOwner(clusterName client.ObjectKey, data []byte, owner me
 
 // NeedsClientCertRotation returns whether any of the Kubeconfig secret's client certificates will expire before the given threshold.
 func NeedsClientCertRotation(configSecret *corev1.Secret, threshold time.Duration) (bool, error) {
-	now := time.Now()
+	notAfter, err := ClientCertNotAfter(configSecret)
+	if errors.Is(err, ErrCertNotInKubeconfig) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return time.Until(notAfter) < threshold, nil
+}
+
+// ClientCertRotationThreshold returns how long before it expires the client certificate of the Kubeconfig secret of
+// the cluster is rotated: half way through its lifetime, which is validityPeriod unless capped by the expiry of the
+// client CA. A certificate capped by the CA is not rotated again, its replacement would not last any longer.
+func ClientCertRotationThreshold(ctx context.Context, c client.Reader, clusterName client.ObjectKey, validityPeriod time.Duration) (time.Duration, error) {
+	clientClusterCA, err := secret.GetFromNamespacedName(ctx, c, clusterName, secret.ClientClusterCA)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return 0, ErrDependentCertificateNotFound
+		}
+		return 0, err
+	}
+
+	clientCACert, err := certs.DecodeCertPEM(clientClusterCA.Data[secret.TLSCrtDataName])
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to decode CA Cert")
+	} else if clientCACert == nil {
+		return 0, ErrCertNotInKubeconfig
+	}
+
+	return clientCertRotationThreshold(validityPeriod, clientCACert.NotAfter, time.Now()), nil
+}
 
+func clientCertRotationThreshold(validityPeriod time.Duration, caNotAfter, now time.Time) time.Duration {
+	if validityPeriod == 0 {
+		validityPeriod = DefaultCertificateValidityPeriod
+	}
+	if remaining := caNotAfter.Sub(now); remaining < validityPeriod {
+		validityPeriod = remaining
+	}
+	return validityPeriod / 2
+}
+
+// ClientCertNotAfter returns when the first of the Kubeconfig secret's client certificates expires.
+func ClientCertNotAfter(configSecret *corev1.Secret) (time.Time, error) {
 	data, err := toKubeconfigBytes(configSecret)
 	if err != nil {
-		return false, err
+		return time.Time{}, err
 	}
 
 	config, err := clientcmd.Load(data)
 	if err != nil {
-		return false, errors.Wrap(err, "failed to convert kubeconfig Secret into a clientcmdapi.Config")
+		return time.Time{}, errors.Wrap(err, "failed to convert kubeconfig Secret into a clientcmdapi.Config")
 	}
 
+	var notAfter time.Time
 	for _, authInfo := range config.AuthInfos {
 		cert, err := certs.DecodeCertPEM(authInfo.ClientCertificateData)
 		if err != nil {
-			return false, errors.Wrap(err, "failed to decode kubeconfig client certificate")
+			return time.Time{}, errors.Wrap(err, "failed to decode kubeconfig client certificate")
+		}
+		if cert == nil {
+			continue
 		}
-		if cert.NotAfter.Sub(now) < threshold {
-			return true, nil
+		if notAfter.IsZero() || cert.NotAfter.Before(notAfter) {
+			notAfter = cert.NotAfter
 		}
 	}
 
-	return false, nil
+	if notAfter.IsZero() {
+		return time.Time{}, ErrCertNotInKubeconfig
+	}
+	return notAfter, nil
 }
 
-// RegenerateSecret creates and stores a new Kubeconfig in the given secret.
-func RegenerateSecret(ctx context.Context, c client.Client, configSecret *corev1.Secret) error {
+// ServerURL returns the server URL of the cluster in the Kubeconfig secret.
+func ServerURL(configSecret *corev1.Secret) (string, error) {
 	clusterName, _, err := secret.ParseSecretName(configSecret.Name)
 	if err != nil {
-		return errors.Wrap(err, "failed to parse secret name")
+		return "", errors.Wrap(err, "failed to parse secret name")
 	}
 	data, err := toKubeconfigBytes(configSecret)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	config, err := clientcmd.Load(data)
 	if err != nil {
-		return errors.Wrap(err, "failed to convert kubeconfig Secret into a clientcmdapi.Config")
+		return "", errors.Wrap(err, "failed to convert kubeconfig Secret into a clientcmdapi.Config")
+	}
+	cluster, ok := config.Clusters[clusterName]
+	if !ok {
+		return "", errors.Errorf("cluster %q not found in kubeconfig", clusterName)
+	}
+	return cluster.Server, nil
+}
+
+// RegenerateSecret creates and stores a new Kubeconfig in the given secret, with a client certificate valid for validityPeriod.
+func RegenerateSecret(ctx context.Context, c client.Client, configSecret *corev1.Secret, validityPeriod time.Duration) error {
+	server, err := ServerURL(configSecret)
+	if err != nil {
+		return err
+	}
+	return RegenerateSecretWithServer(ctx, c, configSecret, server, validityPeriod)
+}
+
+// RegenerateSecretWithServer creates and stores a new Kubeconfig in the given secret, pointing to the given server URL,
+// with a client certificate valid for validityPeriod.
+func RegenerateSecretWithServer(ctx context.Context, c client.Client, configSecret *corev1.Secret, server string, validityPeriod time.Duration) error {
+	clusterName, _, err := secret.ParseSecretName(configSecret.Name)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse secret name")
 	}
-	endpoint := config.Clusters[clusterName].Server
 	key := client.ObjectKey{Name: clusterName, Namespace: configSecret.Namespace}
-	out, err := generateKubeconfig(ctx, c, key, endpoint)
+	out, err := generateKubeconfig(ctx, c, key, server, validityPeriod)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,105 @@
+package kubeconfig
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/k3s-io/cluster-api-k3s/pkg/secret"
+)
+
+func TestCreateSecretWithOwnerValidityPeriod(t *testing.T) {
+	g := NewWithT(t)
+
+	clusterName := client.ObjectKey{Namespace: "default", Name: "test"}
+	c := fake.NewClientBuilder().WithObjects(newCASecrets(g, clusterName, 0)...).Build()
+
+	g.Expect(CreateSecretWithOwner(context.TODO(), c, clusterName, "example.com:6443", metav1.OwnerReference{}, 48*time.Hour)).To(Succeed())
+
+	configSecret := &corev1.Secret{}
+	g.Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: "default", Name: secret.Name("test", secret.Kubeconfig)}, configSecret)).To(Succeed())
+	notAfter, err := ClientCertNotAfter(configSecret)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(notAfter).To(BeTemporally("~", time.Now().Add(48*time.Hour), time.Minute))
+
+	threshold, err := ClientCertRotationThreshold(context.TODO(), c, clusterName, 48*time.Hour)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(threshold).To(Equal(24 * time.Hour))
+	g.Expect(NeedsClientCertRotation(configSecret, threshold)).To(BeFalse())
+}
+
+func TestClientCertRotationThresholdCappedByCA(t *testing.T) {
+	g := NewWithT(t)
+
+	// the client CA expires well before the requested validity period.
+	clusterName := client.ObjectKey{Namespace: "default", Name: "test"}
+	c := fake.NewClientBuilder().WithObjects(newCASecrets(g, clusterName, 30*24*time.Hour)...).Build()
+	validityPeriod := 365 * 24 * time.Hour
+
+	g.Expect(CreateSecretWithOwner(context.TODO(), c, clusterName, "example.com:6443", metav1.OwnerReference{}, validityPeriod)).To(Succeed())
+
+	configSecret := &corev1.Secret{}
+	g.Expect(c.Get(context.TODO(), client.ObjectKey{Namespace: "default", Name: secret.Name("test", secret.Kubeconfig)}, configSecret)).To(Succeed())
+	notAfter, err := ClientCertNotAfter(configSecret)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(notAfter).To(BeTemporally("~", time.Now().Add(30*24*time.Hour), time.Minute))
+
+	// a freshly issued certificate capped by the CA is not due for rotation.
+	threshold, err := ClientCertRotationThreshold(context.TODO(), c, clusterName, validityPeriod)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(threshold).To(BeNumerically("~", 15*24*time.Hour, time.Minute))
+	g.Expect(NeedsClientCertRotation(configSecret, threshold)).To(BeFalse())
+	g.Expect(NeedsClientCertRotation(configSecret, validityPeriod/2)).To(BeTrue())
+}
+
+func TestClientCertRotationThreshold(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name           string
+		validityPeriod time.Duration
+		caNotAfter     time.Time
+		want           time.Duration
+	}{
+		{
+			name:           "half of the validity period",
+			validityPeriod: 48 * time.Hour,
+			caNotAfter:     now.Add(365 * 24 * time.Hour),
+			want:           24 * time.Hour,
+		},
+		{
+			name:       "half of the default validity period",
+			caNotAfter: now.Add(10 * 365 * 24 * time.Hour),
+			want:       DefaultCertificateValidityPeriod / 2,
+		},
+		{
+			name:           "half of the remaining CA lifetime",
+			validityPeriod: 365 * 24 * time.Hour,
+			caNotAfter:     now.Add(10 * 24 * time.Hour),
+			want:           5 * 24 * time.Hour,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(clientCertRotationThreshold(tt.validityPeriod, tt.caNotAfter, now)).To(Equal(tt.want))
+		})
+	}
+}
+
+func newCASecrets(g *WithT, clusterName client.ObjectKey, validityPeriod time.Duration) []client.Object {
+	objs := []client.Object{}
+	for _, purpose := range []secret.Purpose{secret.ClusterCA, secret.ClientClusterCA} {
+		certificate := &secret.Certificate{Purpose: purpose, ValidityPeriod: validityPeriod}
+		g.Expect(certificate.Generate()).To(Succeed())
+		objs = append(objs, certificate.AsSecret(clusterName, metav1.OwnerReference{}))
+	}
+	return objs
+}
@@ -34,7 +34,7 @@ type Func = collections.Func
 // Kubernetes version, infrastructure template, and KThreesConfig field need to be equivalent.
 func MatchesKCPConfiguration(infraConfigs map[string]*unstructured.Unstructured, machineConfigs map[string]*bootstrapv1.KThreesConfig, kcp *controlplanev1.KThreesControlPlane) func(machine *clusterv1.Machine) bool {
 	return collections.And(
-		MatchesKubernetesVersion(kcp.Spec.Version),
+		MatchesKubernetesVersion(kcp.K3sVersion()),
 		MatchesKThreesBootstrapConfig(machineConfigs, kcp),
 		MatchesTemplateClonedFrom(infraConfigs, kcp),
 	)
@@ -83,6 +83,18 @@ func MatchesKubernetesVersion(kubernetesVersion string) Func {
 	}
 }
 
+// MatchesControlPlaneEndpoint returns a filter to find all machines bootstrapped with the given control plane endpoint,
+// in the HOST:PORT form. Machines created before the endpoint was recorded are considered matching.
+func MatchesControlPlaneEndpoint(endpoint string) Func {
+	return func(machine *clusterv1.Machine) bool {
+		if machine == nil {
+			return false
+		}
+		machineEndpoint, ok := machine.Annotations[controlplanev1.ControlPlaneEndpointAnnotation]
+		return !ok || machineEndpoint == endpoint
+	}
+}
+
 // MatchesKThreesBootstrapConfig checks if machine's KThreesConfigSpec is equivalent with KCP's KThreesConfigSpec.
 func MatchesKThreesBootstrapConfig(machineConfigs map[string]*bootstrapv1.KThreesConfig, kcp *controlplanev1.KThreesControlPlane) Func {
 	return func(machine *clusterv1.Machine) bool {
@@ -105,12 +117,29 @@ func MatchesKThreesBootstrapConfig(machineConfigs map[string]*bootstrapv1.KThree
 		}
 
 		kcpConfig := kcp.Spec.KThreesConfigSpec.DeepCopy()
+		machineConfigSpec := machineConfig.Spec.DeepCopy()
 
 		// KCP version check is handled elsewhere
 		kcpConfig.Version = ""
-		machineConfig.Spec.Version = ""
+		machineConfigSpec.Version = ""
+
+		// The provisioning timeout and bootstrap data TTL only apply while the machine joins, so changing them
+		// does not require a rollout.
+		kcpConfig.ProvisioningTimeout = nil
+		machineConfigSpec.ProvisioningTimeout = nil
+		kcpConfig.BootstrapDataTTL = nil
+		machineConfigSpec.BootstrapDataTTL = nil
+
+		// The bootstrap controller derives the pod and service CIDRs of IPv6-only clusters from the Cluster network
+		// when they are not set, so only compare them when they are set on the KCP.
+		if kcpConfig.ServerConfig.ClusterCidr == "" {
+			machineConfigSpec.ServerConfig.ClusterCidr = ""
+		}
+		if kcpConfig.ServerConfig.ServiceCidr == "" {
+			machineConfigSpec.ServerConfig.ServiceCidr = ""
+		}
 
-		return reflect.DeepEqual(&machineConfig.Spec, kcpConfig)
+		return reflect.DeepEqual(machineConfigSpec, kcpConfig)
 	}
 }
 
@@ -2,6 +2,7 @@ package machinefilters
 
 import (
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
 	"google.golang.org/protobuf/proto"
@@ -206,6 +207,31 @@ func TestMatchesKThreesBootstrapConfig(t *testing.T) {
 			g.Expect(match).To(BeTrue())
 		})
 
+		t.Run("by returning true if only the provisioning timeout doesn't match", func(t *testing.T) {
+			g := NewWithT(t)
+			machineConfigs[m.Name].Spec.ProvisioningTimeout = &metav1.Duration{Duration: 10 * time.Minute}
+			match := MatchesKThreesBootstrapConfig(machineConfigs, kcp)(m)
+			g.Expect(match).To(BeTrue())
+		})
+
+		t.Run("by returning true if only the CIDRs derived from the cluster network are set", func(t *testing.T) {
+			g := NewWithT(t)
+			machineConfigs[m.Name].Spec.ServerConfig.ClusterCidr = "fd00:42::/56"
+			machineConfigs[m.Name].Spec.ServerConfig.ServiceCidr = "fd00:43::/112"
+			match := MatchesKThreesBootstrapConfig(machineConfigs, kcp)(m)
+			g.Expect(match).To(BeTrue())
+		})
+
+		t.Run("by returning false if the CIDRs set on the KCP don't match", func(t *testing.T) {
+			g := NewWithT(t)
+			kcp := kcp.DeepCopy()
+			kcp.Spec.KThreesConfigSpec.ServerConfig.ClusterCidr = "fd00:44::/56"
+			match := MatchesKThreesBootstrapConfig(machineConfigs, kcp)(m)
+			g.Expect(match).To(BeFalse())
+			machineConfigs[m.Name].Spec.ServerConfig.ClusterCidr = ""
+			machineConfigs[m.Name].Spec.ServerConfig.ServiceCidr = ""
+		})
+
 		t.Run("by returning false if post commands don't match", func(t *testing.T) {
 			g := NewWithT(t)
 			machineConfigs[m.Name].Spec.PostK3sCommands = []string{"new-test"}
@@ -308,3 +334,15 @@ func TestMatchesKThreesBootstrapConfig(t *testing.T) {
 		})
 	})
 }
+
+func TestMatchesControlPlaneEndpoint(t *testing.T) {
+	g := NewWithT(t)
+
+	m := &clusterv1.Machine{}
+	g.Expect(MatchesControlPlaneEndpoint("lb.example.com:6443")(m)).To(BeTrue())
+
+	m.Annotations = map[string]string{controlplanev1.ControlPlaneEndpointAnnotation: "lb.example.com:6443"}
+	g.Expect(MatchesControlPlaneEndpoint("lb.example.com:6443")(m)).To(BeTrue())
+	g.Expect(MatchesControlPlaneEndpoint("new-lb.example.com:6443")(m)).To(BeFalse())
+	g.Expect(MatchesControlPlaneEndpoint("lb.example.com:6443")(nil)).To(BeFalse())
+}
@@ -46,6 +46,9 @@ const (
 	rootOwnerValue = "root:root"
 
 	DefaultCertificatesDir = "/var/lib/rancher/k3s/server/tls"
+
+	// DefaultCACertificateValidityPeriod is how long generated certificate authorities are valid for by default.
+	DefaultCACertificateValidityPeriod = time.Hour * 24 * 365 * 10
 )
 
 var (
@@ -93,6 +96,13 @@ func NewCertificatesForInitialControlPlane(config *bootstrapv1.KThreesConfigSpec
 	return certificates
 }
 
+// SetValidityPeriod sets how long the certificates are valid for when generated.
+func (c Certificates) SetValidityPeriod(validityPeriod time.Duration) {
+	for _, certificate := range c {
+		certificate.ValidityPeriod = validityPeriod
+	}
+}
+
 // GetByPurpose returns a certificate by the given name.
 // This could be removed if we use a map instead of a slice to hold certificates, however other code becomes more complex.
 func (c Certificates) GetByPurpose(purpose Purpose) *Certificate {
@@ -177,6 +187,36 @@ func (c Certificates) SaveGenerated(ctx context.Context, ctrlclient client.Clien
 	return nil
 }
 
+// adoptRetained sets owner as the controller of the certificate secrets marked with RetainedAnnotation, so they are
+// garbage collected with it again.
+func (c Certificates) adoptRetained(ctx context.Context, ctrlclient client.Client, clusterName client.ObjectKey, owner metav1.OwnerReference) error {
+	for _, certificate := range c {
+		s := &corev1.Secret{}
+		key := client.ObjectKey{
+			Name:      Name(clusterName.Name, certificate.Purpose),
+			Namespace: clusterName.Namespace,
+		}
+		if err := ctrlclient.Get(ctx, key, s); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		if _, ok := s.Annotations[RetainedAnnotation]; !ok {
+			continue
+		}
+
+		delete(s.Annotations, RetainedAnnotation)
+		if metav1.GetControllerOf(s) == nil {
+			s.OwnerReferences = append(s.OwnerReferences, owner)
+		}
+		if err := ctrlclient.Update(ctx, s); err != nil {
+			return fmt.Errorf("failed to adopt retained certificate %s: %w", certificate.Purpose, err)
+		}
+	}
+	return nil
+}
+
 // LookupOrGenerate is a convenience function that wraps cluster bootstrap certificate behavior.
 func (c Certificates) LookupOrGenerate(ctx context.Context, ctrlclient client.Client, clusterName client.ObjectKey, owner metav1.OwnerReference) error {
 	// Find the certificates that exist
@@ -184,6 +224,11 @@ func (c Certificates) LookupOrGenerate(ctx context.Context, ctrlclient client.Cl
 		return err
 	}
 
+	// Adopt the certificates retained on the deletion of their previous owner
+	if err := c.adoptRetained(ctx, ctrlclient, clusterName, owner); err != nil {
+		return err
+	}
+
 	// Generate the certificates that don't exist
 	if err := c.Generate(); err != nil {
 		return err
@@ -204,6 +249,10 @@ type Certificate struct {
 	Purpose           Purpose
 	KeyPair           *certs.KeyPair
 	CertFile, KeyFile string
+
+	// ValidityPeriod is how long the certificate is valid for when generated,
+	// DefaultCACertificateValidityPeriod if zero.
+	ValidityPeriod time.Duration
 }
 
 // Hashes hashes all the certificates stored in a CA certificate.
@@ -219,6 +268,24 @@ func (c *Certificate) Hashes() ([]string, error) {
 	return out, nil
 }
 
+// NotAfter returns when the certificate expires, the earliest expiry if there is a certificate chain.
+func (c *Certificate) NotAfter() (time.Time, error) {
+	if c.KeyPair == nil {
+		return time.Time{}, ErrMissingCertificate
+	}
+	certificates, err := cert.ParseCertsPEM(c.KeyPair.Cert)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to parse %s certificate: %w", c.Purpose, err)
+	}
+	notAfter := certificates[0].NotAfter
+	for _, c := range certificates[1:] {
+		if c.NotAfter.Before(notAfter) {
+			notAfter = c.NotAfter
+		}
+	}
+	return notAfter, nil
+}
+
 // hashCert calculates the sha256 of certificate.
 func hashCert(certificate *x509.Certificate) string {
 	spkiHash := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
@@ -276,12 +343,13 @@ func (c *Certificate) Generate() error {
 		return nil
 	}
 
-	generator := generateCACert
+	var kp *certs.KeyPair
+	var err error
 	if c.Purpose == ServiceAccount {
-		generator = generateServiceAccountKeys
+		kp, err = generateServiceAccountKeys()
+	} else {
+		kp, err = generateCACert(c.ValidityPeriod)
 	}
-
-	kp, err := generator()
 	if err != nil {
 		return err
 	}
@@ -337,8 +405,8 @@ func secretToKeyPair(s *corev1.Secret) (*certs.KeyPair, error) {
 	}, nil
 }
 
-func generateCACert() (*certs.KeyPair, error) {
-	x509Cert, privKey, err := newCertificateAuthority()
+func generateCACert(validityPeriod time.Duration) (*certs.KeyPair, error) {
+	x509Cert, privKey, err := newCertificateAuthority(validityPeriod)
 	if err != nil {
 		return nil, err
 	}
@@ -364,13 +432,13 @@ func generateServiceAccountKeys() (*certs.KeyPair, error) {
 }
 
 // newCertificateAuthority creates new certificate and private key for the certificate authority.
-func newCertificateAuthority() (*x509.Certificate, *rsa.PrivateKey, error) {
+func newCertificateAuthority(validityPeriod time.Duration) (*x509.Certificate, *rsa.PrivateKey, error) {
 	key, err := certs.NewPrivateKey()
 	if err != nil {
 		return nil, nil, err
 	}
 
-	c, err := newSelfSignedCACert(key)
+	c, err := newSelfSignedCACert(key, validityPeriod)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -379,11 +447,15 @@ func newCertificateAuthority() (*x509.Certificate, *rsa.PrivateKey, error) {
 }
 
 // newSelfSignedCACert creates a CA certificate.
-func newSelfSignedCACert(key *rsa.PrivateKey) (*x509.Certificate, error) {
+func newSelfSignedCACert(key *rsa.PrivateKey, validityPeriod time.Duration) (*x509.Certificate, error) {
 	cfg := certs.Config{
 		CommonName: "kubernetes",
 	}
 
+	if validityPeriod == 0 {
+		validityPeriod = DefaultCACertificateValidityPeriod
+	}
+
 	now := time.Now().UTC()
 
 	tmpl := x509.Certificate{
@@ -393,7 +465,7 @@ func newSelfSignedCACert(key *rsa.PrivateKey) (*x509.Certificate, error) {
 			Organization: cfg.Organization,
 		},
 		NotBefore:             now.Add(time.Minute * -5),
-		NotAfter:              now.Add(time.Hour * 24 * 365 * 10), // 10 years
+		NotAfter:              now.Add(validityPeriod),
 		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
 		MaxPathLenZero:        true,
 		BasicConstraintsValid: true,
@@ -29,6 +29,10 @@ const (
 	// TLSCrtDataName is the key used to store a TLS certificate in the secret's data field.
 	TLSCrtDataName = "tls.crt"
 
+	// RetainedAnnotation marks the certificate secrets retained on the deletion of their owner, which are adopted
+	// by the next owner looking them up for the same cluster.
+	RetainedAnnotation = "cluster.x-k8s.io/retained-secret"
+
 	// Kubeconfig is the secret name suffix storing the Cluster Kubeconfig.
 	Kubeconfig = Purpose("kubeconfig")
 
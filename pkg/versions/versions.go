@@ -0,0 +1,226 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package versions holds the matrix of k3s versions supported with each Cluster API release.
+*/
+package versions
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/blang/semver/v4"
+	"sigs.k8s.io/yaml"
+)
+
+// ClusterAPIVersion is the Cluster API minor release this provider is built with.
+// It must be kept in sync with the sigs.k8s.io/cluster-api version in go.mod.
+const ClusterAPIVersion = "v1.8"
+
+//go:embed supported-versions.yaml
+var defaultMatrixData []byte
+
+var current atomic.Pointer[Matrix]
+
+func init() {
+	m, err := Parse(defaultMatrixData)
+	if err != nil {
+		panic(fmt.Sprintf("invalid embedded supported versions matrix: %v", err))
+	}
+	current.Store(m)
+}
+
+// Matrix lists the k3s versions supported with each Cluster API release.
+type Matrix struct {
+	ClusterAPI []MatrixEntry `json:"clusterAPI"`
+
+	// K3sBuilds are the k3s releases rebuilt after their first build, e.g. v1.30.4+k3s2. They are used to
+	// resolve the latest known build of plain Kubernetes versions.
+	K3sBuilds []string `json:"k3sBuilds,omitempty"`
+}
+
+// MatrixEntry is the range of k3s minor releases supported with a Cluster API minor release.
+type MatrixEntry struct {
+	// Version is the Cluster API minor release, e.g. v1.8.
+	Version string `json:"version"`
+
+	// MinimumK3sVersion is the oldest supported k3s minor release, e.g. v1.26.
+	MinimumK3sVersion string `json:"minimumK3sVersion"`
+
+	// MaximumK3sVersion is the newest supported k3s minor release, e.g. v1.31.
+	MaximumK3sVersion string `json:"maximumK3sVersion"`
+
+	// ExcludedK3sVersions are k3s releases within the range that are known to be broken, e.g. v1.30.0+k3s1.
+	ExcludedK3sVersions []string `json:"excludedK3sVersions,omitempty"`
+}
+
+// Parse decodes and validates a supported versions matrix.
+func Parse(data []byte) (*Matrix, error) {
+	m := &Matrix{}
+	if err := yaml.UnmarshalStrict(data, m); err != nil {
+		return nil, fmt.Errorf("failed to decode supported versions matrix: %w", err)
+	}
+
+	for _, e := range m.ClusterAPI {
+		for _, v := range append([]string{e.Version, e.MinimumK3sVersion, e.MaximumK3sVersion}, e.ExcludedK3sVersions...) {
+			if _, err := semver.ParseTolerant(v); err != nil {
+				return nil, fmt.Errorf("invalid version %q in supported versions matrix: %w", v, err)
+			}
+		}
+	}
+
+	for _, b := range m.K3sBuilds {
+		if _, err := k3sBuild(b); err != nil {
+			return nil, fmt.Errorf("invalid k3s build %q in supported versions matrix: %w", b, err)
+		}
+	}
+
+	return m, nil
+}
+
+// LoadFile reads the supported versions matrix from path, typically a mounted ConfigMap,
+// and uses it instead of the embedded one.
+func LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read supported versions matrix: %w", err)
+	}
+
+	m, err := Parse(data)
+	if err != nil {
+		return err
+	}
+
+	current.Store(m)
+	return nil
+}
+
+// CheckSupported returns an error if the k3s version is not supported with ClusterAPIVersion.
+func CheckSupported(version string) error {
+	return current.Load().Check(ClusterAPIVersion, version)
+}
+
+// Check returns an error if the k3s version is not supported with the given Cluster API version.
+func (m *Matrix) Check(clusterAPIVersion, version string) error {
+	capi, err := semver.ParseTolerant(clusterAPIVersion)
+	if err != nil {
+		return fmt.Errorf("invalid Cluster API version %q: %w", clusterAPIVersion, err)
+	}
+
+	v, err := semver.ParseTolerant(version)
+	if err != nil {
+		return fmt.Errorf("invalid version %q: %w", version, err)
+	}
+
+	for _, e := range m.ClusterAPI {
+		// versions in the matrix are validated by Parse.
+		entry, _ := semver.ParseTolerant(e.Version)
+		if !sameMinor(entry, capi) {
+			continue
+		}
+
+		minimum, _ := semver.ParseTolerant(e.MinimumK3sVersion)
+		maximum, _ := semver.ParseTolerant(e.MaximumK3sVersion)
+		if compareMinor(v, minimum) < 0 || compareMinor(v, maximum) > 0 {
+			return fmt.Errorf("version %s is not supported with Cluster API %s, supported versions are %s to %s",
+				version, clusterAPIVersion, e.MinimumK3sVersion, e.MaximumK3sVersion)
+		}
+
+		for _, excluded := range e.ExcludedK3sVersions {
+			// the k3s release suffix is build metadata, which semver ignores when comparing versions.
+			if strings.TrimPrefix(excluded, "v") == strings.TrimPrefix(version, "v") {
+				return fmt.Errorf("version %s is known to be broken with Cluster API %s", version, clusterAPIVersion)
+			}
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("no supported versions are known for Cluster API %s", clusterAPIVersion)
+}
+
+func sameMinor(a, b semver.Version) bool {
+	return compareMinor(a, b) == 0
+}
+
+func compareMinor(a, b semver.Version) int {
+	if a.Major != b.Major {
+		if a.Major < b.Major {
+			return -1
+		}
+		return 1
+	}
+	if a.Minor != b.Minor {
+		if a.Minor < b.Minor {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+// ResolveK3sBuild returns the k3s release of a version using the current supported versions matrix.
+func ResolveK3sBuild(version string, latestKnown bool) (string, error) {
+	return current.Load().ResolveK3sBuild(version, latestKnown)
+}
+
+// ResolveK3sBuild returns the k3s release of a version. Versions with a k3s build, e.g. v1.30.4+k3s2, are
+// returned as is, while plain Kubernetes versions, e.g. v1.30.4, resolve to their first build, or to the
+// latest one listed in k3sBuilds when latestKnown is set.
+func (m *Matrix) ResolveK3sBuild(version string, latestKnown bool) (string, error) {
+	v, err := semver.ParseTolerant(version)
+	if err != nil {
+		return "", fmt.Errorf("invalid version %q: %w", version, err)
+	}
+	if len(v.Build) > 0 {
+		return version, nil
+	}
+
+	build := 1
+	if latestKnown {
+		for _, b := range m.K3sBuilds {
+			// k3s builds are validated by Parse.
+			bv, _ := semver.ParseTolerant(b)
+			n, _ := k3sBuild(b)
+			if bv.EQ(v) && n > build {
+				build = n
+			}
+		}
+	}
+
+	return fmt.Sprintf("v%s+k3s%d", v.String(), build), nil
+}
+
+// k3sBuild returns the build number of a k3s release, e.g. 2 for v1.30.4+k3s2.
+func k3sBuild(version string) (int, error) {
+	v, err := semver.ParseTolerant(version)
+	if err != nil {
+		return 0, err
+	}
+	if len(v.Build) != 1 || !strings.HasPrefix(v.Build[0], "k3s") {
+		return 0, fmt.Errorf("missing k3s build, e.g. +k3s1")
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(v.Build[0], "k3s"))
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid k3s build %q", v.Build[0])
+	}
+	return n, nil
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package versions
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestDefaultMatrixCoversClusterAPIVersion(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(CheckSupported("v1.30.2+k3s2")).To(Succeed())
+	g.Expect(CheckSupported("v1.20.4+k3s1")).ToNot(Succeed())
+}
+
+func TestMatrixCheck(t *testing.T) {
+	m, err := Parse([]byte(`
+clusterAPI:
+- version: v1.8
+  minimumK3sVersion: v1.28
+  maximumK3sVersion: v1.30
+  excludedK3sVersions:
+  - v1.29.1+k3s1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		capi      string
+		version   string
+		expectErr bool
+	}{
+		{name: "oldest supported minor", capi: "v1.8", version: "v1.28.0+k3s1"},
+		{name: "newest supported minor", capi: "v1.8.3", version: "v1.30.6+k3s1"},
+		{name: "excluded release with another suffix", capi: "v1.8", version: "v1.29.1+k3s2"},
+		{name: "too old", capi: "v1.8", version: "v1.27.9+k3s1", expectErr: true},
+		{name: "too new", capi: "v1.8", version: "v1.31.0+k3s1", expectErr: true},
+		{name: "excluded release", capi: "v1.8", version: "v1.29.1+k3s1", expectErr: true},
+		{name: "unknown cluster api version", capi: "v1.9", version: "v1.29.0+k3s1", expectErr: true},
+		{name: "invalid version", capi: "v1.8", version: "latest", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			err := m.Check(tt.capi, tt.version)
+			if tt.expectErr {
+				g.Expect(err).To(HaveOccurred())
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestParseInvalidMatrix(t *testing.T) {
+	g := NewWithT(t)
+
+	_, err := Parse([]byte(`
+clusterAPI:
+- version: v1.8
+  minimumK3sVersion: one
+  maximumK3sVersion: v1.30
+`))
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestMatrixResolveK3sBuild(t *testing.T) {
+	m, err := Parse([]byte(`
+clusterAPI: []
+k3sBuilds:
+- v1.30.4+k3s2
+- v1.30.4+k3s3
+- v1.30.5+k3s2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		version     string
+		latestKnown bool
+		expected    string
+		expectErr   bool
+	}{
+		{name: "k3s release", version: "v1.30.4+k3s1", latestKnown: true, expected: "v1.30.4+k3s1"},
+		{name: "first build", version: "v1.30.4", expected: "v1.30.4+k3s1"},
+		{name: "latest known build", version: "v1.30.4", latestKnown: true, expected: "v1.30.4+k3s3"},
+		{name: "no known rebuild", version: "1.29.8", latestKnown: true, expected: "v1.29.8+k3s1"},
+		{name: "invalid version", version: "latest", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			version, err := m.ResolveK3sBuild(tt.version, tt.latestKnown)
+			if tt.expectErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(version).To(Equal(tt.expected))
+		})
+	}
+
+	_, err = Parse([]byte(`
+clusterAPI: []
+k3sBuilds:
+- v1.30.4
+`))
+	g := NewWithT(t)
+	g.Expect(err).To(HaveOccurred())
+}